@@ -0,0 +1,255 @@
+// Code generated by protoc-gen-connect-go. DO NOT EDIT.
+//
+// Source: agent/v1/vault.proto
+
+package agentv1connect
+
+import (
+	connect "connectrpc.com/connect"
+	context "context"
+	errors "errors"
+	v1 "github.com/prskr/git-age/api/gen/agent/v1"
+	http "net/http"
+	strings "strings"
+)
+
+// This is a compile-time assertion to ensure that this generated file and the connect package are
+// compatible. If you get a compiler error that this constant is not defined, this code was
+// generated with a version of connect newer than the one compiled into your binary. You can fix the
+// problem by either regenerating this code with an older version of connect or updating the connect
+// version compiled into your binary.
+const _ = connect.IsAtLeastVersion1_13_0
+
+const (
+	// IdentitiesStoreServiceName is the fully-qualified name of the IdentitiesStoreService service.
+	IdentitiesStoreServiceName = "agent.v1.IdentitiesStoreService"
+)
+
+// These constants are the fully-qualified names of the RPCs defined in this package. They're
+// exposed at runtime as Spec.Procedure and as the final two segments of the HTTP route.
+//
+// Note that these are different from the fully-qualified method names used by
+// google.golang.org/protobuf/reflect/protoreflect. To convert from these constants to
+// reflection-formatted method names, remove the leading slash and convert the remaining slash to a
+// period.
+const (
+	// IdentitiesStoreServiceGetIdentitiesProcedure is the fully-qualified name of the
+	// IdentitiesStoreService's GetIdentities RPC.
+	IdentitiesStoreServiceGetIdentitiesProcedure = "/agent.v1.IdentitiesStoreService/GetIdentities"
+	// IdentitiesStoreServiceStoreIdentityProcedure is the fully-qualified name of the
+	// IdentitiesStoreService's StoreIdentity RPC.
+	IdentitiesStoreServiceStoreIdentityProcedure = "/agent.v1.IdentitiesStoreService/StoreIdentity"
+	// IdentitiesStoreServiceLockProcedure is the fully-qualified name of the IdentitiesStoreService's
+	// Lock RPC.
+	IdentitiesStoreServiceLockProcedure = "/agent.v1.IdentitiesStoreService/Lock"
+	// IdentitiesStoreServiceUnlockProcedure is the fully-qualified name of the IdentitiesStoreService's
+	// Unlock RPC.
+	IdentitiesStoreServiceUnlockProcedure = "/agent.v1.IdentitiesStoreService/Unlock"
+	// IdentitiesStoreServiceGetPassphraseProcedure is the fully-qualified name of the
+	// IdentitiesStoreService's GetPassphrase RPC.
+	IdentitiesStoreServiceGetPassphraseProcedure = "/agent.v1.IdentitiesStoreService/GetPassphrase"
+	// IdentitiesStoreServiceStorePassphraseProcedure is the fully-qualified name of the
+	// IdentitiesStoreService's StorePassphrase RPC.
+	IdentitiesStoreServiceStorePassphraseProcedure = "/agent.v1.IdentitiesStoreService/StorePassphrase"
+)
+
+// IdentitiesStoreServiceClient is a client for the agent.v1.IdentitiesStoreService service.
+type IdentitiesStoreServiceClient interface {
+	GetIdentities(context.Context, *connect.Request[v1.GetIdentitiesRequest]) (*connect.Response[v1.GetIdentitiesResponse], error)
+	StoreIdentity(context.Context, *connect.Request[v1.StoreIdentityRequest]) (*connect.Response[v1.StoreIdentityResponse], error)
+	Lock(context.Context, *connect.Request[v1.LockRequest]) (*connect.Response[v1.LockResponse], error)
+	Unlock(context.Context, *connect.Request[v1.UnlockRequest]) (*connect.Response[v1.UnlockResponse], error)
+	GetPassphrase(context.Context, *connect.Request[v1.GetPassphraseRequest]) (*connect.Response[v1.GetPassphraseResponse], error)
+	StorePassphrase(context.Context, *connect.Request[v1.StorePassphraseRequest]) (*connect.Response[v1.StorePassphraseResponse], error)
+}
+
+// NewIdentitiesStoreServiceClient constructs a client for the agent.v1.IdentitiesStoreService
+// service. By default, it uses the Connect protocol with the binary Protobuf Codec, asks for
+// gzipped responses, and sends uncompressed requests. To use the gRPC or gRPC-Web protocols, supply
+// the connect.WithGRPC() or connect.WithGRPCWeb() options.
+//
+// The URL supplied here should be the base URL for the Connect or gRPC server (for example,
+// http://api.acme.com or https://acme.com/grpc).
+func NewIdentitiesStoreServiceClient(httpClient connect.HTTPClient, baseURL string, opts ...connect.ClientOption) IdentitiesStoreServiceClient {
+	baseURL = strings.TrimRight(baseURL, "/")
+	identitiesStoreServiceMethods := v1.File_agent_v1_vault_proto.Services().ByName("IdentitiesStoreService").Methods()
+	return &identitiesStoreServiceClient{
+		getIdentities: connect.NewClient[v1.GetIdentitiesRequest, v1.GetIdentitiesResponse](
+			httpClient,
+			baseURL+IdentitiesStoreServiceGetIdentitiesProcedure,
+			connect.WithSchema(identitiesStoreServiceMethods.ByName("GetIdentities")),
+			connect.WithClientOptions(opts...),
+		),
+		storeIdentity: connect.NewClient[v1.StoreIdentityRequest, v1.StoreIdentityResponse](
+			httpClient,
+			baseURL+IdentitiesStoreServiceStoreIdentityProcedure,
+			connect.WithSchema(identitiesStoreServiceMethods.ByName("StoreIdentity")),
+			connect.WithClientOptions(opts...),
+		),
+		lock: connect.NewClient[v1.LockRequest, v1.LockResponse](
+			httpClient,
+			baseURL+IdentitiesStoreServiceLockProcedure,
+			connect.WithSchema(identitiesStoreServiceMethods.ByName("Lock")),
+			connect.WithClientOptions(opts...),
+		),
+		unlock: connect.NewClient[v1.UnlockRequest, v1.UnlockResponse](
+			httpClient,
+			baseURL+IdentitiesStoreServiceUnlockProcedure,
+			connect.WithSchema(identitiesStoreServiceMethods.ByName("Unlock")),
+			connect.WithClientOptions(opts...),
+		),
+		getPassphrase: connect.NewClient[v1.GetPassphraseRequest, v1.GetPassphraseResponse](
+			httpClient,
+			baseURL+IdentitiesStoreServiceGetPassphraseProcedure,
+			connect.WithSchema(identitiesStoreServiceMethods.ByName("GetPassphrase")),
+			connect.WithClientOptions(opts...),
+		),
+		storePassphrase: connect.NewClient[v1.StorePassphraseRequest, v1.StorePassphraseResponse](
+			httpClient,
+			baseURL+IdentitiesStoreServiceStorePassphraseProcedure,
+			connect.WithSchema(identitiesStoreServiceMethods.ByName("StorePassphrase")),
+			connect.WithClientOptions(opts...),
+		),
+	}
+}
+
+// identitiesStoreServiceClient implements IdentitiesStoreServiceClient.
+type identitiesStoreServiceClient struct {
+	getIdentities   *connect.Client[v1.GetIdentitiesRequest, v1.GetIdentitiesResponse]
+	storeIdentity   *connect.Client[v1.StoreIdentityRequest, v1.StoreIdentityResponse]
+	lock            *connect.Client[v1.LockRequest, v1.LockResponse]
+	unlock          *connect.Client[v1.UnlockRequest, v1.UnlockResponse]
+	getPassphrase   *connect.Client[v1.GetPassphraseRequest, v1.GetPassphraseResponse]
+	storePassphrase *connect.Client[v1.StorePassphraseRequest, v1.StorePassphraseResponse]
+}
+
+// GetIdentities calls agent.v1.IdentitiesStoreService.GetIdentities.
+func (c *identitiesStoreServiceClient) GetIdentities(ctx context.Context, req *connect.Request[v1.GetIdentitiesRequest]) (*connect.Response[v1.GetIdentitiesResponse], error) {
+	return c.getIdentities.CallUnary(ctx, req)
+}
+
+// StoreIdentity calls agent.v1.IdentitiesStoreService.StoreIdentity.
+func (c *identitiesStoreServiceClient) StoreIdentity(ctx context.Context, req *connect.Request[v1.StoreIdentityRequest]) (*connect.Response[v1.StoreIdentityResponse], error) {
+	return c.storeIdentity.CallUnary(ctx, req)
+}
+
+// Lock calls agent.v1.IdentitiesStoreService.Lock.
+func (c *identitiesStoreServiceClient) Lock(ctx context.Context, req *connect.Request[v1.LockRequest]) (*connect.Response[v1.LockResponse], error) {
+	return c.lock.CallUnary(ctx, req)
+}
+
+// Unlock calls agent.v1.IdentitiesStoreService.Unlock.
+func (c *identitiesStoreServiceClient) Unlock(ctx context.Context, req *connect.Request[v1.UnlockRequest]) (*connect.Response[v1.UnlockResponse], error) {
+	return c.unlock.CallUnary(ctx, req)
+}
+
+// GetPassphrase calls agent.v1.IdentitiesStoreService.GetPassphrase.
+func (c *identitiesStoreServiceClient) GetPassphrase(ctx context.Context, req *connect.Request[v1.GetPassphraseRequest]) (*connect.Response[v1.GetPassphraseResponse], error) {
+	return c.getPassphrase.CallUnary(ctx, req)
+}
+
+// StorePassphrase calls agent.v1.IdentitiesStoreService.StorePassphrase.
+func (c *identitiesStoreServiceClient) StorePassphrase(ctx context.Context, req *connect.Request[v1.StorePassphraseRequest]) (*connect.Response[v1.StorePassphraseResponse], error) {
+	return c.storePassphrase.CallUnary(ctx, req)
+}
+
+// IdentitiesStoreServiceHandler is an implementation of the agent.v1.IdentitiesStoreService
+// service.
+type IdentitiesStoreServiceHandler interface {
+	GetIdentities(context.Context, *connect.Request[v1.GetIdentitiesRequest]) (*connect.Response[v1.GetIdentitiesResponse], error)
+	StoreIdentity(context.Context, *connect.Request[v1.StoreIdentityRequest]) (*connect.Response[v1.StoreIdentityResponse], error)
+	Lock(context.Context, *connect.Request[v1.LockRequest]) (*connect.Response[v1.LockResponse], error)
+	Unlock(context.Context, *connect.Request[v1.UnlockRequest]) (*connect.Response[v1.UnlockResponse], error)
+	GetPassphrase(context.Context, *connect.Request[v1.GetPassphraseRequest]) (*connect.Response[v1.GetPassphraseResponse], error)
+	StorePassphrase(context.Context, *connect.Request[v1.StorePassphraseRequest]) (*connect.Response[v1.StorePassphraseResponse], error)
+}
+
+// NewIdentitiesStoreServiceHandler builds an HTTP handler from the service implementation. It
+// returns the path on which to mount the handler and the handler itself.
+//
+// By default, handlers support the Connect, gRPC, and gRPC-Web protocols with the binary Protobuf
+// and JSON codecs. They also support gzip compression.
+func NewIdentitiesStoreServiceHandler(svc IdentitiesStoreServiceHandler, opts ...connect.HandlerOption) (string, http.Handler) {
+	identitiesStoreServiceMethods := v1.File_agent_v1_vault_proto.Services().ByName("IdentitiesStoreService").Methods()
+	identitiesStoreServiceGetIdentitiesHandler := connect.NewUnaryHandler(
+		IdentitiesStoreServiceGetIdentitiesProcedure,
+		svc.GetIdentities,
+		connect.WithSchema(identitiesStoreServiceMethods.ByName("GetIdentities")),
+		connect.WithHandlerOptions(opts...),
+	)
+	identitiesStoreServiceStoreIdentityHandler := connect.NewUnaryHandler(
+		IdentitiesStoreServiceStoreIdentityProcedure,
+		svc.StoreIdentity,
+		connect.WithSchema(identitiesStoreServiceMethods.ByName("StoreIdentity")),
+		connect.WithHandlerOptions(opts...),
+	)
+	identitiesStoreServiceLockHandler := connect.NewUnaryHandler(
+		IdentitiesStoreServiceLockProcedure,
+		svc.Lock,
+		connect.WithSchema(identitiesStoreServiceMethods.ByName("Lock")),
+		connect.WithHandlerOptions(opts...),
+	)
+	identitiesStoreServiceUnlockHandler := connect.NewUnaryHandler(
+		IdentitiesStoreServiceUnlockProcedure,
+		svc.Unlock,
+		connect.WithSchema(identitiesStoreServiceMethods.ByName("Unlock")),
+		connect.WithHandlerOptions(opts...),
+	)
+	identitiesStoreServiceGetPassphraseHandler := connect.NewUnaryHandler(
+		IdentitiesStoreServiceGetPassphraseProcedure,
+		svc.GetPassphrase,
+		connect.WithSchema(identitiesStoreServiceMethods.ByName("GetPassphrase")),
+		connect.WithHandlerOptions(opts...),
+	)
+	identitiesStoreServiceStorePassphraseHandler := connect.NewUnaryHandler(
+		IdentitiesStoreServiceStorePassphraseProcedure,
+		svc.StorePassphrase,
+		connect.WithSchema(identitiesStoreServiceMethods.ByName("StorePassphrase")),
+		connect.WithHandlerOptions(opts...),
+	)
+	return "/agent.v1.IdentitiesStoreService/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case IdentitiesStoreServiceGetIdentitiesProcedure:
+			identitiesStoreServiceGetIdentitiesHandler.ServeHTTP(w, r)
+		case IdentitiesStoreServiceStoreIdentityProcedure:
+			identitiesStoreServiceStoreIdentityHandler.ServeHTTP(w, r)
+		case IdentitiesStoreServiceLockProcedure:
+			identitiesStoreServiceLockHandler.ServeHTTP(w, r)
+		case IdentitiesStoreServiceUnlockProcedure:
+			identitiesStoreServiceUnlockHandler.ServeHTTP(w, r)
+		case IdentitiesStoreServiceGetPassphraseProcedure:
+			identitiesStoreServiceGetPassphraseHandler.ServeHTTP(w, r)
+		case IdentitiesStoreServiceStorePassphraseProcedure:
+			identitiesStoreServiceStorePassphraseHandler.ServeHTTP(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// UnimplementedIdentitiesStoreServiceHandler returns CodeUnimplemented from all methods.
+type UnimplementedIdentitiesStoreServiceHandler struct{}
+
+func (UnimplementedIdentitiesStoreServiceHandler) GetIdentities(context.Context, *connect.Request[v1.GetIdentitiesRequest]) (*connect.Response[v1.GetIdentitiesResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("agent.v1.IdentitiesStoreService.GetIdentities is not implemented"))
+}
+
+func (UnimplementedIdentitiesStoreServiceHandler) StoreIdentity(context.Context, *connect.Request[v1.StoreIdentityRequest]) (*connect.Response[v1.StoreIdentityResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("agent.v1.IdentitiesStoreService.StoreIdentity is not implemented"))
+}
+
+func (UnimplementedIdentitiesStoreServiceHandler) Lock(context.Context, *connect.Request[v1.LockRequest]) (*connect.Response[v1.LockResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("agent.v1.IdentitiesStoreService.Lock is not implemented"))
+}
+
+func (UnimplementedIdentitiesStoreServiceHandler) Unlock(context.Context, *connect.Request[v1.UnlockRequest]) (*connect.Response[v1.UnlockResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("agent.v1.IdentitiesStoreService.Unlock is not implemented"))
+}
+
+func (UnimplementedIdentitiesStoreServiceHandler) GetPassphrase(context.Context, *connect.Request[v1.GetPassphraseRequest]) (*connect.Response[v1.GetPassphraseResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("agent.v1.IdentitiesStoreService.GetPassphrase is not implemented"))
+}
+
+func (UnimplementedIdentitiesStoreServiceHandler) StorePassphrase(context.Context, *connect.Request[v1.StorePassphraseRequest]) (*connect.Response[v1.StorePassphraseResponse], error) {
+	return nil, connect.NewError(connect.CodeUnimplemented, errors.New("agent.v1.IdentitiesStoreService.StorePassphrase is not implemented"))
+}
@@ -0,0 +1,710 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: agent/v1/vault.proto
+
+package agentv1
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	durationpb "google.golang.org/protobuf/types/known/durationpb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type GetIdentitiesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Remotes       []string               `protobuf:"bytes,1,rep,name=remotes,proto3" json:"remotes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetIdentitiesRequest) Reset() {
+	*x = GetIdentitiesRequest{}
+	mi := &file_agent_v1_vault_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetIdentitiesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetIdentitiesRequest) ProtoMessage() {}
+
+func (x *GetIdentitiesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_v1_vault_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetIdentitiesRequest.ProtoReflect.Descriptor instead.
+func (*GetIdentitiesRequest) Descriptor() ([]byte, []int) {
+	return file_agent_v1_vault_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *GetIdentitiesRequest) GetRemotes() []string {
+	if x != nil {
+		return x.Remotes
+	}
+	return nil
+}
+
+type GetIdentitiesResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Keys          []string               `protobuf:"bytes,1,rep,name=keys,proto3" json:"keys,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetIdentitiesResponse) Reset() {
+	*x = GetIdentitiesResponse{}
+	mi := &file_agent_v1_vault_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetIdentitiesResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetIdentitiesResponse) ProtoMessage() {}
+
+func (x *GetIdentitiesResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_v1_vault_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetIdentitiesResponse.ProtoReflect.Descriptor instead.
+func (*GetIdentitiesResponse) Descriptor() ([]byte, []int) {
+	return file_agent_v1_vault_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *GetIdentitiesResponse) GetKeys() []string {
+	if x != nil {
+		return x.Keys
+	}
+	return nil
+}
+
+type StoreIdentityRequest struct {
+	state      protoimpl.MessageState `protogen:"open.v1"`
+	PublicKey  string                 `protobuf:"bytes,1,opt,name=public_key,json=publicKey,proto3" json:"public_key,omitempty"`
+	PrivateKey string                 `protobuf:"bytes,2,opt,name=private_key,json=privateKey,proto3" json:"private_key,omitempty"`
+	Comment    string                 `protobuf:"bytes,3,opt,name=comment,proto3" json:"comment,omitempty"`
+	Remote     string                 `protobuf:"bytes,4,opt,name=remote,proto3" json:"remote,omitempty"`
+	Overwrite  bool                   `protobuf:"varint,5,opt,name=overwrite,proto3" json:"overwrite,omitempty"`
+	// lifetime after which the agent drops the identity again, unset means forever
+	Lifetime *durationpb.Duration `protobuf:"bytes,6,opt,name=lifetime,proto3" json:"lifetime,omitempty"`
+	// ephemeral identities are only kept in memory by the agent, identities with a lifetime are always ephemeral
+	Ephemeral     bool `protobuf:"varint,7,opt,name=ephemeral,proto3" json:"ephemeral,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StoreIdentityRequest) Reset() {
+	*x = StoreIdentityRequest{}
+	mi := &file_agent_v1_vault_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StoreIdentityRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StoreIdentityRequest) ProtoMessage() {}
+
+func (x *StoreIdentityRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_v1_vault_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StoreIdentityRequest.ProtoReflect.Descriptor instead.
+func (*StoreIdentityRequest) Descriptor() ([]byte, []int) {
+	return file_agent_v1_vault_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *StoreIdentityRequest) GetPublicKey() string {
+	if x != nil {
+		return x.PublicKey
+	}
+	return ""
+}
+
+func (x *StoreIdentityRequest) GetPrivateKey() string {
+	if x != nil {
+		return x.PrivateKey
+	}
+	return ""
+}
+
+func (x *StoreIdentityRequest) GetComment() string {
+	if x != nil {
+		return x.Comment
+	}
+	return ""
+}
+
+func (x *StoreIdentityRequest) GetRemote() string {
+	if x != nil {
+		return x.Remote
+	}
+	return ""
+}
+
+func (x *StoreIdentityRequest) GetOverwrite() bool {
+	if x != nil {
+		return x.Overwrite
+	}
+	return false
+}
+
+func (x *StoreIdentityRequest) GetLifetime() *durationpb.Duration {
+	if x != nil {
+		return x.Lifetime
+	}
+	return nil
+}
+
+func (x *StoreIdentityRequest) GetEphemeral() bool {
+	if x != nil {
+		return x.Ephemeral
+	}
+	return false
+}
+
+type StoreIdentityResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StoreIdentityResponse) Reset() {
+	*x = StoreIdentityResponse{}
+	mi := &file_agent_v1_vault_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StoreIdentityResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StoreIdentityResponse) ProtoMessage() {}
+
+func (x *StoreIdentityResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_v1_vault_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StoreIdentityResponse.ProtoReflect.Descriptor instead.
+func (*StoreIdentityResponse) Descriptor() ([]byte, []int) {
+	return file_agent_v1_vault_proto_rawDescGZIP(), []int{3}
+}
+
+type LockRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Passphrase    string                 `protobuf:"bytes,1,opt,name=passphrase,proto3" json:"passphrase,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LockRequest) Reset() {
+	*x = LockRequest{}
+	mi := &file_agent_v1_vault_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LockRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LockRequest) ProtoMessage() {}
+
+func (x *LockRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_v1_vault_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LockRequest.ProtoReflect.Descriptor instead.
+func (*LockRequest) Descriptor() ([]byte, []int) {
+	return file_agent_v1_vault_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *LockRequest) GetPassphrase() string {
+	if x != nil {
+		return x.Passphrase
+	}
+	return ""
+}
+
+type LockResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LockResponse) Reset() {
+	*x = LockResponse{}
+	mi := &file_agent_v1_vault_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LockResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LockResponse) ProtoMessage() {}
+
+func (x *LockResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_v1_vault_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LockResponse.ProtoReflect.Descriptor instead.
+func (*LockResponse) Descriptor() ([]byte, []int) {
+	return file_agent_v1_vault_proto_rawDescGZIP(), []int{5}
+}
+
+type UnlockRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Passphrase    string                 `protobuf:"bytes,1,opt,name=passphrase,proto3" json:"passphrase,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UnlockRequest) Reset() {
+	*x = UnlockRequest{}
+	mi := &file_agent_v1_vault_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UnlockRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UnlockRequest) ProtoMessage() {}
+
+func (x *UnlockRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_v1_vault_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UnlockRequest.ProtoReflect.Descriptor instead.
+func (*UnlockRequest) Descriptor() ([]byte, []int) {
+	return file_agent_v1_vault_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *UnlockRequest) GetPassphrase() string {
+	if x != nil {
+		return x.Passphrase
+	}
+	return ""
+}
+
+type UnlockResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UnlockResponse) Reset() {
+	*x = UnlockResponse{}
+	mi := &file_agent_v1_vault_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UnlockResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UnlockResponse) ProtoMessage() {}
+
+func (x *UnlockResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_v1_vault_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UnlockResponse.ProtoReflect.Descriptor instead.
+func (*UnlockResponse) Descriptor() ([]byte, []int) {
+	return file_agent_v1_vault_proto_rawDescGZIP(), []int{7}
+}
+
+type GetPassphraseRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Remotes       []string               `protobuf:"bytes,1,rep,name=remotes,proto3" json:"remotes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetPassphraseRequest) Reset() {
+	*x = GetPassphraseRequest{}
+	mi := &file_agent_v1_vault_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetPassphraseRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetPassphraseRequest) ProtoMessage() {}
+
+func (x *GetPassphraseRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_v1_vault_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetPassphraseRequest.ProtoReflect.Descriptor instead.
+func (*GetPassphraseRequest) Descriptor() ([]byte, []int) {
+	return file_agent_v1_vault_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *GetPassphraseRequest) GetRemotes() []string {
+	if x != nil {
+		return x.Remotes
+	}
+	return nil
+}
+
+type GetPassphraseResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// passphrase is empty if the agent does not know a passphrase for any of the remotes
+	Passphrase    string `protobuf:"bytes,1,opt,name=passphrase,proto3" json:"passphrase,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetPassphraseResponse) Reset() {
+	*x = GetPassphraseResponse{}
+	mi := &file_agent_v1_vault_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetPassphraseResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetPassphraseResponse) ProtoMessage() {}
+
+func (x *GetPassphraseResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_v1_vault_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetPassphraseResponse.ProtoReflect.Descriptor instead.
+func (*GetPassphraseResponse) Descriptor() ([]byte, []int) {
+	return file_agent_v1_vault_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *GetPassphraseResponse) GetPassphrase() string {
+	if x != nil {
+		return x.Passphrase
+	}
+	return ""
+}
+
+type StorePassphraseRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Passphrase    string                 `protobuf:"bytes,1,opt,name=passphrase,proto3" json:"passphrase,omitempty"`
+	Comment       string                 `protobuf:"bytes,2,opt,name=comment,proto3" json:"comment,omitempty"`
+	Remote        string                 `protobuf:"bytes,3,opt,name=remote,proto3" json:"remote,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StorePassphraseRequest) Reset() {
+	*x = StorePassphraseRequest{}
+	mi := &file_agent_v1_vault_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StorePassphraseRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StorePassphraseRequest) ProtoMessage() {}
+
+func (x *StorePassphraseRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_v1_vault_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StorePassphraseRequest.ProtoReflect.Descriptor instead.
+func (*StorePassphraseRequest) Descriptor() ([]byte, []int) {
+	return file_agent_v1_vault_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *StorePassphraseRequest) GetPassphrase() string {
+	if x != nil {
+		return x.Passphrase
+	}
+	return ""
+}
+
+func (x *StorePassphraseRequest) GetComment() string {
+	if x != nil {
+		return x.Comment
+	}
+	return ""
+}
+
+func (x *StorePassphraseRequest) GetRemote() string {
+	if x != nil {
+		return x.Remote
+	}
+	return ""
+}
+
+type StorePassphraseResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StorePassphraseResponse) Reset() {
+	*x = StorePassphraseResponse{}
+	mi := &file_agent_v1_vault_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StorePassphraseResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StorePassphraseResponse) ProtoMessage() {}
+
+func (x *StorePassphraseResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_agent_v1_vault_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StorePassphraseResponse.ProtoReflect.Descriptor instead.
+func (*StorePassphraseResponse) Descriptor() ([]byte, []int) {
+	return file_agent_v1_vault_proto_rawDescGZIP(), []int{11}
+}
+
+var File_agent_v1_vault_proto protoreflect.FileDescriptor
+
+const file_agent_v1_vault_proto_rawDesc = "" +
+	"\n" +
+	"\x14agent/v1/vault.proto\x12\bagent.v1\x1a\x1egoogle/protobuf/duration.proto\"0\n" +
+	"\x14GetIdentitiesRequest\x12\x18\n" +
+	"\aremotes\x18\x01 \x03(\tR\aremotes\"+\n" +
+	"\x15GetIdentitiesResponse\x12\x12\n" +
+	"\x04keys\x18\x01 \x03(\tR\x04keys\"\xfb\x01\n" +
+	"\x14StoreIdentityRequest\x12\x1d\n" +
+	"\n" +
+	"public_key\x18\x01 \x01(\tR\tpublicKey\x12\x1f\n" +
+	"\vprivate_key\x18\x02 \x01(\tR\n" +
+	"privateKey\x12\x18\n" +
+	"\acomment\x18\x03 \x01(\tR\acomment\x12\x16\n" +
+	"\x06remote\x18\x04 \x01(\tR\x06remote\x12\x1c\n" +
+	"\toverwrite\x18\x05 \x01(\bR\toverwrite\x125\n" +
+	"\blifetime\x18\x06 \x01(\v2\x19.google.protobuf.DurationR\blifetime\x12\x1c\n" +
+	"\tephemeral\x18\a \x01(\bR\tephemeral\"\x17\n" +
+	"\x15StoreIdentityResponse\"-\n" +
+	"\vLockRequest\x12\x1e\n" +
+	"\n" +
+	"passphrase\x18\x01 \x01(\tR\n" +
+	"passphrase\"\x0e\n" +
+	"\fLockResponse\"/\n" +
+	"\rUnlockRequest\x12\x1e\n" +
+	"\n" +
+	"passphrase\x18\x01 \x01(\tR\n" +
+	"passphrase\"\x10\n" +
+	"\x0eUnlockResponse\"0\n" +
+	"\x14GetPassphraseRequest\x12\x18\n" +
+	"\aremotes\x18\x01 \x03(\tR\aremotes\"7\n" +
+	"\x15GetPassphraseResponse\x12\x1e\n" +
+	"\n" +
+	"passphrase\x18\x01 \x01(\tR\n" +
+	"passphrase\"j\n" +
+	"\x16StorePassphraseRequest\x12\x1e\n" +
+	"\n" +
+	"passphrase\x18\x01 \x01(\tR\n" +
+	"passphrase\x12\x18\n" +
+	"\acomment\x18\x02 \x01(\tR\acomment\x12\x16\n" +
+	"\x06remote\x18\x03 \x01(\tR\x06remote\"\x19\n" +
+	"\x17StorePassphraseResponse2\xda\x03\n" +
+	"\x16IdentitiesStoreService\x12P\n" +
+	"\rGetIdentities\x12\x1e.agent.v1.GetIdentitiesRequest\x1a\x1f.agent.v1.GetIdentitiesResponse\x12P\n" +
+	"\rStoreIdentity\x12\x1e.agent.v1.StoreIdentityRequest\x1a\x1f.agent.v1.StoreIdentityResponse\x125\n" +
+	"\x04Lock\x12\x15.agent.v1.LockRequest\x1a\x16.agent.v1.LockResponse\x12;\n" +
+	"\x06Unlock\x12\x17.agent.v1.UnlockRequest\x1a\x18.agent.v1.UnlockResponse\x12P\n" +
+	"\rGetPassphrase\x12\x1e.agent.v1.GetPassphraseRequest\x1a\x1f.agent.v1.GetPassphraseResponse\x12V\n" +
+	"\x0fStorePassphrase\x12 .agent.v1.StorePassphraseRequest\x1a!.agent.v1.StorePassphraseResponseB3Z1github.com/prskr/git-age/api/gen/agent/v1;agentv1b\x06proto3"
+
+var (
+	file_agent_v1_vault_proto_rawDescOnce sync.Once
+	file_agent_v1_vault_proto_rawDescData []byte
+)
+
+func file_agent_v1_vault_proto_rawDescGZIP() []byte {
+	file_agent_v1_vault_proto_rawDescOnce.Do(func() {
+		file_agent_v1_vault_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_agent_v1_vault_proto_rawDesc), len(file_agent_v1_vault_proto_rawDesc)))
+	})
+	return file_agent_v1_vault_proto_rawDescData
+}
+
+var file_agent_v1_vault_proto_msgTypes = make([]protoimpl.MessageInfo, 12)
+var file_agent_v1_vault_proto_goTypes = []any{
+	(*GetIdentitiesRequest)(nil),    // 0: agent.v1.GetIdentitiesRequest
+	(*GetIdentitiesResponse)(nil),   // 1: agent.v1.GetIdentitiesResponse
+	(*StoreIdentityRequest)(nil),    // 2: agent.v1.StoreIdentityRequest
+	(*StoreIdentityResponse)(nil),   // 3: agent.v1.StoreIdentityResponse
+	(*LockRequest)(nil),             // 4: agent.v1.LockRequest
+	(*LockResponse)(nil),            // 5: agent.v1.LockResponse
+	(*UnlockRequest)(nil),           // 6: agent.v1.UnlockRequest
+	(*UnlockResponse)(nil),          // 7: agent.v1.UnlockResponse
+	(*GetPassphraseRequest)(nil),    // 8: agent.v1.GetPassphraseRequest
+	(*GetPassphraseResponse)(nil),   // 9: agent.v1.GetPassphraseResponse
+	(*StorePassphraseRequest)(nil),  // 10: agent.v1.StorePassphraseRequest
+	(*StorePassphraseResponse)(nil), // 11: agent.v1.StorePassphraseResponse
+	(*durationpb.Duration)(nil),     // 12: google.protobuf.Duration
+}
+var file_agent_v1_vault_proto_depIdxs = []int32{
+	12, // 0: agent.v1.StoreIdentityRequest.lifetime:type_name -> google.protobuf.Duration
+	0,  // 1: agent.v1.IdentitiesStoreService.GetIdentities:input_type -> agent.v1.GetIdentitiesRequest
+	2,  // 2: agent.v1.IdentitiesStoreService.StoreIdentity:input_type -> agent.v1.StoreIdentityRequest
+	4,  // 3: agent.v1.IdentitiesStoreService.Lock:input_type -> agent.v1.LockRequest
+	6,  // 4: agent.v1.IdentitiesStoreService.Unlock:input_type -> agent.v1.UnlockRequest
+	8,  // 5: agent.v1.IdentitiesStoreService.GetPassphrase:input_type -> agent.v1.GetPassphraseRequest
+	10, // 6: agent.v1.IdentitiesStoreService.StorePassphrase:input_type -> agent.v1.StorePassphraseRequest
+	1,  // 7: agent.v1.IdentitiesStoreService.GetIdentities:output_type -> agent.v1.GetIdentitiesResponse
+	3,  // 8: agent.v1.IdentitiesStoreService.StoreIdentity:output_type -> agent.v1.StoreIdentityResponse
+	5,  // 9: agent.v1.IdentitiesStoreService.Lock:output_type -> agent.v1.LockResponse
+	7,  // 10: agent.v1.IdentitiesStoreService.Unlock:output_type -> agent.v1.UnlockResponse
+	9,  // 11: agent.v1.IdentitiesStoreService.GetPassphrase:output_type -> agent.v1.GetPassphraseResponse
+	11, // 12: agent.v1.IdentitiesStoreService.StorePassphrase:output_type -> agent.v1.StorePassphraseResponse
+	7,  // [7:13] is the sub-list for method output_type
+	1,  // [1:7] is the sub-list for method input_type
+	1,  // [1:1] is the sub-list for extension type_name
+	1,  // [1:1] is the sub-list for extension extendee
+	0,  // [0:1] is the sub-list for field type_name
+}
+
+func init() { file_agent_v1_vault_proto_init() }
+func file_agent_v1_vault_proto_init() {
+	if File_agent_v1_vault_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_agent_v1_vault_proto_rawDesc), len(file_agent_v1_vault_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   12,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_agent_v1_vault_proto_goTypes,
+		DependencyIndexes: file_agent_v1_vault_proto_depIdxs,
+		MessageInfos:      file_agent_v1_vault_proto_msgTypes,
+	}.Build()
+	File_agent_v1_vault_proto = out.File
+	file_agent_v1_vault_proto_goTypes = nil
+	file_agent_v1_vault_proto_depIdxs = nil
+}
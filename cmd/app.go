@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"syscall"
 	"time"
 
 	"github.com/prskr/git-age/core/ports"
@@ -16,21 +17,34 @@ import (
 	"github.com/lmittmann/tint"
 
 	clih "github.com/prskr/git-age/handlers/cli"
+	"github.com/prskr/git-age/infrastructure"
 )
 
 type App struct {
 	Logging struct {
-		Level slog.Level `env:"GIT_AGE_LOG_LEVEL" help:"Log level" default:"warn"`
+		Level slog.Level `env:"GIT_AGE_LOG_LEVEL" config:"logLevel" help:"Log level" default:"warn"`
 	} `embed:""`
 
-	Clean        clih.CleanCliHandler        `cmd:"" name:"clean" hidden:"" help:"clean should only be invoked by Git"`
-	Smudge       clih.SmudgeCliHandler       `cmd:"" name:"smudge" hidden:"" help:"smudge should only be invoked by Git"`
-	Files        clih.FilesCliHandler        `cmd:"" name:"files" help:"Interact with repo files"`
-	AddRecipient clih.AddRecipientCliHandler `cmd:"" name:"add-recipient" help:"Generate a recipient to the list of recipients"`
-	Keys         clih.KeysCliHandler         `cmd:"" name:"keys" help:"Manage keys"`
-	Init         clih.InitCliHandler         `cmd:"" name:"init" help:"Initialize a repository"`
-	Install      clih.InstallCliHandler      `cmd:"" name:"install" help:"Install git-age hooks in global git config"`
-	Version      clih.VersionCliHandler      `cmd:"" name:"version" help:"Print version information" default:"1"`
+	Clean           clih.CleanCliHandler           `cmd:"" name:"clean" hidden:"" help:"clean should only be invoked by Git"`
+	Smudge          clih.SmudgeCliHandler          `cmd:"" name:"smudge" hidden:"" help:"smudge should only be invoked by Git"`
+	MergeRecipients clih.MergeRecipientsCliHandler `cmd:"" name:"merge-recipients" hidden:"" help:"merge-recipients should only be invoked by Git"`
+	Files           clih.FilesCliHandler           `cmd:"" name:"files" help:"Interact with repo files"`
+	Merge           clih.MergeCliHandler           `cmd:"" name:"merge" help:"Merge a branch and re-encrypt files if the branches use different recipients"`
+	AddRecipient    clih.AddRecipientCliHandler    `cmd:"" name:"add-recipient" help:"Generate a recipient to the list of recipients"`
+	RemoveRecipient clih.RemoveRecipientCliHandler `cmd:"" name:"remove-recipient" help:"Remove recipients and re-encrypt all files"`
+	Recipients      clih.RecipientsCliHandler      `cmd:"" name:"recipients" help:"Inspect the recipients of the repository"`
+	RequestAccess   clih.RequestAccessCliHandler   `cmd:"" name:"request-access" help:"Generate a key and commit a request to be added as recipient"`
+	Grant           clih.GrantCliHandler           `cmd:"" name:"grant" help:"Grant a pending access request and re-encrypt all files"`
+	Deny            clih.DenyCliHandler            `cmd:"" name:"deny" help:"Deny a pending access request"`
+	Trust           clih.TrustCliHandler           `cmd:"" name:"trust" help:"Manage the keys trusted to sign the recipients file"`
+	Keys            clih.KeysCliHandler            `cmd:"" name:"keys" help:"Manage keys"`
+	Agent           clih.AgentCliHandler           `cmd:"" name:"agent" help:"Run an agent serving identities to other git-age processes"`
+	Init            clih.InitCliHandler            `cmd:"" name:"init" help:"Initialize a repository"`
+	Install         clih.InstallCliHandler         `cmd:"" name:"install" help:"Install git-age hooks in global git config"`
+	Hooks           clih.HooksCliHandler           `cmd:"" name:"hooks" help:"Manage the hooks detecting files encrypted for outdated recipients"`
+	Config          clih.ConfigCliHandler          `cmd:"" name:"config" help:"Get and set git-age settings"`
+	Doctor          clih.DoctorCliHandler          `cmd:"" name:"doctor" help:"Diagnose the git-age setup"`
+	Version         clih.VersionCliHandler         `cmd:"" name:"version" help:"Print version information" default:"1"`
 }
 
 func (a *App) Execute() error {
@@ -44,14 +58,27 @@ func (a *App) Execute() error {
 		return err
 	}
 
-	ctx, _ := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
+	configFile := clih.ConfigFilePath(env, xdg.ConfigHome)
+
+	cfg, err := infrastructure.LoadConfig(env, infrastructure.DefaultConfigSources(ports.CWD(wd), configFile)...)
+	if err != nil {
+		return err
+	}
+
+	// settings that are only read from the environment e.g. the agent host
+	cfg.ApplyEnv(env)
+
+	ctx, _ := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	cliCtx := kong.Parse(a,
 		kong.Name("git-age"),
 		kong.BindTo(ctx, (*context.Context)(nil)),
 		kong.BindTo(os.Stdout, (*ports.STDOUT)(nil)),
+		kong.BindTo(os.Stderr, (*ports.STDERR)(nil)),
 		kong.BindTo(os.Stdin, (*ports.STDIN)(nil)),
 		kong.Bind(ports.CWD(wd)),
 		kong.Bind(env),
+		kong.Bind(cfg),
+		kong.Resolvers(clih.ConfigResolver(cfg)),
 		kong.Vars{
 			"XDG_CONFIG_HOME": filepath.ToSlash(xdg.ConfigHome),
 		})
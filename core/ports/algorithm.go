@@ -103,3 +103,15 @@ func (i *identityWrapper[R]) Unwrap(stanzas []*age.Stanza) ([]byte, error) {
 func (i *identityWrapper[R]) Recipient() Recipient {
 	return i.identity.Recipient()
 }
+
+// WrapIdentity converts native X25519 and hybrid identities to an [Identity], other identities are not supported.
+func WrapIdentity(id age.Identity) (Identity, bool) {
+	switch identity := id.(type) {
+	case *age.X25519Identity:
+		return &identityWrapper[*age.X25519Recipient]{identity: identity}, true
+	case *age.HybridIdentity:
+		return &identityWrapper[*age.HybridRecipient]{identity: identity}, true
+	default:
+		return nil, false
+	}
+}
@@ -2,6 +2,7 @@ package ports
 
 import (
 	"context"
+	"time"
 
 	"filippo.io/age"
 )
@@ -10,6 +11,14 @@ type GenerateIdentityCommand struct {
 	Comment   string
 	Remote    string
 	Algorithm IdentityAlgorithm
+	// Stores optionally selects the stores by name the identity should be persisted in
+	Stores []string
+}
+
+type StoreIdentityCommand struct {
+	Identity Identity
+	Comment  string
+	Remote   string
 }
 
 type IdentitiesQuery struct {
@@ -17,6 +26,35 @@ type IdentitiesQuery struct {
 }
 
 type IdentitiesStore interface {
+	Name() string
+	Store(ctx context.Context, cmd StoreIdentityCommand) error
 	Generate(ctx context.Context, cmd GenerateIdentityCommand) (publicKey string, err error)
 	Identities(ctx context.Context, query IdentitiesQuery) ([]age.Identity, error)
 }
+
+// IdentityRetirer is optionally implemented by identities stores that support retiring identities
+// e.g. after they were rotated.
+// Retired identities are not returned anymore after the given point in time.
+type IdentityRetirer interface {
+	Retire(ctx context.Context, publicKey string, after time.Time) error
+}
+
+// ExplicitIdentitiesStore is optionally implemented by identities stores that only persist identities
+// and passphrases if they were selected explicitly e.g. an agent that was discovered instead of configured.
+type ExplicitIdentitiesStore interface {
+	ExplicitOnly() bool
+}
+
+type StorePassphraseCommand struct {
+	Passphrase string
+	Comment    string
+	Remote     string
+}
+
+// PassphraseStore is optionally implemented by identities stores that can keep the shared passphrase
+// of repositories that are encrypted for a passphrase instead of personal keys.
+type PassphraseStore interface {
+	// Passphrase returns an empty string if the store does not know a passphrase for any of the remotes
+	Passphrase(ctx context.Context, query IdentitiesQuery) (string, error)
+	StorePassphrase(ctx context.Context, cmd StorePassphraseCommand) error
+}
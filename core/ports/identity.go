@@ -14,3 +14,25 @@ type Recipient interface {
 	String() string
 	Wrap(fileKey []byte) ([]*age.Stanza, error)
 }
+
+// PublicKeyHolder is implemented by identities that know their public key but cannot be wrapped as [Identity],
+// e.g. SSH keys whose private key must not be written to other stores.
+type PublicKeyHolder interface {
+	PublicKey() string
+}
+
+// PublicKeyOf returns the public key of the given native age identity or of a [PublicKeyHolder].
+func PublicKeyOf(id age.Identity) (publicKey string, ok bool) {
+	switch identity := id.(type) {
+	case *age.X25519Identity:
+		return identity.Recipient().String(), true
+	case *age.HybridIdentity:
+		return identity.Recipient().String(), true
+	case Identity:
+		return identity.Recipient().String(), true
+	case PublicKeyHolder:
+		return identity.PublicKey(), true
+	default:
+		return "", false
+	}
+}
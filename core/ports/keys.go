@@ -7,8 +7,11 @@ import (
 )
 
 const (
-	RecipientsFileName    = ".agerecipients"
-	GitAttributesFileName = ".gitattributes"
+	RecipientsFileName          = ".agerecipients"
+	RecipientsSignatureFileName = ".agerecipients.sig"
+	GitAttributesFileName       = ".gitattributes"
+	AccessRequestsDirName       = ".agerequests"
+	RecipientsMergeDriver       = "age-recipients"
 )
 
 type PeekReader interface {
@@ -20,6 +20,8 @@ type STDIN io.ReadCloser
 
 type STDOUT io.Writer
 
+type STDERR io.Writer
+
 func HostEnv() (OSEnv, error) {
 	env := make(OSEnv)
 	for _, v := range os.Environ() {
@@ -43,3 +45,13 @@ type OSEnv map[string]string
 func (e OSEnv) Get(key string) string {
 	return e[key]
 }
+
+// Environ returns the variables in the form key=value as expected by exec.Cmd.
+func (e OSEnv) Environ() []string {
+	vars := make([]string, 0, len(e))
+	for key, value := range e {
+		vars = append(vars, key+"="+value)
+	}
+
+	return vars
+}
@@ -1,8 +1,29 @@
 package ports
 
-import "filippo.io/age"
+import (
+	"time"
+
+	"filippo.io/age"
+)
+
+// PassphraseRecipient is the marker in the recipients file of repositories that are encrypted
+// for a shared passphrase (an age scrypt recipient) instead of personal keys.
+// age refuses to mix scrypt recipients with any other recipient, hence it must be the only recipient.
+const PassphraseRecipient = "scrypt"
 
 type Recipients interface {
 	All() ([]age.Recipient, error)
 	Append(pubKey string, comment string) ([]age.Recipient, error)
+	Remove(pubKeys ...string) error
+}
+
+// RecipientsVerifier is implemented by recipients that can prove they were not tampered with.
+// Nothing must be sealed for recipients that fail the verification.
+type RecipientsVerifier interface {
+	Verify() error
+}
+
+// ExpiringRecipients is implemented by recipients that can limit the access of a recipient to a certain day.
+type ExpiringRecipients interface {
+	AppendExpiring(pubKey, comment string, lastDay time.Time) ([]age.Recipient, error)
 }
@@ -29,6 +29,12 @@ type HeadObjectOpener interface {
 	OpenObjectAtHead(objectPath string) (*object.File, error)
 }
 
+// HeadRefResolver resolves the full name of the current branch e.g. refs/heads/main,
+// it is empty if HEAD is detached.
+type HeadRefResolver interface {
+	HeadRef() (string, error)
+}
+
 type RemotesLister interface {
 	Remotes() ([]string, error)
 }
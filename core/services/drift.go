@@ -0,0 +1,117 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io/fs"
+	"slices"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/go-git/go-git/v5/plumbing"
+
+	"github.com/prskr/git-age/core/ports"
+)
+
+const stanzaPrefix = "-> "
+
+// DriftedFile is a file at HEAD that is not encrypted for the current recipients.
+type DriftedFile struct {
+	Path string
+	// Stanzas are the types of the recipient stanzas in the header of the file
+	Stanzas []string
+}
+
+// StanzaTypes returns the sorted types of the recipient stanzas in an age header.
+func StanzaTypes(header []byte) []string {
+	var types []string
+
+	scanner := bufio.NewScanner(bytes.NewReader(header))
+	for scanner.Scan() {
+		args, ok := strings.CutPrefix(scanner.Text(), stanzaPrefix)
+		if !ok {
+			continue
+		}
+
+		if stanzaType, _, _ := strings.Cut(args, " "); stanzaType != "" {
+			types = append(types, stanzaType)
+		}
+	}
+
+	slices.Sort(types)
+
+	return types
+}
+
+// RecipientStanzaTypes returns the sorted stanza types a file encrypted for the given recipients has.
+// The recipients wrap a throwaway file key as the stanza types are not exposed otherwise.
+func RecipientStanzaTypes(recipients ...age.Recipient) ([]string, error) {
+	fileKey := make([]byte, 16)
+	if _, err := rand.Read(fileKey); err != nil {
+		return nil, err
+	}
+
+	types := make([]string, 0, len(recipients))
+
+	for _, recipient := range recipients {
+		if _, ok := recipient.(*age.ScryptRecipient); ok {
+			// wrapping is expensive on purpose
+			types = append(types, "scrypt")
+			continue
+		}
+
+		stanzas, err := recipient.Wrap(fileKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to determine stanza type of recipient: %w", err)
+		}
+
+		for _, stanza := range stanzas {
+			types = append(types, stanza.Type)
+		}
+	}
+
+	slices.Sort(types)
+
+	return types, nil
+}
+
+// DriftWalkFunc reports every file whose version at HEAD is encrypted for a different number or types of recipients
+// than expected, files that are not committed yet are skipped.
+func DriftWalkFunc(repo ports.HeadObjectOpener, expected []string, onDrift func(DriftedFile)) fs.WalkDirFunc {
+	return func(path string, _ fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		fileObj, err := repo.OpenObjectAtHead(path)
+		if err != nil {
+			if errors.Is(err, plumbing.ErrObjectNotFound) {
+				return nil
+			}
+			return fmt.Errorf("opening object at path %s at HEAD: %w", path, err)
+		}
+
+		objReader, err := fileObj.Reader()
+		if err != nil {
+			return fmt.Errorf("opening object reader at path %s at HEAD: %w", path, err)
+		}
+
+		defer func() {
+			_ = objReader.Close()
+		}()
+
+		header, err := age.ExtractHeader(objReader)
+		if err != nil {
+			return fmt.Errorf("reading age header of %s: %w", path, err)
+		}
+
+		if stanzas := StanzaTypes(header); !slices.Equal(stanzas, expected) {
+			onDrift(DriftedFile{Path: path, Stanzas: stanzas})
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,125 @@
+package services_test
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+
+	"filippo.io/age"
+
+	"github.com/prskr/git-age/core/services"
+	"github.com/prskr/git-age/infrastructure"
+)
+
+func TestStanzaTypes(t *testing.T) {
+	t.Parallel()
+
+	first, second := generateIdentity(t), generateIdentity(t)
+
+	buf := new(bytes.Buffer)
+
+	w, err := age.Encrypt(buf, first.Recipient(), second.Recipient())
+	if err != nil {
+		t.Fatalf("failed to encrypt: %v", err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close writer: %v", err)
+	}
+
+	header, err := age.ExtractHeader(buf)
+	if err != nil {
+		t.Fatalf("failed to extract header: %v", err)
+	}
+
+	got := services.StanzaTypes(header)
+
+	want, err := services.RecipientStanzaTypes(first.Recipient(), second.Recipient())
+	if err != nil {
+		t.Fatalf("failed to determine recipient stanza types: %v", err)
+	}
+
+	if !slices.Equal(got, want) || !slices.Equal(got, []string{"X25519", "X25519"}) {
+		t.Errorf("StanzaTypes() = %v, RecipientStanzaTypes() = %v", got, want)
+	}
+}
+
+func TestDriftWalkFunc(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		recipients  func(tb testing.TB, setup *testSetup) []age.Recipient
+		wantDrifted int
+	}{
+		{
+			name: "Encrypted for current recipients",
+			recipients: func(_ testing.TB, setup *testSetup) []age.Recipient {
+				return []age.Recipient{setup.id.Recipient()}
+			},
+		},
+		{
+			name: "Recipient added",
+			recipients: func(tb testing.TB, setup *testSetup) []age.Recipient {
+				tb.Helper()
+				return []age.Recipient{setup.id.Recipient(), generateIdentity(tb).Recipient()}
+			},
+			wantDrifted: 2,
+		},
+		{
+			name: "Recipient replaced by passphrase",
+			recipients: func(tb testing.TB, _ *testSetup) []age.Recipient {
+				tb.Helper()
+				recipient, err := age.NewScryptRecipient("correct horse battery staple")
+				if err != nil {
+					tb.Fatalf("failed to create scrypt recipient: %v", err)
+				}
+
+				return []age.Recipient{recipient}
+			},
+			wantDrifted: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			setup := prepareRepo(t)
+
+			g, err := infrastructure.NewGitRepository(setup.repoFS, setup.repo)
+			if err != nil {
+				t.Fatalf("failed to create git repository: %v", err)
+			}
+
+			expected, err := services.RecipientStanzaTypes(tt.recipients(t, setup)...)
+			if err != nil {
+				t.Fatalf("failed to determine stanza types: %v", err)
+			}
+
+			var drifted []services.DriftedFile
+
+			err = g.WalkAgeFiles(services.DriftWalkFunc(g, expected, func(file services.DriftedFile) {
+				drifted = append(drifted, file)
+			}))
+			if err != nil {
+				t.Fatalf("failed to check files: %v", err)
+			}
+
+			if len(drifted) != tt.wantDrifted {
+				t.Errorf("got %d drifted files %v, want %d", len(drifted), drifted, tt.wantDrifted)
+			}
+		})
+	}
+}
+
+func generateIdentity(tb testing.TB) *age.X25519Identity {
+	tb.Helper()
+
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		tb.Fatalf("failed to generate identity: %v", err)
+	}
+
+	return id
+}
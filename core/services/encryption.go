@@ -22,6 +22,12 @@ type AgeSealerOption func(*AgeSealer) error
 
 func WithRecipients(r ports.Recipients) AgeSealerOption {
 	return func(sealer *AgeSealer) error {
+		if verifier, ok := r.(ports.RecipientsVerifier); ok {
+			if err := verifier.Verify(); err != nil {
+				return err
+			}
+		}
+
 		recipients, err := r.All()
 		if err != nil {
 			return err
@@ -4,69 +4,352 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"filippo.io/age"
 
 	"github.com/prskr/git-age/core/ports"
 )
 
-var _ ports.IdentitiesStore = (*IdentitiesStoreChain)(nil)
+var (
+	_ ports.IdentitiesStore = (*IdentitiesStoreChain)(nil)
+	_ ports.IdentityRetirer = (*IdentitiesStoreChain)(nil)
+	_ ports.PassphraseStore = (*IdentitiesStoreChain)(nil)
+)
+
+var (
+	ErrEmptyChain             = errors.New("empty identities chain")
+	ErrUnknownStore           = errors.New("unknown identities store")
+	ErrAmbiguousStore         = errors.New("ambiguous identities store")
+	ErrNoDefaultStore         = errors.New("no identities store to persist identities in by default, select one explicitly")
+	ErrRetiringNotSupported   = errors.New("none of the identities stores supports retiring identities")
+	ErrNoPassphrase           = errors.New("none of the identities stores knows the passphrase")
+	ErrPassphraseNotSupported = errors.New("none of the identities stores supports passphrases")
+)
+
+// StoreError names the store that caused an error.
+type StoreError struct {
+	Store string
+	Err   error
+}
+
+func (e *StoreError) Error() string {
+	return fmt.Sprintf("identities store %s: %v", e.Store, e.Err)
+}
+
+func (e *StoreError) Unwrap() error {
+	return e.Err
+}
+
+type IdentitiesStoreChainOption func(chain *IdentitiesStoreChain)
+
+func WithStores(stores ...ports.IdentitiesStore) IdentitiesStoreChainOption {
+	return func(chain *IdentitiesStoreChain) {
+		chain.Stores = append(chain.Stores, stores...)
+	}
+}
+
+// WithStoreTimeout limits the time every single store may take to look up identities.
+func WithStoreTimeout(timeout time.Duration) IdentitiesStoreChainOption {
+	return func(chain *IdentitiesStoreChain) {
+		chain.StoreTimeout = timeout
+	}
+}
+
+// WithTolerateUnavailableStores skips failing stores with a warning instead of failing the whole lookup
+// as long as at least one store succeeded.
+func WithTolerateUnavailableStores(tolerate bool) IdentitiesStoreChainOption {
+	return func(chain *IdentitiesStoreChain) {
+		chain.TolerateUnavailable = tolerate
+	}
+}
+
+func NewIdentitiesStoreChain(opts ...IdentitiesStoreChainOption) *IdentitiesStoreChain {
+	chain := new(IdentitiesStoreChain)
+
+	for _, opt := range opts {
+		opt(chain)
+	}
+
+	return chain
+}
+
+// IdentitiesStoreChain combines multiple stores.
+// The order of the stores defines their priority i.e. the first store is the default store to persist identities in
+// and identities are always returned in the order of the stores.
+type IdentitiesStoreChain struct {
+	Stores              []ports.IdentitiesStore
+	StoreTimeout        time.Duration
+	TolerateUnavailable bool
+}
+
+func (i *IdentitiesStoreChain) Name() string {
+	names := make([]string, 0, len(i.Stores))
+	for _, store := range i.Stores {
+		names = append(names, store.Name())
+	}
+
+	return strings.Join(names, ",")
+}
+
+// Select returns all stores matching the given names in the order of the names.
+// Store names consist of a kind and a label e.g. file:/home/jane/keys.txt,
+// a name selects the store with exactly this name or the single store of this kind or with this label.
+// If no name is given, only the first store of the chain that doesn't have to be selected explicitly is selected.
+func (i *IdentitiesStoreChain) Select(names ...string) ([]ports.IdentitiesStore, error) {
+	if len(i.Stores) == 0 {
+		return nil, ErrEmptyChain
+	}
+
+	if len(names) == 0 {
+		idx := slices.IndexFunc(i.Stores, isDefaultCandidate)
+		if idx < 0 {
+			return nil, fmt.Errorf("%w - available stores: %s", ErrNoDefaultStore, i.Name())
+		}
 
-var ErrEmptyChain = errors.New("empty identities chain")
+		return i.Stores[idx : idx+1], nil
+	}
+
+	selected := make([]ports.IdentitiesStore, 0, len(names))
+	for _, name := range names {
+		store, err := i.selectOne(name)
+		if err != nil {
+			return nil, err
+		}
 
-func NewIdentitiesStoreChain(stores ...ports.IdentitiesStore) IdentitiesStoreChain {
-	return stores
+		selected = append(selected, store)
+	}
+
+	return selected, nil
 }
 
-type IdentitiesStoreChain []ports.IdentitiesStore
+func (i *IdentitiesStoreChain) selectOne(name string) (ports.IdentitiesStore, error) {
+	if idx := slices.IndexFunc(i.Stores, func(store ports.IdentitiesStore) bool {
+		return store.Name() == name
+	}); idx >= 0 {
+		return i.Stores[idx], nil
+	}
 
-func (i IdentitiesStoreChain) Generate(
+	var candidates []ports.IdentitiesStore
+	for _, store := range i.Stores {
+		kind, label, _ := strings.Cut(store.Name(), ":")
+		if kind == name || label == name {
+			candidates = append(candidates, store)
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return nil, fmt.Errorf("%w: %s - available stores: %s", ErrUnknownStore, name, i.Name())
+	case 1:
+		return candidates[0], nil
+	default:
+		return nil, fmt.Errorf(
+			"%w: %s matches %s - select one by its full name",
+			ErrAmbiguousStore,
+			name,
+			NewIdentitiesStoreChain(WithStores(candidates...)).Name(),
+		)
+	}
+}
+
+func (i *IdentitiesStoreChain) Generate(
 	ctx context.Context,
 	cmd ports.GenerateIdentityCommand,
 ) (publicKey string, err error) {
-	for _, store := range i {
-		return store.Generate(ctx, cmd)
+	publicKey, _, err = i.GenerateTo(ctx, cmd)
+	return publicKey, err
+}
+
+// GenerateTo generates a new identity and persists it in all stores selected by cmd.Stores.
+// It returns the names of the stores the identity was persisted in.
+func (i *IdentitiesStoreChain) GenerateTo(
+	ctx context.Context,
+	cmd ports.GenerateIdentityCommand,
+) (publicKey string, storedIn []string, err error) {
+	targets, err := i.Select(cmd.Stores...)
+	if err != nil {
+		return "", nil, fmt.Errorf("cannot generate identity: %w", err)
+	}
+
+	newID, err := cmd.Algorithm.Generate()
+	if err != nil {
+		return "", nil, err
+	}
+
+	storeCmd := ports.StoreIdentityCommand{
+		Identity: newID,
+		Comment:  cmd.Comment,
+		Remote:   cmd.Remote,
 	}
 
-	return "", fmt.Errorf("cannot generate identity: %w", ErrEmptyChain)
+	for _, store := range targets {
+		if err := store.Store(ctx, storeCmd); err != nil {
+			return "", storedIn, &StoreError{Store: store.Name(), Err: err}
+		}
+
+		slog.InfoContext(ctx, "Stored identity", slog.String("store", store.Name()))
+		storedIn = append(storedIn, store.Name())
+	}
+
+	return newID.Recipient().String(), storedIn, nil
+}
+
+// Store persists the given identity in the first store of the chain.
+func (i *IdentitiesStoreChain) Store(ctx context.Context, cmd ports.StoreIdentityCommand) error {
+	targets, err := i.Select()
+	if err != nil {
+		return fmt.Errorf("cannot store identity: %w", err)
+	}
+
+	if err := targets[0].Store(ctx, cmd); err != nil {
+		return &StoreError{Store: targets[0].Name(), Err: err}
+	}
+
+	return nil
 }
 
-func (i IdentitiesStoreChain) Identities(
+// Identities queries all stores concurrently and returns the identities in the priority order of the stores.
+// It always waits for all stores to finish, each store is limited by the configured StoreTimeout.
+func (i *IdentitiesStoreChain) Identities(
 	ctx context.Context,
 	query ports.IdentitiesQuery,
 ) (result []age.Identity, err error) {
 	var (
-		out  = make(chan []age.Identity)
-		errs = make(chan error)
+		wg      sync.WaitGroup
+		results = make([][]age.Identity, len(i.Stores))
+		errs    = make([]error, len(i.Stores))
 	)
 
-	defer func() {
-		close(out)
-		close(errs)
-	}()
-
-	for _, store := range i {
-		go func() {
-			ids, err := store.Identities(ctx, query)
-			if err != nil {
-				errs <- err
-				return
+	for idx, store := range i.Stores {
+		wg.Go(func() {
+			storeCtx, cancel := i.storeContext(ctx)
+			defer cancel()
+
+			results[idx], errs[idx] = store.Identities(storeCtx, query)
+		})
+	}
+
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var failed int
+
+	for idx, store := range i.Stores {
+		if errs[idx] == nil {
+			result = append(result, results[idx]...)
+			continue
+		}
+
+		failed++
+		storeErr := &StoreError{Store: store.Name(), Err: errs[idx]}
+		err = errors.Join(err, storeErr)
+
+		if i.TolerateUnavailable {
+			slog.WarnContext(
+				ctx,
+				"Ignoring unavailable identities store",
+				slog.String("store", store.Name()),
+				slog.String("err", errs[idx].Error()),
+			)
+		}
+	}
+
+	if failed == 0 || (i.TolerateUnavailable && failed < len(i.Stores)) {
+		return result, nil
+	}
+
+	return nil, err
+}
+
+// Retire retires the identity in all stores that support it.
+func (i *IdentitiesStoreChain) Retire(ctx context.Context, publicKey string, after time.Time) (err error) {
+	var supported bool
+
+	for _, store := range i.Stores {
+		if retirer, ok := store.(ports.IdentityRetirer); ok {
+			supported = true
+			if retireErr := retirer.Retire(ctx, publicKey, after); retireErr != nil {
+				err = errors.Join(err, &StoreError{Store: store.Name(), Err: retireErr})
 			}
+		}
+	}
 
-			out <- ids
-		}()
+	if !supported {
+		return ErrRetiringNotSupported
 	}
 
-	for range i {
-		select {
-		case ids := <-out:
-			result = append(result, ids...)
-		case e := <-errs:
-			err = errors.Join(err, e)
-		case <-ctx.Done():
-			return nil, ctx.Err()
+	return err
+}
+
+// Passphrase asks all stores supporting passphrases in order and returns the first passphrase found.
+func (i *IdentitiesStoreChain) Passphrase(ctx context.Context, query ports.IdentitiesQuery) (string, error) {
+	for _, store := range i.Stores {
+		passphraseStore, ok := store.(ports.PassphraseStore)
+		if !ok {
+			continue
+		}
+
+		storeCtx, cancel := i.storeContext(ctx)
+		passphrase, err := passphraseStore.Passphrase(storeCtx, query)
+		cancel()
+
+		if err != nil {
+			if !i.TolerateUnavailable {
+				return "", &StoreError{Store: store.Name(), Err: err}
+			}
+
+			slog.WarnContext(
+				ctx,
+				"Ignoring unavailable identities store",
+				slog.String("store", store.Name()),
+				slog.String("err", err.Error()),
+			)
+
+			continue
+		}
+
+		if passphrase != "" {
+			return passphrase, nil
 		}
 	}
 
-	return result, err
+	return "", ErrNoPassphrase
+}
+
+// StorePassphrase persists the passphrase in the first store supporting passphrases.
+func (i *IdentitiesStoreChain) StorePassphrase(ctx context.Context, cmd ports.StorePassphraseCommand) error {
+	for _, store := range i.Stores {
+		if passphraseStore, ok := store.(ports.PassphraseStore); ok && isDefaultCandidate(store) {
+			if err := passphraseStore.StorePassphrase(ctx, cmd); err != nil {
+				return &StoreError{Store: store.Name(), Err: err}
+			}
+
+			return nil
+		}
+	}
+
+	return ErrPassphraseNotSupported
+}
+
+func (i *IdentitiesStoreChain) storeContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if i.StoreTimeout > 0 {
+		return context.WithTimeout(ctx, i.StoreTimeout)
+	}
+
+	return context.WithCancel(ctx)
+}
+
+// isDefaultCandidate checks whether the store may be written to without being selected explicitly.
+func isDefaultCandidate(store ports.IdentitiesStore) bool {
+	explicit, ok := store.(ports.ExplicitIdentitiesStore)
+
+	return !ok || !explicit.ExplicitOnly()
 }
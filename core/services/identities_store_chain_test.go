@@ -0,0 +1,364 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+
+	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/core/services"
+	"github.com/prskr/git-age/internal/testx"
+)
+
+func TestIdentitiesStoreChain_GenerateTo(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		stores       []string
+		discovered   bool
+		wantStoredIn []string
+		wantErr      error
+	}{
+		{
+			name:         "Default to first store",
+			wantStoredIn: []string{"agent"},
+		},
+		{
+			name:         "Skip discovered agent by default",
+			discovered:   true,
+			wantStoredIn: []string{"file"},
+		},
+		{
+			name:         "Select discovered agent explicitly",
+			stores:       []string{"agent"},
+			discovered:   true,
+			wantStoredIn: []string{"agent"},
+		},
+		{
+			name:         "Select single store",
+			stores:       []string{"file"},
+			wantStoredIn: []string{"file"},
+		},
+		{
+			name:         "Select multiple stores",
+			stores:       []string{"agent", "file"},
+			wantStoredIn: []string{"agent", "file"},
+		},
+		{
+			name:    "Unknown store",
+			stores:  []string{"vault"},
+			wantErr: services.ErrUnknownStore,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			agent, file := &memoryStore{name: "agent", explicitOnly: tt.discovered}, &memoryStore{name: "file"}
+			chain := services.NewIdentitiesStoreChain(services.WithStores(agent, file))
+
+			cmd := ports.GenerateIdentityCommand{
+				Algorithm: ports.IdentityAlgorithmX25519,
+				Stores:    tt.stores,
+			}
+
+			pubKey, storedIn, err := chain.GenerateTo(testx.Context(t), cmd)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("GenerateTo() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			} else if tt.wantErr != nil {
+				return
+			}
+
+			if len(storedIn) != len(tt.wantStoredIn) {
+				t.Errorf("GenerateTo() storedIn = %v, want %v", storedIn, tt.wantStoredIn)
+				return
+			}
+
+			for idx, name := range tt.wantStoredIn {
+				if storedIn[idx] != name {
+					t.Errorf("GenerateTo() storedIn = %v, want %v", storedIn, tt.wantStoredIn)
+				}
+			}
+
+			for _, store := range []*memoryStore{agent, file} {
+				for _, id := range store.ids {
+					if id.Recipient().String() != pubKey {
+						t.Errorf("store %s holds unexpected identity %s", store.name, id.Recipient().String())
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestIdentitiesStoreChain_Select(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		names   []string
+		want    []string
+		wantErr error
+	}{
+		{
+			name:  "Full name",
+			names: []string{"file:/home/jane/keys.txt"},
+			want:  []string{"file:/home/jane/keys.txt"},
+		},
+		{
+			name:  "Unique kind",
+			names: []string{"env"},
+			want:  []string{"env:AGE_KEY"},
+		},
+		{
+			name:  "Label",
+			names: []string{"backup"},
+			want:  []string{"file:backup"},
+		},
+		{
+			name:    "Ambiguous kind",
+			names:   []string{"file"},
+			wantErr: services.ErrAmbiguousStore,
+		},
+		{
+			name:    "Unknown store",
+			names:   []string{"vault"},
+			wantErr: services.ErrUnknownStore,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			chain := services.NewIdentitiesStoreChain(services.WithStores(
+				&memoryStore{name: "file:/home/jane/keys.txt"},
+				&memoryStore{name: "file:backup"},
+				&memoryStore{name: "env:AGE_KEY"},
+			))
+
+			selected, err := chain.Select(tt.names...)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Select() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			names := make([]string, 0, len(selected))
+			for _, store := range selected {
+				names = append(names, store.Name())
+			}
+
+			if !slices.Equal(names, tt.want) {
+				t.Errorf("Select() = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+func TestIdentitiesStoreChain_Identities(t *testing.T) {
+	t.Parallel()
+
+	errUnavailable := errors.New("unavailable")
+
+	tests := []struct {
+		name      string
+		stores    func(tb testing.TB) []ports.IdentitiesStore
+		opts      []services.IdentitiesStoreChainOption
+		wantCount int
+		wantErr   error
+		wantStore string
+	}{
+		{
+			name: "Identities in priority order",
+			stores: func(tb testing.TB) []ports.IdentitiesStore {
+				tb.Helper()
+				return []ports.IdentitiesStore{newMemoryStore(tb, "agent", 2), newMemoryStore(tb, "file", 1)}
+			},
+			wantCount: 3,
+		},
+		{
+			name: "Failing store fails lookup",
+			stores: func(tb testing.TB) []ports.IdentitiesStore {
+				tb.Helper()
+				return []ports.IdentitiesStore{&memoryStore{name: "agent", err: errUnavailable}, newMemoryStore(tb, "file", 1)}
+			},
+			wantErr:   errUnavailable,
+			wantStore: "agent",
+		},
+		{
+			name: "Tolerate failing store",
+			stores: func(tb testing.TB) []ports.IdentitiesStore {
+				tb.Helper()
+				return []ports.IdentitiesStore{&memoryStore{name: "agent", err: errUnavailable}, newMemoryStore(tb, "file", 1)}
+			},
+			opts:      []services.IdentitiesStoreChainOption{services.WithTolerateUnavailableStores(true)},
+			wantCount: 1,
+		},
+		{
+			name: "Tolerate failing store - all stores failing",
+			stores: func(tb testing.TB) []ports.IdentitiesStore {
+				tb.Helper()
+				return []ports.IdentitiesStore{&memoryStore{name: "agent", err: errUnavailable}}
+			},
+			opts:      []services.IdentitiesStoreChainOption{services.WithTolerateUnavailableStores(true)},
+			wantErr:   errUnavailable,
+			wantStore: "agent",
+		},
+		{
+			name: "Slow store times out",
+			stores: func(tb testing.TB) []ports.IdentitiesStore {
+				tb.Helper()
+				return []ports.IdentitiesStore{&memoryStore{name: "agent", block: true}, newMemoryStore(tb, "file", 1)}
+			},
+			opts: []services.IdentitiesStoreChainOption{
+				services.WithStoreTimeout(10 * time.Millisecond),
+				services.WithTolerateUnavailableStores(true),
+			},
+			wantCount: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			stores := tt.stores(t)
+			chain := services.NewIdentitiesStoreChain(append(tt.opts, services.WithStores(stores...))...)
+
+			for range 5 {
+				ids, err := chain.Identities(testx.Context(t), ports.IdentitiesQuery{})
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("Identities() error = %v, wantErr %v", err, tt.wantErr)
+					return
+				}
+
+				if storeErr := new(services.StoreError); tt.wantStore != "" {
+					if !errors.As(err, &storeErr) || storeErr.Store != tt.wantStore {
+						t.Errorf("expected error to name store %s, got %v", tt.wantStore, err)
+					}
+				}
+
+				if len(ids) != tt.wantCount {
+					t.Errorf("Identities() got %d identities, want %d", len(ids), tt.wantCount)
+					return
+				}
+
+				if tt.wantErr != nil {
+					continue
+				}
+
+				var offset int
+				for _, store := range stores {
+					memStore, ok := store.(*memoryStore)
+					if !ok || memStore.err != nil || memStore.block {
+						continue
+					}
+
+					for idx, id := range memStore.ids {
+						pubKey, _ := ports.PublicKeyOf(ids[offset+idx])
+						if pubKey != id.Recipient().String() {
+							t.Errorf("identities are not in priority order")
+						}
+					}
+
+					offset += len(memStore.ids)
+				}
+			}
+		})
+	}
+}
+
+func TestIdentitiesStoreChain_Identities_Cancelled(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(testx.Context(t))
+	chain := services.NewIdentitiesStoreChain(
+		services.WithStores(&memoryStore{name: "agent", block: true}, &memoryStore{name: "file", block: true}),
+	)
+
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	if _, err := chain.Identities(ctx, ports.IdentitiesQuery{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Identities() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func newMemoryStore(tb testing.TB, name string, numberOfIdentities int) *memoryStore {
+	tb.Helper()
+
+	store := &memoryStore{name: name}
+	for range numberOfIdentities {
+		id, err := ports.IdentityAlgorithmX25519.Generate()
+		if err != nil {
+			tb.Fatalf("failed to generate identity: %v", err)
+		}
+
+		store.ids = append(store.ids, id)
+	}
+
+	return store
+}
+
+var (
+	_ ports.IdentitiesStore         = (*memoryStore)(nil)
+	_ ports.ExplicitIdentitiesStore = (*memoryStore)(nil)
+)
+
+type memoryStore struct {
+	name         string
+	ids          []ports.Identity
+	err          error
+	block        bool
+	explicitOnly bool
+}
+
+func (m *memoryStore) Name() string {
+	return m.name
+}
+
+func (m *memoryStore) ExplicitOnly() bool {
+	return m.explicitOnly
+}
+
+func (m *memoryStore) Store(_ context.Context, cmd ports.StoreIdentityCommand) error {
+	if m.err != nil {
+		return m.err
+	}
+
+	m.ids = append(m.ids, cmd.Identity)
+
+	return nil
+}
+
+func (m *memoryStore) Generate(ctx context.Context, cmd ports.GenerateIdentityCommand) (publicKey string, err error) {
+	id, err := cmd.Algorithm.Generate()
+	if err != nil {
+		return "", err
+	}
+
+	return id.Recipient().String(), m.Store(ctx, ports.StoreIdentityCommand{Identity: id})
+}
+
+func (m *memoryStore) Identities(ctx context.Context, _ ports.IdentitiesQuery) ([]age.Identity, error) {
+	if m.block {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	ids := make([]age.Identity, 0, len(m.ids))
+	for _, id := range m.ids {
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
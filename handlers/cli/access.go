@@ -0,0 +1,346 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"github.com/go-git/go-git/v5/config"
+
+	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/core/services"
+	"github.com/prskr/git-age/infrastructure"
+)
+
+var (
+	ErrRequestNameRequired = errors.New("cannot derive a request name from user.name, pass a name")
+	ErrAmbiguousRequest    = errors.New("more than one access request is pending, pass a name")
+	ErrNoPendingRequests   = errors.New("no access request is pending")
+)
+
+var invalidRequestNameChars = regexp.MustCompile(`[^a-z0-9._-]+`)
+
+type RequestAccessCliHandler struct {
+	KeysFlag      `embed:""`
+	CommentFlag   `embed:""`
+	RemoteFlag    `embed:""`
+	AlgorithmFlag `embed:""`
+	StoreFlag     `embed:""`
+	Name          string `arg:"" optional:"" help:"Name of the request, defaults to user.name"`
+	Message       string `help:"Message to be used for the commit, defaults to chore: request access for <name>" short:"m"`
+}
+
+func (h *RequestAccessCliHandler) Run(
+	ctx context.Context,
+	stdout ports.STDOUT,
+	stderr ports.STDERR,
+	identities *services.IdentitiesStoreChain,
+	recipients *infrastructure.RecipientsFile,
+	requests *infrastructure.AccessRequests,
+	repo *infrastructure.GitRepository,
+) error {
+	if isDirty, err := repo.IsStagingDirty(); err != nil {
+		return fmt.Errorf("failed to check if repository is dirty: %w", err)
+	} else if isDirty {
+		slog.Warn("Repository is dirty")
+		os.Exit(1)
+	}
+
+	name, err := h.requestName(repo)
+	if err != nil {
+		return err
+	}
+
+	if _, err := requests.Get(name); err == nil {
+		return fmt.Errorf("%w: %s", infrastructure.ErrAccessRequestExists, name)
+	} else if !errors.Is(err, infrastructure.ErrAccessRequestMissing) {
+		return err
+	}
+
+	// identity algorithms are named like the recipient types
+	if err := recipients.CompatibleWith(infrastructure.RecipientType(h.Algorithm)); err != nil {
+		return fmt.Errorf("cannot request access with a %s key: %w", h.Algorithm, err)
+	}
+
+	cmd := ports.GenerateIdentityCommand{
+		Comment:   h.Comment,
+		Remote:    h.Remote,
+		Algorithm: h.Algorithm,
+		Stores:    h.Stores,
+	}
+
+	pubKey, storedIn, err := identities.GenerateTo(ctx, cmd)
+	if err != nil {
+		return fmt.Errorf("failed to generate identity: %w", err)
+	}
+
+	_, _ = fmt.Fprintf(stderr, "Stored identity in: %s\n", strings.Join(storedIn, ", "))
+
+	req := infrastructure.AccessRequest{
+		Name:        name,
+		PublicKey:   pubKey,
+		Comment:     h.Comment,
+		RequestedAt: time.Now(),
+	}
+
+	if err := requests.Create(req); err != nil {
+		return err
+	}
+
+	if err := repo.StageFile(req.Path()); err != nil {
+		return fmt.Errorf("failed to add access request to git index: %w", err)
+	}
+
+	slog.Info("Committing access request", slog.String("name", name))
+	if err := repo.Commit(messageOrDefault(h.Message, "chore: request access for %s", name)); err != nil {
+		return fmt.Errorf("failed to commit changes: %w", err)
+	}
+
+	_, err = fmt.Fprintln(stdout, pubKey)
+
+	return err
+}
+
+func (h *RequestAccessCliHandler) AfterApply(ctx context.Context, kongCtx *kong.Context, cwd ports.CWD, env ports.OSEnv) error {
+	gitRepo, repoFS, err := infrastructure.NewGitRepositoryFromPath(cwd)
+	if err != nil {
+		return err
+	}
+
+	idStore, err := h.identitiesStore(ctx, cwd, env)
+	if err != nil {
+		return fmt.Errorf("failed to init identities store: %w", err)
+	}
+
+	kongCtx.Bind(gitRepo)
+	kongCtx.Bind(idStore)
+	kongCtx.Bind(infrastructure.NewRecipientsFile(repoFS))
+	kongCtx.Bind(infrastructure.NewAccessRequests(repoFS))
+
+	return nil
+}
+
+// requestName derives the name of the request from user.name if none was given.
+func (h *RequestAccessCliHandler) requestName(repo *infrastructure.GitRepository) (string, error) {
+	if h.Name != "" {
+		return h.Name, nil
+	}
+
+	cfg, err := repo.Repository.ConfigScoped(config.GlobalScope)
+	if err != nil {
+		return "", fmt.Errorf("failed to read git config: %w", err)
+	}
+
+	name := strings.Trim(invalidRequestNameChars.ReplaceAllString(strings.ToLower(cfg.User.Name), "-"), "-._")
+	if name == "" {
+		return "", ErrRequestNameRequired
+	}
+
+	return name, nil
+}
+
+type GrantCliHandler struct {
+	KeysFlag       `embed:""`
+	ExpiresFlag    `embed:""`
+	SigningKeyFlag `embed:""`
+	Name           string `arg:"" optional:"" help:"Name of the request to grant, can be omitted if only one request is pending"`
+	Message        string `help:"Message to be used for the commit, defaults to chore: grant access to <name>" short:"m"`
+}
+
+func (h *GrantCliHandler) Run(
+	repoFS ports.ReadWriteFS,
+	recipients *infrastructure.RecipientsFile,
+	requests *infrastructure.AccessRequests,
+	openSealer ports.FileOpenSealer,
+	repo ports.GitRepository,
+) error {
+	if isDirty, err := repo.IsStagingDirty(); err != nil {
+		return fmt.Errorf("failed to check if repository is dirty: %w", err)
+	} else if isDirty {
+		slog.Warn("Repository is dirty")
+		os.Exit(1)
+	}
+
+	req, err := pendingRequest(requests, h.Name)
+	if err != nil {
+		return err
+	}
+
+	_, recipientType, err := infrastructure.ParseRecipient(req.PublicKey)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %w", infrastructure.ErrInvalidAccessRequest, req.Name, err)
+	}
+
+	if err := recipients.CompatibleWith(recipientType); err != nil {
+		return fmt.Errorf("cannot grant access to %s: %w", req.Name, err)
+	}
+
+	comment := req.Comment
+	if comment == "" {
+		comment = req.Name
+	}
+
+	slog.Info("Granting access", slog.String("name", req.Name), slog.String("recipient", req.PublicKey))
+	appendedRecipients, err := appendRecipient(recipients, req.PublicKey, comment, h.Expires)
+	if err != nil {
+		return fmt.Errorf("failed to append public key to recipients file: %w", err)
+	}
+	openSealer.AddRecipients(appendedRecipients...)
+
+	if err := removeRequest(requests, repo, req); err != nil {
+		return err
+	}
+
+	if err := stageRecipients(repo, repoFS); err != nil {
+		return err
+	}
+
+	if err := repo.WalkAgeFiles(services.ReEncryptWalkFunc(repo, repoFS, openSealer)); err != nil {
+		return err
+	}
+
+	slog.Info("Committing changes")
+	if err := repo.Commit(messageOrDefault(h.Message, "chore: grant access to %s", req.Name)); err != nil {
+		return fmt.Errorf("failed to commit changes: %w", err)
+	}
+
+	return nil
+}
+
+func (h *GrantCliHandler) AfterApply(ctx context.Context, kongCtx *kong.Context, cwd ports.CWD, env ports.OSEnv) error {
+	gitRepo, repoFS, err := infrastructure.NewGitRepositoryFromPath(cwd)
+	if err != nil {
+		return err
+	}
+
+	recipients, err := h.recipientsFile(cwd, env, repoFS)
+	if err != nil {
+		return err
+	}
+
+	idStore, err := h.identitiesStore(ctx, cwd, env)
+	if err != nil {
+		return fmt.Errorf("failed to init identities store: %w", err)
+	}
+
+	remotes, err := gitRepo.Remotes()
+	if err != nil {
+		return fmt.Errorf("failed to determine Git remotes: %w", err)
+	}
+
+	ids, err := idStore.Identities(ctx, ports.IdentitiesQuery{Remotes: remotes})
+	if err != nil {
+		return fmt.Errorf("failed to get identities: %w", err)
+	}
+
+	openSealer, err := services.NewAgeSealer(
+		services.WithIdentities(ids...),
+		services.WithRecipients(recipients),
+	)
+	if err != nil {
+		return err
+	}
+
+	kongCtx.BindTo(repoFS, (*ports.ReadWriteFS)(nil))
+	kongCtx.BindTo(gitRepo, (*ports.GitRepository)(nil))
+	kongCtx.BindTo(openSealer, (*ports.FileOpenSealer)(nil))
+	kongCtx.Bind(recipients)
+	kongCtx.Bind(infrastructure.NewAccessRequests(repoFS))
+
+	return nil
+}
+
+type DenyCliHandler struct {
+	Name    string `arg:"" help:"Name of the request to deny"`
+	Message string `help:"Message to be used for the commit, defaults to chore: deny access request of <name>" short:"m"`
+}
+
+func (h *DenyCliHandler) Run(requests *infrastructure.AccessRequests, repo ports.GitRepository) error {
+	if isDirty, err := repo.IsStagingDirty(); err != nil {
+		return fmt.Errorf("failed to check if repository is dirty: %w", err)
+	} else if isDirty {
+		slog.Warn("Repository is dirty")
+		os.Exit(1)
+	}
+
+	req, err := requests.Get(h.Name)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Denying access", slog.String("name", req.Name))
+	if err := removeRequest(requests, repo, req); err != nil {
+		return err
+	}
+
+	if err := repo.Commit(messageOrDefault(h.Message, "chore: deny access request of %s", req.Name)); err != nil {
+		return fmt.Errorf("failed to commit changes: %w", err)
+	}
+
+	return nil
+}
+
+func (h *DenyCliHandler) AfterApply(kongCtx *kong.Context, cwd ports.CWD) error {
+	gitRepo, repoFS, err := infrastructure.NewGitRepositoryFromPath(cwd)
+	if err != nil {
+		return err
+	}
+
+	kongCtx.BindTo(gitRepo, (*ports.GitRepository)(nil))
+	kongCtx.Bind(infrastructure.NewAccessRequests(repoFS))
+
+	return nil
+}
+
+// pendingRequest returns the request with the given name or the only pending request if no name is given.
+func pendingRequest(requests *infrastructure.AccessRequests, name string) (infrastructure.AccessRequest, error) {
+	if name != "" {
+		return requests.Get(name)
+	}
+
+	pending, err := requests.List()
+	if err != nil {
+		return infrastructure.AccessRequest{}, err
+	}
+
+	switch len(pending) {
+	case 0:
+		return infrastructure.AccessRequest{}, ErrNoPendingRequests
+	case 1:
+		return pending[0], nil
+	default:
+		names := make([]string, 0, len(pending))
+		for _, req := range pending {
+			names = append(names, req.Name)
+		}
+
+		return infrastructure.AccessRequest{}, fmt.Errorf("%w: %s", ErrAmbiguousRequest, strings.Join(names, ", "))
+	}
+}
+
+// removeRequest deletes the request file and stages the deletion.
+func removeRequest(requests *infrastructure.AccessRequests, repo ports.GitRepository, req infrastructure.AccessRequest) error {
+	if err := requests.Remove(req.Name); err != nil {
+		return fmt.Errorf("failed to remove access request: %w", err)
+	}
+
+	if err := repo.StageFile(req.Path()); err != nil {
+		return fmt.Errorf("failed to stage removal of access request: %w", err)
+	}
+
+	return nil
+}
+
+func messageOrDefault(message, format string, args ...any) string {
+	if message != "" {
+		return message
+	}
+
+	return fmt.Sprintf(format, args...)
+}
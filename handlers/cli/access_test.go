@@ -0,0 +1,132 @@
+package cli_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/alecthomas/kong"
+
+	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/handlers/cli"
+	"github.com/prskr/git-age/infrastructure"
+	"github.com/prskr/git-age/internal/testx"
+)
+
+func TestAccessRequest_Grant(t *testing.T) {
+	t.Parallel()
+
+	setup := prepareTestRepo(t)
+	repo := testx.ResultOfA[*infrastructure.GitRepository](t, infrastructure.NewGitRepository, setup.repoFS, setup.repo)
+
+	newcomerKeys := filepath.Join(t.TempDir(), "keys.txt")
+	if err := os.WriteFile(newcomerKeys, nil, 0o600); err != nil {
+		t.Fatalf("failed to create keys file: %v", err)
+	}
+
+	outBuf := new(bytes.Buffer)
+	run := func(grammar any, keysFile string, args ...string) error {
+		parser := newKong(
+			t,
+			grammar,
+			kong.Bind(ports.CWD(setup.root)),
+			kong.BindTo(testx.Context(t), (*context.Context)(nil)),
+			kong.BindTo(ports.STDOUT(outBuf), (*ports.STDOUT)(nil)),
+			kong.BindTo(ports.STDERR(io.Discard), (*ports.STDERR)(nil)),
+			kong.Bind(ports.NewOSEnv()),
+		)
+
+		ctx, err := parser.Parse(append([]string{"-k", fmt.Sprintf("file:///%s", filepath.ToSlash(keysFile))}, args...))
+		if err != nil {
+			t.Fatalf("failed to parse arguments: %v", err)
+		}
+
+		return ctx.Run()
+	}
+
+	if err := run(new(cli.RequestAccessCliHandler), newcomerKeys, "newcomer"); !errors.Is(err, infrastructure.ErrMixedPostQuantumRecipients) {
+		t.Fatalf("expected hybrid key request to be refused with %v, got %v", infrastructure.ErrMixedPostQuantumRecipients, err)
+	}
+
+	if err := run(new(cli.RequestAccessCliHandler), newcomerKeys, "-a", "x25519", "-c", "Newcomer", "newcomer"); err != nil {
+		t.Fatalf("failed to request access: %v", err)
+	}
+
+	requestedKey := strings.TrimSpace(outBuf.String())
+	if got := string(readObjectAtHead(t, repo, infrastructure.AccessRequestPath("newcomer"))); !strings.Contains(got, requestedKey) {
+		t.Fatalf("expected committed request to contain %s, got:\n%s", requestedKey, got)
+	}
+
+	if err := run(new(cli.GrantCliHandler), filepath.Join(setup.root, "keys.txt")); err != nil {
+		t.Fatalf("failed to grant access: %v", err)
+	}
+
+	if _, err := repo.OpenObjectAtHead(infrastructure.AccessRequestPath("newcomer")); err == nil {
+		t.Error("expected request to be removed after granting access")
+	}
+
+	if got := string(readObjectAtHead(t, repo, ports.RecipientsFileName)); !strings.Contains(got, "# Newcomer\n"+requestedKey+"\n") {
+		t.Errorf("expected newcomer to be added to the recipients, got:\n%s", got)
+	}
+
+	keysFile := testx.ResultOfA[*os.File](t, os.Open, newcomerKeys)
+	t.Cleanup(func() {
+		_ = keysFile.Close()
+	})
+
+	ids := testx.ResultOfA[[]age.Identity](t, age.ParseIdentities, keysFile)
+	if _, err := age.Decrypt(bytes.NewReader(readObjectAtHead(t, repo, ".env")), ids...); err != nil {
+		t.Errorf("newcomer cannot decrypt .env after granting access: %v", err)
+	}
+}
+
+func TestDenyCliHandler_Run(t *testing.T) {
+	t.Parallel()
+
+	setup := prepareTestRepo(t)
+	repo := testx.ResultOfA[*infrastructure.GitRepository](t, infrastructure.NewGitRepository, setup.repoFS, setup.repo)
+	requests := infrastructure.NewAccessRequests(setup.repoFS)
+
+	req := infrastructure.AccessRequest{
+		Name:      "mallory",
+		PublicKey: testx.ResultOf(t, age.GenerateX25519Identity).Recipient().String(),
+	}
+
+	if err := requests.Create(req); err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+
+	if err := repo.StageFile(req.Path()); err != nil {
+		t.Fatalf("failed to stage request: %v", err)
+	}
+
+	if err := repo.Commit("chore: request access for mallory"); err != nil {
+		t.Fatalf("failed to commit request: %v", err)
+	}
+
+	parser := newKong(t, new(cli.DenyCliHandler), kong.Bind(ports.CWD(setup.root)))
+
+	ctx, err := parser.Parse([]string{"mallory"})
+	if err != nil {
+		t.Fatalf("failed to parse arguments: %v", err)
+	}
+
+	if err := ctx.Run(); err != nil {
+		t.Fatalf("failed to deny access: %v", err)
+	}
+
+	if _, err := repo.OpenObjectAtHead(req.Path()); err == nil {
+		t.Error("expected request to be removed from HEAD")
+	}
+
+	if got := string(readObjectAtHead(t, repo, ports.RecipientsFileName)); strings.Contains(got, req.PublicKey) {
+		t.Errorf("expected denied key not to be added to the recipients, got:\n%s", got)
+	}
+}
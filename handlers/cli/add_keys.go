@@ -0,0 +1,119 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/infrastructure"
+)
+
+var (
+	ErrNoAgent           = errors.New("no agent available, start one with 'git age agent start' or set GIT_AGE_AGENT_HOST")
+	ErrNoIdentitiesToAdd = errors.New("no identities to add")
+)
+
+//nolint:lll // doesn't make sense to break tags in struct
+type AddKeysCliHandler struct {
+	KeysFlag   `embed:""`
+	RemoteFlag `embed:""`
+	Lifetime   time.Duration `short:"t" name:"lifetime" help:"Duration after which the agent forgets the identities again e.g. 8h, defaults to as long as the agent runs"`
+	Files      []string      `arg:"" optional:"" help:"Keys files or age-keygen output to add, defaults to the identities of the local stores"`
+}
+
+// Run hands identities to the agent like ssh-add, the agent only keeps them in memory.
+func (h *AddKeysCliHandler) Run(ctx context.Context, cwd ports.CWD, env ports.OSEnv, stderr ports.STDERR) error {
+	source := infrastructure.NewAgentIdentitiesStoreSource(cwd, env)
+	if valid, err := source.IsValid(ctx); err != nil {
+		return err
+	} else if !valid {
+		return ErrNoAgent
+	}
+
+	agent, err := source.Agent()
+	if err != nil {
+		return err
+	}
+
+	entries, err := h.entries(ctx, env)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		cmd := ports.StoreIdentityCommand{Identity: entry.Identity, Comment: entry.Comment, Remote: entry.Remote}
+		if h.Remote != "" {
+			cmd.Remote = h.Remote
+		}
+
+		if err := agent.Add(ctx, cmd, h.Lifetime); err != nil {
+			return fmt.Errorf("failed to add identity to agent: %w", err)
+		}
+
+		_, _ = fmt.Fprintf(stderr, "Identity added: %s\n", abbreviateKey(entry.Identity.Recipient().String()))
+	}
+
+	if h.Lifetime > 0 {
+		_, _ = fmt.Fprintf(stderr, "Lifetime set to %s\n", h.Lifetime)
+	}
+
+	return nil
+}
+
+// entries reads the given files or falls back to the identities of the local stores.
+func (h *AddKeysCliHandler) entries(ctx context.Context, env ports.OSEnv) ([]infrastructure.KeyBundleEntry, error) {
+	if len(h.Files) == 0 {
+		return h.localEntries(ctx, env)
+	}
+
+	var entries []infrastructure.KeyBundleEntry
+
+	for _, filePath := range h.Files {
+		raw, err := os.ReadFile(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read keys to add: %w", err)
+		}
+
+		parsed, err := infrastructure.OpenKeyBundle(raw)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filePath, err)
+		}
+
+		entries = append(entries, parsed...)
+	}
+
+	return entries, nil
+}
+
+func (h *AddKeysCliHandler) localEntries(ctx context.Context, env ports.OSEnv) ([]infrastructure.KeyBundleEntry, error) {
+	idStore, err := h.localIdentitiesStore(ctx, env)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init identities store: %w", err)
+	}
+
+	ids, err := idStore.Identities(ctx, ports.IdentitiesQuery{Remotes: []string{h.Remote}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get identities: %w", err)
+	}
+
+	entries := make([]infrastructure.KeyBundleEntry, 0, len(ids))
+	for _, id := range ids {
+		wrapped, ok := ports.WrapIdentity(id)
+		if !ok {
+			slog.WarnContext(ctx, "Skipping identity that cannot be added to the agent", slog.String("type", fmt.Sprintf("%T", id)))
+			continue
+		}
+
+		entries = append(entries, infrastructure.KeyBundleEntry{Identity: wrapped})
+	}
+
+	if len(entries) == 0 {
+		return nil, ErrNoIdentitiesToAdd
+	}
+
+	return entries, nil
+}
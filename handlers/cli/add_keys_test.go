@@ -0,0 +1,87 @@
+package cli_test
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	"github.com/alecthomas/kong"
+
+	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/handlers/cli"
+	"github.com/prskr/git-age/infrastructure"
+	"github.com/prskr/git-age/internal/testx"
+)
+
+func TestAddKeysCliHandler_Run_Lifetime(t *testing.T) {
+	t.Parallel()
+
+	const lifetime = 300 * time.Millisecond
+
+	var (
+		agentID  = testx.ResultOf(t, age.GenerateX25519Identity)
+		added    = testx.ResultOf(t, age.GenerateX25519Identity)
+		keysPath = filepath.Join(t.TempDir(), "keys.txt")
+	)
+
+	writeKeysFile(t, keysPath, added.String()+"\n")
+
+	agentHost := startTestAgent(t, agentID)
+
+	stderr := new(bytes.Buffer)
+	parser := newKong(
+		t,
+		new(cli.AddKeysCliHandler),
+		kong.BindTo(testx.Context(t), (*context.Context)(nil)),
+		kong.BindTo(ports.STDERR(stderr), (*ports.STDERR)(nil)),
+		kong.Bind(ports.OSEnv{"GIT_AGE_AGENT_HOST": agentHost}),
+		kong.Bind(ports.CWD(t.TempDir())),
+	)
+
+	kongCtx, err := parser.Parse([]string{"--lifetime", lifetime.String(), keysPath})
+	if err != nil {
+		t.Fatalf("failed to parse arguments: %v", err)
+	}
+
+	if err := kongCtx.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if !strings.Contains(stderr.String(), "Lifetime set to "+lifetime.String()) {
+		t.Errorf("expected lifetime in output, got %q", stderr.String())
+	}
+
+	agentHasKey := func() bool {
+		agent, err := (&infrastructure.AgentIdentitiesStoreSource{BaseURL: agentHost}).Agent()
+		if err != nil {
+			t.Fatalf("Agent() error = %v", err)
+		}
+
+		ids, err := agent.Identities(testx.Context(t), ports.IdentitiesQuery{})
+		if err != nil {
+			t.Fatalf("Identities() error = %v", err)
+		}
+
+		for _, id := range ids {
+			if publicKey, _ := ports.PublicKeyOf(id); publicKey == added.Recipient().String() {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	if !agentHasKey() {
+		t.Fatalf("expected agent to return the added identity")
+	}
+
+	time.Sleep(2 * lifetime)
+
+	if agentHasKey() {
+		t.Errorf("expected agent to forget the identity after its lifetime")
+	}
+}
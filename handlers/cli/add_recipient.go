@@ -1,10 +1,16 @@
 package cli
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/alecthomas/kong"
 
@@ -13,16 +19,36 @@ import (
 	"github.com/prskr/git-age/infrastructure"
 )
 
+var (
+	ErrRecipientRequired    = errors.New("either a public key or --from-forge is required")
+	ErrRecipientNotVerified = errors.New("fingerprint was not confirmed, recipient not added")
+)
+
+//nolint:lll // doesn't make sense to break tags in struct
 type AddRecipientCliHandler struct {
-	KeysFlag    `embed:""`
-	CommentFlag `embed:""`
-	Recipient   string `arg:"" help:"Recipient to add"`
-	Message     string `help:"Message to be used for the commit" default:"chore: add recipient" short:"m"`
+	KeysFlag       `embed:""`
+	CommentFlag    `embed:""`
+	ExpiresFlag    `embed:""`
+	SigningKeyFlag `embed:""`
+	Recipient      string       `arg:"" optional:"" help:"Recipient to add"`
+	FromForge      string       `name:"from-forge" placeholder:"FORGE:USER" help:"Add the SSH keys a forge publishes for the user e.g. github:alice, gitlab:alice, gitea:codeberg.org/alice or https://git.example.com/alice"`
+	Message        string       `help:"Message to be used for the commit" default:"chore: add recipient" short:"m"`
+	Verify         bool         `help:"Show the fingerprint of every recipient and ask to confirm it before adding it"`
+	Client         *http.Client `kong:"-"`
+}
+
+// recipientToAdd is a public key with the comment preceding it in the recipients file.
+type recipientToAdd struct {
+	PublicKey string
+	Comment   string
 }
 
 func (h *AddRecipientCliHandler) Run(
+	ctx context.Context,
+	stdin ports.STDIN,
+	stderr ports.STDERR,
 	repoFS ports.ReadWriteFS,
-	recipients ports.Recipients,
+	recipients *infrastructure.RecipientsFile,
 	openSealer ports.FileOpenSealer,
 	repo ports.GitRepository,
 ) (err error) {
@@ -33,16 +59,28 @@ func (h *AddRecipientCliHandler) Run(
 		os.Exit(1)
 	}
 
-	slog.Info("Adding recipient", slog.String("recipient", h.Recipient))
-	appendedRecipients, err := recipients.Append(h.Recipient, h.Comment)
+	toAdd, err := h.recipientsToAdd(ctx, recipients)
 	if err != nil {
-		return fmt.Errorf("failed to append public key to recipients file: %w", err)
+		return err
 	}
-	openSealer.AddRecipients(appendedRecipients...)
 
-	slog.Info("Staging recipients file")
-	if err := repo.StageFile(ports.RecipientsFileName); err != nil {
-		return fmt.Errorf("failed to add recipients file to git index: %w", err)
+	if h.Verify {
+		if toAdd, err = verifyRecipients(stdin, stderr, toAdd, time.Now()); err != nil {
+			return err
+		}
+	}
+
+	for _, recipient := range toAdd {
+		slog.Info("Adding recipient", slog.String("recipient", recipient.PublicKey))
+		appendedRecipients, err := appendRecipient(recipients, recipient.PublicKey, recipient.Comment, h.Expires)
+		if err != nil {
+			return fmt.Errorf("failed to append public key to recipients file: %w", err)
+		}
+		openSealer.AddRecipients(appendedRecipients...)
+	}
+
+	if err := stageRecipients(repo, repoFS); err != nil {
+		return err
 	}
 
 	if err := repo.WalkAgeFiles(services.ReEncryptWalkFunc(repo, repoFS, openSealer)); err != nil {
@@ -57,6 +95,84 @@ func (h *AddRecipientCliHandler) Run(
 	return nil
 }
 
+// recipientsToAdd returns either the given recipient or the keys the forge publishes for the user.
+// The fingerprints of the fetched keys are pinned in the comment to make later changes of the keys visible.
+func (h *AddRecipientCliHandler) recipientsToAdd(ctx context.Context, recipients *infrastructure.RecipientsFile) ([]recipientToAdd, error) {
+	switch {
+	case (h.Recipient == "") == (h.FromForge == ""):
+		return nil, ErrRecipientRequired
+	case h.Recipient != "":
+		return []recipientToAdd{{PublicKey: h.Recipient, Comment: h.Comment}}, nil
+	}
+
+	user, err := infrastructure.ParseForgeUser(h.FromForge)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := recipients.CompatibleWith(infrastructure.RecipientTypeSSH); err != nil {
+		return nil, fmt.Errorf("cannot add SSH keys of %s: %w", h.FromForge, err)
+	}
+
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	slog.Info("Fetching SSH keys", slog.String("url", user.KeysURL.String()))
+	keys, err := infrastructure.FetchForgeKeys(ctx, client, user)
+	if err != nil {
+		return nil, err
+	}
+
+	comment := h.Comment
+	if comment == "" {
+		comment = user.Name
+	}
+
+	toAdd := make([]recipientToAdd, 0, len(keys))
+	for _, key := range keys {
+		toAdd = append(toAdd, recipientToAdd{
+			PublicKey: key.PublicKey,
+			Comment:   fmt.Sprintf("%s (%s %s)", comment, h.FromForge, key.Fingerprint),
+		})
+	}
+
+	return toAdd, nil
+}
+
+// verifyRecipients shows the fingerprint of every recipient and asks to confirm it,
+// the comments of confirmed recipients record when they were verified.
+func verifyRecipients(stdin io.Reader, stderr io.Writer, toAdd []recipientToAdd, now time.Time) ([]recipientToAdd, error) {
+	answers := bufio.NewReader(stdin)
+	verified := make([]recipientToAdd, 0, len(toAdd))
+
+	for _, recipient := range toAdd {
+		if _, _, err := infrastructure.ParseRecipient(recipient.PublicKey); err != nil {
+			return nil, err
+		}
+
+		_, _ = fmt.Fprintf(stderr, "Recipient:   %s\n", abbreviateKey(recipient.PublicKey))
+		_, _ = fmt.Fprintf(stderr, "Fingerprint: %s\n", infrastructure.RecipientFingerprint(recipient.PublicKey))
+		_, _ = fmt.Fprintf(stderr, "Words:       %s\n", infrastructure.RecipientFingerprintWords(recipient.PublicKey))
+		_, _ = fmt.Fprint(stderr, "Does the owner read out the same fingerprint from 'git age keys list'? [y/N] ")
+
+		answer, err := answers.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("failed to read answer: %w", err)
+		}
+
+		if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+			return nil, fmt.Errorf("%w: %s", ErrRecipientNotVerified, infrastructure.RecipientFingerprint(recipient.PublicKey))
+		}
+
+		recipient.Comment = strings.TrimSpace(recipient.Comment + " (verified on " + now.Format(time.DateOnly) + ")")
+		verified = append(verified, recipient)
+	}
+
+	return verified, nil
+}
+
 func (h *AddRecipientCliHandler) AfterApply(
 	ctx context.Context,
 	kongCtx *kong.Context,
@@ -68,13 +184,12 @@ func (h *AddRecipientCliHandler) AfterApply(
 		return err
 	}
 
-	recipients := infrastructure.NewRecipientsFile(repoFS)
+	recipients, err := h.recipientsFile(cwd, env, repoFS)
+	if err != nil {
+		return err
+	}
 
-	idStore, err := infrastructure.IdentitiesStore(
-		ctx,
-		infrastructure.NewAgentIdentitiesStoreSource(env),
-		infrastructure.NewFileIdentityStoreSource(h.Keys),
-	)
+	idStore, err := h.identitiesStore(ctx, cwd, env)
 	if err != nil {
 		return fmt.Errorf("failed to init identities store: %w", err)
 	}
@@ -93,8 +208,13 @@ func (h *AddRecipientCliHandler) AfterApply(
 		return fmt.Errorf("failed to get identities: %w", err)
 	}
 
+	passphraseIDs, err := unlockPassphrase(ctx, idStore, recipients, query)
+	if err != nil {
+		return err
+	}
+
 	openSealer, err := services.NewAgeSealer(
-		services.WithIdentities(ids...),
+		services.WithIdentities(append(ids, passphraseIDs...)...),
 		services.WithRecipients(recipients),
 	)
 	if err != nil {
@@ -103,7 +223,7 @@ func (h *AddRecipientCliHandler) AfterApply(
 
 	kongCtx.BindTo(repoFS, (*ports.ReadWriteFS)(nil))
 	kongCtx.BindTo(gitRepo, (*ports.GitRepository)(nil))
-	kongCtx.BindTo(recipients, (*ports.Recipients)(nil))
+	kongCtx.Bind(recipients)
 	kongCtx.BindTo(openSealer, (*ports.FileOpenSealer)(nil))
 
 	return nil
@@ -1,12 +1,23 @@
 package cli_test
 
 import (
+	"bytes"
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
+	"filippo.io/age/agessh"
 	"github.com/alecthomas/kong"
+	"golang.org/x/crypto/ssh"
 
 	"github.com/prskr/git-age/core/ports"
 	"github.com/prskr/git-age/internal/testx"
@@ -34,6 +45,8 @@ func TestAddRecipientCliHandler_Run(t *testing.T) {
 		kong.Bind(ports.CWD(setup.root)),
 		kong.BindTo(testx.Context(t), (*context.Context)(nil)),
 		kong.Bind(ports.NewOSEnv()),
+		kong.BindTo(ports.STDIN(io.NopCloser(strings.NewReader(""))), (*ports.STDIN)(nil)),
+		kong.BindTo(ports.STDERR(io.Discard), (*ports.STDERR)(nil)),
 	)
 
 	args := []string{
@@ -80,3 +93,138 @@ func TestAddRecipientCliHandler_Run(t *testing.T) {
 		t.Errorf("failed to decrypt file: %v", err)
 	}
 }
+
+func TestAddRecipientCliHandler_Run_FromForge(t *testing.T) {
+	t.Parallel()
+
+	setup := prepareTestRepo(t)
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ed25519 key: %v", err)
+	}
+
+	pubKey := testx.ResultOfA[ssh.PublicKey](t, ssh.NewPublicKey, key.Public())
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/alice.keys" {
+			http.NotFound(w, r)
+			return
+		}
+
+		_, _ = w.Write(ssh.MarshalAuthorizedKey(pubKey))
+	}))
+	t.Cleanup(srv.Close)
+
+	parser := newKong(
+		t,
+		&cli.AddRecipientCliHandler{Client: srv.Client()},
+		kong.Bind(ports.CWD(setup.root)),
+		kong.BindTo(testx.Context(t), (*context.Context)(nil)),
+		kong.Bind(ports.NewOSEnv()),
+		kong.BindTo(ports.STDIN(io.NopCloser(strings.NewReader(""))), (*ports.STDIN)(nil)),
+		kong.BindTo(ports.STDERR(io.Discard), (*ports.STDERR)(nil)),
+	)
+
+	ctx, err := parser.Parse([]string{
+		"-k", fmt.Sprintf("file:///%s/keys.txt", filepath.ToSlash(setup.root)),
+		"--from-forge", srv.URL + "/alice",
+	})
+	if err != nil {
+		t.Fatalf("failed to parse arguments: %v", err)
+	}
+
+	if err := ctx.Run(); err != nil {
+		t.Fatalf("failed to run command: %v", err)
+	}
+
+	repo := testx.ResultOfA[*infrastructure.GitRepository](t, infrastructure.NewGitRepository, setup.repoFS, setup.repo)
+
+	wantEntry := fmt.Sprintf("# alice (%s/alice %s)\n%s", srv.URL, infrastructure.RecipientFingerprint(string(ssh.MarshalAuthorizedKey(pubKey))), ssh.MarshalAuthorizedKey(pubKey))
+	if got := string(readObjectAtHead(t, repo, ports.RecipientsFileName)); !strings.HasSuffix(got, wantEntry) {
+		t.Errorf("expected recipients file to end with\n%s\ngot:\n%s", wantEntry, got)
+	}
+
+	id := testx.ResultOfA[age.Identity](t, agessh.NewEd25519Identity, key)
+	if _, err := age.Decrypt(bytes.NewReader(readObjectAtHead(t, repo, ".env")), id); err != nil {
+		t.Errorf("SSH key fetched from forge cannot decrypt .env: %v", err)
+	}
+}
+
+func TestAddRecipientCliHandler_Run_Verify(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		answer    string
+		wantErr   error
+		wantAdded bool
+	}{
+		{
+			name:      "Confirmed",
+			answer:    "y\n",
+			wantAdded: true,
+		},
+		{
+			name:    "Rejected",
+			answer:  "n\n",
+			wantErr: cli.ErrRecipientNotVerified,
+		},
+		{
+			name:    "No answer",
+			wantErr: cli.ErrRecipientNotVerified,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			setup := prepareTestRepo(t)
+			idToAdd := testx.ResultOf(t, age.GenerateX25519Identity)
+			stderr := new(bytes.Buffer)
+
+			parser := newKong(
+				t,
+				new(cli.AddRecipientCliHandler),
+				kong.Bind(ports.CWD(setup.root)),
+				kong.BindTo(testx.Context(t), (*context.Context)(nil)),
+				kong.Bind(ports.NewOSEnv()),
+				kong.BindTo(ports.STDIN(io.NopCloser(strings.NewReader(tt.answer))), (*ports.STDIN)(nil)),
+				kong.BindTo(ports.STDERR(stderr), (*ports.STDERR)(nil)),
+			)
+
+			ctx, err := parser.Parse([]string{
+				"-k", fmt.Sprintf("file:///%s/keys.txt", filepath.ToSlash(setup.root)),
+				"-c", "bob",
+				"--verify",
+				idToAdd.Recipient().String(),
+			})
+			if err != nil {
+				t.Fatalf("failed to parse arguments: %v", err)
+			}
+
+			if err := ctx.Run(); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			words := infrastructure.RecipientFingerprintWords(idToAdd.Recipient().String())
+			if !strings.Contains(stderr.String(), words) {
+				t.Errorf("expected fingerprint words %q in output, got %q", words, stderr.String())
+			}
+
+			raw, err := os.ReadFile(filepath.Join(setup.root, ports.RecipientsFileName))
+			if err != nil {
+				t.Fatalf("failed to read recipients file: %v", err)
+			}
+
+			if added := strings.Contains(string(raw), idToAdd.Recipient().String()); added != tt.wantAdded {
+				t.Fatalf("recipient added = %t, want %t", added, tt.wantAdded)
+			}
+
+			if tt.wantAdded && !strings.Contains(string(raw), "# bob (verified on ") {
+				t.Errorf("expected comment to record the verification, got %q", raw)
+			}
+		})
+	}
+}
@@ -0,0 +1,416 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"golang.org/x/term"
+
+	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/infrastructure"
+)
+
+const lockPassphraseEnv = "GIT_AGE_AGENT_LOCK_PASSPHRASE"
+
+type AgentCliHandler struct {
+	Socket string `name:"socket" help:"Path of the unix socket, defaults to $XDG_RUNTIME_DIR/git-age/agent.sock"`
+
+	Serve  AgentServeCliHandler  `cmd:"" name:"serve" help:"Serve the identities of the local stores to other git-age processes in the foreground"`
+	Start  AgentStartCliHandler  `cmd:"" name:"start" help:"Start the agent in the background"`
+	Stop   AgentStopCliHandler   `cmd:"" name:"stop" help:"Stop the agent running in the background"`
+	Status AgentStatusCliHandler `cmd:"" name:"status" help:"Show whether the agent is running"`
+	Lock   AgentLockCliHandler   `cmd:"" name:"lock" help:"Lock the agent, it does not hand out identities until it is unlocked"`
+	Unlock AgentUnlockCliHandler `cmd:"" name:"unlock" help:"Unlock the agent again"`
+	Audit  AgentAuditCliHandler  `cmd:"" name:"audit" help:"Query and verify the audit log of the agent"`
+}
+
+func (h *AgentCliHandler) AfterApply(kongCtx *kong.Context) error {
+	kongCtx.Bind(infrastructure.NewAgentDaemon(h.Socket))
+	return nil
+}
+
+//nolint:lll // doesn't make sense to break tags in struct
+type AgentServeFlags struct {
+	AuditLog          string        `name:"audit-log" help:"Path of the audit log, defaults to $XDG_STATE_HOME/git-age/agent-audit.jsonl"`
+	Policy            string        `name:"policy" default:"${XDG_CONFIG_HOME}/git-age/agent-policy" help:"Rules which clients get the keys for which remotes"`
+	ConfirmHelper     string        `env:"GIT_AGE_AGENT_CONFIRM_HELPER" config:"agentConfirmHelper" name:"confirm-helper" help:"Command asked to confirm requests of ask rules, exit code 0 allows the request"`
+	AllowUnknownPeers bool          `name:"allow-unknown-peers" help:"Handle requests of clients whose credentials cannot be determined, e.g. on platforms other than Linux, like requests of the same user"`
+	LockAfter         time.Duration `env:"GIT_AGE_AGENT_LOCK_AFTER" config:"agentLockAfter" name:"lock-after" help:"Lock the agent after it did not handle any request for the given period e.g. 30m, the passphrase is read from GIT_AGE_AGENT_LOCK_PASSPHRASE or prompted for"`
+}
+
+// lockPassphrase returns the passphrase the agent unlocks with after it locked itself,
+// it is only needed with --lock-after and kept out of argv, hence read from the environment or prompted for.
+func (f AgentServeFlags) lockPassphrase(env ports.OSEnv, stdin ports.STDIN, stderr ports.STDERR) (string, error) {
+	if f.LockAfter <= 0 {
+		return env.Get(lockPassphraseEnv), nil
+	}
+
+	passphrase, err := readPassphrase(stdin, stderr, env.Get(lockPassphraseEnv))
+	if err != nil {
+		return "", err
+	}
+
+	if passphrase == "" {
+		return "", fmt.Errorf("--lock-after: %w", infrastructure.ErrMissingLockPassphrase)
+	}
+
+	return passphrase, nil
+}
+
+type AgentServeCliHandler struct {
+	KeysFlag        `embed:""`
+	AgentServeFlags `embed:""`
+}
+
+func (h *AgentServeCliHandler) Run(
+	ctx context.Context,
+	env ports.OSEnv,
+	stdin ports.STDIN,
+	stderr ports.STDERR,
+	daemon infrastructure.AgentDaemon,
+) (err error) {
+	policy, err := infrastructure.LoadAgentPolicy(h.Policy)
+	if err != nil {
+		return err
+	}
+
+	policy.ConfirmHelper = h.ConfirmHelper
+	policy.AllowUnknownPeers = h.AllowUnknownPeers
+
+	lockPassphrase, err := h.lockPassphrase(env, stdin, stderr)
+	if err != nil {
+		return err
+	}
+
+	idStore, err := h.localIdentitiesStore(ctx, env)
+	if err != nil {
+		return fmt.Errorf("failed to init identities store: %w", err)
+	}
+
+	auditLog, err := infrastructure.OpenAgentAuditLog(auditLogPath(h.AuditLog))
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		err = errors.Join(err, auditLog.Close())
+	}()
+
+	listener, err := daemon.Listen(env)
+	if err != nil {
+		return err
+	}
+
+	if err := daemon.WritePID(); err != nil {
+		return errors.Join(err, listener.Close())
+	}
+
+	defer func() {
+		err = errors.Join(err, daemon.RemovePID())
+	}()
+
+	slog.Info("Agent listening", slog.String("socket", listener.Addr().String()), slog.Int("rules", len(policy.Rules)))
+
+	server := &infrastructure.AgentServer{
+		Store:          idStore,
+		Policy:         policy,
+		Audit:          auditLog,
+		IdleTimeout:    h.LockAfter,
+		LockPassphrase: lockPassphrase,
+	}
+
+	return server.Serve(ctx, listener)
+}
+
+type AgentStartCliHandler struct {
+	KeysFlag        `embed:""`
+	AgentServeFlags `embed:""`
+}
+
+func (h *AgentStartCliHandler) Run(
+	ctx context.Context,
+	env ports.OSEnv,
+	stdin ports.STDIN,
+	stdout ports.STDOUT,
+	stderr ports.STDERR,
+	daemon infrastructure.AgentDaemon,
+) error {
+	args := []string{"agent", "--socket", daemon.Socket, "serve", "--policy", h.Policy}
+	if h.ConfirmHelper != "" {
+		args = append(args, "--confirm-helper", h.ConfirmHelper)
+	}
+
+	if h.AuditLog != "" {
+		args = append(args, "--audit-log", h.AuditLog)
+	}
+
+	if h.AllowUnknownPeers {
+		args = append(args, "--allow-unknown-peers")
+	}
+
+	if h.LockAfter > 0 {
+		args = append(args, "--lock-after", h.LockAfter.String())
+	}
+
+	for _, keys := range h.Keys {
+		args = append(args, "--keys", keys)
+	}
+
+	lockPassphrase, err := h.lockPassphrase(env, stdin, stderr)
+	if err != nil {
+		return err
+	}
+
+	// the passphrase is handed over in the environment of the agent to keep it out of the process list
+	agentEnv := maps.Clone(env)
+	if lockPassphrase != "" {
+		agentEnv[lockPassphraseEnv] = lockPassphrase
+	}
+
+	pid, err := daemon.Start(ctx, agentEnv, args...)
+	if errors.Is(err, infrastructure.ErrAgentAlreadyRunning) {
+		_, err = fmt.Fprintf(stdout, "Agent is already running with pid %d\n", pid)
+		return err
+	} else if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(stdout, "Agent started with pid %d, listening on %s\n", pid, daemon.Socket)
+
+	return err
+}
+
+type AgentStopCliHandler struct{}
+
+func (AgentStopCliHandler) Run(ctx context.Context, stdout ports.STDOUT, daemon infrastructure.AgentDaemon) error {
+	pid, err := daemon.Stop(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(stdout, "Agent with pid %d stopped\n", pid)
+
+	return err
+}
+
+type AgentStatusCliHandler struct{}
+
+func (AgentStatusCliHandler) Run(stdout ports.STDOUT, daemon infrastructure.AgentDaemon) error {
+	pid, err := daemon.Status()
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(stdout, "Agent is running with pid %d, listening on %s\n", pid, daemon.Socket)
+
+	return err
+}
+
+//nolint:lll // doesn't make sense to break tags in struct
+type AgentLockCliHandler struct {
+	Passphrase string `env:"GIT_AGE_AGENT_LOCK_PASSPHRASE" name:"passphrase" help:"Passphrase to lock the agent with, read from stdin if empty"`
+}
+
+func (h *AgentLockCliHandler) Run(
+	ctx context.Context,
+	env ports.OSEnv,
+	stdin ports.STDIN,
+	stderr ports.STDERR,
+	daemon infrastructure.AgentDaemon,
+) error {
+	agent, err := agentOf(env, daemon)
+	if err != nil {
+		return err
+	}
+
+	passphrase, err := readPassphrase(stdin, stderr, h.Passphrase)
+	if err != nil {
+		return err
+	}
+
+	if err := agent.Lock(ctx, passphrase); err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(stderr, "Agent locked")
+
+	return err
+}
+
+//nolint:lll // doesn't make sense to break tags in struct
+type AgentUnlockCliHandler struct {
+	Passphrase string `env:"GIT_AGE_AGENT_LOCK_PASSPHRASE" name:"passphrase" help:"Passphrase the agent was locked with, read from stdin if empty"`
+}
+
+func (h *AgentUnlockCliHandler) Run(
+	ctx context.Context,
+	env ports.OSEnv,
+	stdin ports.STDIN,
+	stderr ports.STDERR,
+	daemon infrastructure.AgentDaemon,
+) error {
+	agent, err := agentOf(env, daemon)
+	if err != nil {
+		return err
+	}
+
+	passphrase, err := readPassphrase(stdin, stderr, h.Passphrase)
+	if err != nil {
+		return err
+	}
+
+	if err := agent.Unlock(ctx, passphrase); err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(stderr, "Agent unlocked")
+
+	return err
+}
+
+// agentOf connects to the agent configured with GIT_AGE_AGENT_HOST or the one listening on the socket of the daemon.
+func agentOf(env ports.OSEnv, daemon infrastructure.AgentDaemon) (*infrastructure.AgentIdentitiesStore, error) {
+	source := &infrastructure.AgentIdentitiesStoreSource{BaseURL: os.ExpandEnv(env.Get("GIT_AGE_AGENT_HOST"))}
+	if source.BaseURL == infrastructure.AgentHostNone {
+		return nil, ErrNoAgent
+	} else if source.BaseURL == "" {
+		source.BaseURL = "unix://" + daemon.Socket
+	}
+
+	return source.Agent()
+}
+
+// readPassphrase prompts for the passphrase unless it was already given,
+// it is not echoed if stdin is a terminal.
+func readPassphrase(stdin ports.STDIN, stderr ports.STDERR, given string) (string, error) {
+	if given != "" {
+		return given, nil
+	}
+
+	_, _ = fmt.Fprint(stderr, "Passphrase: ")
+
+	if file, ok := stdin.(*os.File); ok && term.IsTerminal(int(file.Fd())) {
+		raw, err := term.ReadPassword(int(file.Fd()))
+		_, _ = fmt.Fprintln(stderr)
+
+		return string(raw), err
+	}
+
+	line, err := bufio.NewReader(stdin).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("failed to read passphrase: %w", err)
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+//nolint:lll // doesn't make sense to break tags in struct
+type AgentAuditCliHandler struct {
+	AuditLog   string        `name:"audit-log" help:"Path of the audit log, defaults to $XDG_STATE_HOME/git-age/agent-audit.jsonl"`
+	Since      time.Duration `name:"since" help:"Only show requests of the given period e.g. 24h"`
+	Repository string        `name:"repository" help:"Only show requests for repositories matching the pattern"`
+	Remote     string        `name:"remote" help:"Only show requests for remotes matching the pattern"`
+	Denied     bool          `name:"denied" help:"Only show denied requests"`
+	JSON       bool          `name:"json" help:"Print JSON lines instead of a table"`
+	Verify     bool          `name:"verify" help:"Only verify the hash chain of the audit log"`
+}
+
+func (h *AgentAuditCliHandler) Run(stdout ports.STDOUT) error {
+	entries, err := infrastructure.ReadAgentAuditLog(auditLogPath(h.AuditLog))
+	if err != nil {
+		return err
+	}
+
+	verifyErr := infrastructure.VerifyAgentAuditLog(entries)
+
+	if h.Verify {
+		if verifyErr != nil {
+			return verifyErr
+		}
+
+		_, err = fmt.Fprintf(stdout, "%d entries, hash chain intact\n", len(entries))
+
+		return err
+	}
+
+	if verifyErr != nil {
+		slog.Warn("Audit log was tampered with", slog.String("err", verifyErr.Error()))
+	}
+
+	entries = slices.DeleteFunc(entries, func(entry infrastructure.AgentAuditEntry) bool {
+		return !h.matches(entry)
+	})
+
+	if h.JSON {
+		encoder := json.NewEncoder(stdout)
+		for _, entry := range entries {
+			if err := encoder.Encode(entry); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	writer := tabwriter.NewWriter(stdout, 0, 0, 3, ' ', 0)
+
+	_, _ = fmt.Fprintln(writer, "Time\tDecision\tPID\tExecutable\tRepository\tRemotes\tKeys\t")
+
+	for _, entry := range entries {
+		keys := make([]string, 0, len(entry.Keys))
+		for _, key := range entry.Keys {
+			keys = append(keys, abbreviateKey(key))
+		}
+
+		_, _ = fmt.Fprintf(
+			writer, "%s\t%s\t%d\t%s\t%s\t%s\t%s\t\n",
+			entry.Time.Local().Format(time.DateTime), entry.Decision, entry.PID, entry.Executable,
+			entry.Repository, strings.Join(entry.Remotes, ","), strings.Join(keys, ","),
+		)
+	}
+
+	return writer.Flush()
+}
+
+func (h *AgentAuditCliHandler) matches(entry infrastructure.AgentAuditEntry) bool {
+	switch {
+	case h.Since > 0 && entry.Time.Before(time.Now().Add(-h.Since)):
+		return false
+	case h.Denied && entry.Decision == infrastructure.AgentDecisionAllow:
+		return false
+	case h.Repository != "":
+		if matched, _ := path.Match(h.Repository, entry.Repository); !matched {
+			return false
+		}
+	}
+
+	if h.Remote == "" {
+		return true
+	}
+
+	return slices.ContainsFunc(entry.Remotes, func(remote string) bool {
+		matched, _ := path.Match(h.Remote, remote)
+		return matched
+	})
+}
+
+func auditLogPath(configured string) string {
+	if configured == "" {
+		return infrastructure.DefaultAgentAuditLog()
+	}
+
+	return configured
+}
@@ -0,0 +1,205 @@
+package cli_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/alecthomas/kong"
+
+	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/handlers/cli"
+	"github.com/prskr/git-age/infrastructure"
+	"github.com/prskr/git-age/internal/testx"
+)
+
+func TestAgentAuditCliHandler_Run(t *testing.T) {
+	t.Parallel()
+
+	logPath := filepath.Join(t.TempDir(), "agent-audit.jsonl")
+
+	auditLog, err := infrastructure.OpenAgentAuditLog(logPath)
+	if err != nil {
+		t.Fatalf("OpenAgentAuditLog() error = %v", err)
+	}
+
+	for _, decision := range []infrastructure.AgentDecision{infrastructure.AgentDecisionAllow, infrastructure.AgentDecisionDeny} {
+		req := infrastructure.AgentRequest{
+			Procedure: "/agent.v1.IdentitiesStoreService/GetIdentities",
+			Peer:      &infrastructure.AgentPeer{PID: 42, Executable: "/usr/bin/" + string(decision)},
+			Remotes:   []string{"git@github.com:acme/infra.git"},
+		}
+
+		if err := auditLog.Append(infrastructure.NewAgentAuditEntry(req, decision, "test")); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+	}
+
+	if err := auditLog.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	runAudit := func(tb testing.TB, args ...string) (string, error) {
+		tb.Helper()
+
+		stdout := new(bytes.Buffer)
+		parser := newKong(tb, new(cli.AgentCliHandler), kong.BindTo(ports.STDOUT(stdout), (*ports.STDOUT)(nil)))
+
+		ctx, err := parser.Parse(append([]string{"audit", "--audit-log", logPath}, args...))
+		if err != nil {
+			tb.Fatalf("failed to parse arguments: %v", err)
+		}
+
+		err = ctx.Run()
+
+		return stdout.String(), err
+	}
+
+	out, err := runAudit(t, "--denied", "--remote", "git@github.com:acme/*")
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if !strings.Contains(out, "/usr/bin/deny") || strings.Contains(out, "/usr/bin/allow") {
+		t.Errorf("expected only the denied request, got %q", out)
+	}
+
+	if out, err := runAudit(t, "--verify"); err != nil || !strings.Contains(out, "2 entries") {
+		t.Errorf("Run() = %q, %v, want intact chain", out, err)
+	}
+
+	raw, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("failed to read audit log: %v", err)
+	}
+
+	if err := os.WriteFile(logPath, bytes.Replace(raw, []byte(`"deny"`), []byte(`"allow"`), 1), 0o600); err != nil {
+		t.Fatalf("failed to tamper with audit log: %v", err)
+	}
+
+	if _, err := runAudit(t, "--verify"); !errors.Is(err, infrastructure.ErrAuditChainBroken) {
+		t.Errorf("Run() error = %v, want %v", err, infrastructure.ErrAuditChainBroken)
+	}
+}
+
+func TestAgentLockCliHandler_Run(t *testing.T) {
+	t.Parallel()
+
+	id := testx.ResultOf(t, age.GenerateX25519Identity)
+	agentHost := startTestAgent(t, id)
+	source := &infrastructure.AgentIdentitiesStoreSource{BaseURL: agentHost}
+
+	runAgent := func(tb testing.TB, stdin string, args ...string) error {
+		tb.Helper()
+
+		parser := newKong(
+			tb,
+			new(cli.AgentCliHandler),
+			kong.BindTo(testx.Context(t), (*context.Context)(nil)),
+			kong.BindTo(ports.STDIN(io.NopCloser(strings.NewReader(stdin))), (*ports.STDIN)(nil)),
+			kong.BindTo(ports.STDERR(new(bytes.Buffer)), (*ports.STDERR)(nil)),
+			kong.Bind(ports.OSEnv{"GIT_AGE_AGENT_HOST": agentHost}),
+		)
+
+		ctx, err := parser.Parse(args)
+		if err != nil {
+			tb.Fatalf("failed to parse arguments: %v", err)
+		}
+
+		return ctx.Run()
+	}
+
+	if err := runAgent(t, "", "lock", "--passphrase", "secret"); err != nil {
+		t.Fatalf("lock error = %v", err)
+	}
+
+	if _, err := source.IsValid(testx.Context(t)); !errors.Is(err, infrastructure.ErrAgentLocked) {
+		t.Errorf("IsValid() error = %v, want %v", err, infrastructure.ErrAgentLocked)
+	}
+
+	if err := runAgent(t, "wrong\n", "unlock"); err == nil {
+		t.Errorf("expected unlock with wrong passphrase to fail")
+	}
+
+	// the passphrase is read from stdin if it is not passed as flag
+	if err := runAgent(t, "secret\n", "unlock"); err != nil {
+		t.Fatalf("unlock error = %v", err)
+	}
+
+	if valid, err := source.IsValid(testx.Context(t)); err != nil || !valid {
+		t.Errorf("IsValid() = %t, %v after unlock", valid, err)
+	}
+}
+
+func TestAgentServeCliHandler_Run_MissingLockPassphrase(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := t.TempDir()
+
+	parser := newKong(
+		t,
+		new(cli.AgentCliHandler),
+		kong.BindTo(testx.Context(t), (*context.Context)(nil)),
+		kong.BindTo(ports.STDIN(io.NopCloser(strings.NewReader(""))), (*ports.STDIN)(nil)),
+		kong.BindTo(ports.STDERR(new(bytes.Buffer)), (*ports.STDERR)(nil)),
+		kong.Bind(ports.NewOSEnv()),
+	)
+
+	args := []string{
+		"--socket", filepath.Join(tmpDir, "agent.sock"),
+		"serve",
+		"--policy", filepath.Join(tmpDir, "agent-policy"),
+		"--lock-after", "30m",
+	}
+
+	ctx, err := parser.Parse(args)
+	if err != nil {
+		t.Fatalf("failed to parse arguments: %v", err)
+	}
+
+	if err := ctx.Run(); !errors.Is(err, infrastructure.ErrMissingLockPassphrase) {
+		t.Errorf("serve error = %v, want %v", err, infrastructure.ErrMissingLockPassphrase)
+	}
+
+	if _, err := parser.Parse(append(args, "--lock-passphrase", "secret")); err == nil {
+		t.Errorf("expected the passphrase to not be accepted as flag")
+	}
+}
+
+// startTestAgent serves the identity with an agent without policy and returns its URL.
+func startTestAgent(t *testing.T, id *age.X25519Identity) string {
+	t.Helper()
+
+	socketPath := filepath.Join(t.TempDir(), "agent.sock")
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(testx.Context(t))
+	t.Cleanup(cancel)
+
+	server := &infrastructure.AgentServer{
+		Store: &infrastructure.StaticIdentitiesStore{
+			StoreName: "static",
+			Load: func() ([]byte, error) {
+				return []byte(id.String()), nil
+			},
+		},
+		Policy: new(infrastructure.AgentPolicy),
+	}
+
+	go func() {
+		_ = server.Serve(ctx, listener)
+	}()
+
+	return "unix://" + socketPath
+}
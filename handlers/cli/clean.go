@@ -10,6 +10,7 @@ import (
 	"io"
 	"log/slog"
 	"os"
+	"time"
 
 	"github.com/go-git/go-git/v5/plumbing"
 
@@ -22,14 +23,19 @@ import (
 	"github.com/prskr/git-age/infrastructure"
 )
 
+//nolint:lll // doesn't make sense to break tags in struct
 type CleanCliHandler struct {
 	KeysFlag        `embed:""`
+	ExpiryWarning   time.Duration        `env:"GIT_AGE_EXPIRY_WARNING" config:"expiryWarning" name:"expiry-warning" default:"336h" help:"Warn about recipients expiring within this duration"`
 	Repository      ports.GitRepository  `kong:"-"`
 	OpenSealer      ports.FileOpenSealer `kong:"-"`
 	FileToCleanPath string               `arg:"" name:"file" help:"Path to the file to clean"`
+
+	// expired are the recipients of the recipients file the file is not encrypted for anymore
+	expired []infrastructure.RecipientEntry
 }
 
-func (h *CleanCliHandler) Run(stdin ports.STDIN, stdout ports.STDOUT) error {
+func (h *CleanCliHandler) Run(stdin ports.STDIN, stdout ports.STDOUT, stderr ports.STDERR) error {
 	if err := requireStdin(stdin); err != nil {
 		return err
 	}
@@ -60,7 +66,7 @@ func (h *CleanCliHandler) Run(stdin ports.STDIN, stdout ports.STDOUT) error {
 	if err != nil {
 		if isFileNotFound(err) {
 			logger.Info("Could not compare file to HEAD, handling as new")
-			return h.copyEncryptedFileToStdout(fileToClean, stdout)
+			return h.copyEncryptedFileToStdout(fileToClean, stdout, stderr)
 		}
 
 		return fmt.Errorf("failed to hash file at HEAD: %w", err)
@@ -82,7 +88,7 @@ func (h *CleanCliHandler) Run(stdin ports.STDIN, stdout ports.STDOUT) error {
 	}
 
 	logger.Info("File has changed since last commit")
-	return h.copyEncryptedFileToStdout(fileToClean, stdout)
+	return h.copyEncryptedFileToStdout(fileToClean, stdout, stderr)
 }
 
 func (h *CleanCliHandler) AfterApply(ctx context.Context, cwd ports.CWD, env ports.OSEnv) (err error) {
@@ -93,11 +99,7 @@ func (h *CleanCliHandler) AfterApply(ctx context.Context, cwd ports.CWD, env por
 		return err
 	}
 
-	idStore, err := infrastructure.IdentitiesStore(
-		ctx,
-		infrastructure.NewAgentIdentitiesStoreSource(env),
-		infrastructure.NewFileIdentityStoreSource(h.Keys),
-	)
+	idStore, err := h.identitiesStore(ctx, cwd, env)
 	if err != nil {
 		return fmt.Errorf("failed to init identities store: %w", err)
 	}
@@ -116,15 +118,97 @@ func (h *CleanCliHandler) AfterApply(ctx context.Context, cwd ports.CWD, env por
 		return fmt.Errorf("failed to get identities: %w", err)
 	}
 
+	recipients, err := verifiedRecipientsFile(cwd, repoFS)
+	if err != nil {
+		return err
+	}
+
+	recipients.SkipExpired = func(entry infrastructure.RecipientEntry) {
+		h.expired = append(h.expired, entry)
+	}
+
+	if err := h.warnExpiringRecipients(recipients); err != nil {
+		return err
+	}
+
+	warnReEncryptNeeded(cwd)
+
+	passphraseIDs, err := unlockPassphrase(ctx, idStore, recipients, query)
+	if err != nil {
+		return err
+	}
+
 	h.OpenSealer, err = services.NewAgeSealer(
-		services.WithRecipients(infrastructure.NewRecipientsFile(repoFS)),
-		services.WithIdentities(ids...),
+		services.WithRecipients(recipients),
+		services.WithIdentities(append(ids, passphraseIDs...)...),
 	)
 
 	return err
 }
 
-func (h *CleanCliHandler) copyEncryptedFileToStdout(reader io.Reader, out io.Writer) (err error) {
+// warnExpiringRecipients warns about recipients expiring soon,
+// expired recipients are not encrypted for anymore and reported for every file that is encrypted.
+func (h *CleanCliHandler) warnExpiringRecipients(recipients *infrastructure.RecipientsFile) error {
+	now := time.Now()
+
+	expiring, err := recipients.Expiring(now.Add(h.ExpiryWarning))
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range expiring {
+		if entry.IsExpired(now) {
+			continue
+		}
+
+		slog.Warn(
+			"Recipient expires soon",
+			slog.String("recipient", entry.PublicKey),
+			slog.String("comment", entry.Comment),
+			slog.String("expires", entry.Expires.Format(time.DateOnly)),
+		)
+	}
+
+	return nil
+}
+
+// warnReEncryptNeeded reminds to re-encrypt the files after a merge changed the recipients,
+// until then files that were not changed are still encrypted for the recipients of their branch.
+func warnReEncryptNeeded(cwd ports.CWD) {
+	marker, err := infrastructure.NewReEncryptMarker(cwd)
+	if err != nil {
+		return
+	}
+
+	if reason, err := marker.Reason(); err != nil {
+		slog.Warn("Failed to check if files have to be re-encrypted", slog.String("err", err.Error()))
+	} else if reason != "" {
+		slog.Warn("Files have to be re-encrypted, run 'git age files re-encrypt'", slog.String("reason", reason))
+	}
+}
+
+// reportExpiredRecipients prints the expired recipients the file is encrypted without,
+// regardless of the log level, they lose access to the new content of the file.
+func (h *CleanCliHandler) reportExpiredRecipients(stderr io.Writer) {
+	for _, entry := range h.expired {
+		recipient := entry.PublicKey
+		if entry.Comment != "" {
+			recipient += " (" + entry.Comment + ")"
+		}
+
+		_, _ = fmt.Fprintf(
+			stderr,
+			"git-age: not encrypting %s for expired recipient %s, its last day was %s, remove it with 'git age recipients prune-expired'\n",
+			h.FileToCleanPath,
+			recipient,
+			entry.Expires.Format(time.DateOnly),
+		)
+	}
+}
+
+func (h *CleanCliHandler) copyEncryptedFileToStdout(reader io.Reader, out, stderr io.Writer) (err error) {
+	h.reportExpiredRecipients(stderr)
+
 	encryptWriter, err := h.OpenSealer.SealFile(out)
 	if err != nil {
 		return err
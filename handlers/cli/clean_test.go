@@ -3,11 +3,14 @@ package cli_test
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"filippo.io/age"
 	"github.com/alecthomas/kong"
@@ -15,6 +18,7 @@ import (
 
 	"github.com/prskr/git-age/core/ports"
 	"github.com/prskr/git-age/handlers/cli"
+	"github.com/prskr/git-age/infrastructure"
 	"github.com/prskr/git-age/internal/testx"
 )
 
@@ -78,6 +82,7 @@ func TestCleanCliHandler_Run(t *testing.T) {
 				kong.BindTo(testx.Context(t), (*context.Context)(nil)),
 				kong.BindTo(ports.STDIN(inFile), (*ports.STDIN)(nil)),
 				kong.BindTo(ports.STDOUT(out), (*ports.STDOUT)(nil)),
+				kong.BindTo(ports.STDERR(io.Discard), (*ports.STDERR)(nil)),
 				kong.Bind(ports.NewOSEnv()),
 			)
 
@@ -126,3 +131,74 @@ func TestCleanCliHandler_Run(t *testing.T) {
 		})
 	}
 }
+
+func TestCleanCliHandler_Run_ExpiredRecipient(t *testing.T) {
+	t.Parallel()
+	setup := prepareTestRepo(t)
+
+	expiredIdentity := testx.ResultOf(t, age.GenerateX25519Identity)
+	recipientsFile := infrastructure.NewRecipientsFile(infrastructure.NewReadWriteDirFS(setup.root))
+
+	lastDay := time.Date(2020, 1, 31, 0, 0, 0, 0, time.UTC)
+	if _, err := recipientsFile.AppendExpiring(expiredIdentity.Recipient().String(), "Expired", lastDay); err != nil {
+		t.Fatalf("failed to append expired recipient: %v", err)
+	}
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+
+	parser := newKong(
+		t,
+		new(cli.CleanCliHandler),
+		kong.Bind(ports.CWD(setup.root)),
+		kong.BindTo(testx.Context(t), (*context.Context)(nil)),
+		kong.BindTo(ports.STDIN(io.NopCloser(strings.NewReader("MODIFIED=true\n"))), (*ports.STDIN)(nil)),
+		kong.BindTo(ports.STDOUT(stdout), (*ports.STDOUT)(nil)),
+		kong.BindTo(ports.STDERR(stderr), (*ports.STDERR)(nil)),
+		kong.Bind(ports.NewOSEnv()),
+	)
+
+	args := []string{
+		"-k", fmt.Sprintf("file:///%s/keys.txt", filepath.ToSlash(setup.root)),
+		".env",
+	}
+
+	ctx, err := parser.Parse(args)
+	if err != nil {
+		t.Fatalf("failed to parse arguments: %v", err)
+	}
+
+	if err := ctx.Run(); err != nil {
+		t.Fatalf("failed to run command: %v", err)
+	}
+
+	header, _, found := bytes.Cut(stdout.Bytes(), []byte("\n---"))
+	if !found {
+		t.Fatalf("encrypted file has no age header")
+	}
+
+	if stanzas := bytes.Count(header, []byte("\n-> X25519 ")); stanzas != 1 {
+		t.Errorf("expected a single X25519 stanza for the unexpired recipient, got %d", stanzas)
+	}
+
+	var noMatch *age.NoIdentityMatchError
+	if _, err := age.Decrypt(bytes.NewReader(stdout.Bytes()), expiredIdentity); !errors.As(err, &noMatch) {
+		t.Errorf("expected the expired recipient not to be able to decrypt the file, got %v", err)
+	}
+
+	ids, err := age.ParseIdentities(bytes.NewReader(keys))
+	if err != nil {
+		t.Fatalf("failed to parse identities: %v", err)
+	}
+
+	if _, err := age.Decrypt(bytes.NewReader(stdout.Bytes()), ids...); err != nil {
+		t.Errorf("failed to decrypt file with unexpired identity: %v", err)
+	}
+
+	report := stderr.String()
+	for _, want := range []string{expiredIdentity.Recipient().String(), "Expired", "2020-01-31", ".env"} {
+		if !strings.Contains(report, want) {
+			t.Errorf("expected stderr to mention %q, got %q", want, report)
+		}
+	}
+}
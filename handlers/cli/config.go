@@ -0,0 +1,128 @@
+package cli
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/alecthomas/kong"
+
+	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/infrastructure"
+)
+
+const configTag = "config"
+
+// ConfigFilePath returns the path of the git-age config file, GIT_AGE_CONFIG overrides the default location.
+func ConfigFilePath(env ports.OSEnv, configHome string) string {
+	if configPath := env.Get("GIT_AGE_CONFIG"); configPath != "" {
+		return configPath
+	}
+
+	return filepath.Join(configHome, "git-age", "config.toml")
+}
+
+// ConfigResolver resolves all flags with a config tag from git config or the config file.
+// Flags set on the command line or via their environment variable are left untouched
+// hence the precedence is flags > environment > git config > config file.
+func ConfigResolver(cfg *infrastructure.Config) kong.Resolver {
+	return kong.ResolverFunc(func(_ *kong.Context, _ *kong.Path, flag *kong.Flag) (any, error) {
+		key := flag.Tag.Get(configTag)
+		if key == "" {
+			return nil, nil
+		}
+
+		value, ok := cfg.Lookup(key)
+		if !ok || value.Scope == infrastructure.ConfigScopeEnv {
+			return nil, nil
+		}
+
+		if flag.IsSlice() {
+			values := make([]any, 0, len(value.Values))
+			for _, v := range value.Values {
+				values = append(values, v)
+			}
+
+			return values, nil
+		}
+
+		return value.Value(), nil
+	})
+}
+
+type ConfigFileFlag struct {
+	ConfigFile string `env:"GIT_AGE_CONFIG" name:"config-file" default:"${XDG_CONFIG_HOME}/git-age/config.toml" help:"Path to the git-age config file"`
+}
+
+type ConfigCliHandler struct {
+	Get  ConfigGetCliHandler  `cmd:"" name:"get" help:"Print the effective value of a setting"`
+	Set  ConfigSetCliHandler  `cmd:"" name:"set" help:"Set a setting in git config or the git-age config file"`
+	List ConfigListCliHandler `cmd:"" name:"list" aliases:"ls" help:"List all effective settings and where they come from"`
+}
+
+type ConfigGetCliHandler struct {
+	ShowOrigin bool   `name:"show-origin" help:"Print where the value came from"`
+	Key        string `arg:"" help:"Setting to print e.g. age.keys"`
+}
+
+func (h *ConfigGetCliHandler) Run(stdout ports.STDOUT, cfg *infrastructure.Config) (err error) {
+	if _, err := infrastructure.LookupConfigKey(h.Key); err != nil {
+		return err
+	}
+
+	value, ok := cfg.Lookup(h.Key)
+	if !ok {
+		return nil
+	}
+
+	for _, v := range value.Values {
+		if h.ShowOrigin {
+			_, err = fmt.Fprintf(stdout, "%s\t%s\t%s\n", value.Scope, value.Origin, v)
+		} else {
+			_, err = fmt.Fprintln(stdout, v)
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type ConfigSetCliHandler struct {
+	ConfigFileFlag `embed:""`
+	Scope          string   `name:"scope" enum:"local,worktree,global,system,file" default:"local" help:"Where to store the setting (${enum})"`
+	Key            string   `arg:"" help:"Setting to set e.g. age.keys"`
+	Values         []string `arg:"" help:"Value(s) to set, multiple values replace all existing ones"`
+}
+
+func (h *ConfigSetCliHandler) Run(stderr ports.STDERR, cwd ports.CWD, env ports.OSEnv, cfg *infrastructure.Config) error {
+	src, err := infrastructure.ConfigSourceFor(infrastructure.ConfigScope(h.Scope), cwd, h.ConfigFile)
+	if err != nil {
+		return err
+	}
+
+	if err := infrastructure.SetConfig(src, env, h.Key, h.Values...); err != nil {
+		return err
+	}
+
+	if value, ok := cfg.Lookup(h.Key); ok && value.Scope == infrastructure.ConfigScopeEnv {
+		_, err = fmt.Fprintf(stderr, "%s is set in the environment and overrides age.%s\n", value.Origin, value.Key.Name)
+	}
+
+	return err
+}
+
+type ConfigListCliHandler struct{}
+
+func (h *ConfigListCliHandler) Run(stdout ports.STDOUT, cfg *infrastructure.Config) error {
+	for _, value := range cfg.List() {
+		for _, v := range value.Values {
+			if _, err := fmt.Fprintf(stdout, "%s\t%s\tage.%s=%s\n", value.Scope, value.Origin, value.Key.Name, v); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
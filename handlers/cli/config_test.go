@@ -0,0 +1,153 @@
+package cli_test
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/kong"
+
+	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/handlers/cli"
+	"github.com/prskr/git-age/infrastructure"
+)
+
+func TestConfigResolver(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := t.TempDir()
+	cfgFile := filepath.Join(tmpDir, "config.toml")
+	gitConfig := filepath.Join(tmpDir, "gitconfig")
+
+	if err := os.WriteFile(cfgFile, []byte("keys = [\"file:///from-file.txt\"]\nalgorithm = \"x25519\"\nstoreTimeout = \"3s\"\n"), 0o600); err != nil {
+		t.Fatalf("failed to write config file: %v", err)
+	}
+
+	if err := os.WriteFile(gitConfig, []byte("[age]\n\tkeys = file:///from-git-1.txt\n\tkeys = file:///from-git-2.txt\n"), 0o600); err != nil {
+		t.Fatalf("failed to write git config: %v", err)
+	}
+
+	cfg, err := infrastructure.LoadConfig(
+		ports.NewOSEnv(),
+		infrastructure.ConfigSource{Scope: infrastructure.ConfigScopeFile, Path: cfgFile},
+		infrastructure.ConfigSource{Scope: infrastructure.ConfigScopeLocal, Path: gitConfig},
+	)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		args          []string
+		wantKeys      []string
+		wantAlgorithm ports.IdentityAlgorithm
+	}{
+		{
+			name:          "Git config overrides config file",
+			wantKeys:      []string{"file:///from-git-1.txt", "file:///from-git-2.txt"},
+			wantAlgorithm: ports.IdentityAlgorithmX25519,
+		},
+		{
+			name:          "Flags override git config",
+			args:          []string{"--keys", "file:///from-flag.txt", "--algorithm", "hybrid"},
+			wantKeys:      []string{"file:///from-flag.txt"},
+			wantAlgorithm: ports.IdentityAlgorithmHybrid,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var grammar struct {
+				cli.KeysFlag      `embed:""`
+				cli.AlgorithmFlag `embed:""`
+			}
+
+			parser := newKong(t, &grammar, kong.Resolvers(cli.ConfigResolver(cfg)))
+			if _, err := parser.Parse(tt.args); err != nil {
+				t.Fatalf("failed to parse arguments: %v", err)
+			}
+
+			if !slices.Equal(grammar.Keys, tt.wantKeys) {
+				t.Errorf("Keys = %v, want %v", grammar.Keys, tt.wantKeys)
+			}
+
+			if grammar.Algorithm != tt.wantAlgorithm {
+				t.Errorf("Algorithm = %v, want %v", grammar.Algorithm, tt.wantAlgorithm)
+			}
+
+			if grammar.StoreTimeout.String() != "3s" {
+				t.Errorf("StoreTimeout = %v, want 3s", grammar.StoreTimeout)
+			}
+		})
+	}
+}
+
+func TestConfigCliHandler(t *testing.T) {
+	t.Parallel()
+
+	setup := prepareTestRepo(t)
+	cfgFile := filepath.Join(t.TempDir(), "config.toml")
+	env := ports.OSEnv{
+		"GIT_AGE_AGENT_HOST":  "unix:///run/git-age.sock",
+		"GIT_CONFIG_NOSYSTEM": "1",
+		"GIT_CONFIG_GLOBAL":   filepath.Join(t.TempDir(), "gitconfig"),
+	}
+
+	run := func(args ...string) string {
+		t.Helper()
+
+		cfg, err := infrastructure.LoadConfig(env, infrastructure.DefaultConfigSources(ports.CWD(setup.root), cfgFile)...)
+		if err != nil {
+			t.Fatalf("LoadConfig() error = %v", err)
+		}
+
+		outBuf := new(bytes.Buffer)
+		parser := newKong(
+			t,
+			new(cli.ConfigCliHandler),
+			kong.BindTo(ports.STDOUT(outBuf), (*ports.STDOUT)(nil)),
+			kong.BindTo(ports.STDERR(outBuf), (*ports.STDERR)(nil)),
+			kong.Bind(ports.CWD(setup.root)),
+			kong.Bind(env),
+			kong.Bind(cfg),
+		)
+
+		kongCtx, err := parser.Parse(args)
+		if err != nil {
+			t.Fatalf("failed to parse arguments %v: %v", args, err)
+		}
+
+		if err := kongCtx.Run(); err != nil {
+			t.Fatalf("failed to run %v: %v", args, err)
+		}
+
+		return outBuf.String()
+	}
+
+	run("set", "--config-file", cfgFile, "--scope", "file", "age.algorithm", "x25519")
+	run("set", "age.keys", "file:///a.txt", "env://AGE_KEY")
+
+	if got := run("get", "algorithm"); got != "x25519\n" {
+		t.Errorf("get algorithm = %q", got)
+	}
+
+	if got := run("get", "--show-origin", "age.keys"); !strings.HasPrefix(got, "local\t"+filepath.Join(setup.root, ".git", "config")+"\tfile:///a.txt\n") {
+		t.Errorf("get --show-origin age.keys = %q", got)
+	}
+
+	listed := run("list")
+	for _, want := range []string{
+		"file\t" + cfgFile + "\tage.algorithm=x25519",
+		"local\t" + filepath.Join(setup.root, ".git", "config") + "\tage.keys=env://AGE_KEY",
+		"env\tGIT_AGE_AGENT_HOST\tage.agentHost=unix:///run/git-age.sock",
+	} {
+		if !strings.Contains(listed, want) {
+			t.Errorf("list does not contain %q:\n%s", want, listed)
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"filippo.io/age"
+
+	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/core/services"
+	"github.com/prskr/git-age/infrastructure"
+)
+
+var ErrDoctorChecksFailed = errors.New("doctor checks failed")
+
+type checkStatus string
+
+const (
+	checkOK   checkStatus = "ok"
+	checkWarn checkStatus = "warn"
+	checkFail checkStatus = "fail"
+	checkSkip checkStatus = "skip"
+)
+
+type DoctorCliHandler struct {
+	KeysFlag `embed:""`
+	SelfTest bool `name:"selftest" help:"Additionally run a clean/smudge round trip in a temporary repository"`
+}
+
+func (h *DoctorCliHandler) Run(ctx context.Context, stdout ports.STDOUT, cwd ports.CWD, env ports.OSEnv) error {
+	r := &doctorReport{out: stdout}
+
+	h.checkFilter(r, cwd, env)
+
+	var (
+		repo   *infrastructure.GitRepository
+		repoFS ports.ReadWriteFS
+	)
+
+	if gitRepo, dirFS, err := infrastructure.NewGitRepositoryFromPath(cwd); err != nil {
+		r.report(checkSkip, "repository", "not in a git repository: %v", err)
+	} else {
+		repo, repoFS = gitRepo, dirFS
+		h.checkAttributes(r, repoFS)
+	}
+
+	ids, chain, query := h.checkStores(ctx, r, cwd, env, repo)
+
+	if repoFS != nil {
+		h.checkSignature(r, cwd, repoFS)
+		h.checkRecipients(ctx, r, repo, repoFS, ids, chain, query)
+	}
+
+	if h.SelfTest {
+		if err := infrastructure.FilterSelfTest(ctx, env); err != nil {
+			r.report(checkFail, "selftest", "%v", err)
+		} else {
+			r.report(checkOK, "selftest", "clean/smudge round trip succeeded")
+		}
+	}
+
+	if r.failures > 0 {
+		return fmt.Errorf("%w: %d failed", ErrDoctorChecksFailed, r.failures)
+	}
+
+	return nil
+}
+
+func (h *DoctorCliHandler) checkFilter(r *doctorReport, cwd ports.CWD, env ports.OSEnv) {
+	filter, err := infrastructure.LoadGitFilter(cwd, env)
+	if err != nil {
+		r.report(checkFail, "filter", "%v - run git-age install", err)
+		return
+	}
+
+	if filter.Clean == "" || filter.Smudge == "" {
+		r.report(checkFail, "filter", "filter.age in %s needs both a clean and a smudge command", filter.Origin)
+		return
+	}
+
+	binary, err := filter.ResolveBinary()
+	if err != nil {
+		r.report(checkFail, "filter", "cannot resolve %s from filter.age.clean: %v", filter.Binary(), err)
+		return
+	}
+
+	r.report(checkOK, "filter", "filter.age in %s uses %s", filter.Origin, binary)
+
+	if !filter.Required {
+		r.report(checkWarn, "filter", "filter.age.required is not set, git commits plain text if the filter fails")
+	}
+}
+
+func (h *DoctorCliHandler) checkAttributes(r *doctorReport, repoFS ports.ReadWriteFS) {
+	patterns, err := infrastructure.AgeAttributePatterns(repoFS)
+	if err != nil {
+		r.report(checkFail, "attributes", "%v", err)
+		return
+	}
+
+	if len(patterns) == 0 {
+		r.report(checkWarn, "attributes", "no .gitattributes pattern assigns filter=age")
+		return
+	}
+
+	var matched int
+	for _, pattern := range patterns {
+		if pattern.Matches == 0 {
+			r.report(checkWarn, "attributes", "%s:%d: %s does not match any file", pattern.File, pattern.Line, pattern.Pattern)
+			continue
+		}
+
+		matched += pattern.Matches
+	}
+
+	r.report(checkOK, "attributes", "%d pattern(s) match %d file(s)", len(patterns), matched)
+}
+
+// checkStores queries every identities store on its own to point at the broken one
+// and returns the identities of all working stores and a chain of them.
+func (h *DoctorCliHandler) checkStores(
+	ctx context.Context,
+	r *doctorReport,
+	cwd ports.CWD,
+	env ports.OSEnv,
+	repo *infrastructure.GitRepository,
+) (ids []age.Identity, chain *services.IdentitiesStoreChain, query ports.IdentitiesQuery) {
+	keysSources, err := infrastructure.KeysSources(env, h.Keys...)
+	if err != nil {
+		r.report(checkFail, "keys", "%v", err)
+	}
+
+	sources := append(
+		[]infrastructure.IdentityStoreSource{
+			infrastructure.NewAgentIdentitiesStoreSource(cwd, env),
+			infrastructure.NewCommandIdentitiesStoreSource(env),
+		},
+		keysSources...,
+	)
+
+	chain = services.NewIdentitiesStoreChain(
+		services.WithStoreTimeout(h.StoreTimeout),
+		services.WithTolerateUnavailableStores(true),
+	)
+
+	if repo != nil {
+		if query.Remotes, err = repo.Remotes(); err != nil {
+			r.report(checkWarn, "keys", "failed to determine Git remotes: %v", err)
+		}
+	}
+
+	for _, src := range sources {
+		storeCtx, cancel := context.WithTimeout(ctx, h.StoreTimeout)
+		store, storeIDs, status, msg := h.checkStore(storeCtx, src, query)
+		cancel()
+
+		r.report(status, src.Name(), "%s", msg)
+
+		if store != nil {
+			ids = append(ids, storeIDs...)
+			chain.Stores = append(chain.Stores, store)
+		}
+	}
+
+	return ids, chain, query
+}
+
+func (h *DoctorCliHandler) checkStore(
+	ctx context.Context,
+	src infrastructure.IdentityStoreSource,
+	query ports.IdentitiesQuery,
+) (ports.IdentitiesStore, []age.Identity, checkStatus, string) {
+	isValid, err := src.IsValid(ctx)
+	switch {
+	case errors.Is(err, infrastructure.ErrAgentLocked):
+		return nil, nil, checkWarn, "agent is reachable but locked"
+	case err != nil:
+		return nil, nil, checkFail, fmt.Sprintf("unavailable: %v", err)
+	case !isValid:
+		return nil, nil, checkSkip, "not configured"
+	}
+
+	store, err := src.GetStore()
+	if err != nil {
+		return nil, nil, checkFail, err.Error()
+	}
+
+	ids, err := store.Identities(ctx, query)
+	if err != nil {
+		return nil, nil, checkFail, fmt.Sprintf("failed to read identities: %v", err)
+	}
+
+	return store, ids, checkOK, fmt.Sprintf("%d identities", len(ids))
+}
+
+func (h *DoctorCliHandler) checkSignature(r *doctorReport, cwd ports.CWD, repoFS ports.ReadWriteFS) {
+	recipientsFile, err := verifiedRecipientsFile(cwd, repoFS)
+	if err != nil {
+		r.report(checkFail, "signature", "%v", err)
+		return
+	}
+
+	// doctor only reports, the signer is trusted on first use by the next command changing or reading recipients
+	switch signer, err := recipientsFile.CheckSignature(); {
+	case errors.Is(err, infrastructure.ErrRecipientsSignerNotTrusted):
+		r.report(checkWarn, "signature", "%v, it is trusted on first use", err)
+	case err != nil:
+		r.report(checkFail, "signature", "%v", err)
+	case signer != nil:
+		r.report(checkOK, "signature", "%s is signed by a trusted key", ports.RecipientsFileName)
+	default:
+		r.report(checkSkip, "signature", "%s is not signed", ports.RecipientsFileName)
+	}
+}
+
+func (h *DoctorCliHandler) checkRecipients(
+	ctx context.Context,
+	r *doctorReport,
+	repo *infrastructure.GitRepository,
+	repoFS ports.ReadWriteFS,
+	ids []age.Identity,
+	chain *services.IdentitiesStoreChain,
+	query ports.IdentitiesQuery,
+) {
+	recipientsFile := infrastructure.NewRecipientsFile(repoFS)
+	// like clean, check the recipients of the section used on the current branch
+	recipientsFile.Head = repo
+
+	if protected, err := recipientsFile.IsPassphraseProtected(); err != nil {
+		r.report(checkFail, "recipients", "%v", err)
+		return
+	} else if protected {
+		if _, err := chain.Passphrase(ctx, query); err != nil {
+			r.report(checkFail, "recipients", "repository is encrypted for a shared passphrase: %v", err)
+		} else {
+			r.report(checkOK, "recipients", "repository is encrypted for a shared passphrase, the passphrase is available")
+		}
+		return
+	}
+
+	recipients, err := recipientsFile.All()
+	switch {
+	case errors.Is(err, infrastructure.ErrAllRecipientsExpired):
+		r.report(checkFail, "recipients", "all recipients of %s are expired, add a recipient or extend its expiry", ports.RecipientsFileName)
+		return
+	case errors.Is(err, infrastructure.ErrNoRecipients) || err == nil && len(recipients) == 0:
+		if ref, refErr := recipientsFile.Ref(); refErr == nil && ref != "" {
+			r.report(checkWarn, "recipients", "section [%s] of %s used on the current branch is empty", ref, ports.RecipientsFileName)
+		} else {
+			r.report(checkWarn, "recipients", "%s is missing or empty, files are committed as plain text", ports.RecipientsFileName)
+		}
+		return
+	case err != nil:
+		r.report(checkFail, "recipients", "failed to parse %s: %v", ports.RecipientsFileName, err)
+		return
+	}
+
+	var postQuantum int
+	for _, recipient := range recipients {
+		if _, ok := recipient.(*age.HybridRecipient); ok {
+			postQuantum++
+		}
+	}
+
+	if postQuantum > 0 && postQuantum < len(recipients) {
+		r.report(
+			checkFail,
+			"recipients",
+			"%d of %d recipients are post-quantum, age refuses to mix them with classic recipients - rotate the classic keys",
+			postQuantum, len(recipients),
+		)
+	}
+
+	var matching int
+	for _, recipient := range recipients {
+		if canDecrypt(recipient, ids) {
+			matching++
+		}
+	}
+
+	if matching == 0 {
+		r.report(checkFail, "recipients", "none of your identities matches any of the %d recipients", len(recipients))
+		return
+	}
+
+	r.report(checkOK, "recipients", "your identities match %d of %d recipients", matching, len(recipients))
+}
+
+type doctorReport struct {
+	out      io.Writer
+	failures int
+}
+
+func (r *doctorReport) report(status checkStatus, check, format string, args ...any) {
+	if status == checkFail {
+		r.failures++
+	}
+
+	_, _ = fmt.Fprintf(r.out, "%-4s  %-14s %s\n", status, check, fmt.Sprintf(format, args...))
+}
+
+// canDecrypt encrypts a probe for the given recipient and tries to open it with the given identities,
+// this way every kind of identity is supported without knowing how to derive its recipient.
+func canDecrypt(recipient age.Recipient, ids []age.Identity) bool {
+	if len(ids) == 0 {
+		return false
+	}
+
+	buf := new(bytes.Buffer)
+
+	w, err := age.Encrypt(buf, recipient)
+	if err != nil {
+		return false
+	}
+
+	if err := w.Close(); err != nil {
+		return false
+	}
+
+	_, err = age.Decrypt(buf, ids...)
+
+	return err == nil
+}
@@ -0,0 +1,155 @@
+package cli_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/alecthomas/kong"
+
+	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/handlers/cli"
+	"github.com/prskr/git-age/internal/testx"
+)
+
+func TestDoctorCliHandler_Run(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		gitConfig  string
+		attributes string
+		// recipients replaces the recipients file, %s is replaced with a new recipient
+		recipients string
+		foreignKey bool
+		wantErr    error
+		wantLines  []string
+	}{
+		{
+			name:      "Healthy setup",
+			gitConfig: "[filter \"age\"]\n\tclean = %[1]q clean -- %%f\n\tsmudge = %[1]q smudge -- %%f\n\trequired = true\n",
+			wantLines: []string{
+				"ok    filter",
+				"ok    attributes     1 pattern(s) match 2 file(s)",
+				"skip  agent          not configured",
+				"ok    file:",
+				"keys.txt 1 identities",
+				"ok    recipients     your identities match 1 of 1 recipients",
+			},
+		},
+		{
+			name:       "Missing filter and foreign identity",
+			foreignKey: true,
+			wantErr:    cli.ErrDoctorChecksFailed,
+			wantLines: []string{
+				"fail  filter         filter.age is not configured",
+				"fail  recipients     none of your identities matches any of the 1 recipients",
+			},
+		},
+		{
+			name:       "Optional filter and unmatched pattern",
+			gitConfig:  "[filter \"age\"]\n\tclean = %[1]q clean -- %%f\n\tsmudge = %[1]q smudge -- %%f\n",
+			attributes: "secrets/*.yaml filter=age\n",
+			wantLines: []string{
+				"warn  filter         filter.age.required is not set",
+				"warn  attributes     .gitattributes:2: secrets/*.yaml does not match any file",
+			},
+		},
+		{
+			name:       "Empty recipients file",
+			recipients: "\n",
+			wantErr:    cli.ErrDoctorChecksFailed,
+			wantLines: []string{
+				"warn  recipients     .agerecipients is missing or empty, files are committed as plain text",
+			},
+		},
+		{
+			name:       "Expired recipients",
+			recipients: "# expires: 2020-01-31\n%s\n",
+			wantErr:    cli.ErrDoctorChecksFailed,
+			wantLines: []string{
+				"fail  recipients     all recipients of .agerecipients are expired, add a recipient or extend its expiry",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			setup := prepareTestRepo(t)
+			globalConfig := filepath.Join(t.TempDir(), "gitconfig")
+
+			gitConfig := ""
+			if tt.gitConfig != "" {
+				// the test binary is an executable that is guaranteed to exist
+				gitConfig = fmt.Sprintf(tt.gitConfig, filepath.ToSlash(testx.ResultOf(t, os.Executable)))
+			}
+
+			if err := os.WriteFile(globalConfig, []byte(gitConfig), 0o600); err != nil {
+				t.Fatalf("failed to write git config: %v", err)
+			}
+
+			if tt.attributes != "" {
+				attributesPath := filepath.Join(setup.root, ".gitattributes")
+				attributes := append(testx.ResultOfA[[]byte](t, os.ReadFile, attributesPath), tt.attributes...)
+				if err := os.WriteFile(attributesPath, attributes, 0o600); err != nil {
+					t.Fatalf("failed to write .gitattributes: %v", err)
+				}
+			}
+
+			if tt.recipients != "" {
+				recipient := testx.ResultOf(t, age.GenerateX25519Identity).Recipient().String()
+				recipients := strings.ReplaceAll(tt.recipients, "%s", recipient)
+				if err := os.WriteFile(filepath.Join(setup.root, ports.RecipientsFileName), []byte(recipients), 0o600); err != nil {
+					t.Fatalf("failed to write recipients file: %v", err)
+				}
+			}
+
+			keysPath := filepath.Join(setup.root, "keys.txt")
+			if tt.foreignKey {
+				keysPath = filepath.Join(t.TempDir(), "keys.txt")
+				id := testx.ResultOf(t, age.GenerateX25519Identity)
+				if err := os.WriteFile(keysPath, []byte(id.String()+"\n"), 0o600); err != nil {
+					t.Fatalf("failed to write keys file: %v", err)
+				}
+			}
+
+			env := ports.OSEnv{
+				"GIT_CONFIG_NOSYSTEM": "1",
+				"GIT_CONFIG_GLOBAL":   globalConfig,
+			}
+
+			outBuf := new(bytes.Buffer)
+			parser := newKong(
+				t,
+				new(cli.DoctorCliHandler),
+				kong.Bind(ports.CWD(setup.root)),
+				kong.BindTo(testx.Context(t), (*context.Context)(nil)),
+				kong.BindTo(ports.STDOUT(outBuf), (*ports.STDOUT)(nil)),
+				kong.Bind(env),
+			)
+
+			ctx, err := parser.Parse([]string{"--keys", keysPath})
+			if err != nil {
+				t.Fatalf("failed to parse arguments: %v", err)
+			}
+
+			if err := ctx.Run(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Run() error = %v, wantErr %v\n%s", err, tt.wantErr, outBuf.String())
+			}
+
+			for _, want := range tt.wantLines {
+				if !strings.Contains(outBuf.String(), want) {
+					t.Errorf("expected output to contain %q, got:\n%s", want, outBuf.String())
+				}
+			}
+		})
+	}
+}
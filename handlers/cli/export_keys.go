@@ -0,0 +1,167 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"slices"
+
+	"filippo.io/age"
+
+	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/core/services"
+	"github.com/prskr/git-age/infrastructure"
+)
+
+// exportToPassphrase selects a passphrase instead of a recipient to encrypt the bundle for.
+const exportToPassphrase = "passphrase"
+
+var (
+	ErrNoIdentitiesToExport    = errors.New("no identities to export")
+	ErrUnsupportedExportTarget = errors.New("bundles can only be exported to X25519, hybrid or SSH recipients or a passphrase")
+)
+
+//nolint:lll // doesn't make sense to break tags in struct
+type ExportKeysCliHandler struct {
+	KeysFlag   `embed:""`
+	RemoteFlag `embed:""`
+	PublicKeys []string `arg:"" optional:"" name:"public-key" help:"Public keys of the identities to export, defaults to all identities"`
+	Stores     []string `name:"store" help:"Identities store(s) to export identities from, defaults to all stores"`
+	To         string   `required:"" help:"Recipient to encrypt the bundle for or 'passphrase'"`
+	Passphrase string   `env:"GIT_AGE_BUNDLE_PASSPHRASE" help:"Passphrase to encrypt the bundle with if exported to a passphrase, generated if empty"`
+	Armor      bool     `help:"Encode the bundle in ASCII armor"`
+	Paper      bool     `help:"Print a checksummed backup suitable for printing, implies --armor"`
+	Output     string   `short:"o" help:"File to write the bundle to, defaults to stdout"`
+
+	Identities *services.IdentitiesStoreChain `kong:"-"`
+}
+
+func (h *ExportKeysCliHandler) Run(ctx context.Context, stdout ports.STDOUT, stderr ports.STDERR) (err error) {
+	entries, err := h.selectedEntries(ctx)
+	if err != nil {
+		return err
+	}
+
+	recipient, err := h.recipient(stderr)
+	if err != nil {
+		return err
+	}
+
+	bundle := new(bytes.Buffer)
+	if err := infrastructure.SealKeyBundle(bundle, entries, h.Armor || h.Paper, recipient); err != nil {
+		return err
+	}
+
+	var out io.Writer = stdout
+	if h.Output != "" {
+		outFile, err := os.OpenFile(h.Output, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+		if err != nil {
+			return fmt.Errorf("failed to open output file: %w", err)
+		}
+
+		defer func() {
+			err = errors.Join(err, outFile.Close())
+		}()
+
+		out = outFile
+	}
+
+	if h.Paper {
+		publicKeys := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			publicKeys = append(publicKeys, entry.Identity.Recipient().String())
+		}
+
+		return infrastructure.WritePaperBackup(out, bundle.Bytes(), publicKeys)
+	}
+
+	_, err = out.Write(bundle.Bytes())
+
+	return err
+}
+
+func (h *ExportKeysCliHandler) AfterApply(ctx context.Context, cwd ports.CWD, env ports.OSEnv) error {
+	idStore, err := h.identitiesStore(ctx, cwd, env)
+	if err != nil {
+		return fmt.Errorf("failed to init identities store: %w", err)
+	}
+
+	h.Identities = idStore
+	return nil
+}
+
+// selectedEntries collects the identities of the selected stores, optionally filtered by public key.
+func (h *ExportKeysCliHandler) selectedEntries(ctx context.Context) ([]infrastructure.KeyBundleEntry, error) {
+	stores := h.Identities.Stores
+	if len(h.Stores) > 0 {
+		selected, err := h.Identities.Select(h.Stores...)
+		if err != nil {
+			return nil, err
+		}
+
+		stores = selected
+	}
+
+	chain := services.NewIdentitiesStoreChain(
+		services.WithStores(stores...),
+		services.WithStoreTimeout(h.StoreTimeout),
+		services.WithTolerateUnavailableStores(h.TolerateUnavailableStores),
+	)
+
+	ids, err := chain.Identities(ctx, ports.IdentitiesQuery{Remotes: []string{h.Remote}})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get identities: %w", err)
+	}
+
+	var (
+		entries = make([]infrastructure.KeyBundleEntry, 0, len(ids))
+		seen    = make(map[string]bool, len(ids))
+	)
+
+	for _, id := range ids {
+		wrapped, ok := ports.WrapIdentity(id)
+		if !ok {
+			slog.WarnContext(ctx, "Skipping identity that cannot be exported", slog.String("type", fmt.Sprintf("%T", id)))
+			continue
+		}
+
+		publicKey := wrapped.Recipient().String()
+		if seen[publicKey] || (len(h.PublicKeys) > 0 && !slices.Contains(h.PublicKeys, publicKey)) {
+			continue
+		}
+
+		seen[publicKey] = true
+		entries = append(entries, infrastructure.KeyBundleEntry{Identity: wrapped, Remote: h.Remote})
+	}
+
+	if len(entries) == 0 {
+		return nil, ErrNoIdentitiesToExport
+	}
+
+	return entries, nil
+}
+
+func (h *ExportKeysCliHandler) recipient(stderr ports.STDERR) (age.Recipient, error) {
+	if h.To != exportToPassphrase {
+		recipient, _, err := infrastructure.ParseRecipient(h.To)
+		if err != nil {
+			return nil, err
+		} else if recipient == nil {
+			return nil, ErrUnsupportedExportTarget
+		}
+
+		return recipient, nil
+	}
+
+	if h.Passphrase == "" {
+		h.Passphrase = rand.Text()
+		_, _ = fmt.Fprintf(stderr, "Generated passphrase: %s\n", h.Passphrase)
+	}
+
+	return age.NewScryptRecipient(h.Passphrase)
+}
@@ -0,0 +1,174 @@
+package cli_test
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/alecthomas/kong"
+
+	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/handlers/cli"
+	"github.com/prskr/git-age/internal/testx"
+)
+
+func TestExportKeysCliHandler_Run(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		// toMachine exports the bundle to the key already present on the new machine
+		toMachine  bool
+		args       []string
+		importArgs []string
+		wantPrefix string
+	}{
+		{
+			name:       "Passphrase armored",
+			args:       []string{"--to", "passphrase", "--passphrase", "correct horse battery staple", "--armor"},
+			importArgs: []string{"--passphrase", "correct horse battery staple"},
+			wantPrefix: "-----BEGIN AGE ENCRYPTED FILE-----",
+		},
+		{
+			name:       "Paper backup",
+			args:       []string{"--to", "passphrase", "--passphrase", "correct horse battery staple", "--paper"},
+			importArgs: []string{"--passphrase", "correct horse battery staple"},
+			wantPrefix: "git-age paper backup",
+		},
+		{
+			name:       "Recipient of the new machine",
+			toMachine:  true,
+			wantPrefix: "age-encryption.org/v1",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				tmpDir     = t.TempDir()
+				oldKeys    = filepath.Join(tmpDir, "old", "keys.txt")
+				newKeys    = filepath.Join(tmpDir, "new", "keys.txt")
+				bundlePath = filepath.Join(tmpDir, "bundle")
+			)
+
+			exported := testx.ResultOf(t, age.GenerateX25519Identity)
+			writeKeysFile(t, oldKeys, "# created: 2026-01-02T15:04:05Z\n"+exported.String()+"\n")
+
+			machineID := testx.ResultOf(t, age.GenerateX25519Identity)
+			writeKeysFile(t, newKeys, machineID.String()+"\n")
+
+			args := append([]string{"-k", "file:///" + filepath.ToSlash(oldKeys), "-o", bundlePath}, tt.args...)
+			if tt.toMachine {
+				args = append(args, "--to", machineID.Recipient().String())
+			}
+
+			runKeysCommand(t, new(cli.ExportKeysCliHandler), args...)
+
+			bundle, err := os.ReadFile(bundlePath)
+			if err != nil {
+				t.Fatalf("failed to read bundle: %v", err)
+			}
+
+			if !bytes.HasPrefix(bundle, []byte(tt.wantPrefix)) {
+				t.Errorf("expected bundle to start with %q, got %.40q", tt.wantPrefix, bundle)
+			}
+
+			if bytes.Contains(bundle, []byte(exported.String())) {
+				t.Fatalf("bundle must not contain the plain identity")
+			}
+
+			importArgs := append([]string{"-k", "file:///" + filepath.ToSlash(newKeys)}, tt.importArgs...)
+			stdout := runKeysCommand(t, new(cli.ImportKeysCliHandler), append(importArgs, bundlePath)...)
+
+			if !strings.Contains(stdout, exported.Recipient().String()) {
+				t.Errorf("expected imported public key in output, got %q", stdout)
+			}
+
+			// importing the same bundle twice must not duplicate the identity
+			runKeysCommand(t, new(cli.ImportKeysCliHandler), append(importArgs, bundlePath)...)
+
+			imported, err := os.ReadFile(newKeys)
+			if err != nil {
+				t.Fatalf("failed to read keys file: %v", err)
+			}
+
+			if got := strings.Count(string(imported), exported.String()); got != 1 {
+				t.Errorf("expected identity to be imported once, found it %d times", got)
+			}
+		})
+	}
+}
+
+func TestImportKeysCliHandler_Run_AgeKeygen(t *testing.T) {
+	t.Parallel()
+
+	var (
+		tmpDir     = t.TempDir()
+		keysPath   = filepath.Join(tmpDir, "keys.txt")
+		keygenPath = filepath.Join(tmpDir, "key.txt")
+	)
+
+	id := testx.ResultOf(t, age.GenerateX25519Identity)
+	writeKeysFile(t, keygenPath, strings.Join([]string{
+		"# created: 2026-01-02T15:04:05Z",
+		"# public key: " + id.Recipient().String(),
+		id.String(),
+	}, "\n"))
+
+	runKeysCommand(t, new(cli.ImportKeysCliHandler), "-k", "file:///"+filepath.ToSlash(keysPath), keygenPath)
+
+	imported, err := os.ReadFile(keysPath)
+	if err != nil {
+		t.Fatalf("failed to read keys file: %v", err)
+	}
+
+	for _, want := range []string{"# created: 2026-01-02T15:04:05Z", id.String()} {
+		if !strings.Contains(string(imported), want) {
+			t.Errorf("expected keys file to contain %q, got %q", want, imported)
+		}
+	}
+}
+
+func runKeysCommand(t *testing.T, handler any, args ...string) string {
+	t.Helper()
+
+	stdout := new(bytes.Buffer)
+	parser := newKong(
+		t,
+		handler,
+		kong.BindTo(testx.Context(t), (*context.Context)(nil)),
+		kong.BindTo(ports.STDOUT(stdout), (*ports.STDOUT)(nil)),
+		kong.BindTo(ports.STDERR(new(bytes.Buffer)), (*ports.STDERR)(nil)),
+		kong.Bind(ports.NewOSEnv()),
+		kong.Bind(ports.CWD(t.TempDir())),
+	)
+
+	kongCtx, err := parser.Parse(args)
+	if err != nil {
+		t.Fatalf("failed to parse arguments: %v", err)
+	}
+
+	if err := kongCtx.Run(); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	return stdout.String()
+}
+
+func writeKeysFile(tb testing.TB, filePath, content string) {
+	tb.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o700); err != nil {
+		tb.Fatalf("failed to create keys directory: %v", err)
+	}
+
+	if err := os.WriteFile(filePath, []byte(content), 0o600); err != nil {
+		tb.Fatalf("failed to write keys file: %v", err)
+	}
+}
@@ -84,6 +84,7 @@ type ReEncryptFilesCliHandler struct {
 }
 
 func (h ReEncryptFilesCliHandler) Run(
+	cwd ports.CWD,
 	repo ports.GitRepository,
 	repoFS ports.ReadWriteFS,
 	sealer ports.FileOpenSealer,
@@ -104,7 +105,12 @@ func (h ReEncryptFilesCliHandler) Run(
 		return fmt.Errorf("failed to commit changes: %w", err)
 	}
 
-	return nil
+	marker, err := infrastructure.NewReEncryptMarker(cwd)
+	if err != nil {
+		return err
+	}
+
+	return marker.Clear()
 }
 
 type FilesCliHandler struct {
@@ -132,33 +138,17 @@ func (h *FilesCliHandler) AfterApply(ctx context.Context, kongCtx *kong.Context,
 		return err
 	}
 
-	idStore, err := infrastructure.IdentitiesStore(
-		ctx,
-		infrastructure.NewAgentIdentitiesStoreSource(env),
-		infrastructure.NewFileIdentityStoreSource(h.Keys),
-	)
+	recipients, err := verifiedRecipientsFile(cwd, repoFS)
 	if err != nil {
-		return fmt.Errorf("failed to init identities store: %w", err)
-	}
-
-	remotes, err := gitRepo.Remotes()
-	if err != nil {
-		return fmt.Errorf("failed to determine Git remotes: %w", err)
-	}
-
-	query := ports.IdentitiesQuery{
-		Remotes: remotes,
+		return err
 	}
 
-	ids, err := idStore.Identities(ctx, query)
+	idStore, err := h.identitiesStore(ctx, cwd, env)
 	if err != nil {
-		return fmt.Errorf("failed to get identities: %w", err)
+		return fmt.Errorf("failed to init identities store: %w", err)
 	}
 
-	sealer, err := services.NewAgeSealer(
-		services.WithIdentities(ids...),
-		services.WithRecipients(infrastructure.NewRecipientsFile(repoFS)),
-	)
+	sealer, err := repoSealer(ctx, idStore, gitRepo, recipients)
 	if err != nil {
 		return err
 	}
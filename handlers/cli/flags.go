@@ -1,13 +1,80 @@
 package cli
 
 import (
-	"net/url"
+	"context"
+	"time"
 
 	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/core/services"
+	"github.com/prskr/git-age/infrastructure"
 )
 
+//nolint:lll // doesn't make sense to break tags in struct
 type KeysFlag struct {
-	Keys *url.URL `env:"GIT_AGE_KEYS" name:"keys" short:"k" default:"file:///${XDG_CONFIG_HOME}/git-age/keys.txt"`
+	Keys                      []string      `env:"GIT_AGE_KEYS" config:"keys" name:"keys" short:"k" sep:"none" default:"file:///${XDG_CONFIG_HOME}/git-age/keys.txt" help:"Keys source(s) e.g. file://, env://VAR, fd://N or cmd://helper, can be repeated or colon separated"`
+	StoreTimeout              time.Duration `env:"GIT_AGE_STORE_TIMEOUT" config:"storeTimeout" name:"store-timeout" default:"10s" help:"Timeout for every single identities store"`
+	TolerateUnavailableStores bool          `env:"GIT_AGE_TOLERATE_UNAVAILABLE_STORES" config:"tolerateUnavailableStores" name:"tolerate-unavailable-stores" help:"Ignore unavailable identities stores"`
+}
+
+func (f KeysFlag) identitiesStore(ctx context.Context, cwd ports.CWD, env ports.OSEnv) (*services.IdentitiesStoreChain, error) {
+	return f.identitiesStoreOf(ctx, env, infrastructure.NewAgentIdentitiesStoreSource(cwd, env))
+}
+
+// localIdentitiesStore is the identities store without the agent, for the agent itself.
+func (f KeysFlag) localIdentitiesStore(ctx context.Context, env ports.OSEnv) (*services.IdentitiesStoreChain, error) {
+	return f.identitiesStoreOf(ctx, env)
+}
+
+func (f KeysFlag) identitiesStoreOf(
+	ctx context.Context,
+	env ports.OSEnv,
+	sources ...infrastructure.IdentityStoreSource,
+) (*services.IdentitiesStoreChain, error) {
+	keysSources, err := infrastructure.KeysSources(env, f.Keys...)
+	if err != nil {
+		return nil, err
+	}
+
+	sources = append(sources, infrastructure.NewCommandIdentitiesStoreSource(env))
+	sources = append(sources, keysSources...)
+
+	return infrastructure.IdentitiesStore(
+		ctx,
+		[]services.IdentitiesStoreChainOption{
+			services.WithStoreTimeout(f.StoreTimeout),
+			services.WithTolerateUnavailableStores(f.TolerateUnavailableStores),
+		},
+		sources...,
+	)
+}
+
+//nolint:lll // doesn't make sense to break tags in struct
+type SigningKeyFlag struct {
+	SigningKey string `env:"GIT_AGE_SIGNING_KEY" config:"signingKey" name:"signing-key" help:"SSH key to sign the recipients file with, a public key or passphrase protected key is used via the ssh-agent"`
+}
+
+// recipientsFile returns the recipients file of the repository, signed with the signing key if one is configured.
+func (f SigningKeyFlag) recipientsFile(
+	cwd ports.CWD,
+	env ports.OSEnv,
+	repoFS ports.ReadWriteFS,
+) (*infrastructure.RecipientsFile, error) {
+	recipients, err := verifiedRecipientsFile(cwd, repoFS)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.SigningKey != "" {
+		if recipients.SigningKey, err = infrastructure.LoadSSHSigner(f.SigningKey, env); err != nil {
+			return nil, err
+		}
+	}
+
+	return recipients, nil
+}
+
+type ExpiresFlag struct {
+	Expires string `name:"expires" placeholder:"YYYY-MM-DD" help:"Last day files are encrypted for the recipient"`
 }
 
 type CommentFlag struct {
@@ -19,5 +86,9 @@ type RemoteFlag struct {
 }
 
 type AlgorithmFlag struct {
-	Algorithm ports.IdentityAlgorithm `short:"a" name:"algorithm" help:"Algorithm to use for key generation" default:"hybrid"`
+	Algorithm ports.IdentityAlgorithm `config:"algorithm" short:"a" name:"algorithm" help:"Algorithm to use for key generation" default:"hybrid"`
+}
+
+type StoreFlag struct {
+	Stores []string `name:"store" help:"Identities store(s) to persist the key in by name, kind or label e.g. agent, file or file:backup, defaults to the first store"`
 }
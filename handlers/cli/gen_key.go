@@ -3,9 +3,10 @@ package cli
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/prskr/git-age/core/ports"
-	"github.com/prskr/git-age/infrastructure"
+	"github.com/prskr/git-age/core/services"
 )
 
 type GenKeyCliHandler struct {
@@ -13,33 +14,32 @@ type GenKeyCliHandler struct {
 	CommentFlag   `embed:""`
 	RemoteFlag    `embed:""`
 	AlgorithmFlag `embed:""`
+	StoreFlag     `embed:""`
 
-	Identities ports.IdentitiesStore `kong:"-"`
+	Identities *services.IdentitiesStoreChain `kong:"-"`
 }
 
-func (h *GenKeyCliHandler) Run(ctx context.Context, stdout ports.STDOUT) (err error) {
+func (h *GenKeyCliHandler) Run(ctx context.Context, stdout ports.STDOUT, stderr ports.STDERR) (err error) {
 	cmd := ports.GenerateIdentityCommand{
 		Comment:   h.Comment,
 		Remote:    h.Remote,
 		Algorithm: h.Algorithm,
+		Stores:    h.Stores,
 	}
 
-	pubKey, err := h.Identities.Generate(ctx, cmd)
+	pubKey, storedIn, err := h.Identities.GenerateTo(ctx, cmd)
 	if err != nil {
 		return fmt.Errorf("failed to generate identity: %w", err)
 	}
 
+	_, _ = fmt.Fprintf(stderr, "Stored identity in: %s\n", strings.Join(storedIn, ", "))
 	_, err = fmt.Fprintln(stdout, pubKey)
 
 	return err
 }
 
-func (h *GenKeyCliHandler) AfterApply(ctx context.Context, env ports.OSEnv) error {
-	idStore, err := infrastructure.IdentitiesStore(
-		ctx,
-		infrastructure.NewAgentIdentitiesStoreSource(env),
-		infrastructure.NewFileIdentityStoreSource(h.Keys),
-	)
+func (h *GenKeyCliHandler) AfterApply(ctx context.Context, cwd ports.CWD, env ports.OSEnv) error {
+	idStore, err := h.identitiesStore(ctx, cwd, env)
 	if err != nil {
 		return fmt.Errorf("failed to init identities store: %w", err)
 	}
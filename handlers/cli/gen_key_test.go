@@ -3,7 +3,10 @@ package cli_test
 import (
 	"bytes"
 	"context"
+	"errors"
+	"io"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"filippo.io/age"
@@ -11,6 +14,7 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/core/services"
 	"github.com/prskr/git-age/handlers/cli"
 	"github.com/prskr/git-age/internal/testx"
 )
@@ -36,7 +40,9 @@ func TestGenKeyCliHandler_Run(t *testing.T) {
 		new(cli.GenKeyCliHandler),
 		kong.BindTo(testx.Context(t), (*context.Context)(nil)),
 		kong.BindTo(ports.STDOUT(outBuf), (*ports.STDOUT)(nil)),
+		kong.BindTo(ports.STDERR(io.Discard), (*ports.STDERR)(nil)),
 		kong.Bind(ports.NewOSEnv()),
+		kong.Bind(ports.CWD(t.TempDir())),
 	)
 
 	args := []string{
@@ -72,3 +78,64 @@ func TestGenKeyCliHandler_Run(t *testing.T) {
 		t.Errorf("failed to parse recipients: %v", err)
 	}
 }
+
+func TestGenKeyCliHandler_Store(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		stores     []string
+		wantStored string
+		wantErr    error
+	}{
+		{
+			name:       "Default store",
+			wantStored: "Stored identity in: file",
+		},
+		{
+			name:       "Explicit file store",
+			stores:     []string{"file"},
+			wantStored: "Stored identity in: file",
+		},
+		{
+			name:    "Unknown store",
+			stores:  []string{"vault"},
+			wantErr: services.ErrUnknownStore,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			errBuf := new(bytes.Buffer)
+
+			parser := newKong(
+				t,
+				new(cli.GenKeyCliHandler),
+				kong.BindTo(testx.Context(t), (*context.Context)(nil)),
+				kong.BindTo(ports.STDOUT(io.Discard), (*ports.STDOUT)(nil)),
+				kong.BindTo(ports.STDERR(errBuf), (*ports.STDERR)(nil)),
+				kong.Bind(ports.NewOSEnv()),
+				kong.Bind(ports.CWD(t.TempDir())),
+			)
+
+			args := []string{"-k", "file:///" + filepath.ToSlash(filepath.Join(t.TempDir(), "keys.txt"))}
+			for _, store := range tt.stores {
+				args = append(args, "--store", store)
+			}
+
+			kongCtx, err := parser.Parse(args)
+			if !assert.NoError(t, err, "failed to parse arguments") {
+				return
+			}
+
+			if err := kongCtx.Run(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Run() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			assert.Contains(t, errBuf.String(), tt.wantStored)
+		})
+	}
+}
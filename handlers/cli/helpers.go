@@ -0,0 +1,141 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"time"
+
+	"filippo.io/age"
+
+	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/core/services"
+	"github.com/prskr/git-age/infrastructure"
+)
+
+var ErrExpiryNotSupported = errors.New("recipients do not support expiry dates")
+
+// unlockPassphrase looks up the shared passphrase if the repository is encrypted for a passphrase,
+// configures the recipients file with it and returns the matching identity.
+// For all other repositories it does nothing.
+func unlockPassphrase(
+	ctx context.Context,
+	idStore ports.PassphraseStore,
+	recipients *infrastructure.RecipientsFile,
+	query ports.IdentitiesQuery,
+) ([]age.Identity, error) {
+	if protected, err := recipients.IsPassphraseProtected(); err != nil || !protected {
+		return nil, err
+	}
+
+	passphrase, err := idStore.Passphrase(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("repository is encrypted for a shared passphrase: %w", err)
+	}
+
+	recipients.Passphrase = passphrase
+
+	id, err := age.NewScryptIdentity(passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	return []age.Identity{id}, nil
+}
+
+// repoSealer builds a sealer for the identities known to the stores and the recipients of the repository,
+// for repositories encrypted for a shared passphrase the passphrase is unlocked as well.
+func repoSealer(
+	ctx context.Context,
+	idStore *services.IdentitiesStoreChain,
+	repo *infrastructure.GitRepository,
+	recipients *infrastructure.RecipientsFile,
+) (*services.AgeSealer, error) {
+	remotes, err := repo.Remotes()
+	if err != nil {
+		return nil, fmt.Errorf("failed to determine Git remotes: %w", err)
+	}
+
+	query := ports.IdentitiesQuery{
+		Remotes: remotes,
+	}
+
+	ids, err := idStore.Identities(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get identities: %w", err)
+	}
+
+	passphraseIDs, err := unlockPassphrase(ctx, idStore, recipients, query)
+	if err != nil {
+		return nil, err
+	}
+
+	return services.NewAgeSealer(
+		services.WithIdentities(append(ids, passphraseIDs...)...),
+		services.WithRecipients(recipients),
+	)
+}
+
+// verifiedRecipientsFile returns the recipients file of the repository
+// whose signature is verified against the trusted signers of the repository.
+func verifiedRecipientsFile(cwd ports.CWD, repoFS ports.ReadWriteFS) (*infrastructure.RecipientsFile, error) {
+	trustedSigners, err := infrastructure.NewTrustedSigners(cwd)
+	if err != nil {
+		return nil, err
+	}
+
+	repo, _, err := infrastructure.NewGitRepositoryFromPath(cwd)
+	if err != nil {
+		return nil, err
+	}
+
+	recipients := infrastructure.NewRecipientsFile(repoFS)
+	recipients.TrustedSigners = trustedSigners
+	// sections of the recipients file are picked by the current branch
+	recipients.Head = repo
+
+	return recipients, nil
+}
+
+// stageRecipients stages the recipients file and its signature if the repository is signed.
+func stageRecipients(repo ports.GitRepository, repoFS ports.ReadWriteFS) error {
+	slog.Info("Staging recipients file")
+
+	files := []string{ports.RecipientsFileName}
+	if _, err := fs.Stat(repoFS, ports.RecipientsSignatureFileName); err == nil {
+		files = append(files, ports.RecipientsSignatureFileName)
+	}
+
+	for _, file := range files {
+		if err := repo.StageFile(file); err != nil {
+			return fmt.Errorf("failed to add %s to git index: %w", file, err)
+		}
+	}
+
+	return nil
+}
+
+// appendRecipient appends the recipient, annotated with the expiry date (YYYY-MM-DD) if one is given.
+func appendRecipient(recipients ports.Recipients, pubKey, comment, expires string) ([]age.Recipient, error) {
+	if expires == "" {
+		return recipients.Append(pubKey, comment)
+	}
+
+	lastDay, err := time.Parse(time.DateOnly, expires)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", infrastructure.ErrInvalidRecipientExpiry, err)
+	}
+
+	if (infrastructure.RecipientEntry{Expires: lastDay}).IsExpired(time.Now()) {
+		return nil, fmt.Errorf("%w: %s is in the past", infrastructure.ErrInvalidRecipientExpiry, expires)
+	}
+
+	expiring, ok := recipients.(ports.ExpiringRecipients)
+	if !ok {
+		return nil, ErrExpiryNotSupported
+	}
+
+	return expiring.AppendExpiring(pubKey, comment, lastDay)
+}
@@ -0,0 +1,257 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/alecthomas/kong"
+
+	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/core/services"
+	"github.com/prskr/git-age/infrastructure"
+)
+
+var ErrRecipientsDrift = errors.New("files are not encrypted for the current recipients")
+
+type HooksCliHandler struct {
+	Install   HooksInstallCliHandler   `cmd:"" name:"install" help:"Install hooks checking for files encrypted for outdated recipients"`
+	Uninstall HooksUninstallCliHandler `cmd:"" name:"uninstall" help:"Remove the hooks installed by git-age"`
+	Check     HooksCheckCliHandler     `cmd:"" name:"check" help:"List files encrypted for other recipients than the current ones"`
+}
+
+func (h *HooksCliHandler) AfterApply(kongCtx *kong.Context, cwd ports.CWD) error {
+	gitRepo, repoFS, err := infrastructure.NewGitRepositoryFromPath(cwd)
+	if err != nil {
+		return err
+	}
+
+	hooks, err := infrastructure.NewGitHooks(cwd, gitRepo.Repository)
+	if err != nil {
+		return err
+	}
+
+	kongCtx.Bind(gitRepo)
+	kongCtx.BindTo(repoFS, (*ports.ReadWriteFS)(nil))
+	kongCtx.Bind(hooks)
+
+	return nil
+}
+
+type HooksInstallCliHandler struct {
+	Force bool `name:"force" help:"Replace hooks installed by other tools"`
+}
+
+func (h HooksInstallCliHandler) Run(stdout ports.STDOUT, hooks *infrastructure.GitHooks) error {
+	installed, err := hooks.Install(h.Force)
+	for _, hookPath := range installed {
+		_, _ = fmt.Fprintf(stdout, "Installed %s\n", hookPath)
+	}
+
+	if errors.Is(err, infrastructure.ErrForeignHook) {
+		return fmt.Errorf("%w, pass --force to replace it", err)
+	}
+
+	return err
+}
+
+type HooksUninstallCliHandler struct{}
+
+func (HooksUninstallCliHandler) Run(stdout ports.STDOUT, hooks *infrastructure.GitHooks) error {
+	removed, err := hooks.Uninstall()
+	for _, hookPath := range removed {
+		_, _ = fmt.Fprintf(stdout, "Removed %s\n", hookPath)
+	}
+
+	return err
+}
+
+//nolint:lll // doesn't make sense to break tags in struct
+type HooksCheckCliHandler struct {
+	KeysFlag  `embed:""`
+	ReEncrypt bool     `env:"GIT_AGE_AUTO_REENCRYPT" config:"autoReEncrypt" name:"re-encrypt" help:"Re-encrypt and commit the outdated files if the working tree is clean"`
+	Message   string   `help:"Message to be used for the commit" default:"chore: re-encrypt secret files for current recipients" short:"m"`
+	Hook      string   `name:"hook" hidden:"" help:"Name of the hook running the check"`
+	HookArgs  []string `arg:"" optional:"" hidden:"" help:"Arguments passed to the hook"`
+}
+
+func (h *HooksCheckCliHandler) Run(
+	ctx context.Context,
+	stdout ports.STDOUT,
+	cwd ports.CWD,
+	env ports.OSEnv,
+	repo *infrastructure.GitRepository,
+	repoFS ports.ReadWriteFS,
+) error {
+	if skip, err := h.skipHook(repo); err != nil || skip {
+		return err
+	}
+
+	recipients, err := verifiedRecipientsFile(cwd, repoFS)
+	if err != nil {
+		return err
+	}
+
+	expected, err := expectedStanzaTypes(recipients)
+	if err != nil || expected == nil {
+		return err
+	}
+
+	var drifted []services.DriftedFile
+
+	err = repo.WalkAgeFiles(services.DriftWalkFunc(repo, expected, func(file services.DriftedFile) {
+		drifted = append(drifted, file)
+	}))
+	if err != nil {
+		return err
+	}
+
+	if len(drifted) == 0 {
+		if h.Hook == "" {
+			_, err = fmt.Fprintln(stdout, "All files are encrypted for the current recipients")
+		}
+		return err
+	}
+
+	_, _ = fmt.Fprintf(stdout, "Files encrypted for outdated recipients, expected %s:\n", formatStanzaTypes(expected))
+	for _, file := range drifted {
+		_, _ = fmt.Fprintf(stdout, "  %s (%s)\n", file.Path, formatStanzaTypes(file.Stanzas))
+	}
+
+	if h.ReEncrypt {
+		reEncrypted, err := h.reEncrypt(ctx, env, cwd, repo, repoFS, recipients, drifted)
+		if err != nil || reEncrypted {
+			return err
+		}
+	}
+
+	_, _ = fmt.Fprintln(stdout, "Run 'git age files re-encrypt' to re-encrypt them")
+
+	// hooks only inform, they can't undo the checkout or merge anyway
+	if h.Hook != "" {
+		return nil
+	}
+
+	return fmt.Errorf("%w: %d files", ErrRecipientsDrift, len(drifted))
+}
+
+// skipHook skips checking out single files and operations in progress as the recipients are checked once they are done.
+func (h *HooksCheckCliHandler) skipHook(repo *infrastructure.GitRepository) (bool, error) {
+	if h.Hook == "" {
+		return false, nil
+	}
+
+	// the third argument of post-checkout is 0 if files were checked out instead of a branch
+	if h.Hook == "post-checkout" && len(h.HookArgs) == 3 && h.HookArgs[2] == "0" {
+		return true, nil
+	}
+
+	op, err := repo.OperationInProgress()
+
+	return op != "", err
+}
+
+// reEncrypt re-encrypts and commits the drifted files if the working tree is clean.
+func (h *HooksCheckCliHandler) reEncrypt(
+	ctx context.Context,
+	env ports.OSEnv,
+	cwd ports.CWD,
+	repo *infrastructure.GitRepository,
+	repoFS ports.ReadWriteFS,
+	recipients *infrastructure.RecipientsFile,
+	drifted []services.DriftedFile,
+) (bool, error) {
+	if reason, err := h.reEncryptBlocker(ctx, repo); err != nil {
+		return false, err
+	} else if reason != "" {
+		slog.Warn("Not re-encrypting files automatically", slog.String("reason", reason))
+		return false, nil
+	}
+
+	idStore, err := h.identitiesStore(ctx, cwd, env)
+	if err != nil {
+		return false, fmt.Errorf("failed to init identities store: %w", err)
+	}
+
+	sealer, err := repoSealer(ctx, idStore, repo, recipients)
+	if err != nil {
+		return false, err
+	}
+
+	reEncryptFile := services.ReEncryptWalkFunc(repo, repoFS, sealer)
+	for _, file := range drifted {
+		if err := reEncryptFile(file.Path, nil, nil); err != nil {
+			return false, err
+		}
+	}
+
+	slog.Info("Committing changes")
+	if err := repo.Commit(h.Message); err != nil {
+		return false, fmt.Errorf("failed to commit changes: %w", err)
+	}
+
+	marker, err := infrastructure.NewReEncryptMarker(cwd)
+	if err != nil {
+		return false, err
+	}
+
+	return true, marker.Clear()
+}
+
+func (h *HooksCheckCliHandler) reEncryptBlocker(ctx context.Context, repo *infrastructure.GitRepository) (string, error) {
+	if head, err := repo.Repository.Head(); err != nil {
+		return "", err
+	} else if !head.Name().IsBranch() {
+		return "HEAD is detached", nil
+	}
+
+	if clean, err := repo.IsWorktreeClean(ctx); err != nil {
+		return "", err
+	} else if !clean {
+		return "working tree has local changes", nil
+	}
+
+	return "", nil
+}
+
+// expectedStanzaTypes returns the stanza types of files encrypted for the current recipients
+// or nil if the repository has no recipients yet.
+func expectedStanzaTypes(recipients *infrastructure.RecipientsFile) ([]string, error) {
+	// the passphrase is not needed to know the stanza type
+	if protected, err := recipients.IsPassphraseProtected(); err != nil {
+		return nil, err
+	} else if protected {
+		return []string{"scrypt"}, nil
+	}
+
+	all, err := recipients.All()
+	if err != nil || len(all) == 0 {
+		return nil, err
+	}
+
+	return services.RecipientStanzaTypes(all...)
+}
+
+// formatStanzaTypes summarizes stanza types like 2 X25519, 1 ssh-ed25519.
+func formatStanzaTypes(types []string) string {
+	if len(types) == 0 {
+		return "no recipients"
+	}
+
+	var (
+		parts []string
+		count int
+	)
+
+	for idx, stanzaType := range types {
+		count++
+		if idx == len(types)-1 || types[idx+1] != stanzaType {
+			parts = append(parts, fmt.Sprintf("%d %s", count, stanzaType))
+			count = 0
+		}
+	}
+
+	return strings.Join(parts, ", ")
+}
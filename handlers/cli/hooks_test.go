@@ -0,0 +1,120 @@
+package cli_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/alecthomas/kong"
+	"github.com/go-git/go-git/v5"
+
+	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/handlers/cli"
+	"github.com/prskr/git-age/infrastructure"
+	"github.com/prskr/git-age/internal/testx"
+)
+
+func TestHooksCheckCliHandler_Run(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		addRecipient bool
+		args         []string
+		wantErr      error
+		wantOutput   string
+	}{
+		{
+			name:       "Files encrypted for current recipients",
+			wantOutput: "All files are encrypted for the current recipients",
+		},
+		{
+			name:         "Recipient added",
+			addRecipient: true,
+			wantErr:      cli.ErrRecipientsDrift,
+			wantOutput:   ".env (1 X25519)",
+		},
+		{
+			name:         "Automatic re-encryption refused for local changes",
+			addRecipient: true,
+			args:         []string{"--re-encrypt"},
+			wantErr:      cli.ErrRecipientsDrift,
+			wantOutput:   "Run 'git age files re-encrypt'",
+		},
+		{
+			name:         "Hooks only report",
+			addRecipient: true,
+			args:         []string{"--hook", "post-merge", "--", "0"},
+			wantOutput:   "expected 2 X25519",
+		},
+		{
+			name:         "Checkout of single files is skipped",
+			addRecipient: true,
+			args:         []string{"--hook", "post-checkout", "--", "abc", "def", "0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			setup := prepareTestRepo(t)
+
+			if tt.addRecipient {
+				newID, err := age.GenerateX25519Identity()
+				if err != nil {
+					t.Fatalf("failed to generate identity: %v", err)
+				}
+
+				recipients := infrastructure.NewRecipientsFile(setup.repoFS)
+				if _, err := recipients.Append(newID.Recipient().String(), ""); err != nil {
+					t.Fatalf("failed to append recipient: %v", err)
+				}
+
+				wt := testx.ResultOf(t, setup.repo.Worktree)
+				if _, err := wt.Add(ports.RecipientsFileName); err != nil {
+					t.Fatalf("failed to add file: %v", err)
+				}
+
+				if _, err := wt.Commit("chore: add recipient", new(git.CommitOptions)); err != nil {
+					t.Fatalf("failed to commit: %v", err)
+				}
+			}
+
+			stdout := new(bytes.Buffer)
+			parser := newKong(
+				t,
+				new(cli.HooksCliHandler),
+				kong.Bind(ports.CWD(setup.root)),
+				kong.BindTo(testx.Context(t), (*context.Context)(nil)),
+				kong.BindTo(ports.STDOUT(stdout), (*ports.STDOUT)(nil)),
+				kong.Bind(ports.NewOSEnv()),
+			)
+
+			args := append([]string{
+				"check",
+				"-k", fmt.Sprintf("file:///%s/keys.txt", filepath.ToSlash(setup.root)),
+			}, tt.args...)
+
+			ctx, err := parser.Parse(args)
+			if err != nil {
+				t.Fatalf("failed to parse arguments: %v", err)
+			}
+
+			if err := ctx.Run(); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Run() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantOutput == "" && stdout.Len() > 0 {
+				t.Errorf("expected no output, got %q", stdout.String())
+			} else if !strings.Contains(stdout.String(), tt.wantOutput) {
+				t.Errorf("expected output to contain %q, got %q", tt.wantOutput, stdout.String())
+			}
+		})
+	}
+}
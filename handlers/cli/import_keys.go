@@ -0,0 +1,158 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+
+	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/core/services"
+	"github.com/prskr/git-age/infrastructure"
+)
+
+//nolint:lll // doesn't make sense to break tags in struct
+type ImportKeysCliHandler struct {
+	KeysFlag    `embed:""`
+	CommentFlag `embed:""`
+	RemoteFlag  `embed:""`
+	StoreFlag   `embed:""`
+	File        string `arg:"" help:"age-keygen output, keys file, unencrypted ed25519 OpenSSH key, exported bundle or paper backup"`
+	Passphrase  string `env:"GIT_AGE_BUNDLE_PASSPHRASE" help:"Passphrase the bundle was exported with, otherwise the bundle is decrypted with the identities of the stores"`
+
+	Identities *services.IdentitiesStoreChain `kong:"-"`
+}
+
+func (h *ImportKeysCliHandler) Run(ctx context.Context, stdout ports.STDOUT, stderr ports.STDERR) error {
+	raw, err := os.ReadFile(h.File)
+	if err != nil {
+		return fmt.Errorf("failed to read keys to import: %w", err)
+	}
+
+	decryptIDs, err := h.decryptionIdentities(ctx)
+	if err != nil {
+		return err
+	}
+
+	entries, err := infrastructure.OpenKeyBundle(raw, decryptIDs...)
+	if err != nil {
+		return err
+	}
+
+	targets, err := h.Identities.Select(h.Stores...)
+	if err != nil {
+		return err
+	}
+
+	var imported int
+
+	for _, store := range targets {
+		known, err := knownPublicKeys(ctx, store)
+		if err != nil {
+			return &services.StoreError{Store: store.Name(), Err: err}
+		}
+
+		for _, entry := range entries {
+			publicKey := entry.Identity.Recipient().String()
+			if known[publicKey] {
+				slog.Info("Skipping identity already known to store", slog.String("store", store.Name()), slog.String("public_key", publicKey))
+				continue
+			}
+
+			if err := store.Store(ctx, h.storeCommand(entry)); err != nil {
+				return &services.StoreError{Store: store.Name(), Err: err}
+			}
+
+			known[publicKey] = true
+			imported++
+		}
+	}
+
+	names := make([]string, 0, len(targets))
+	for _, store := range targets {
+		names = append(names, store.Name())
+	}
+
+	_, _ = fmt.Fprintf(stderr, "Imported %d identities into: %s\n", imported, strings.Join(names, ", "))
+
+	for _, entry := range entries {
+		if _, err := fmt.Fprintln(stdout, entry.Identity.Recipient().String()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (h *ImportKeysCliHandler) AfterApply(ctx context.Context, cwd ports.CWD, env ports.OSEnv) error {
+	idStore, err := h.identitiesStore(ctx, cwd, env)
+	if err != nil {
+		return fmt.Errorf("failed to init identities store: %w", err)
+	}
+
+	h.Identities = idStore
+	return nil
+}
+
+// storeCommand keeps the comment and remote recorded in the bundle unless they are overridden by flags.
+func (h *ImportKeysCliHandler) storeCommand(entry infrastructure.KeyBundleEntry) ports.StoreIdentityCommand {
+	cmd := ports.StoreIdentityCommand{
+		Identity: entry.Identity,
+		Comment:  entry.Comment,
+		Remote:   entry.Remote,
+	}
+
+	if h.Comment != "" {
+		cmd.Comment = h.Comment
+	} else if cmd.Comment == "" {
+		cmd.Comment = "imported on " + time.Now().Format(time.RFC3339)
+	}
+
+	if h.Remote != "" {
+		cmd.Remote = h.Remote
+	}
+
+	return cmd
+}
+
+// decryptionIdentities returns the identities to decrypt bundles with,
+// bundles exported for a passphrase can only be decrypted with the passphrase.
+func (h *ImportKeysCliHandler) decryptionIdentities(ctx context.Context) ([]age.Identity, error) {
+	if h.Passphrase != "" {
+		id, err := age.NewScryptIdentity(h.Passphrase)
+		if err != nil {
+			return nil, err
+		}
+
+		return []age.Identity{id}, nil
+	}
+
+	ids, err := h.Identities.Identities(ctx, ports.IdentitiesQuery{Remotes: []string{""}})
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to get identities to decrypt bundle", slog.String("err", err.Error()))
+		return nil, nil
+	}
+
+	return ids, nil
+}
+
+// knownPublicKeys returns the public keys of the identities the store already has.
+func knownPublicKeys(ctx context.Context, store ports.IdentitiesStore) (map[string]bool, error) {
+	ids, err := store.Identities(ctx, ports.IdentitiesQuery{Remotes: []string{""}})
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if wrapped, ok := ports.WrapIdentity(id); ok {
+			known[wrapped.Recipient().String()] = true
+		}
+	}
+
+	return known, nil
+}
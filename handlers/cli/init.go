@@ -2,42 +2,71 @@ package cli
 
 import (
 	"context"
+	"crypto/rand"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"log/slog"
+	"strings"
 
 	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/core/services"
 	"github.com/prskr/git-age/infrastructure"
 )
 
+var ErrNoPassphraseStore = errors.New(
+	"no identities store supports passphrases, make the passphrase available via an agent or an identity helper or pass --print-passphrase",
+)
+
+//nolint:lll // doesn't make sense to break tags in struct
 type InitCliHandler struct {
-	CommentFlag   `embed:""`
-	KeysFlag      `embed:""`
-	RemoteFlag    `embed:""`
-	AlgorithmFlag `embed:""`
-
-	Identities ports.IdentitiesStore `kong:"-"`
-	Recipients ports.Recipients      `kong:"-"`
-	RepoFS     ports.ReadWriteFS     `kong:"-"`
+	CommentFlag     `embed:""`
+	KeysFlag        `embed:""`
+	RemoteFlag      `embed:""`
+	AlgorithmFlag   `embed:""`
+	StoreFlag       `embed:""`
+	SigningKeyFlag  `embed:""`
+	Passphrase      bool `name:"passphrase" help:"Encrypt for a shared passphrase instead of personal keys"`
+	PrintPassphrase bool `name:"print-passphrase" help:"Print the generated passphrase to stderr if no identities store supports passphrases instead of failing"`
+
+	Identities *services.IdentitiesStoreChain `kong:"-"`
+	Recipients ports.Recipients               `kong:"-"`
+	RepoFS     ports.ReadWriteFS              `kong:"-"`
 }
 
-func (h *InitCliHandler) Run(ctx context.Context) (err error) {
-	if _, err := fs.Stat(h.RepoFS, ports.RecipientsFileName); err == nil {
+func (h *InitCliHandler) Run(ctx context.Context, stderr ports.STDERR) (err error) {
+	switch _, statErr := fs.Stat(h.RepoFS, ports.RecipientsFileName); {
+	case statErr == nil:
 		slog.Info("Repository already initialized")
-		return nil
+	case h.Passphrase:
+		err = h.initPassphrase(ctx, stderr)
+	default:
+		err = h.initIdentity(ctx, stderr)
 	}
 
+	if err != nil {
+		return err
+	}
+
+	return h.addMergeAttribute()
+}
+
+func (h *InitCliHandler) initIdentity(ctx context.Context, stderr ports.STDERR) error {
 	cmd := ports.GenerateIdentityCommand{
 		Comment:   h.Comment,
 		Remote:    h.Remote,
 		Algorithm: h.Algorithm,
+		Stores:    h.Stores,
 	}
 
-	pubKey, err := h.Identities.Generate(ctx, cmd)
+	pubKey, storedIn, err := h.Identities.GenerateTo(ctx, cmd)
 	if err != nil {
 		return fmt.Errorf("failed to generate identity: %w", err)
 	}
 
+	_, _ = fmt.Fprintf(stderr, "Stored identity in: %s\n", strings.Join(storedIn, ", "))
+
 	if _, err := h.Recipients.Append(pubKey, h.Comment); err != nil {
 		return fmt.Errorf("failed to append recipient: %w", err)
 	}
@@ -45,12 +74,88 @@ func (h *InitCliHandler) Run(ctx context.Context) (err error) {
 	return nil
 }
 
+// addMergeAttribute assigns the merge driver registered by install to the recipients file.
+func (h *InitCliHandler) addMergeAttribute() (err error) {
+	attributesLine := ports.RecipientsFileName + " merge=" + ports.RecipientsMergeDriver
+
+	existing, err := fs.ReadFile(h.RepoFS, ports.GitAttributesFileName)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to read %s file: %w", ports.GitAttributesFileName, err)
+	}
+
+	for line := range strings.Lines(string(existing)) {
+		if strings.TrimSpace(line) == attributesLine {
+			return nil
+		}
+	}
+
+	attributesFile, err := h.RepoFS.Create(ports.GitAttributesFileName)
+	if err != nil {
+		return fmt.Errorf("failed to open %s file: %w", ports.GitAttributesFileName, err)
+	}
+
+	defer func() {
+		err = errors.Join(err, attributesFile.Close())
+	}()
+
+	if _, err := attributesFile.Seek(0, io.SeekEnd); err != nil {
+		return err
+	}
+
+	if len(existing) > 0 && !strings.HasSuffix(string(existing), "\n") {
+		attributesLine = "\n" + attributesLine
+	}
+
+	if _, err := attributesFile.WriteString(attributesLine + "\n"); err != nil {
+		return fmt.Errorf("failed to write to %s file: %w", ports.GitAttributesFileName, err)
+	}
+
+	return nil
+}
+
+// initPassphrase uses the passphrase already known to the identities stores
+// or generates a new one and stores it in the first store supporting passphrases.
+// The generated passphrase is only printed if explicitly requested, it would be lost otherwise.
+func (h *InitCliHandler) initPassphrase(ctx context.Context, stderr ports.STDERR) error {
+	var query ports.IdentitiesQuery
+	if h.Remote != "" {
+		query.Remotes = []string{h.Remote}
+	}
+
+	passphrase, err := h.Identities.Passphrase(ctx, query)
+	if errors.Is(err, services.ErrNoPassphrase) {
+		passphrase = rand.Text()
+
+		cmd := ports.StorePassphraseCommand{
+			Passphrase: passphrase,
+			Comment:    h.Comment,
+			Remote:     h.Remote,
+		}
+
+		err = h.Identities.StorePassphrase(ctx, cmd)
+		switch {
+		case errors.Is(err, services.ErrPassphraseNotSupported) && !h.PrintPassphrase:
+			return ErrNoPassphraseStore
+		case errors.Is(err, services.ErrPassphraseNotSupported):
+			_, _ = fmt.Fprintf(stderr, "Generated passphrase: %s\n", passphrase)
+			_, _ = fmt.Fprintln(stderr, "No identities store supports passphrases, make it available via an agent or an identity helper")
+			err = nil
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to get passphrase: %w", err)
+	}
+
+	if _, err := h.Recipients.Append(ports.PassphraseRecipient, h.Comment); err != nil {
+		return fmt.Errorf("failed to append passphrase recipient: %w", err)
+	}
+
+	return nil
+}
+
 func (h *InitCliHandler) AfterApply(ctx context.Context, cwd ports.CWD, env ports.OSEnv) error {
-	idStore, err := infrastructure.IdentitiesStore(
-		ctx,
-		infrastructure.NewAgentIdentitiesStoreSource(env),
-		infrastructure.NewFileIdentityStoreSource(h.Keys),
-	)
+	idStore, err := h.identitiesStore(ctx, cwd, env)
 	if err != nil {
 		return fmt.Errorf("failed to init identities store: %w", err)
 	}
@@ -63,7 +168,7 @@ func (h *InitCliHandler) AfterApply(ctx context.Context, cwd ports.CWD, env port
 	}
 
 	h.RepoFS = infrastructure.NewReadWriteDirFS(repoRootPath)
-	h.Recipients = infrastructure.NewRecipientsFile(h.RepoFS)
+	h.Recipients, err = h.recipientsFile(cwd, env, h.RepoFS)
 
-	return nil
+	return err
 }
@@ -1,10 +1,16 @@
 package cli_test
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 
 	"filippo.io/age"
@@ -12,6 +18,7 @@ import (
 
 	"github.com/prskr/git-age/core/ports"
 	"github.com/prskr/git-age/handlers/cli"
+	"github.com/prskr/git-age/infrastructure"
 	"github.com/prskr/git-age/internal/testx"
 )
 
@@ -53,6 +60,7 @@ func TestInitCliHandler_Run(t *testing.T) {
 				new(cli.InitCliHandler),
 				kong.Bind(ports.CWD(setup.root)),
 				kong.BindTo(testx.Context(t), (*context.Context)(nil)),
+				kong.BindTo(ports.STDERR(io.Discard), (*ports.STDERR)(nil)),
 				kong.Bind(ports.NewOSEnv()),
 			)
 
@@ -105,6 +113,170 @@ func TestInitCliHandler_Run(t *testing.T) {
 				t.Errorf("failed to parse recipients: %v", err)
 				return
 			}
+
+			attributes, err := os.ReadFile(filepath.Join(setup.root, ports.GitAttributesFileName))
+			if err != nil {
+				t.Errorf("failed to read attributes: %v", err)
+				return
+			}
+
+			if !strings.Contains(string(attributes), ports.RecipientsFileName+" merge="+ports.RecipientsMergeDriver+"\n") {
+				t.Errorf("expected merge driver attribute, got %q", attributes)
+			}
+		})
+	}
+}
+
+// passphraseHelper keeps the passphrase next to the script.
+const passphraseHelper = `#!/bin/sh
+store="$(dirname "$0")/passphrase.txt"
+case "$1" in
+	passphrase) [ -f "$store" ] && cat "$store"; exit 0 ;;
+	store-passphrase) grep '^passphrase=' > "$store" ;;
+esac
+`
+
+func TestInitCliHandler_Passphrase(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("helper script requires a POSIX shell")
+	}
+
+	setup := prepareTestRepo(t)
+
+	if err := os.Remove(filepath.Join(setup.root, ports.RecipientsFileName)); err != nil {
+		t.Fatalf("failed to remove file: %v", err)
+	}
+
+	helperPath := filepath.Join(t.TempDir(), "git-age-helper")
+	//nolint:gosec // helper has to be executable
+	if err := os.WriteFile(helperPath, []byte(passphraseHelper), 0o700); err != nil {
+		t.Fatalf("failed to write helper: %v", err)
+	}
+
+	env := ports.OSEnv{"GIT_AGE_IDENTITY_HELPER": helperPath}
+	keysArg := fmt.Sprintf("file:///%s/keys.txt", filepath.ToSlash(t.TempDir()))
+
+	run := func(grammar any, stdin io.Reader, stdout io.Writer, args ...string) {
+		t.Helper()
+
+		parser := newKong(
+			t,
+			grammar,
+			kong.Bind(ports.CWD(setup.root)),
+			kong.BindTo(testx.Context(t), (*context.Context)(nil)),
+			kong.BindTo(ports.STDIN(io.NopCloser(stdin)), (*ports.STDIN)(nil)),
+			kong.BindTo(ports.STDOUT(stdout), (*ports.STDOUT)(nil)),
+			kong.BindTo(ports.STDERR(io.Discard), (*ports.STDERR)(nil)),
+			kong.Bind(env),
+		)
+
+		ctx, err := parser.Parse(append([]string{"-k", keysArg}, args...))
+		if err != nil {
+			t.Fatalf("failed to parse arguments: %v", err)
+		}
+
+		if err := ctx.Run(); err != nil {
+			t.Fatalf("failed to run command: %v", err)
+		}
+	}
+
+	run(new(cli.InitCliHandler), nil, io.Discard, "--passphrase")
+
+	recipients, err := os.ReadFile(filepath.Join(setup.root, ports.RecipientsFileName))
+	if err != nil {
+		t.Fatalf("failed to read recipients file: %v", err)
+	}
+
+	if strings.TrimSpace(string(recipients)) != ports.PassphraseRecipient {
+		t.Errorf("expected only the passphrase marker in recipients file, got %q", recipients)
+	}
+
+	const plainText = "API_KEY=secret\n"
+
+	encrypted := new(bytes.Buffer)
+	run(new(cli.CleanCliHandler), strings.NewReader(plainText), encrypted, "new.env")
+
+	if !strings.Contains(encrypted.String(), "-> scrypt ") {
+		t.Errorf("expected file to be encrypted for a scrypt recipient")
+	}
+
+	decrypted := new(bytes.Buffer)
+	run(new(cli.SmudgeCliHandler), encrypted, decrypted, "new.env")
+
+	if decrypted.String() != plainText {
+		t.Errorf("expected %q after round trip, got %q", plainText, decrypted.String())
+	}
+}
+
+func TestInitCliHandler_PassphraseWithoutStore(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name       string
+		args       []string
+		wantErr    error
+		wantStderr string
+	}{
+		{
+			name:    "Fail without store",
+			wantErr: cli.ErrNoPassphraseStore,
+		},
+		{
+			name:       "Print passphrase explicitly",
+			args:       []string{"--print-passphrase"},
+			wantStderr: "Generated passphrase: ",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			setup := prepareTestRepo(t)
+			recipientsPath := filepath.Join(setup.root, ports.RecipientsFileName)
+
+			if err := os.Remove(recipientsPath); err != nil {
+				t.Fatalf("failed to remove file: %v", err)
+			}
+
+			stderr := new(bytes.Buffer)
+			parser := newKong(
+				t,
+				new(cli.InitCliHandler),
+				kong.Bind(ports.CWD(setup.root)),
+				kong.BindTo(testx.Context(t), (*context.Context)(nil)),
+				kong.BindTo(ports.STDERR(stderr), (*ports.STDERR)(nil)),
+				kong.Bind(ports.OSEnv{"GIT_AGE_AGENT_HOST": infrastructure.AgentHostNone}),
+			)
+
+			args := append([]string{"-k", fmt.Sprintf("file:///%s/keys.txt", filepath.ToSlash(t.TempDir())), "--passphrase"}, tt.args...)
+
+			ctx, err := parser.Parse(args)
+			if err != nil {
+				t.Fatalf("failed to parse arguments: %v", err)
+			}
+
+			if err := ctx.Run(); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr != nil {
+				if strings.Contains(stderr.String(), "Generated passphrase") {
+					t.Errorf("passphrase must not be printed without --print-passphrase, got %q", stderr.String())
+				}
+
+				if _, err := os.Stat(recipientsPath); !errors.Is(err, fs.ErrNotExist) {
+					t.Errorf("expected no recipients file after failure, got %v", err)
+				}
+
+				return
+			}
+
+			if !strings.Contains(stderr.String(), tt.wantStderr) {
+				t.Errorf("expected stderr to contain %q, got %q", tt.wantStderr, stderr.String())
+			}
 		})
 	}
 }
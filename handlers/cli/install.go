@@ -39,17 +39,14 @@ func (h *InstallCliHandler) Run() (err error) {
 		return fmt.Errorf("failed to prepare config file for writing: %w", err)
 	}
 
-	filterSection := cfg.Raw.Section("filter")
-	if filterSection.HasSubsection("age") {
+	installedFilter := installFilter(cfg)
+	installedMergeDriver := installMergeDriver(cfg)
+
+	if !installedFilter && !installedMergeDriver {
 		slog.Info("git-age already installed")
 		return nil
 	}
 
-	ageSection := filterSection.Subsection("age")
-	ageSection.SetOption("clean", "git-age clean -- %f")
-	ageSection.SetOption("smudge", "git-age smudge -- %f")
-	ageSection.SetOption("required", strconv.FormatBool(true))
-
 	if err := cfg.Validate(); err != nil {
 		return fmt.Errorf("failed to validate config: %w", err)
 	}
@@ -63,5 +60,39 @@ func (h *InstallCliHandler) Run() (err error) {
 		return fmt.Errorf("failed to write config: %w", err)
 	}
 
+	// the marshaled config might be shorter than the original one e.g. because comments are dropped
+	if err := cfgFile.Truncate(int64(len(cfgBytes))); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+
 	return nil
 }
+
+// installFilter registers the clean and smudge filter unless a filter named age is already configured.
+func installFilter(cfg *config.Config) bool {
+	filterSection := cfg.Raw.Section("filter")
+	if filterSection.HasSubsection("age") {
+		return false
+	}
+
+	ageSection := filterSection.Subsection("age")
+	ageSection.SetOption("clean", "git-age clean -- %f")
+	ageSection.SetOption("smudge", "git-age smudge -- %f")
+	ageSection.SetOption("required", strconv.FormatBool(true))
+
+	return true
+}
+
+// installMergeDriver registers the merge driver for the recipients file referenced by the .gitattributes of init.
+func installMergeDriver(cfg *config.Config) bool {
+	mergeSection := cfg.Raw.Section("merge")
+	if mergeSection.HasSubsection(ports.RecipientsMergeDriver) {
+		return false
+	}
+
+	driverSection := mergeSection.Subsection(ports.RecipientsMergeDriver)
+	driverSection.SetOption("name", "git-age recipients merge driver")
+	driverSection.SetOption("driver", "git-age merge-recipients -- %O %A %B %P")
+
+	return true
+}
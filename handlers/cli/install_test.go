@@ -87,6 +87,11 @@ func TestInstallCliHandler_Run(t *testing.T) {
 					t.Errorf("expected %q, got %q", expectedValue, actualValue)
 				}
 			}
+
+			mergeSection := cfg.Section(`merge "age-recipients"`)
+			if driver := getKey(t, mergeSection, "driver"); driver != "git-age merge-recipients -- %O %A %B %P" {
+				t.Errorf("expected merge driver to be installed, got %q", driver)
+			}
 		})
 	}
 }
@@ -1,6 +1,10 @@
 package cli
 
 type KeysCliHandler struct {
-	Generate GenKeyCliHandler   `cmd:"" name:"generate" aliases:"gen" help:"Generate a new key pair"`
-	List     ListKeysCliHandler `cmd:"" name:"list" aliases:"ls" help:"List all keys"`
+	Generate GenKeyCliHandler     `cmd:"" name:"generate" aliases:"gen" help:"Generate a new key pair"`
+	List     ListKeysCliHandler   `cmd:"" name:"list" aliases:"ls" help:"List all keys"`
+	Add      AddKeysCliHandler    `cmd:"" name:"add" help:"Add keys to the agent, optionally for a limited time"`
+	Rotate   RotateKeyCliHandler  `cmd:"" name:"rotate" help:"Replace your key in the current repository with a new one"`
+	Import   ImportKeysCliHandler `cmd:"" name:"import" help:"Import keys from a keys file, an OpenSSH key or an exported bundle"`
+	Export   ExportKeysCliHandler `cmd:"" name:"export" help:"Export keys as encrypted bundle e.g. to move them to another machine"`
 }
@@ -6,8 +6,6 @@ import (
 	"log/slog"
 	"text/tabwriter"
 
-	"filippo.io/age"
-
 	"github.com/prskr/git-age/core/ports"
 	"github.com/prskr/git-age/infrastructure"
 )
@@ -26,26 +24,28 @@ func (h *ListKeysCliHandler) Run(ctx context.Context, stdout ports.STDOUT) error
 
 	writer := tabwriter.NewWriter(stdout, 0, 0, 3, ' ', 0)
 
-	_, _ = fmt.Fprintln(writer, "Public Key\t")
+	_, _ = fmt.Fprintln(writer, "Fingerprint\tWords\tPublic Key\t")
 
 	for _, id := range identities {
-		identity, ok := id.(*age.X25519Identity)
+		publicKey, ok := ports.PublicKeyOf(id)
 		if !ok {
-			slog.Warn("uknown identity type", slog.String("type", fmt.Sprintf("%t", id)))
+			slog.Warn("uknown identity type", slog.String("type", fmt.Sprintf("%T", id)))
 			continue
 		}
-		_, _ = fmt.Fprintf(writer, "%s\t\n", identity.Recipient().String())
+		_, _ = fmt.Fprintf(
+			writer,
+			"%s\t%s\t%s\t\n",
+			infrastructure.RecipientFingerprint(publicKey),
+			infrastructure.RecipientFingerprintWords(publicKey),
+			publicKey,
+		)
 	}
 
 	return writer.Flush()
 }
 
-func (h *ListKeysCliHandler) AfterApply(ctx context.Context, env ports.OSEnv) error {
-	idStore, err := infrastructure.IdentitiesStore(
-		ctx,
-		infrastructure.NewAgentIdentitiesStoreSource(env),
-		infrastructure.NewFileIdentityStoreSource(h.Keys),
-	)
+func (h *ListKeysCliHandler) AfterApply(ctx context.Context, cwd ports.CWD, env ports.OSEnv) error {
+	idStore, err := h.identitiesStore(ctx, cwd, env)
 	if err != nil {
 		return fmt.Errorf("failed to init identities store: %w", err)
 	}
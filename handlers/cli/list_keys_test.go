@@ -3,15 +3,23 @@ package cli_test
 import (
 	"bytes"
 	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"filippo.io/age"
 	"github.com/alecthomas/kong"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/ssh"
 
 	"github.com/prskr/git-age/core/ports"
 	"github.com/prskr/git-age/handlers/cli"
+	"github.com/prskr/git-age/infrastructure"
 	"github.com/prskr/git-age/internal/testx"
 )
 
@@ -41,6 +49,7 @@ func TestListKeysCliHandler_Run(t *testing.T) {
 		kong.BindTo(testx.Context(t), (*context.Context)(nil)),
 		kong.BindTo(ports.STDOUT(outBuf), (*ports.STDOUT)(nil)),
 		kong.Bind(ports.NewOSEnv()),
+		kong.Bind(ports.CWD(t.TempDir())),
 	)
 
 	args := []string{
@@ -58,4 +67,44 @@ func TestListKeysCliHandler_Run(t *testing.T) {
 
 	assert.Contains(t, outBuf.String(), "Public Key")
 	assert.Contains(t, outBuf.String(), id.Recipient().String())
+	assert.Contains(t, outBuf.String(), infrastructure.RecipientFingerprint(id.Recipient().String()))
+	assert.Contains(t, outBuf.String(), infrastructure.RecipientFingerprintWords(id.Recipient().String()))
+}
+
+func TestListKeysCliHandler_Run_SSH(t *testing.T) {
+	t.Parallel()
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ed25519 key: %v", err)
+	}
+
+	block := testx.ResultOfA[*pem.Block](t, ssh.MarshalPrivateKey, crypto.PrivateKey(privateKey), "jane@laptop")
+	keyPath := filepath.Join(t.TempDir(), "id_ed25519")
+	writeKeysFile(t, keyPath, string(pem.EncodeToMemory(block)))
+
+	signer := testx.ResultOfA[ssh.Signer](t, ssh.NewSignerFromKey, any(privateKey))
+	publicKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey())))
+
+	outBuf := new(bytes.Buffer)
+	parser := newKong(
+		t,
+		new(cli.ListKeysCliHandler),
+		kong.BindTo(testx.Context(t), (*context.Context)(nil)),
+		kong.BindTo(ports.STDOUT(outBuf), (*ports.STDOUT)(nil)),
+		kong.Bind(ports.NewOSEnv()),
+		kong.Bind(ports.CWD(t.TempDir())),
+	)
+
+	kongCtx, err := parser.Parse([]string{"-k", "ssh://" + keyPath})
+	if !assert.NoError(t, err, "failed to parse arguments") {
+		return
+	}
+
+	if !assert.NoError(t, kongCtx.Run(), "failed to run command") {
+		return
+	}
+
+	assert.Contains(t, outBuf.String(), publicKey)
+	assert.Contains(t, outBuf.String(), infrastructure.RecipientFingerprint(publicKey))
 }
@@ -0,0 +1,121 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/alecthomas/kong"
+
+	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/core/services"
+	"github.com/prskr/git-age/infrastructure"
+)
+
+//nolint:lll // doesn't make sense to break tags in struct
+type MergeCliHandler struct {
+	KeysFlag `embed:""`
+	Branch   string `arg:"" help:"Branch to merge into the current branch"`
+	Message  string `help:"Message to be used for the re-encryption commit" default:"chore: re-encrypt secret files for the recipients of the current branch" short:"m"`
+}
+
+func (h *MergeCliHandler) AfterApply(kongCtx *kong.Context, cwd ports.CWD) error {
+	gitRepo, repoFS, err := infrastructure.NewGitRepositoryFromPath(cwd)
+	if err != nil {
+		return err
+	}
+
+	kongCtx.Bind(gitRepo)
+	kongCtx.BindTo(repoFS, (*ports.ReadWriteFS)(nil))
+
+	return nil
+}
+
+func (h *MergeCliHandler) Run(
+	ctx context.Context,
+	stdout ports.STDOUT,
+	stderr ports.STDERR,
+	cwd ports.CWD,
+	env ports.OSEnv,
+	repoFS ports.ReadWriteFS,
+	repo *infrastructure.GitRepository,
+) error {
+	if isDirty, err := repo.IsStagingDirty(); err != nil {
+		return fmt.Errorf("failed to check if repository is dirty: %w", err)
+	} else if isDirty {
+		slog.Warn("Repository is dirty")
+		os.Exit(1)
+	}
+
+	recipients, err := verifiedRecipientsFile(cwd, repoFS)
+	if err != nil {
+		return err
+	}
+
+	before, err := recipients.Active()
+	if err != nil {
+		return err
+	}
+
+	source, err := h.sourceRecipients(repo)
+	if err != nil {
+		return err
+	}
+
+	if err := repo.Merge(ctx, stdout, stderr, h.Branch); err != nil {
+		return fmt.Errorf("%w, resolve the conflicts, commit and run 'git age files re-encrypt'", err)
+	}
+
+	after, err := recipients.Active()
+	if err != nil {
+		return err
+	}
+
+	if infrastructure.SameRecipients(after, before) && infrastructure.SameRecipients(after, source) {
+		_, err = fmt.Fprintln(stdout, "Both branches use the same recipients, nothing to re-encrypt")
+		return err
+	}
+
+	idStore, err := h.identitiesStore(ctx, cwd, env)
+	if err != nil {
+		return fmt.Errorf("failed to init identities store: %w", err)
+	}
+
+	sealer, err := repoSealer(ctx, idStore, repo, recipients)
+	if err != nil {
+		return err
+	}
+
+	slog.Info("Re-encrypting files for the recipients of the current branch")
+	if err := repo.WalkAgeFiles(services.ReEncryptWalkFunc(repo, repoFS, sealer)); err != nil {
+		return err
+	}
+
+	slog.Info("Committing changes")
+	if err := repo.Commit(h.Message); err != nil {
+		return fmt.Errorf("failed to commit changes: %w", err)
+	}
+
+	marker, err := infrastructure.NewReEncryptMarker(cwd)
+	if err != nil {
+		return err
+	}
+
+	return marker.Clear()
+}
+
+// sourceRecipients returns the recipients the files of the merged branch are encrypted for.
+func (h *MergeCliHandler) sourceRecipients(repo *infrastructure.GitRepository) ([]infrastructure.RecipientEntry, error) {
+	raw, err := repo.RecipientsFileAt(h.Branch)
+	if err != nil {
+		return nil, err
+	}
+
+	ref, err := repo.SectionRef(h.Branch)
+	if err != nil {
+		return nil, err
+	}
+
+	return infrastructure.RecipientsForRef(raw, ref), nil
+}
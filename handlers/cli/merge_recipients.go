@@ -0,0 +1,69 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/infrastructure"
+)
+
+var ErrRecipientsMergeConflict = errors.New("recipients file could not be merged automatically")
+
+type MergeRecipientsCliHandler struct {
+	Base   string `arg:"" help:"Common ancestor of the recipients file (%O)"`
+	Ours   string `arg:"" help:"Current version of the recipients file, receives the merge result (%A)"`
+	Theirs string `arg:"" help:"Version of the recipients file being merged (%B)"`
+	Path   string `arg:"" optional:"" help:"Path of the recipients file in the repository (%P)"`
+}
+
+func (h *MergeRecipientsCliHandler) Run(cwd ports.CWD, stderr ports.STDERR) error {
+	versions := make([][]byte, 0, 3)
+	for _, versionPath := range []string{h.Base, h.Ours, h.Theirs} {
+		raw, err := os.ReadFile(versionPath)
+		if err != nil {
+			return fmt.Errorf("failed to read recipients file: %w", err)
+		}
+
+		versions = append(versions, raw)
+	}
+
+	merge := infrastructure.MergeRecipients(versions[0], versions[1], versions[2])
+
+	if err := os.WriteFile(h.Ours, merge.Result, 0o644); err != nil {
+		return fmt.Errorf("failed to write merged recipients file: %w", err)
+	}
+
+	for _, conflict := range merge.Conflicts {
+		_, _ = fmt.Fprintf(stderr, "CONFLICT (%s): %s\n", h.path(), conflict)
+	}
+
+	if merge.ReEncrypt {
+		marker, err := infrastructure.NewReEncryptMarker(cwd)
+		if err != nil {
+			return err
+		}
+
+		if err := marker.Set(fmt.Sprintf("recipients changed by merging %s", h.path())); err != nil {
+			return fmt.Errorf("failed to flag re-encryption: %w", err)
+		}
+
+		slog.Warn("Recipients changed by merge, run 'git age files re-encrypt' after committing the merge")
+	}
+
+	if len(merge.Conflicts) > 0 {
+		return fmt.Errorf("%w: %d conflicts", ErrRecipientsMergeConflict, len(merge.Conflicts))
+	}
+
+	return nil
+}
+
+func (h *MergeRecipientsCliHandler) path() string {
+	if h.Path == "" {
+		return ports.RecipientsFileName
+	}
+
+	return h.Path
+}
@@ -0,0 +1,124 @@
+package cli_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/alecthomas/kong"
+
+	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/handlers/cli"
+	"github.com/prskr/git-age/infrastructure"
+)
+
+func TestMergeRecipientsCliHandler_Run(t *testing.T) {
+	t.Parallel()
+
+	alice := testx25519Recipient(t)
+	bob := testx25519Recipient(t)
+	carol := testx25519Recipient(t)
+
+	tests := []struct {
+		name          string
+		base          string
+		ours          string
+		theirs        string
+		want          string
+		wantErr       error
+		wantReEncrypt bool
+	}{
+		{
+			name:          "Union of added recipients",
+			base:          "# alice\n" + alice + "\n",
+			ours:          "# alice\n" + alice + "\n# bob\n" + bob + "\n",
+			theirs:        "# alice\n" + alice + "\n# carol\n" + carol + "\n",
+			want:          "# alice\n" + alice + "\n# bob\n" + bob + "\n# carol\n" + carol + "\n",
+			wantReEncrypt: true,
+		},
+		{
+			name:          "Removed recipient changed on the other side",
+			base:          alice + "\n# bob\n" + bob + "\n",
+			ours:          alice + "\n",
+			theirs:        alice + "\n# bob (ops)\n" + bob + "\n",
+			want:          alice + "\n# bob (ops)\n" + bob + "\n",
+			wantErr:       cli.ErrRecipientsMergeConflict,
+			wantReEncrypt: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			setup := prepareTestRepo(t)
+			tmpDir := t.TempDir()
+
+			paths := make([]string, 0, 3)
+			for idx, content := range []string{tt.base, tt.ours, tt.theirs} {
+				versionPath := filepath.Join(tmpDir, string(rune('a'+idx)))
+				if err := os.WriteFile(versionPath, []byte(content), 0o600); err != nil {
+					t.Fatalf("failed to write recipients version: %v", err)
+				}
+
+				paths = append(paths, versionPath)
+			}
+
+			stderr := new(bytes.Buffer)
+			parser := newKong(
+				t,
+				new(cli.MergeRecipientsCliHandler),
+				kong.Bind(ports.CWD(setup.root)),
+				kong.BindTo(ports.STDERR(stderr), (*ports.STDERR)(nil)),
+			)
+
+			ctx, err := parser.Parse(append([]string{"--"}, append(paths, ports.RecipientsFileName)...))
+			if err != nil {
+				t.Fatalf("failed to parse arguments: %v", err)
+			}
+
+			if err := ctx.Run(); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Run() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr != nil && !strings.Contains(stderr.String(), "CONFLICT") {
+				t.Errorf("expected conflict to be reported, got %q", stderr.String())
+			}
+
+			merged, err := os.ReadFile(paths[1])
+			if err != nil {
+				t.Fatalf("failed to read merge result: %v", err)
+			}
+
+			if string(merged) != tt.want {
+				t.Errorf("merge result = %q, want %q", merged, tt.want)
+			}
+
+			marker, err := infrastructure.NewReEncryptMarker(ports.CWD(setup.root))
+			if err != nil {
+				t.Fatalf("failed to locate re-encrypt marker: %v", err)
+			}
+
+			if reason, err := marker.Reason(); err != nil {
+				t.Errorf("failed to read re-encrypt marker: %v", err)
+			} else if (reason != "") != tt.wantReEncrypt {
+				t.Errorf("re-encrypt marker = %q, want set %t", reason, tt.wantReEncrypt)
+			}
+		})
+	}
+}
+
+func testx25519Recipient(tb testing.TB) string {
+	tb.Helper()
+
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		tb.Fatalf("failed to create age identity: %v", err)
+	}
+
+	return id.Recipient().String()
+}
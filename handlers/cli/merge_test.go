@@ -0,0 +1,146 @@
+package cli_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/alecthomas/kong"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/handlers/cli"
+	"github.com/prskr/git-age/internal/testx"
+)
+
+func TestMergeCliHandler_Run(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		masterSection bool
+		wantOutput    string
+	}{
+		{
+			name:       "Same recipients on both branches",
+			wantOutput: "nothing to re-encrypt",
+		},
+		{
+			name:          "Current branch with own recipients",
+			masterSection: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			setup := prepareTestRepo(t)
+			wt := testx.ResultOf(t, setup.repo.Worktree)
+			initial := testx.ResultOf(t, setup.repo.Head)
+
+			// commit a plain file on the feature branch without switching branches
+			commitFile(t, wt, "notes.txt", "feature notes\n", "feat: add notes")
+
+			head := testx.ResultOf(t, setup.repo.Head)
+			featureRef := plumbing.NewHashReference(plumbing.NewBranchReferenceName("feature"), head.Hash())
+			if err := setup.repo.Storer.SetReference(featureRef); err != nil {
+				t.Fatalf("failed to create feature branch: %v", err)
+			}
+
+			if err := wt.Reset(&git.ResetOptions{Commit: initial.Hash(), Mode: git.MixedReset}); err != nil {
+				t.Fatalf("failed to reset master: %v", err)
+			}
+
+			if err := os.Remove(filepath.Join(setup.root, "notes.txt")); err != nil {
+				t.Fatalf("failed to remove notes: %v", err)
+			}
+
+			newID, err := age.GenerateX25519Identity()
+			if err != nil {
+				t.Fatalf("failed to generate identity: %v", err)
+			}
+
+			if tt.masterSection {
+				section := fmt.Sprintf("%s\n[refs/heads/master]\n%s\n", recipients, newID.Recipient())
+				commitFile(t, wt, ports.RecipientsFileName, section, "chore: own recipients for master")
+			}
+
+			stdout := new(bytes.Buffer)
+			parser := newKong(
+				t,
+				new(cli.MergeCliHandler),
+				kong.Bind(ports.CWD(setup.root)),
+				kong.BindTo(testx.Context(t), (*context.Context)(nil)),
+				kong.BindTo(ports.STDOUT(stdout), (*ports.STDOUT)(nil)),
+				kong.BindTo(ports.STDERR(new(bytes.Buffer)), (*ports.STDERR)(nil)),
+				kong.Bind(ports.NewOSEnv()),
+			)
+
+			ctx, err := parser.Parse([]string{
+				"-k", fmt.Sprintf("file:///%s/keys.txt", filepath.ToSlash(setup.root)),
+				"feature",
+			})
+			if err != nil {
+				t.Fatalf("failed to parse arguments: %v", err)
+			}
+
+			if err := ctx.Run(); err != nil {
+				t.Fatalf("Run() error = %v", err)
+			}
+
+			if !strings.Contains(stdout.String(), tt.wantOutput) {
+				t.Errorf("expected output to contain %q, got %q", tt.wantOutput, stdout.String())
+			}
+
+			headCommit := testx.ResultOfA[*object.Commit](t, setup.repo.CommitObject, testx.ResultOf(t, setup.repo.Head).Hash())
+			if _, err := headCommit.File("notes.txt"); err != nil {
+				t.Fatalf("expected feature branch to be merged: %v", err)
+			}
+
+			envFile, err := headCommit.File(".env")
+			if err != nil {
+				t.Fatalf("failed to get .env from HEAD: %v", err)
+			}
+
+			reader, err := envFile.Reader()
+			if err != nil {
+				t.Fatalf("failed to read .env: %v", err)
+			}
+
+			t.Cleanup(func() {
+				_ = reader.Close()
+			})
+
+			_, err = age.Decrypt(reader, newID)
+			if tt.masterSection && err != nil {
+				t.Errorf("expected .env to be encrypted for the recipients of master: %v", err)
+			} else if !tt.masterSection && err == nil {
+				t.Errorf("expected .env to stay encrypted for the default recipients")
+			}
+		})
+	}
+}
+
+func commitFile(tb testing.TB, wt *git.Worktree, name, content, msg string) {
+	tb.Helper()
+
+	if err := os.WriteFile(filepath.Join(wt.Filesystem.Root(), name), []byte(content), 0o600); err != nil {
+		tb.Fatalf("failed to write %s: %v", name, err)
+	}
+
+	if _, err := wt.Add(name); err != nil {
+		tb.Fatalf("failed to add %s: %v", name, err)
+	}
+
+	if _, err := wt.Commit(msg, new(git.CommitOptions)); err != nil {
+		tb.Fatalf("failed to commit: %v", err)
+	}
+}
@@ -0,0 +1,353 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"filippo.io/age"
+	"github.com/alecthomas/kong"
+
+	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/core/services"
+	"github.com/prskr/git-age/infrastructure"
+)
+
+// abbreviatedKeyLength is the length from which public keys are shortened in tables,
+// post-quantum keys are almost 2000 characters long.
+const abbreviatedKeyLength = 72
+
+type RecipientsCliHandler struct {
+	List RecipientsListCliHandler `cmd:"" name:"list" aliases:"ls" help:"List the recipients with their type and whether they are yours"`
+	Log  RecipientsLogCliHandler  `cmd:"" name:"log" help:"Show who was added to or removed from the recipients over time"`
+
+	PruneExpired RecipientsPruneExpiredCliHandler `cmd:"" name:"prune-expired" help:"Remove expired recipients and re-encrypt all files"`
+}
+
+func (h *RecipientsCliHandler) AfterApply(kongCtx *kong.Context, cwd ports.CWD) error {
+	gitRepo, repoFS, err := infrastructure.NewGitRepositoryFromPath(cwd)
+	if err != nil {
+		return err
+	}
+
+	kongCtx.Bind(gitRepo)
+	kongCtx.BindTo(repoFS, (*ports.ReadWriteFS)(nil))
+
+	return nil
+}
+
+type RecipientsListCliHandler struct {
+	KeysFlag `embed:""`
+	JSON     bool `name:"json" help:"Print JSON instead of a table"`
+}
+
+// recipientListing is a single recipient in the output of recipients list.
+type recipientListing struct {
+	infrastructure.RecipientDetails
+	// Local is set if one of the local identities (or the shared passphrase) decrypts files for this recipient
+	Local bool `json:"local"`
+}
+
+func (h *RecipientsListCliHandler) Run(
+	ctx context.Context,
+	stdout ports.STDOUT,
+	cwd ports.CWD,
+	env ports.OSEnv,
+	repoFS ports.ReadWriteFS,
+	repo *infrastructure.GitRepository,
+) error {
+	raw, err := fs.ReadFile(repoFS, ports.RecipientsFileName)
+	if err != nil {
+		return fmt.Errorf("failed to read recipients file: %w", err)
+	}
+
+	details := infrastructure.InspectRecipients(raw)
+	listings := make([]recipientListing, 0, len(details))
+
+	needsPassphrase := slices.ContainsFunc(details, func(detail infrastructure.RecipientDetails) bool {
+		return detail.Type == infrastructure.RecipientTypePassphrase
+	})
+
+	ids, passphrase := h.localIdentities(ctx, cwd, env, repo, needsPassphrase)
+
+	for _, detail := range details {
+		listing := recipientListing{RecipientDetails: detail}
+
+		switch detail.Type {
+		case infrastructure.RecipientTypePassphrase:
+			listing.Local = passphrase
+		case infrastructure.RecipientTypeInvalid, infrastructure.RecipientTypePlugin:
+		default:
+			if recipient, _, err := infrastructure.ParseRecipient(detail.PublicKey); err == nil {
+				listing.Local = canDecrypt(recipient, ids)
+			}
+		}
+
+		listings = append(listings, listing)
+	}
+
+	if h.JSON {
+		return writeJSON(stdout, listings)
+	}
+
+	writer := tabwriter.NewWriter(stdout, 0, 0, 3, ' ', 0)
+
+	_, _ = fmt.Fprintln(writer, "Line\tType\tFingerprint\tLocal\tPublic Key\tComment\tNotes\t")
+
+	for _, listing := range listings {
+		var local string
+		if listing.Local {
+			local = "*"
+		}
+
+		_, _ = fmt.Fprintf(
+			writer, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t\n",
+			listing.Line, listing.Type, listing.Fingerprint, local, abbreviateKey(listing.PublicKey), listing.Comment, listingNotes(listing),
+		)
+	}
+
+	return writer.Flush()
+}
+
+// localIdentities returns the identities of the local identities stores and whether a shared passphrase is available.
+// Unavailable stores only lead to missing marks, the recipients are listed anyway.
+func (h *RecipientsListCliHandler) localIdentities(
+	ctx context.Context,
+	cwd ports.CWD,
+	env ports.OSEnv,
+	repo *infrastructure.GitRepository,
+	needsPassphrase bool,
+) (ids []age.Identity, passphrase bool) {
+	idStore, err := h.identitiesStore(ctx, cwd, env)
+	if err != nil {
+		slog.Warn("Failed to init identities store, local recipients are not marked", slog.String("err", err.Error()))
+		return nil, false
+	}
+
+	var query ports.IdentitiesQuery
+	if query.Remotes, err = repo.Remotes(); err != nil {
+		slog.Warn("Failed to determine Git remotes", slog.String("err", err.Error()))
+	}
+
+	if ids, err = idStore.Identities(ctx, query); err != nil {
+		slog.Warn("Failed to get identities, local recipients are not marked", slog.String("err", err.Error()))
+	}
+
+	if needsPassphrase {
+		_, err = idStore.Passphrase(ctx, query)
+		passphrase = err == nil
+	}
+
+	return ids, passphrase
+}
+
+func listingNotes(listing recipientListing) string {
+	var notes []string
+
+	if listing.Error != "" {
+		notes = append(notes, listing.Error)
+	}
+
+	if listing.DuplicateOf > 0 {
+		notes = append(notes, fmt.Sprintf("duplicate of line %d", listing.DuplicateOf))
+	}
+
+	if listing.Ref != "" {
+		notes = append(notes, "only on "+listing.Ref)
+	}
+
+	switch {
+	case listing.IsExpired(time.Now()):
+		notes = append(notes, "expired "+listing.Expires.Format(time.DateOnly))
+	case !listing.Expires.IsZero():
+		notes = append(notes, "expires "+listing.Expires.Format(time.DateOnly))
+	}
+
+	return strings.Join(notes, ", ")
+}
+
+type RecipientsLogCliHandler struct {
+	At   string `name:"at" placeholder:"REV" help:"Print the recipients effective at the given revision instead of the history"`
+	JSON bool   `name:"json" help:"Print JSON instead of text"`
+}
+
+func (h *RecipientsLogCliHandler) Run(stdout ports.STDOUT, repo *infrastructure.GitRepository) error {
+	if h.At != "" {
+		recipients, err := repo.RecipientsAt(h.At)
+		if err != nil {
+			return err
+		}
+
+		if h.JSON {
+			return writeJSON(stdout, recipients)
+		}
+
+		return writeRecipientEntries(stdout, recipients)
+	}
+
+	changes, err := repo.RecipientsLog()
+	if err != nil {
+		return err
+	}
+
+	if h.JSON {
+		return writeJSON(stdout, changes)
+	}
+
+	for idx, change := range changes {
+		if idx > 0 {
+			_, _ = fmt.Fprintln(stdout)
+		}
+
+		_, _ = fmt.Fprintf(stdout, "commit %s\n", change.Commit)
+		_, _ = fmt.Fprintf(stdout, "Author: %s\n", change.Author)
+		_, _ = fmt.Fprintf(stdout, "Date:   %s\n", change.Date.Format(time.RFC3339))
+		_, _ = fmt.Fprintf(stdout, "\n    %s\n\n", change.Message)
+
+		for _, entry := range change.Added {
+			_, _ = fmt.Fprintf(stdout, "  + %s\n", formatRecipientEntry(entry))
+		}
+
+		for _, entry := range change.Removed {
+			_, _ = fmt.Fprintf(stdout, "  - %s\n", formatRecipientEntry(entry))
+		}
+	}
+
+	return nil
+}
+
+func writeRecipientEntries(out io.Writer, entries []infrastructure.RecipientEntry) error {
+	writer := tabwriter.NewWriter(out, 0, 0, 3, ' ', 0)
+
+	_, _ = fmt.Fprintln(writer, "Public Key\tComment\t")
+
+	for _, entry := range entries {
+		_, _ = fmt.Fprintf(writer, "%s\t%s\t\n", abbreviateKey(entry.PublicKey), entry.Comment)
+	}
+
+	return writer.Flush()
+}
+
+func writeJSON(out io.Writer, v any) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(v)
+}
+
+func formatRecipientEntry(entry infrastructure.RecipientEntry) string {
+	if entry.Comment == "" {
+		return abbreviateKey(entry.PublicKey)
+	}
+
+	return fmt.Sprintf("%s (%s)", abbreviateKey(entry.PublicKey), entry.Comment)
+}
+
+// abbreviateKey shortens long public keys for display, the full keys are part of the JSON output.
+func abbreviateKey(pubKey string) string {
+	if len(pubKey) <= abbreviatedKeyLength {
+		return pubKey
+	}
+
+	return pubKey[:32] + "..." + pubKey[len(pubKey)-16:]
+}
+
+type RecipientsPruneExpiredCliHandler struct {
+	KeysFlag       `embed:""`
+	SigningKeyFlag `embed:""`
+	Message        string `help:"Message to be used for the commit" default:"chore: prune expired recipients" short:"m"`
+}
+
+func (h *RecipientsPruneExpiredCliHandler) Run(
+	ctx context.Context,
+	stdout ports.STDOUT,
+	cwd ports.CWD,
+	env ports.OSEnv,
+	repoFS ports.ReadWriteFS,
+	repo *infrastructure.GitRepository,
+) error {
+	if isDirty, err := repo.IsStagingDirty(); err != nil {
+		return fmt.Errorf("failed to check if repository is dirty: %w", err)
+	} else if isDirty {
+		slog.Warn("Repository is dirty")
+		os.Exit(1)
+	}
+
+	recipients, err := h.recipientsFile(cwd, env, repoFS)
+	if err != nil {
+		return err
+	}
+
+	expired, err := recipients.Expiring(time.Now())
+	if err != nil {
+		return err
+	}
+
+	if len(expired) == 0 {
+		_, err = fmt.Fprintln(stdout, "No expired recipients")
+		return err
+	}
+
+	idStore, err := h.identitiesStore(ctx, cwd, env)
+	if err != nil {
+		return fmt.Errorf("failed to init identities store: %w", err)
+	}
+
+	remotes, err := repo.Remotes()
+	if err != nil {
+		return fmt.Errorf("failed to determine Git remotes: %w", err)
+	}
+
+	ids, err := idStore.Identities(ctx, ports.IdentitiesQuery{Remotes: remotes})
+	if err != nil {
+		return fmt.Errorf("failed to get identities: %w", err)
+	}
+
+	pubKeys := make([]string, 0, len(expired))
+	for _, entry := range expired {
+		pubKeys = append(pubKeys, entry.PublicKey)
+	}
+
+	slog.Info("Removing expired recipients", slog.Any("recipients", pubKeys))
+	if err := recipients.Remove(pubKeys...); err != nil {
+		return fmt.Errorf("failed to remove expired recipients: %w", err)
+	}
+
+	// the sealer has to be created after the removal to encrypt for the remaining recipients only
+	openSealer, err := services.NewAgeSealer(
+		services.WithIdentities(ids...),
+		services.WithRecipients(recipients),
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := stageRecipients(repo, repoFS); err != nil {
+		return err
+	}
+
+	if err := repo.WalkAgeFiles(services.ReEncryptWalkFunc(repo, repoFS, openSealer)); err != nil {
+		return err
+	}
+
+	slog.Info("Committing changes")
+	if err := repo.Commit(h.Message); err != nil {
+		return fmt.Errorf("failed to commit changes: %w", err)
+	}
+
+	for _, entry := range expired {
+		if _, err := fmt.Fprintf(stdout, "%s expired %s\n", formatRecipientEntry(entry), entry.Expires.Format(time.DateOnly)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,220 @@
+package cli_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/alecthomas/kong"
+
+	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/handlers/cli"
+	"github.com/prskr/git-age/infrastructure"
+	"github.com/prskr/git-age/internal/testx"
+)
+
+func TestRecipientsListCliHandler_Run(t *testing.T) {
+	t.Parallel()
+
+	setup := prepareTestRepo(t)
+
+	foreign := testx.ResultOf(t, age.GenerateX25519Identity).Recipient().String()
+	content := string(recipients) + "# Bob\n" + foreign + "\ngarbage\n" + string(recipients)
+
+	if err := os.WriteFile(filepath.Join(setup.root, ports.RecipientsFileName), []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write recipients file: %v", err)
+	}
+
+	outBuf := new(bytes.Buffer)
+	parser := newKong(
+		t,
+		new(cli.RecipientsCliHandler),
+		kong.Bind(ports.CWD(setup.root)),
+		kong.BindTo(testx.Context(t), (*context.Context)(nil)),
+		kong.BindTo(ports.STDOUT(outBuf), (*ports.STDOUT)(nil)),
+		kong.Bind(ports.NewOSEnv()),
+	)
+
+	ctx, err := parser.Parse([]string{"list", "--json", "-k", fmt.Sprintf("file:///%s/keys.txt", filepath.ToSlash(setup.root))})
+	if err != nil {
+		t.Fatalf("failed to parse arguments: %v", err)
+	}
+
+	if err := ctx.Run(); err != nil {
+		t.Fatalf("failed to run command: %v", err)
+	}
+
+	var got []struct {
+		infrastructure.RecipientDetails
+		Local bool `json:"local"`
+	}
+
+	if err := json.Unmarshal(outBuf.Bytes(), &got); err != nil {
+		t.Fatalf("failed to parse output: %v\n%s", err, outBuf.String())
+	}
+
+	if len(got) != 4 {
+		t.Fatalf("expected 4 recipients, got %+v", got)
+	}
+
+	if !got[0].Local || got[0].Type != infrastructure.RecipientTypeX25519 {
+		t.Errorf("expected the sample recipient to be a local x25519 recipient, got %+v", got[0])
+	}
+
+	if got[1].Local || got[1].Comment != "Bob" {
+		t.Errorf("expected Bob not to be local, got %+v", got[1])
+	}
+
+	if got[2].Type != infrastructure.RecipientTypeInvalid || got[2].Error == "" {
+		t.Errorf("expected garbage to be invalid, got %+v", got[2])
+	}
+
+	if got[3].DuplicateOf != got[0].Line {
+		t.Errorf("expected duplicate of line %d, got %+v", got[0].Line, got[3])
+	}
+}
+
+func TestRecipientsLogCliHandler_Run(t *testing.T) {
+	t.Parallel()
+
+	sampleRecipient := strings.TrimSpace(string(recipients))
+
+	tests := []struct {
+		name string
+		args []string
+		want func(tb testing.TB, out []byte)
+	}{
+		{
+			name: "History as JSON",
+			args: []string{"log", "--json"},
+			want: func(tb testing.TB, out []byte) {
+				tb.Helper()
+
+				var changes []infrastructure.RecipientsChange
+				if err := json.Unmarshal(out, &changes); err != nil {
+					tb.Fatalf("failed to parse output: %v\n%s", err, out)
+				}
+
+				if len(changes) != 1 || changes[0].Message != "initial commit" {
+					tb.Fatalf("expected the initial commit only, got %+v", changes)
+				}
+
+				if len(changes[0].Added) != 1 || changes[0].Added[0].PublicKey != sampleRecipient {
+					tb.Errorf("expected %s to be added, got %+v", sampleRecipient, changes[0].Added)
+				}
+			},
+		},
+		{
+			name: "History as text",
+			args: []string{"log"},
+			want: func(tb testing.TB, out []byte) {
+				tb.Helper()
+
+				if !bytes.Contains(out, []byte("  + "+sampleRecipient+"\n")) {
+					tb.Errorf("expected %s to be listed as added, got:\n%s", sampleRecipient, out)
+				}
+			},
+		},
+		{
+			name: "Recipients at revision",
+			args: []string{"log", "--at", "HEAD"},
+			want: func(tb testing.TB, out []byte) {
+				tb.Helper()
+
+				if !bytes.Contains(out, []byte(sampleRecipient)) {
+					tb.Errorf("expected %s to be listed, got:\n%s", sampleRecipient, out)
+				}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			setup := prepareTestRepo(t)
+
+			outBuf := new(bytes.Buffer)
+			parser := newKong(
+				t,
+				new(cli.RecipientsCliHandler),
+				kong.Bind(ports.CWD(setup.root)),
+				kong.BindTo(ports.STDOUT(outBuf), (*ports.STDOUT)(nil)),
+			)
+
+			ctx, err := parser.Parse(tt.args)
+			if err != nil {
+				t.Fatalf("failed to parse arguments: %v", err)
+			}
+
+			if err := ctx.Run(); err != nil {
+				t.Fatalf("failed to run command: %v", err)
+			}
+
+			tt.want(t, outBuf.Bytes())
+		})
+	}
+}
+
+func TestRecipientsPruneExpiredCliHandler_Run(t *testing.T) {
+	t.Parallel()
+
+	setup := prepareTestRepo(t)
+	repo := testx.ResultOfA[*infrastructure.GitRepository](t, infrastructure.NewGitRepository, setup.repoFS, setup.repo)
+
+	run := func() string {
+		outBuf := new(bytes.Buffer)
+		parser := newKong(
+			t,
+			new(cli.RecipientsCliHandler),
+			kong.Bind(ports.CWD(setup.root)),
+			kong.BindTo(testx.Context(t), (*context.Context)(nil)),
+			kong.BindTo(ports.STDOUT(outBuf), (*ports.STDOUT)(nil)),
+			kong.Bind(ports.NewOSEnv()),
+		)
+
+		ctx, err := parser.Parse([]string{"prune-expired", "-k", fmt.Sprintf("file:///%s/keys.txt", filepath.ToSlash(setup.root))})
+		if err != nil {
+			t.Fatalf("failed to parse arguments: %v", err)
+		}
+
+		if err := ctx.Run(); err != nil {
+			t.Fatalf("failed to run command: %v", err)
+		}
+
+		return outBuf.String()
+	}
+
+	if out := run(); !strings.Contains(out, "No expired recipients") {
+		t.Errorf("expected nothing to be pruned, got:\n%s", out)
+	}
+
+	contractor := testx.ResultOf(t, age.GenerateX25519Identity).Recipient().String()
+	content := string(recipients) + "# Contractor\n# expires: 2020-01-31\n" + contractor + "\n"
+
+	if err := os.WriteFile(filepath.Join(setup.root, ports.RecipientsFileName), []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write recipients file: %v", err)
+	}
+
+	if err := repo.StageFile(ports.RecipientsFileName); err != nil {
+		t.Fatalf("failed to stage recipients file: %v", err)
+	}
+
+	if err := repo.Commit("chore: add contractor"); err != nil {
+		t.Fatalf("failed to commit recipients file: %v", err)
+	}
+
+	if out := run(); !strings.Contains(out, contractor+" (Contractor) expired 2020-01-31") {
+		t.Errorf("expected contractor to be pruned, got:\n%s", out)
+	}
+
+	if got := string(readObjectAtHead(t, repo, ports.RecipientsFileName)); got != string(recipients) {
+		t.Errorf("expected only the sample recipient to be left, got:\n%s", got)
+	}
+}
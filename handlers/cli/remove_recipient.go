@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/alecthomas/kong"
+
+	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/core/services"
+	"github.com/prskr/git-age/infrastructure"
+)
+
+type RemoveRecipientCliHandler struct {
+	KeysFlag       `embed:""`
+	SigningKeyFlag `embed:""`
+	Recipients     []string `arg:"" help:"Recipient(s) to remove"`
+	Message        string   `help:"Message to be used for the commit" default:"chore: remove recipient" short:"m"`
+}
+
+func (h *RemoveRecipientCliHandler) Run(
+	ctx context.Context,
+	repoFS ports.ReadWriteFS,
+	recipients ports.Recipients,
+	identities ports.IdentitiesStore,
+	repo ports.GitRepository,
+) error {
+	if isDirty, err := repo.IsStagingDirty(); err != nil {
+		return fmt.Errorf("failed to check if repository is dirty: %w", err)
+	} else if isDirty {
+		slog.Warn("Repository is dirty")
+		os.Exit(1)
+	}
+
+	remotes, err := repo.Remotes()
+	if err != nil {
+		return fmt.Errorf("failed to determine Git remotes: %w", err)
+	}
+
+	ids, err := identities.Identities(ctx, ports.IdentitiesQuery{Remotes: remotes})
+	if err != nil {
+		return fmt.Errorf("failed to get identities: %w", err)
+	}
+
+	slog.Info("Removing recipients", slog.Any("recipients", h.Recipients))
+	if err := recipients.Remove(h.Recipients...); err != nil {
+		return fmt.Errorf("failed to remove public keys from recipients file: %w", err)
+	}
+
+	// the sealer has to be created after the removal to encrypt for the remaining recipients only
+	openSealer, err := services.NewAgeSealer(
+		services.WithIdentities(ids...),
+		services.WithRecipients(recipients),
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := stageRecipients(repo, repoFS); err != nil {
+		return err
+	}
+
+	if err := repo.WalkAgeFiles(services.ReEncryptWalkFunc(repo, repoFS, openSealer)); err != nil {
+		return err
+	}
+
+	slog.Info("Committing changes")
+	if err := repo.Commit(h.Message); err != nil {
+		return fmt.Errorf("failed to commit changes: %w", err)
+	}
+
+	return nil
+}
+
+func (h *RemoveRecipientCliHandler) AfterApply(
+	ctx context.Context,
+	kongCtx *kong.Context,
+	cwd ports.CWD,
+	env ports.OSEnv,
+) error {
+	gitRepo, repoFS, err := infrastructure.NewGitRepositoryFromPath(cwd)
+	if err != nil {
+		return err
+	}
+
+	idStore, err := h.identitiesStore(ctx, cwd, env)
+	if err != nil {
+		return fmt.Errorf("failed to init identities store: %w", err)
+	}
+
+	recipients, err := h.recipientsFile(cwd, env, repoFS)
+	if err != nil {
+		return err
+	}
+
+	kongCtx.BindTo(repoFS, (*ports.ReadWriteFS)(nil))
+	kongCtx.BindTo(gitRepo, (*ports.GitRepository)(nil))
+	kongCtx.BindTo(recipients, (*ports.Recipients)(nil))
+	kongCtx.BindTo(idStore, (*ports.IdentitiesStore)(nil))
+
+	return nil
+}
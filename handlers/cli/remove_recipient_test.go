@@ -0,0 +1,112 @@
+package cli_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/alecthomas/kong"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/handlers/cli"
+	"github.com/prskr/git-age/infrastructure"
+	"github.com/prskr/git-age/internal/testx"
+)
+
+func TestRemoveRecipientCliHandler_Run_Signed(t *testing.T) {
+	t.Parallel()
+
+	setup := prepareTestRepo(t)
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate signing key: %v", err)
+	}
+
+	signingKeyPath := filepath.Join(t.TempDir(), "id_ed25519")
+	block := testx.ResultOfA[*pem.Block](t, ssh.MarshalPrivateKey, key, "maintainer")
+	if err := os.WriteFile(signingKeyPath, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatalf("failed to write signing key: %v", err)
+	}
+
+	idToRemove := testx.ResultOf(t, age.GenerateX25519Identity)
+	keysArg := fmt.Sprintf("file:///%s/keys.txt", filepath.ToSlash(setup.root))
+
+	run := func(grammar any, args ...string) error {
+		parser := newKong(
+			t,
+			grammar,
+			kong.Bind(ports.CWD(setup.root)),
+			kong.BindTo(testx.Context(t), (*context.Context)(nil)),
+			kong.Bind(ports.NewOSEnv()),
+			kong.BindTo(ports.STDIN(io.NopCloser(strings.NewReader(""))), (*ports.STDIN)(nil)),
+			kong.BindTo(ports.STDERR(io.Discard), (*ports.STDERR)(nil)),
+		)
+
+		ctx, err := parser.Parse(append([]string{"-k", keysArg}, args...))
+		if err != nil {
+			t.Fatalf("failed to parse arguments: %v", err)
+		}
+
+		return ctx.Run()
+	}
+
+	if err := run(new(cli.AddRecipientCliHandler), "--signing-key", signingKeyPath, idToRemove.Recipient().String()); err != nil {
+		t.Fatalf("failed to add recipient: %v", err)
+	}
+
+	if err := run(new(cli.RemoveRecipientCliHandler), idToRemove.Recipient().String()); !errors.Is(err, infrastructure.ErrSigningKeyRequired) {
+		t.Fatalf("expected removal without signing key to fail with %v, got %v", infrastructure.ErrSigningKeyRequired, err)
+	}
+
+	if err := run(new(cli.RemoveRecipientCliHandler), "--signing-key", signingKeyPath, idToRemove.Recipient().String()); err != nil {
+		t.Fatalf("failed to remove recipient: %v", err)
+	}
+
+	repo := testx.ResultOfA[*infrastructure.GitRepository](t, infrastructure.NewGitRepository, setup.repoFS, setup.repo)
+
+	sig := readObjectAtHead(t, repo, ports.RecipientsSignatureFileName)
+	if _, err := infrastructure.VerifySSH(sig, infrastructure.RecipientsSignatureNamespace, readObjectAtHead(t, repo, ports.RecipientsFileName)); err != nil {
+		t.Errorf("committed signature does not match committed recipients: %v", err)
+	}
+
+	obj, err := repo.OpenObjectAtHead(".env")
+	if err != nil {
+		t.Fatalf("failed to open object: %v", err)
+	}
+
+	objReader := testx.ResultOf(t, obj.Reader)
+	t.Cleanup(func() {
+		_ = objReader.Close()
+	})
+
+	if _, err := age.Decrypt(objReader, idToRemove); err == nil {
+		t.Error("removed recipient is still able to decrypt .env")
+	}
+}
+
+func readObjectAtHead(tb testing.TB, repo *infrastructure.GitRepository, filePath string) []byte {
+	tb.Helper()
+
+	obj, err := repo.OpenObjectAtHead(filePath)
+	if err != nil {
+		tb.Fatalf("failed to open %s at HEAD: %v", filePath, err)
+	}
+
+	content, err := obj.Contents()
+	if err != nil {
+		tb.Fatalf("failed to read %s at HEAD: %v", filePath, err)
+	}
+
+	return []byte(content)
+}
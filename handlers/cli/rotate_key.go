@@ -0,0 +1,194 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"time"
+
+	"filippo.io/age"
+	"github.com/alecthomas/kong"
+
+	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/core/services"
+	"github.com/prskr/git-age/infrastructure"
+)
+
+var (
+	ErrNoOwnRecipient     = errors.New("none of the local identities is a recipient of this repository")
+	ErrInvalidGracePeriod = errors.New("grace period has to be positive, clones that did not pull the rotation yet need the old key")
+)
+
+type RotateKeyCliHandler struct {
+	KeysFlag       `embed:""`
+	CommentFlag    `embed:""`
+	RemoteFlag     `embed:""`
+	AlgorithmFlag  `embed:""`
+	SigningKeyFlag `embed:""`
+	Message        string        `help:"Message to be used for the commit" default:"chore: rotate key" short:"m"`
+	Retire         bool          `help:"Retire the old key from the identities store"`
+	GracePeriod    time.Duration `help:"Grace period after which the old key is retired" default:"168h"`
+}
+
+func (h *RotateKeyCliHandler) Run(
+	ctx context.Context,
+	stdout ports.STDOUT,
+	repoFS ports.ReadWriteFS,
+	recipients ports.Recipients,
+	identities ports.IdentitiesStore,
+	repo ports.GitRepository,
+) error {
+	if h.Retire && h.GracePeriod <= 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidGracePeriod, h.GracePeriod)
+	}
+
+	if isDirty, err := repo.IsStagingDirty(); err != nil {
+		return fmt.Errorf("failed to check if repository is dirty: %w", err)
+	} else if isDirty {
+		slog.Warn("Repository is dirty")
+		os.Exit(1)
+	}
+
+	remotes, err := repo.Remotes()
+	if err != nil {
+		return fmt.Errorf("failed to determine Git remotes: %w", err)
+	}
+
+	ids, err := identities.Identities(ctx, ports.IdentitiesQuery{Remotes: remotes})
+	if err != nil {
+		return fmt.Errorf("failed to get identities: %w", err)
+	}
+
+	oldPubKeys, err := ownRecipients(recipients, ids)
+	if err != nil {
+		return err
+	}
+
+	cmd := ports.GenerateIdentityCommand{
+		Comment:   h.Comment,
+		Remote:    h.Remote,
+		Algorithm: h.Algorithm,
+	}
+
+	newPubKey, err := identities.Generate(ctx, cmd)
+	if err != nil {
+		return fmt.Errorf("failed to generate identity: %w", err)
+	}
+
+	slog.Info("Replacing recipients", slog.Any("old", oldPubKeys), slog.String("new", newPubKey))
+	if _, err := recipients.Append(newPubKey, h.Comment); err != nil {
+		return fmt.Errorf("failed to append public key to recipients file: %w", err)
+	}
+
+	if err := recipients.Remove(oldPubKeys...); err != nil {
+		return fmt.Errorf("failed to remove old public keys from recipients file: %w", err)
+	}
+
+	openSealer, err := services.NewAgeSealer(
+		services.WithIdentities(ids...),
+		services.WithRecipients(recipients),
+	)
+	if err != nil {
+		return err
+	}
+
+	if err := stageRecipients(repo, repoFS); err != nil {
+		return err
+	}
+
+	if err := repo.WalkAgeFiles(services.ReEncryptWalkFunc(repo, repoFS, openSealer)); err != nil {
+		return err
+	}
+
+	slog.Info("Committing changes")
+	if err := repo.Commit(h.Message); err != nil {
+		return fmt.Errorf("failed to commit changes: %w", err)
+	}
+
+	if h.Retire {
+		if err := h.retire(ctx, identities, oldPubKeys); err != nil {
+			return err
+		}
+	}
+
+	_, err = fmt.Fprintln(stdout, newPubKey)
+
+	return err
+}
+
+func (h *RotateKeyCliHandler) AfterApply(
+	ctx context.Context,
+	kongCtx *kong.Context,
+	cwd ports.CWD,
+	env ports.OSEnv,
+) error {
+	gitRepo, repoFS, err := infrastructure.NewGitRepositoryFromPath(cwd)
+	if err != nil {
+		return err
+	}
+
+	idStore, err := h.identitiesStore(ctx, cwd, env)
+	if err != nil {
+		return fmt.Errorf("failed to init identities store: %w", err)
+	}
+
+	recipients, err := h.recipientsFile(cwd, env, repoFS)
+	if err != nil {
+		return err
+	}
+
+	kongCtx.BindTo(repoFS, (*ports.ReadWriteFS)(nil))
+	kongCtx.BindTo(gitRepo, (*ports.GitRepository)(nil))
+	kongCtx.BindTo(recipients, (*ports.Recipients)(nil))
+	kongCtx.BindTo(idStore, (*ports.IdentitiesStore)(nil))
+
+	return nil
+}
+
+func (h *RotateKeyCliHandler) retire(ctx context.Context, identities ports.IdentitiesStore, pubKeys []string) error {
+	retirer, ok := identities.(ports.IdentityRetirer)
+	if !ok {
+		return services.ErrRetiringNotSupported
+	}
+
+	retireAfter := time.Now().Add(h.GracePeriod)
+	for _, pubKey := range pubKeys {
+		slog.Info("Retiring old key", slog.String("public_key", pubKey), slog.Time("after", retireAfter))
+		if err := retirer.Retire(ctx, pubKey, retireAfter); err != nil {
+			return fmt.Errorf("failed to retire old key: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// ownRecipients determines the public keys in the recipients file the given identities belong to.
+func ownRecipients(recipients ports.Recipients, ids []age.Identity) ([]string, error) {
+	all, err := recipients.All()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recipients: %w", err)
+	}
+
+	known := make([]string, 0, len(all))
+	for _, r := range all {
+		if stringer, ok := r.(fmt.Stringer); ok {
+			known = append(known, stringer.String())
+		}
+	}
+
+	var own []string
+	for _, id := range ids {
+		if pubKey, ok := ports.PublicKeyOf(id); ok && slices.Contains(known, pubKey) && !slices.Contains(own, pubKey) {
+			own = append(own, pubKey)
+		}
+	}
+
+	if len(own) == 0 {
+		return nil, ErrNoOwnRecipient
+	}
+
+	return own, nil
+}
@@ -0,0 +1,181 @@
+package cli_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"github.com/alecthomas/kong"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/handlers/cli"
+	"github.com/prskr/git-age/infrastructure"
+	"github.com/prskr/git-age/internal/testx"
+)
+
+func TestRotateKeyCliHandler_Run(t *testing.T) {
+	t.Parallel()
+
+	setup := prepareTestRepo(t)
+	outBuf := new(bytes.Buffer)
+
+	parser := newKong(
+		t,
+		new(cli.RotateKeyCliHandler),
+		kong.Bind(ports.CWD(setup.root)),
+		kong.BindTo(testx.Context(t), (*context.Context)(nil)),
+		kong.BindTo(ports.STDOUT(outBuf), (*ports.STDOUT)(nil)),
+		kong.Bind(ports.NewOSEnv()),
+	)
+
+	args := []string{
+		"-k", fmt.Sprintf("file:///%s/keys.txt", filepath.ToSlash(setup.root)),
+		"-c", "rotated key",
+		"--retire",
+	}
+
+	ctx, err := parser.Parse(args)
+	if err != nil {
+		t.Errorf("failed to parse arguments: %v", err)
+		return
+	}
+
+	if err := ctx.Run(); err != nil {
+		t.Errorf("failed to run command: %v", err)
+		return
+	}
+
+	newPubKey := strings.TrimSpace(outBuf.String())
+
+	recipientsFile, err := os.ReadFile(filepath.Join(setup.root, ports.RecipientsFileName))
+	if err != nil {
+		t.Errorf("failed to read recipients file: %v", err)
+		return
+	}
+
+	if !strings.Contains(string(recipientsFile), newPubKey) {
+		t.Errorf("expected new public key %s in recipients file", newPubKey)
+	}
+
+	if bytes.Contains(recipientsFile, bytes.TrimSpace(recipients)) {
+		t.Errorf("expected old public key to be removed from recipients file")
+	}
+
+	keysFile, err := os.ReadFile(filepath.Join(setup.root, "keys.txt"))
+	if err != nil {
+		t.Errorf("failed to read keys file: %v", err)
+		return
+	}
+
+	if got := strings.Count(string(keysFile), "# retire after: "); got != 1 {
+		t.Errorf("expected old identity to be marked for retirement once, got %d markers", got)
+	}
+
+	// during the grace period the old key is still usable e.g. for commits before the rotation
+	store := infrastructure.FileIdentityStore(url.URL{Path: filepath.Join(setup.root, "keys.txt")})
+	storeIDs, err := store.Identities(testx.Context(t), ports.IdentitiesQuery{})
+	if err != nil {
+		t.Errorf("failed to read identities: %v", err)
+		return
+	}
+
+	if len(storeIDs) != 2 {
+		t.Errorf("expected old identity to be usable during the grace period, got %d identities", len(storeIDs))
+	}
+
+	var ids []age.Identity
+	for _, id := range storeIDs {
+		if pubKey, _ := ports.PublicKeyOf(id); pubKey == newPubKey {
+			ids = append(ids, id)
+		}
+	}
+
+	repo, err := infrastructure.NewGitRepository(setup.repoFS, setup.repo)
+	if err != nil {
+		t.Errorf("failed to create repository: %v", err)
+		return
+	}
+
+	obj, err := repo.OpenObjectAtHead(".env")
+	if err != nil {
+		t.Errorf("failed to open object: %v", err)
+		return
+	}
+
+	objReader, err := obj.Reader()
+	if err != nil {
+		t.Errorf("failed to get reader: %v", err)
+		return
+	}
+
+	t.Cleanup(func() {
+		_ = objReader.Close()
+	})
+
+	if _, err = age.Decrypt(objReader, ids...); err != nil {
+		t.Errorf("failed to decrypt file with new identity: %v", err)
+	}
+
+	head := testx.ResultOf(t, setup.repo.Head)
+	headCommit := testx.ResultOfA[*object.Commit](t, setup.repo.CommitObject, head.Hash())
+	parent := testx.ResultOfA[*object.Commit](t, headCommit.Parent, 0)
+	oldFile := testx.ResultOfA[*object.File](t, parent.File, ".env")
+
+	oldReader, err := oldFile.Reader()
+	if err != nil {
+		t.Errorf("failed to get reader: %v", err)
+		return
+	}
+
+	t.Cleanup(func() {
+		_ = oldReader.Close()
+	})
+
+	if _, err = age.Decrypt(oldReader, storeIDs...); err != nil {
+		t.Errorf("failed to decrypt file of the commit before the rotation during the grace period: %v", err)
+	}
+}
+
+func TestRotateKeyCliHandler_Run_RejectsImmediateRetirement(t *testing.T) {
+	t.Parallel()
+
+	setup := prepareTestRepo(t)
+
+	parser := newKong(
+		t,
+		new(cli.RotateKeyCliHandler),
+		kong.Bind(ports.CWD(setup.root)),
+		kong.BindTo(testx.Context(t), (*context.Context)(nil)),
+		kong.BindTo(ports.STDOUT(new(bytes.Buffer)), (*ports.STDOUT)(nil)),
+		kong.Bind(ports.NewOSEnv()),
+	)
+
+	ctx, err := parser.Parse([]string{
+		"-k", fmt.Sprintf("file:///%s/keys.txt", filepath.ToSlash(setup.root)),
+		"--retire", "--grace-period", "0s",
+	})
+	if err != nil {
+		t.Fatalf("failed to parse arguments: %v", err)
+	}
+
+	if err := ctx.Run(); !errors.Is(err, cli.ErrInvalidGracePeriod) {
+		t.Errorf("Run() error = %v, want %v", err, cli.ErrInvalidGracePeriod)
+	}
+
+	keysFile, err := os.ReadFile(filepath.Join(setup.root, "keys.txt"))
+	if err != nil {
+		t.Fatalf("failed to read keys file: %v", err)
+	}
+
+	if !bytes.Equal(keysFile, keys) {
+		t.Errorf("expected keys file to stay untouched")
+	}
+}
@@ -3,6 +3,7 @@ package cli
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -44,17 +45,15 @@ func (h *SmudgeCliHandler) Run(stdin ports.STDIN, stdout ports.STDOUT) error {
 }
 
 func (h *SmudgeCliHandler) AfterApply(ctx context.Context, cwd ports.CWD, env ports.OSEnv) (err error) {
-	gitRepo, _, err := infrastructure.NewGitRepositoryFromPath(cwd)
+	gitRepo, repoFS, err := infrastructure.NewGitRepositoryFromPath(cwd)
 	if err != nil {
 		return fmt.Errorf("failed to init git repository: %w", err)
 	}
 
-	idStore, err := infrastructure.IdentitiesStore(
-		ctx,
-		infrastructure.NewAgentIdentitiesStoreSource(env),
-		infrastructure.NewFileIdentityStoreSource(h.Keys),
-	)
-	if err != nil {
+	idStore, err := h.identitiesStore(ctx, cwd, env)
+	if errors.Is(err, infrastructure.ErrAgentLocked) {
+		return fmt.Errorf("cannot decrypt %s: %w - unlock it with 'git age agent unlock' and run the checkout again", h.FileToCleanPath, err)
+	} else if err != nil {
 		return fmt.Errorf("failed to init identities store: %w", err)
 	}
 
@@ -72,6 +71,14 @@ func (h *SmudgeCliHandler) AfterApply(ctx context.Context, cwd ports.CWD, env po
 		return fmt.Errorf("failed to get identities: %w", err)
 	}
 
-	h.Opener, err = services.NewAgeSealer(services.WithIdentities(ids...))
+	recipients := infrastructure.NewRecipientsFile(repoFS)
+	recipients.Head = gitRepo
+
+	passphraseIDs, err := unlockPassphrase(ctx, idStore, recipients, query)
+	if err != nil {
+		return fmt.Errorf("cannot decrypt %s: %w", h.FileToCleanPath, err)
+	}
+
+	h.Opener, err = services.NewAgeSealer(services.WithIdentities(append(ids, passphraseIDs...)...))
 	return err
 }
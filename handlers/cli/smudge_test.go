@@ -3,18 +3,25 @@ package cli_test
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"testing"
 
+	"connectrpc.com/grpchealth"
 	"filippo.io/age"
 	"github.com/alecthomas/kong"
 	"github.com/minio/sha256-simd"
 
+	"github.com/prskr/git-age/api/gen/agent/v1/agentv1connect"
+
 	"github.com/prskr/git-age/core/ports"
 	"github.com/prskr/git-age/handlers/cli"
+	"github.com/prskr/git-age/infrastructure"
 	"github.com/prskr/git-age/internal/testx"
 )
 
@@ -62,6 +69,42 @@ func TestSmudgeCliHandler_Run(t *testing.T) {
 	}
 }
 
+func TestSmudgeCliHandler_LockedAgent(t *testing.T) {
+	t.Parallel()
+	setup := prepareTestRepo(t)
+
+	checker := grpchealth.NewStaticChecker(agentv1connect.IdentitiesStoreServiceName)
+	checker.SetStatus(agentv1connect.IdentitiesStoreServiceName, grpchealth.StatusNotServing)
+
+	mux := http.NewServeMux()
+	mux.Handle(grpchealth.NewHandler(checker))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	env := ports.NewOSEnv()
+	env["GIT_AGE_AGENT_HOST"] = server.URL
+
+	parser := newKong(
+		t,
+		new(cli.SmudgeCliHandler),
+		kong.Bind(ports.CWD(setup.root)),
+		kong.BindTo(testx.Context(t), (*context.Context)(nil)),
+		kong.BindTo(ports.STDIN(io.NopCloser(new(bytes.Buffer))), (*ports.STDIN)(nil)),
+		kong.BindTo(ports.STDOUT(new(bytes.Buffer)), (*ports.STDOUT)(nil)),
+		kong.Bind(env),
+	)
+
+	args := []string{
+		"-k", fmt.Sprintf("file:///%s/keys.txt", filepath.ToSlash(setup.root)),
+		".env",
+	}
+
+	_, err := parser.Parse(args)
+	if !errors.Is(err, infrastructure.ErrAgentLocked) {
+		t.Errorf("expected agent locked error, got %v", err)
+	}
+}
+
 func encryptFileToBuffer(tb testing.TB, filePath string) *bytes.Buffer {
 	tb.Helper()
 
@@ -0,0 +1,101 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"text/tabwriter"
+
+	"github.com/alecthomas/kong"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/infrastructure"
+)
+
+type TrustCliHandler struct {
+	List   ListTrustCliHandler   `cmd:"" name:"list" aliases:"ls" help:"List the keys trusted to sign the recipients file"`
+	Add    AddTrustCliHandler    `cmd:"" name:"add" help:"Trust a key to sign the recipients file"`
+	Remove RemoveTrustCliHandler `cmd:"" name:"remove" aliases:"rm" help:"Stop trusting a key to sign the recipients file"`
+}
+
+func (h *TrustCliHandler) AfterApply(kongCtx *kong.Context, cwd ports.CWD) error {
+	trustedSigners, err := infrastructure.NewTrustedSigners(cwd)
+	if err != nil {
+		return err
+	}
+
+	kongCtx.Bind(trustedSigners)
+
+	return nil
+}
+
+type ListTrustCliHandler struct{}
+
+func (ListTrustCliHandler) Run(trustedSigners *infrastructure.TrustedSigners, stdout ports.STDOUT) error {
+	signers, err := trustedSigners.All()
+	if err != nil {
+		return err
+	}
+
+	writer := tabwriter.NewWriter(stdout, 0, 0, 3, ' ', 0)
+
+	_, _ = fmt.Fprintln(writer, "Fingerprint\tType\tComment\t")
+
+	for _, signer := range signers {
+		_, _ = fmt.Fprintf(writer, "%s\t%s\t%s\t\n", infrastructure.SSHFingerprint(signer.Key), signer.Key.Type(), signer.Comment)
+	}
+
+	return writer.Flush()
+}
+
+type AddTrustCliHandler struct {
+	Key     string `arg:"" help:"SSH public key or path to a public key file"`
+	Comment string `short:"c" name:"comment" help:"Comment to add in file, defaults to the comment of the key"`
+}
+
+func (h *AddTrustCliHandler) Run(trustedSigners *infrastructure.TrustedSigners) error {
+	key, comment, err := parseSSHPublicKey(h.Key)
+	if err != nil {
+		return err
+	}
+
+	if h.Comment != "" {
+		comment = h.Comment
+	}
+
+	return trustedSigners.Add(key, comment)
+}
+
+type RemoveTrustCliHandler struct {
+	Key string `arg:"" help:"SSH public key or path to a public key file"`
+}
+
+func (h *RemoveTrustCliHandler) Run(trustedSigners *infrastructure.TrustedSigners) error {
+	key, _, err := parseSSHPublicKey(h.Key)
+	if err != nil {
+		return err
+	}
+
+	return trustedSigners.Remove(key)
+}
+
+// parseSSHPublicKey accepts either a public key in the authorized_keys format or a file containing one.
+func parseSSHPublicKey(keyOrPath string) (ssh.PublicKey, string, error) {
+	raw, err := os.ReadFile(keyOrPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		raw, err = []byte(keyOrPath), nil
+	}
+
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read public key: %w", err)
+	}
+
+	key, comment, _, _, err := ssh.ParseAuthorizedKey(raw)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to parse public key: %w", err)
+	}
+
+	return key, comment, nil
+}
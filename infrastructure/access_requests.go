@@ -0,0 +1,188 @@
+package infrastructure
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/prskr/git-age/core/ports"
+)
+
+const (
+	accessRequestExtension    = ".pub"
+	accessRequestRequestedKey = "requested-at:"
+)
+
+var (
+	ErrInvalidRequestName   = errors.New("request name may only contain letters, digits, dots, dashes and underscores")
+	ErrAccessRequestExists  = errors.New("access request already exists")
+	ErrAccessRequestMissing = errors.New("access request not found")
+	ErrInvalidAccessRequest = errors.New("invalid access request")
+)
+
+var requestNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// AccessRequest is a public key waiting to be added to the recipients by an existing member.
+type AccessRequest struct {
+	Name        string
+	PublicKey   string
+	Comment     string
+	RequestedAt time.Time
+}
+
+// Path is the path of the request file relative to the repository root.
+func (r AccessRequest) Path() string {
+	return AccessRequestPath(r.Name)
+}
+
+func AccessRequestPath(name string) string {
+	return path.Join(ports.AccessRequestsDirName, name+accessRequestExtension)
+}
+
+func NewAccessRequests(repoFS ports.ReadWriteFS) *AccessRequests {
+	return &AccessRequests{FS: repoFS}
+}
+
+// AccessRequests are the pending requests in the .agerequests directory of the repository,
+// every request is a file <name>.pub containing a comment, the time of the request and the public key.
+type AccessRequests struct {
+	FS ports.ReadWriteFS
+}
+
+func (a AccessRequests) Create(req AccessRequest) (err error) {
+	if !requestNamePattern.MatchString(req.Name) {
+		return fmt.Errorf("%w: %q", ErrInvalidRequestName, req.Name)
+	}
+
+	if _, err := fs.Stat(a.FS, req.Path()); err == nil {
+		return fmt.Errorf("%w: %s", ErrAccessRequestExists, req.Name)
+	}
+
+	if err := a.FS.Mkdir(ports.AccessRequestsDirName, true, 0o755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", ports.AccessRequestsDirName, err)
+	}
+
+	f, err := a.FS.Create(req.Path(), ports.WithTruncate)
+	if err != nil {
+		return fmt.Errorf("failed to create access request: %w", err)
+	}
+
+	defer func() {
+		err = errors.Join(err, f.Close())
+	}()
+
+	var content strings.Builder
+	if req.Comment != "" {
+		_, _ = fmt.Fprintf(&content, "# %s\n", req.Comment)
+	}
+
+	_, _ = fmt.Fprintf(&content, "# %s %s\n", accessRequestRequestedKey, req.RequestedAt.UTC().Format(time.RFC3339))
+	content.WriteString(req.PublicKey + "\n")
+
+	_, err = f.WriteString(content.String())
+
+	return err
+}
+
+// Get reads the request with the given name.
+func (a AccessRequests) Get(name string) (AccessRequest, error) {
+	if !requestNamePattern.MatchString(name) {
+		return AccessRequest{}, fmt.Errorf("%w: %q", ErrInvalidRequestName, name)
+	}
+
+	raw, err := fs.ReadFile(a.FS, AccessRequestPath(name))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return AccessRequest{}, fmt.Errorf("%w: %s", ErrAccessRequestMissing, name)
+		}
+		return AccessRequest{}, err
+	}
+
+	return parseAccessRequest(name, raw)
+}
+
+// List returns all pending requests ordered by name.
+func (a AccessRequests) List() ([]AccessRequest, error) {
+	entries, err := fs.ReadDir(a.FS, ports.AccessRequestsDirName)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", ports.AccessRequestsDirName, err)
+	}
+
+	requests := make([]AccessRequest, 0, len(entries))
+
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), accessRequestExtension)
+		if entry.IsDir() || !ok {
+			continue
+		}
+
+		req, err := a.Get(name)
+		if err != nil {
+			return nil, err
+		}
+
+		requests = append(requests, req)
+	}
+
+	slices.SortFunc(requests, func(a, b AccessRequest) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	return requests, nil
+}
+
+// Remove deletes the request file, the directory is kept as Git does not track empty directories anyway.
+func (a AccessRequests) Remove(name string) error {
+	if _, err := a.Get(name); err != nil {
+		return err
+	}
+
+	return a.FS.Remove(AccessRequestPath(name))
+}
+
+func parseAccessRequest(name string, raw []byte) (AccessRequest, error) {
+	req := AccessRequest{Name: name}
+
+	var comments []string
+
+	for line := range strings.Lines(string(raw)) {
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "":
+		case strings.HasPrefix(trimmed, "#"):
+			comment := strings.TrimSpace(strings.TrimPrefix(trimmed, "#"))
+
+			if requestedAt, ok := strings.CutPrefix(comment, accessRequestRequestedKey); ok {
+				parsed, err := time.Parse(time.RFC3339, strings.TrimSpace(requestedAt))
+				if err != nil {
+					return AccessRequest{}, fmt.Errorf("%w: %s: %w", ErrInvalidAccessRequest, name, err)
+				}
+				req.RequestedAt = parsed
+				continue
+			}
+
+			comments = append(comments, comment)
+		case req.PublicKey != "":
+			return AccessRequest{}, fmt.Errorf("%w: %s contains more than one public key", ErrInvalidAccessRequest, name)
+		default:
+			req.PublicKey = trimmed
+		}
+	}
+
+	if req.PublicKey == "" {
+		return AccessRequest{}, fmt.Errorf("%w: %s does not contain a public key", ErrInvalidAccessRequest, name)
+	}
+
+	req.Comment = strings.Join(comments, " ")
+
+	return req, nil
+}
@@ -0,0 +1,133 @@
+package infrastructure_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"filippo.io/age"
+
+	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/infrastructure"
+	"github.com/prskr/git-age/internal/fsx"
+	"github.com/prskr/git-age/internal/testx"
+)
+
+func TestAccessRequests(t *testing.T) {
+	t.Parallel()
+
+	requests := infrastructure.NewAccessRequests(infrastructure.NewReadWriteDirFS(t.TempDir()))
+
+	if pending, err := requests.List(); err != nil || len(pending) != 0 {
+		t.Fatalf("List() = %v, %v, want no requests", pending, err)
+	}
+
+	requestedAt := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	alice := infrastructure.AccessRequest{
+		Name:        "alice",
+		PublicKey:   testx.ResultOf(t, age.GenerateX25519Identity).Recipient().String(),
+		Comment:     "Alice (laptop)",
+		RequestedAt: requestedAt,
+	}
+	bob := infrastructure.AccessRequest{
+		Name:        "bob",
+		PublicKey:   testx.ResultOf(t, age.GenerateX25519Identity).Recipient().String(),
+		RequestedAt: requestedAt,
+	}
+
+	for _, req := range []infrastructure.AccessRequest{bob, alice} {
+		if err := requests.Create(req); err != nil {
+			t.Fatalf("Create(%s) error = %v", req.Name, err)
+		}
+	}
+
+	if err := requests.Create(alice); !errors.Is(err, infrastructure.ErrAccessRequestExists) {
+		t.Errorf("Create() of existing request error = %v, want %v", err, infrastructure.ErrAccessRequestExists)
+	}
+
+	invalid := infrastructure.AccessRequest{Name: "../alice", PublicKey: alice.PublicKey}
+	if err := requests.Create(invalid); !errors.Is(err, infrastructure.ErrInvalidRequestName) {
+		t.Errorf("Create() with path in name error = %v, want %v", err, infrastructure.ErrInvalidRequestName)
+	}
+
+	got, err := requests.Get("alice")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+
+	if got.PublicKey != alice.PublicKey || got.Comment != alice.Comment || !got.RequestedAt.Equal(requestedAt) {
+		t.Errorf("Get() = %+v, want %+v", got, alice)
+	}
+
+	pending, err := requests.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+
+	if len(pending) != 2 || pending[0].Name != "alice" || pending[1].Name != "bob" {
+		t.Errorf("List() = %+v, want alice and bob", pending)
+	}
+
+	if err := requests.Remove("alice"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+
+	if _, err := requests.Get("alice"); !errors.Is(err, infrastructure.ErrAccessRequestMissing) {
+		t.Errorf("Get() of removed request error = %v, want %v", err, infrastructure.ErrAccessRequestMissing)
+	}
+}
+
+func TestRecipientsFile_CompatibleWith(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		content       string
+		recipientType infrastructure.RecipientType
+		wantErr       error
+	}{
+		{
+			name:          "Empty recipients file",
+			recipientType: infrastructure.RecipientTypeHybrid,
+		},
+		{
+			name:          "Same kind of recipient",
+			content:       testx.ResultOf(t, age.GenerateX25519Identity).Recipient().String() + "\n",
+			recipientType: infrastructure.RecipientTypeX25519,
+		},
+		{
+			name:          "Post-quantum and classic recipients",
+			content:       testx.ResultOf(t, age.GenerateX25519Identity).Recipient().String() + "\n",
+			recipientType: infrastructure.RecipientTypeHybrid,
+			wantErr:       infrastructure.ErrMixedPostQuantumRecipients,
+		},
+		{
+			name:          "SSH and X25519 recipients",
+			content:       testx.ResultOf(t, age.GenerateX25519Identity).Recipient().String() + "\n",
+			recipientType: infrastructure.RecipientTypeSSH,
+		},
+		{
+			name:          "Plugin recipient",
+			recipientType: infrastructure.RecipientTypePlugin,
+			wantErr:       infrastructure.ErrUnsupportedRecipientType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			repoFS := infrastructure.NewReadWriteDirFS(t.TempDir())
+			if tt.content != "" {
+				if err := fsx.WriteTo(repoFS, ports.RecipientsFileName, []byte(tt.content)); err != nil {
+					t.Fatalf("failed to write recipients file: %v", err)
+				}
+			}
+
+			err := infrastructure.NewRecipientsFile(repoFS).CompatibleWith(tt.recipientType)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("CompatibleWith() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+package infrastructure
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adrg/xdg"
+)
+
+// auditLogMaxLineLength limits single entries, post-quantum public keys are almost 2000 characters long.
+const auditLogMaxLineLength = 1024 * 1024
+
+var (
+	ErrMalformedAuditLog = errors.New("malformed audit log")
+	ErrAuditChainBroken  = errors.New("audit log hash chain is broken")
+)
+
+// DefaultAgentAuditLog is the audit log of the agent unless another one is configured.
+func DefaultAgentAuditLog() string {
+	return filepath.Join(xdg.StateHome, "git-age", "agent-audit.jsonl")
+}
+
+// AgentAuditEntry records a single request to the agent.
+// Hash covers the entry including the hash of the previous entry, hence entries cannot be changed or removed unnoticed.
+type AgentAuditEntry struct {
+	Time       time.Time     `json:"time"`
+	Procedure  string        `json:"procedure"`
+	Decision   AgentDecision `json:"decision"`
+	Reason     string        `json:"reason,omitempty"`
+	PID        int32         `json:"pid,omitempty"`
+	UID        *uint32       `json:"uid,omitempty"`
+	Executable string        `json:"executable,omitempty"`
+	Repository string        `json:"repository,omitempty"`
+	Remotes    []string      `json:"remotes,omitempty"`
+	// Keys are the public keys of the returned or stored identities
+	Keys  []string `json:"keys,omitempty"`
+	Error string   `json:"error,omitempty"`
+	Prev  string   `json:"prev"`
+	Hash  string   `json:"hash"`
+}
+
+// NewAgentAuditEntry fills an entry from the request and the decision about it.
+func NewAgentAuditEntry(req AgentRequest, decision AgentDecision, reason string) AgentAuditEntry {
+	entry := AgentAuditEntry{
+		Time:       time.Now().UTC(),
+		Procedure:  req.Procedure,
+		Decision:   decision,
+		Reason:     reason,
+		Repository: req.Repository,
+		Remotes:    req.Remotes,
+	}
+
+	if req.Peer != nil {
+		entry.PID = req.Peer.PID
+		entry.UID = &req.Peer.UID
+		entry.Executable = req.Peer.Executable
+	}
+
+	return entry
+}
+
+// computeHash hashes the entry with an empty hash field.
+func (e AgentAuditEntry) computeHash() (string, error) {
+	e.Hash = ""
+
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(raw)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// AgentAuditLog appends entries as JSON lines, each chained to the previous one by its hash.
+type AgentAuditLog struct {
+	Path string
+
+	lock sync.Mutex
+	file *os.File
+	last string
+}
+
+// OpenAgentAuditLog opens the log for appending and continues the hash chain of the existing entries.
+func OpenAgentAuditLog(filePath string) (*AgentAuditLog, error) {
+	entries, err := ReadAgentAuditLog(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create audit log directory: %w", err)
+	}
+
+	file, err := os.OpenFile(filePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log: %w", err)
+	}
+
+	log := &AgentAuditLog{Path: filePath, file: file}
+	if len(entries) > 0 {
+		log.last = entries[len(entries)-1].Hash
+	}
+
+	return log, nil
+}
+
+// Append chains the entry to the previous one and writes it to the log.
+func (l *AgentAuditLog) Append(entry AgentAuditEntry) (err error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.file == nil {
+		return os.ErrClosed
+	}
+
+	entry.Prev = l.last
+	if entry.Hash, err = entry.computeHash(); err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if _, err := l.file.Write(append(raw, '\n')); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+
+	if err := l.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync audit log: %w", err)
+	}
+
+	l.last = entry.Hash
+
+	return nil
+}
+
+func (l *AgentAuditLog) Close() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+
+	err := l.file.Close()
+	l.file = nil
+
+	return err
+}
+
+// ReadAgentAuditLog reads all entries, a missing log has no entries.
+func ReadAgentAuditLog(filePath string) ([]AgentAuditEntry, error) {
+	raw, err := os.ReadFile(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read audit log: %w", err)
+	}
+
+	var (
+		entries []AgentAuditEntry
+		lineNo  int
+	)
+
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	scanner.Buffer(nil, auditLogMaxLineLength)
+
+	for scanner.Scan() {
+		lineNo++
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var entry AgentAuditEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			return nil, fmt.Errorf("%w: line %d: %w", ErrMalformedAuditLog, lineNo, err)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, scanner.Err()
+}
+
+// VerifyAgentAuditLog checks the hash of every entry and that it refers to its predecessor.
+func VerifyAgentAuditLog(entries []AgentAuditEntry) error {
+	var prev string
+
+	for idx, entry := range entries {
+		if entry.Prev != prev {
+			return fmt.Errorf("%w: entry %d does not follow its predecessor", ErrAuditChainBroken, idx+1)
+		}
+
+		hash, err := entry.computeHash()
+		if err != nil {
+			return err
+		}
+
+		if hash != entry.Hash {
+			return fmt.Errorf("%w: entry %d was modified", ErrAuditChainBroken, idx+1)
+		}
+
+		prev = entry.Hash
+	}
+
+	return nil
+}
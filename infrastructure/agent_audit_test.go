@@ -0,0 +1,98 @@
+package infrastructure_test
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/prskr/git-age/infrastructure"
+)
+
+func TestAgentAuditLog(t *testing.T) {
+	t.Parallel()
+
+	logPath := filepath.Join(t.TempDir(), "git-age", "agent-audit.jsonl")
+	peer := &infrastructure.AgentPeer{PID: 42, UID: 1000, Executable: "/usr/bin/git-age"}
+
+	requests := []infrastructure.AgentRequest{
+		{Procedure: "/get", Peer: peer, Remotes: []string{"git@github.com:acme/infra.git"}},
+		{Procedure: "/get", Repository: "/src/infra"},
+		{Procedure: "/store", Peer: peer},
+	}
+
+	// every request reopens the log to check the chain is continued
+	for _, req := range requests {
+		auditLog, err := infrastructure.OpenAgentAuditLog(logPath)
+		if err != nil {
+			t.Fatalf("OpenAgentAuditLog() error = %v", err)
+		}
+
+		if err := auditLog.Append(infrastructure.NewAgentAuditEntry(req, infrastructure.AgentDecisionAllow, "test")); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+
+		if err := auditLog.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+	}
+
+	entries, err := infrastructure.ReadAgentAuditLog(logPath)
+	if err != nil {
+		t.Fatalf("ReadAgentAuditLog() error = %v", err)
+	}
+
+	if len(entries) != len(requests) {
+		t.Fatalf("got %d entries, want %d", len(entries), len(requests))
+	}
+
+	if err := infrastructure.VerifyAgentAuditLog(entries); err != nil {
+		t.Fatalf("VerifyAgentAuditLog() error = %v", err)
+	}
+
+	raw, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("failed to read audit log: %v", err)
+	}
+
+	lines := bytes.SplitAfter(raw, []byte("\n"))
+
+	tests := []struct {
+		name   string
+		tamper func() []byte
+	}{
+		{
+			name: "Entry modified",
+			tamper: func() []byte {
+				return bytes.Replace(raw, []byte(`"pid":42`), []byte(`"pid":43`), 1)
+			},
+		},
+		{
+			name: "Entry removed",
+			tamper: func() []byte {
+				return bytes.Join([][]byte{lines[0], lines[2]}, nil)
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tamperedPath := filepath.Join(t.TempDir(), "agent-audit.jsonl")
+			if err := os.WriteFile(tamperedPath, tt.tamper(), 0o600); err != nil {
+				t.Fatalf("failed to write audit log: %v", err)
+			}
+
+			tampered, err := infrastructure.ReadAgentAuditLog(tamperedPath)
+			if err != nil {
+				t.Fatalf("ReadAgentAuditLog() error = %v", err)
+			}
+
+			if err := infrastructure.VerifyAgentAuditLog(tampered); !errors.Is(err, infrastructure.ErrAuditChainBroken) {
+				t.Errorf("VerifyAgentAuditLog() error = %v, want %v", err, infrastructure.ErrAuditChainBroken)
+			}
+		})
+	}
+}
@@ -0,0 +1,261 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adrg/xdg"
+
+	"github.com/prskr/git-age/core/ports"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd socket activation.
+const listenFDsStart = 3
+
+var (
+	ErrAgentNotRunning     = errors.New("agent is not running")
+	ErrAgentAlreadyRunning = errors.New("agent is already running")
+)
+
+// DefaultAgentSocket is the socket clients probe if no agent host is configured.
+func DefaultAgentSocket() string {
+	return filepath.Join(xdg.RuntimeDir, "git-age", "agent.sock")
+}
+
+// NewAgentDaemon manages the agent listening on the given socket, an empty path selects the default socket.
+// The pidfile is placed next to the socket.
+func NewAgentDaemon(socketPath string) AgentDaemon {
+	if socketPath == "" {
+		socketPath = DefaultAgentSocket()
+	}
+
+	return AgentDaemon{
+		Socket:  socketPath,
+		PIDFile: strings.TrimSuffix(socketPath, filepath.Ext(socketPath)) + ".pid",
+		LogFile: strings.TrimSuffix(socketPath, filepath.Ext(socketPath)) + ".log",
+	}
+}
+
+type AgentDaemon struct {
+	Socket  string
+	PIDFile string
+	// LogFile receives the output of agents started in the background
+	LogFile string
+}
+
+// Listen returns the socket passed by systemd socket activation (LISTEN_FDS) if any,
+// otherwise it listens on the socket only accessible to the current user.
+// Stale sockets left behind by a crashed agent are replaced, if another agent still accepts connections
+// on the socket ErrAgentAlreadyRunning is returned.
+func (d AgentDaemon) Listen(env ports.OSEnv) (net.Listener, error) {
+	if listener, err := activatedListener(env); listener != nil || err != nil {
+		return listener, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(d.Socket), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create socket directory: %w", err)
+	}
+
+	if conn, err := net.DialTimeout("unix", d.Socket, time.Second); err == nil {
+		_ = conn.Close()
+
+		if pid, err := d.Status(); err == nil {
+			return nil, fmt.Errorf("%w with pid %d on %s", ErrAgentAlreadyRunning, pid, d.Socket)
+		}
+
+		return nil, fmt.Errorf("%w on %s", ErrAgentAlreadyRunning, d.Socket)
+	}
+
+	if err := os.Remove(d.Socket); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+	}
+
+	listener, err := net.Listen("unix", d.Socket)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(d.Socket, 0o600); err != nil {
+		return nil, errors.Join(err, listener.Close())
+	}
+
+	return listener, nil
+}
+
+// WritePID records the current process as the running agent.
+func (d AgentDaemon) WritePID() error {
+	if err := os.MkdirAll(filepath.Dir(d.PIDFile), 0o700); err != nil {
+		return fmt.Errorf("failed to create pidfile directory: %w", err)
+	}
+
+	return os.WriteFile(d.PIDFile, []byte(strconv.Itoa(os.Getpid())+"\n"), 0o600)
+}
+
+// RemovePID removes the pidfile if it still belongs to the current process.
+func (d AgentDaemon) RemovePID() error {
+	if pid, err := d.readPID(); err != nil || pid != os.Getpid() {
+		return err
+	}
+
+	return os.Remove(d.PIDFile)
+}
+
+// Status returns the PID of the running agent or ErrAgentNotRunning.
+func (d AgentDaemon) Status() (int, error) {
+	pid, err := d.readPID()
+	if err != nil {
+		return 0, err
+	}
+
+	if pid == 0 || !processAlive(pid) {
+		return 0, ErrAgentNotRunning
+	}
+
+	return pid, nil
+}
+
+// Start runs the given git-age arguments in the background with the given environment
+// and waits until the agent answers on the socket.
+func (d AgentDaemon) Start(ctx context.Context, env ports.OSEnv, args ...string) (int, error) {
+	if pid, err := d.Status(); err == nil {
+		return pid, fmt.Errorf("%w with pid %d", ErrAgentAlreadyRunning, pid)
+	} else if !errors.Is(err, ErrAgentNotRunning) {
+		return 0, err
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(d.LogFile), 0o700); err != nil {
+		return 0, fmt.Errorf("failed to create log directory: %w", err)
+	}
+
+	logFile, err := os.OpenFile(d.LogFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open agent log: %w", err)
+	}
+
+	defer func() {
+		_ = logFile.Close()
+	}()
+
+	//nolint:gosec // starts the current executable again
+	cmd := exec.Command(executable, args...)
+	cmd.Env = env.Environ()
+	cmd.Stdout = logFile
+	cmd.Stderr = logFile
+	detach(cmd)
+
+	if err := cmd.Start(); err != nil {
+		return 0, fmt.Errorf("failed to start agent: %w", err)
+	}
+
+	// the agent keeps running after this process exits
+	pid := cmd.Process.Pid
+	if err := cmd.Process.Release(); err != nil {
+		return 0, err
+	}
+
+	return pid, d.waitFor(ctx, func() bool {
+		valid, err := (&AgentIdentitiesStoreSource{BaseURL: "unix://" + d.Socket}).IsValid(ctx)
+		return valid && err == nil
+	})
+}
+
+// Stop terminates the running agent and waits until it exited.
+func (d AgentDaemon) Stop(ctx context.Context) (int, error) {
+	pid, err := d.Status()
+	if err != nil {
+		return 0, err
+	}
+
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := terminate(proc); err != nil {
+		return 0, fmt.Errorf("failed to stop agent: %w", err)
+	}
+
+	return pid, d.waitFor(ctx, func() bool {
+		return !processAlive(pid)
+	})
+}
+
+func (d AgentDaemon) waitFor(ctx context.Context, done func() bool) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for !done() {
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("agent did not respond, see %s: %w", d.LogFile, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+
+	return nil
+}
+
+// readPID returns 0 if there is no pidfile.
+func (d AgentDaemon) readPID() (int, error) {
+	raw, err := os.ReadFile(d.PIDFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to read pidfile: %w", err)
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(string(raw)))
+	if err != nil {
+		return 0, fmt.Errorf("malformed pidfile %s: %w", d.PIDFile, err)
+	}
+
+	return pid, nil
+}
+
+// activatedListener returns the first socket passed by systemd, if the sockets were meant for this process.
+func activatedListener(env ports.OSEnv) (net.Listener, error) {
+	if env.Get("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+
+	fds, err := strconv.Atoi(env.Get("LISTEN_FDS"))
+	if err != nil || fds < 1 {
+		return nil, nil
+	}
+
+	if fds > 1 {
+		slog.Warn("Ignoring additional activated sockets", slog.Int("fds", fds))
+	}
+
+	file := os.NewFile(listenFDsStart, "LISTEN_FD_"+strconv.Itoa(listenFDsStart))
+	defer func() {
+		_ = file.Close()
+	}()
+
+	listener, err := net.FileListener(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to use activated socket: %w", err)
+	}
+
+	slog.Info("Using socket passed by systemd")
+
+	return listener, nil
+}
@@ -0,0 +1,19 @@
+//go:build !unix
+
+package infrastructure
+
+import (
+	"os"
+	"os/exec"
+)
+
+func detach(*exec.Cmd) {}
+
+func processAlive(pid int) bool {
+	_, err := os.FindProcess(pid)
+	return err == nil
+}
+
+func terminate(proc *os.Process) error {
+	return proc.Kill()
+}
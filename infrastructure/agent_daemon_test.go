@@ -0,0 +1,115 @@
+package infrastructure_test
+
+import (
+	"errors"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/infrastructure"
+)
+
+func TestAgentDaemon_Status(t *testing.T) {
+	t.Parallel()
+
+	daemon := infrastructure.NewAgentDaemon(filepath.Join(t.TempDir(), "git-age", "agent.sock"))
+
+	if want := filepath.Join(filepath.Dir(daemon.Socket), "agent.pid"); daemon.PIDFile != want {
+		t.Errorf("pidfile = %s, want %s", daemon.PIDFile, want)
+	}
+
+	if _, err := daemon.Status(); !errors.Is(err, infrastructure.ErrAgentNotRunning) {
+		t.Fatalf("Status() error = %v, want %v", err, infrastructure.ErrAgentNotRunning)
+	}
+
+	if err := daemon.WritePID(); err != nil {
+		t.Fatalf("WritePID() error = %v", err)
+	}
+
+	if pid, err := daemon.Status(); err != nil || pid != os.Getpid() {
+		t.Fatalf("Status() = %d, %v, want %d", pid, err, os.Getpid())
+	}
+
+	if err := daemon.RemovePID(); err != nil {
+		t.Fatalf("RemovePID() error = %v", err)
+	}
+
+	// a pidfile left behind by a crashed agent
+	exited := exec.Command("true")
+	if err := exited.Run(); err != nil {
+		t.Skipf("failed to run process: %v", err)
+	}
+
+	if err := os.WriteFile(daemon.PIDFile, []byte(strconv.Itoa(exited.Process.Pid)), 0o600); err != nil {
+		t.Fatalf("failed to write pidfile: %v", err)
+	}
+
+	if _, err := daemon.Status(); !errors.Is(err, infrastructure.ErrAgentNotRunning) {
+		t.Errorf("Status() error = %v, want %v for stale pidfile", err, infrastructure.ErrAgentNotRunning)
+	}
+}
+
+func TestAgentDaemon_Listen(t *testing.T) {
+	t.Parallel()
+
+	daemon := infrastructure.NewAgentDaemon(filepath.Join(t.TempDir(), "git-age", "agent.sock"))
+
+	// sockets activated for another process are ignored
+	env := ports.OSEnv{"LISTEN_PID": "1", "LISTEN_FDS": "1"}
+
+	for range 2 {
+		listener, err := daemon.Listen(env)
+		if err != nil {
+			t.Fatalf("Listen() error = %v", err)
+		}
+
+		info, err := os.Stat(daemon.Socket)
+		if err != nil {
+			t.Fatalf("failed to stat socket: %v", err)
+		}
+
+		if info.Mode()&os.ModeSocket == 0 || info.Mode().Perm() != 0o600 {
+			t.Errorf("unexpected socket mode %s", info.Mode())
+		}
+
+		// leave the socket behind like a crashed agent
+		if unixListener, ok := listener.(interface{ SetUnlinkOnClose(bool) }); ok {
+			unixListener.SetUnlinkOnClose(false)
+		}
+
+		if err := listener.Close(); err != nil {
+			t.Fatalf("failed to close listener: %v", err)
+		}
+	}
+}
+
+func TestAgentDaemon_Listen_AlreadyRunning(t *testing.T) {
+	t.Parallel()
+
+	daemon := infrastructure.NewAgentDaemon(filepath.Join(t.TempDir(), "git-age", "agent.sock"))
+
+	listener, err := daemon.Listen(ports.NewOSEnv())
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+
+	t.Cleanup(func() {
+		_ = listener.Close()
+	})
+
+	if _, err := daemon.Listen(ports.NewOSEnv()); !errors.Is(err, infrastructure.ErrAgentAlreadyRunning) {
+		t.Fatalf("Listen() error = %v, want %v", err, infrastructure.ErrAgentAlreadyRunning)
+	}
+
+	// the socket of the running agent is left untouched
+	conn, err := net.Dial("unix", daemon.Socket)
+	if err != nil {
+		t.Fatalf("failed to connect to the running agent: %v", err)
+	}
+
+	_ = conn.Close()
+}
@@ -2,6 +2,8 @@ package infrastructure
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net"
 	"net/http"
@@ -10,30 +12,66 @@ import (
 	"strings"
 	"time"
 
-	"buf.build/gen/go/git-age/agent/connectrpc/go/agent/v1/agentv1connect"
-	agentv1 "buf.build/gen/go/git-age/agent/protocolbuffers/go/agent/v1"
-	"buf.build/gen/go/grpc/grpc/connectrpc/go/grpc/health/v1/healthv1connect"
 	healthv1 "buf.build/gen/go/grpc/grpc/protocolbuffers/go/grpc/health/v1"
 	"connectrpc.com/connect"
 	"filippo.io/age"
+	"google.golang.org/protobuf/types/known/durationpb"
 
+	agentv1 "github.com/prskr/git-age/api/gen/agent/v1"
+	"github.com/prskr/git-age/api/gen/agent/v1/agentv1connect"
 	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/core/services"
 )
 
+// AgentHostNone disables the agent including the discovery of an agent at the default socket.
+const AgentHostNone = "none"
+
+// healthCheckProcedure is the gRPC health check every agent has to serve next to the identities store service.
+const healthCheckProcedure = "/grpc.health.v1.Health/Check"
+
+var ErrAgentLocked = errors.New("agent is locked")
+
 var (
-	_ ports.IdentitiesStore = (*AgentIdentitiesStore)(nil)
-	_ identityStoreSource   = (*AgentIdentitiesStoreSource)(nil)
+	_ ports.IdentitiesStore         = (*AgentIdentitiesStore)(nil)
+	_ ports.PassphraseStore         = (*AgentIdentitiesStore)(nil)
+	_ ports.ExplicitIdentitiesStore = (*AgentIdentitiesStore)(nil)
+	_ IdentityStoreSource           = (*AgentIdentitiesStoreSource)(nil)
 )
 
-func NewAgentIdentitiesStoreSource(env ports.OSEnv) *AgentIdentitiesStoreSource {
-	return &AgentIdentitiesStoreSource{
+func NewAgentIdentitiesStoreSource(cwd ports.CWD, env ports.OSEnv) *AgentIdentitiesStoreSource {
+	src := &AgentIdentitiesStoreSource{
 		BaseURL: os.ExpandEnv(env.Get("GIT_AGE_AGENT_HOST")),
 	}
+
+	// without explicit configuration an agent listening on the default socket is used,
+	// none disables the agent altogether
+	switch src.BaseURL {
+	case AgentHostNone:
+		src.BaseURL = ""
+	case "":
+		if _, err := os.Stat(DefaultAgentSocket()); err == nil {
+			src.BaseURL = "unix://" + DefaultAgentSocket()
+			src.Discovered = true
+		}
+	}
+
+	// the repository is only informational for the agent policy, outside of repositories it stays empty
+	src.Repository, _ = FindRepoRootFrom(cwd)
+
+	return src
 }
 
 type AgentIdentitiesStoreSource struct {
 	BaseURL string
 	Client  connect.HTTPClient
+	// Repository is the path of the repository the identities are requested for
+	Repository string
+	// Discovered agents were found at the default socket, if they do not answer they are skipped
+	Discovered bool
+}
+
+func (a *AgentIdentitiesStoreSource) Name() string {
+	return AgentIdentitiesStore{}.Name()
 }
 
 func (a *AgentIdentitiesStoreSource) IsValid(ctx context.Context) (isValid bool, err error) {
@@ -43,33 +81,70 @@ func (a *AgentIdentitiesStoreSource) IsValid(ctx context.Context) (isValid bool,
 	}
 
 	if a.Client == nil {
-		a.BaseURL, a.Client, err = prepareClient(a.BaseURL)
+		a.BaseURL, a.Client, err = prepareClient(a.BaseURL, a.Repository)
 		if err != nil {
 			return false, err
 		}
 	}
 
-	healthClient := healthv1connect.NewHealthClient(a.Client, a.BaseURL)
+	healthClient := connect.NewClient[healthv1.HealthCheckRequest, healthv1.HealthCheckResponse](
+		a.Client,
+		a.BaseURL+healthCheckProcedure,
+	)
 	healthRequest := &healthv1.HealthCheckRequest{Service: agentv1connect.IdentitiesStoreServiceName}
-	resp, err := healthClient.Check(ctx, connect.NewRequest(healthRequest))
-	if err != nil {
+	resp, err := healthClient.CallUnary(ctx, connect.NewRequest(healthRequest))
+	if err != nil && a.Discovered {
+		slog.DebugContext(ctx, "Skipping agent because the default socket is stale", slog.String("err", err.Error()))
+		return false, nil
+	} else if err != nil {
 		return false, err
-	} else if resp.Msg.Status != healthv1.HealthCheckResponse_SERVING {
+	}
+
+	//nolint:exhaustive // all other states are handled the same way
+	switch resp.Msg.Status {
+	case healthv1.HealthCheckResponse_SERVING:
+		return true, nil
+	case healthv1.HealthCheckResponse_NOT_SERVING:
+		// agents report NOT_SERVING as long as they are locked
+		return false, ErrAgentLocked
+	default:
 		slog.Info("agent health check failed", slog.String("status", resp.Msg.Status.String()))
 		return false, nil
 	}
-
-	return true, nil
 }
 
 func (a *AgentIdentitiesStoreSource) GetStore() (ports.IdentitiesStore, error) {
+	return a.Agent()
+}
+
+// Agent connects to the agent without checking its health e.g. to unlock it.
+func (a *AgentIdentitiesStoreSource) Agent() (agent *AgentIdentitiesStore, err error) {
+	if a.Client == nil {
+		a.BaseURL, a.Client, err = prepareClient(a.BaseURL, a.Repository)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &AgentIdentitiesStore{
 		IdentitiesClient: agentv1connect.NewIdentitiesStoreServiceClient(a.Client, a.BaseURL),
+		Discovered:       a.Discovered,
 	}, nil
 }
 
 type AgentIdentitiesStore struct {
 	IdentitiesClient agentv1connect.IdentitiesStoreServiceClient
+	// Discovered agents are read-only unless they are selected explicitly e.g. with --store agent
+	Discovered bool
+}
+
+func (AgentIdentitiesStore) Name() string {
+	return "agent"
+}
+
+// ExplicitOnly implements [ports.ExplicitIdentitiesStore].
+func (a AgentIdentitiesStore) ExplicitOnly() bool {
+	return a.Discovered
 }
 
 func (a AgentIdentitiesStore) Generate(
@@ -81,24 +156,63 @@ func (a AgentIdentitiesStore) Generate(
 		return "", err
 	}
 
-	if cmd.Comment == "" {
-		cmd.Comment = "Generated on " + time.Now().Format(time.RFC3339)
+	storeCmd := ports.StoreIdentityCommand{
+		Identity: newID,
+		Comment:  cmd.Comment,
+		Remote:   cmd.Remote,
 	}
 
-	publicKey = newID.Recipient().String()
+	if err := a.Store(ctx, storeCmd); err != nil {
+		return "", err
+	}
 
-	req := &agentv1.StoreIdentityRequest{
-		PublicKey:  publicKey,
-		PrivateKey: newID.String(),
-		Comment:    cmd.Comment,
-		Remote:     cmd.Remote,
+	return newID.Recipient().String(), nil
+}
+
+func (a AgentIdentitiesStore) Store(ctx context.Context, cmd ports.StoreIdentityCommand) error {
+	_, err := a.IdentitiesClient.StoreIdentity(ctx, connect.NewRequest(storeIdentityRequest(cmd)))
+
+	return err
+}
+
+// Add keeps the identity only in memory of the agent, if lifetime is positive the agent forgets it afterwards.
+func (a AgentIdentitiesStore) Add(ctx context.Context, cmd ports.StoreIdentityCommand, lifetime time.Duration) error {
+	req := storeIdentityRequest(cmd)
+	req.Ephemeral = true
+
+	if lifetime > 0 {
+		req.Lifetime = durationpb.New(lifetime)
 	}
 
-	if _, err = a.IdentitiesClient.StoreIdentity(ctx, connect.NewRequest(req)); err != nil {
-		return "", err
+	_, err := a.IdentitiesClient.StoreIdentity(ctx, connect.NewRequest(req))
+
+	return err
+}
+
+// Lock locks the agent, it does not hand out identities until it is unlocked with the same passphrase.
+func (a AgentIdentitiesStore) Lock(ctx context.Context, passphrase string) error {
+	_, err := a.IdentitiesClient.Lock(ctx, connect.NewRequest(&agentv1.LockRequest{Passphrase: passphrase}))
+
+	return err
+}
+
+func (a AgentIdentitiesStore) Unlock(ctx context.Context, passphrase string) error {
+	_, err := a.IdentitiesClient.Unlock(ctx, connect.NewRequest(&agentv1.UnlockRequest{Passphrase: passphrase}))
+
+	return err
+}
+
+func storeIdentityRequest(cmd ports.StoreIdentityCommand) *agentv1.StoreIdentityRequest {
+	if cmd.Comment == "" {
+		cmd.Comment = "Generated on " + time.Now().Format(time.RFC3339)
 	}
 
-	return publicKey, nil
+	return &agentv1.StoreIdentityRequest{
+		PublicKey:  cmd.Identity.Recipient().String(),
+		PrivateKey: cmd.Identity.String(),
+		Comment:    cmd.Comment,
+		Remote:     cmd.Remote,
+	}
 }
 
 func (a AgentIdentitiesStore) Identities(ctx context.Context, query ports.IdentitiesQuery) ([]age.Identity, error) {
@@ -119,18 +233,67 @@ func (a AgentIdentitiesStore) Identities(ctx context.Context, query ports.Identi
 
 	ids := make([]age.Identity, 0, len(resp.Msg.Keys))
 	for _, raw := range resp.Msg.Keys {
-		id, err := age.ParseX25519Identity(raw)
+		parsed, err := age.ParseIdentities(strings.NewReader(raw))
 		if err != nil {
 			return nil, err
 		}
 
-		ids = append(ids, id)
+		ids = append(ids, parsed...)
 	}
 
 	return ids, nil
 }
 
-func prepareClient(rawUrl string) (baseUrl string, client *http.Client, err error) {
+// Passphrase returns an empty passphrase if the agent cannot keep passphrases.
+func (a AgentIdentitiesStore) Passphrase(ctx context.Context, query ports.IdentitiesQuery) (string, error) {
+	resp, err := a.IdentitiesClient.GetPassphrase(ctx, connect.NewRequest(&agentv1.GetPassphraseRequest{Remotes: query.Remotes}))
+	if connect.CodeOf(err) == connect.CodeUnimplemented {
+		slog.DebugContext(ctx, "Agent does not support passphrases", slog.String("err", err.Error()))
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+
+	return resp.Msg.GetPassphrase(), nil
+}
+
+func (a AgentIdentitiesStore) StorePassphrase(ctx context.Context, cmd ports.StorePassphraseCommand) error {
+	if cmd.Comment == "" {
+		cmd.Comment = "Generated on " + time.Now().Format(time.RFC3339)
+	}
+
+	req := &agentv1.StorePassphraseRequest{
+		Passphrase: cmd.Passphrase,
+		Comment:    cmd.Comment,
+		Remote:     cmd.Remote,
+	}
+
+	_, err := a.IdentitiesClient.StorePassphrase(ctx, connect.NewRequest(req))
+	if connect.CodeOf(err) == connect.CodeUnimplemented {
+		return fmt.Errorf("%w: %w", services.ErrPassphraseNotSupported, err)
+	}
+
+	return err
+}
+
+// repositoryTransport tells the agent which repository the client is operating on.
+type repositoryTransport struct {
+	http.RoundTripper
+	Repository string
+}
+
+func (t repositoryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.Repository == "" {
+		return t.RoundTripper.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set(AgentRepositoryHeader, t.Repository)
+
+	return t.RoundTripper.RoundTrip(req)
+}
+
+func prepareClient(rawUrl, repository string) (baseUrl string, client *http.Client, err error) {
 	const unixScheme = "unix"
 	parsed, err := url.Parse(rawUrl)
 	if err != nil {
@@ -163,13 +326,13 @@ func prepareClient(rawUrl string) (baseUrl string, client *http.Client, err erro
 		}
 
 		return "http://localhost", &http.Client{
-			Transport: transport,
+			Transport: repositoryTransport{RoundTripper: transport, Repository: repository},
 		}, nil
 	} else {
 		transport.DialContext = dialer.DialContext
 	}
 
 	return rawUrl, &http.Client{
-		Transport: transport,
+		Transport: repositoryTransport{RoundTripper: transport, Repository: repository},
 	}, nil
 }
@@ -5,19 +5,114 @@ import (
 	"errors"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
 
-	"buf.build/gen/go/git-age/agent/connectrpc/go/agent/v1/agentv1connect"
-	agentv1 "buf.build/gen/go/git-age/agent/protocolbuffers/go/agent/v1"
 	"connectrpc.com/connect"
 	"connectrpc.com/grpchealth"
 	"filippo.io/age"
 
+	agentv1 "github.com/prskr/git-age/api/gen/agent/v1"
+	"github.com/prskr/git-age/api/gen/agent/v1/agentv1connect"
+
 	"github.com/prskr/git-age/core/ports"
 	"github.com/prskr/git-age/infrastructure"
 	"github.com/prskr/git-age/internal/testx"
 )
 
+func TestAgentIdentitiesStoreSource_IsValid(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		status  grpchealth.Status
+		want    bool
+		wantErr error
+	}{
+		{
+			name:   "Serving",
+			status: grpchealth.StatusServing,
+			want:   true,
+		},
+		{
+			name:    "Locked",
+			status:  grpchealth.StatusNotServing,
+			wantErr: infrastructure.ErrAgentLocked,
+		},
+		{
+			name:   "Unknown",
+			status: grpchealth.StatusUnknown,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			checker := grpchealth.NewStaticChecker(agentv1connect.IdentitiesStoreServiceName)
+			checker.SetStatus(agentv1connect.IdentitiesStoreServiceName, tt.status)
+
+			mux := http.NewServeMux()
+			mux.Handle(grpchealth.NewHandler(checker))
+			server := httptest.NewServer(mux)
+			t.Cleanup(server.Close)
+
+			storeSource := infrastructure.AgentIdentitiesStoreSource{
+				BaseURL: server.URL,
+				Client:  server.Client(),
+			}
+
+			got, err := storeSource.IsValid(testx.Context(t))
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("IsValid() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+
+			if got != tt.want {
+				t.Errorf("IsValid() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewAgentIdentitiesStoreSource_None(t *testing.T) {
+	t.Parallel()
+
+	src := infrastructure.NewAgentIdentitiesStoreSource(ports.CWD(t.TempDir()), ports.OSEnv{"GIT_AGE_AGENT_HOST": infrastructure.AgentHostNone})
+	if src.BaseURL != "" || src.Discovered {
+		t.Fatalf("expected agent to be disabled, got %+v", src)
+	}
+
+	if valid, err := src.IsValid(testx.Context(t)); err != nil || valid {
+		t.Errorf("IsValid() = %v, %v, want false without error", valid, err)
+	}
+}
+
+func TestNewAgentIdentitiesStoreSource_Repository(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, ".git"), 0o700); err != nil {
+		t.Fatalf("failed to create .git directory: %v", err)
+	}
+
+	subDir := filepath.Join(root, "config", "prod")
+	if err := os.MkdirAll(subDir, 0o700); err != nil {
+		t.Fatalf("failed to create sub directory: %v", err)
+	}
+
+	env := ports.OSEnv{"GIT_AGE_AGENT_HOST": infrastructure.AgentHostNone}
+
+	if got := infrastructure.NewAgentIdentitiesStoreSource(ports.CWD(subDir), env).Repository; got != root {
+		t.Errorf("Repository = %q, want %q", got, root)
+	}
+
+	if got := infrastructure.NewAgentIdentitiesStoreSource(ports.CWD(t.TempDir()), env).Repository; got != "" {
+		t.Errorf("expected no repository outside of repositories, got %q", got)
+	}
+}
+
 func TestAgentIdentitiesStore_Generate(t *testing.T) {
 	t.Parallel()
 
@@ -209,6 +304,8 @@ var _ agentv1connect.IdentitiesStoreServiceHandler = (*AgentStoreMock)(nil)
 
 //nolint:lll // doesn't make sense to break type in struct
 type AgentStoreMock struct {
+	agentv1connect.UnimplementedIdentitiesStoreServiceHandler
+
 	OnGenerate      func(ctx context.Context, c *connect.Request[agentv1.StoreIdentityRequest]) (*connect.Response[agentv1.StoreIdentityResponse], error)
 	OnGetIdentities func(ctx context.Context, c *connect.Request[agentv1.GetIdentitiesRequest]) (*connect.Response[agentv1.GetIdentitiesResponse], error)
 }
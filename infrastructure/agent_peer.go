@@ -0,0 +1,42 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+)
+
+var ErrPeerCredentialsUnsupported = errors.New("peer credentials are not supported on this platform")
+
+type agentPeerKey struct{}
+
+// AgentPeer is the process on the other end of a unix socket connection to the agent.
+type AgentPeer struct {
+	PID        int32
+	UID        uint32
+	Executable string
+}
+
+// AgentPeerContext stores the credentials of the peer of unix socket connections in the context,
+// it is meant to be used as http.Server.ConnContext.
+func AgentPeerContext(ctx context.Context, conn net.Conn) context.Context {
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return ctx
+	}
+
+	peer, err := peerCredentials(unixConn)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to determine agent peer", slog.String("err", err.Error()))
+		return ctx
+	}
+
+	return context.WithValue(ctx, agentPeerKey{}, peer)
+}
+
+// AgentPeerFrom returns the peer stored by AgentPeerContext, if any.
+func AgentPeerFrom(ctx context.Context) (AgentPeer, bool) {
+	peer, ok := ctx.Value(agentPeerKey{}).(AgentPeer)
+	return peer, ok
+}
@@ -0,0 +1,44 @@
+//go:build linux
+
+package infrastructure
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+func peerCredentials(conn *net.UnixConn) (peer AgentPeer, err error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return AgentPeer{}, err
+	}
+
+	var (
+		cred    *unix.Ucred
+		credErr error
+	)
+
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	})
+	if err != nil {
+		return AgentPeer{}, err
+	}
+
+	if credErr != nil {
+		return AgentPeer{}, fmt.Errorf("failed to read SO_PEERCRED: %w", credErr)
+	}
+
+	peer = AgentPeer{PID: cred.Pid, UID: cred.Uid}
+
+	// the executable is not available for processes of other users or in other PID namespaces
+	if exe, err := os.Readlink("/proc/" + strconv.Itoa(int(cred.Pid)) + "/exe"); err == nil {
+		peer.Executable = exe
+	}
+
+	return peer, nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux
+
+package infrastructure
+
+import "net"
+
+func peerCredentials(*net.UnixConn) (AgentPeer, error) {
+	return AgentPeer{}, ErrPeerCredentialsUnsupported
+}
@@ -0,0 +1,281 @@
+package infrastructure
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path"
+	"strconv"
+	"strings"
+
+	"connectrpc.com/connect"
+
+	agentv1 "github.com/prskr/git-age/api/gen/agent/v1"
+	"github.com/prskr/git-age/api/gen/agent/v1/agentv1connect"
+)
+
+// AgentRepositoryHeader carries the path of the repository a client is operating on.
+const AgentRepositoryHeader = "Git-Age-Repository"
+
+var (
+	ErrInvalidAgentPolicy = errors.New("invalid agent policy")
+	ErrAgentRequestDenied = errors.New("agent request denied")
+)
+
+type AgentDecision string
+
+const (
+	AgentDecisionAllow AgentDecision = "allow"
+	AgentDecisionDeny  AgentDecision = "deny"
+	AgentDecisionAsk   AgentDecision = "ask"
+)
+
+// AgentPolicyRule decides about requests for remotes matching Remote from executables matching Executable.
+// Both are path.Match patterns, an empty Executable matches every client.
+type AgentPolicyRule struct {
+	Decision   AgentDecision
+	Remote     string
+	Executable string
+	Line       int
+}
+
+// AgentRequest is a single request to the agent a policy decides about.
+type AgentRequest struct {
+	Procedure  string
+	Peer       *AgentPeer
+	Repository string
+	Remotes    []string
+}
+
+// AgentPolicy decides which clients get which keys.
+// The first rule matching a request wins, requests no rule matches are denied.
+// Without any rules, all requests of the same user are allowed.
+// Requests of clients whose credentials cannot be determined are denied unless AllowUnknownPeers is set.
+type AgentPolicy struct {
+	Rules []AgentPolicyRule
+	// ConfirmHelper is run for ask decisions, it gets the request as key=value lines and allows it by exiting with 0
+	ConfirmHelper string
+	// AllowUnknownPeers treats clients without peer credentials, e.g. on platforms other than Linux, as the same user
+	AllowUnknownPeers bool
+}
+
+// LoadAgentPolicy reads the policy file, a missing file results in an empty policy.
+func LoadAgentPolicy(filePath string) (*AgentPolicy, error) {
+	raw, err := os.ReadFile(filePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		slog.Debug("No agent policy found, allowing all requests", slog.String("path", filePath))
+		return new(AgentPolicy), nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read agent policy: %w", err)
+	}
+
+	return ParseAgentPolicy(raw)
+}
+
+// ParseAgentPolicy parses lines of the form <allow|deny|ask> <remote pattern> [<executable pattern>],
+// empty lines and lines starting with # are ignored.
+func ParseAgentPolicy(raw []byte) (*AgentPolicy, error) {
+	var (
+		policy = new(AgentPolicy)
+		lineNo int
+	)
+
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for scanner.Scan() {
+		lineNo++
+
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+
+		if len(fields) > 3 {
+			return nil, fmt.Errorf("%w: line %d: expected decision, remote and optional executable", ErrInvalidAgentPolicy, lineNo)
+		}
+
+		rule := AgentPolicyRule{Decision: AgentDecision(strings.ToLower(fields[0])), Line: lineNo}
+
+		switch rule.Decision {
+		case AgentDecisionAllow, AgentDecisionDeny, AgentDecisionAsk:
+		default:
+			return nil, fmt.Errorf("%w: line %d: unknown decision %q", ErrInvalidAgentPolicy, lineNo, fields[0])
+		}
+
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("%w: line %d: missing remote pattern", ErrInvalidAgentPolicy, lineNo)
+		}
+
+		rule.Remote = fields[1]
+		if len(fields) == 3 {
+			rule.Executable = fields[2]
+		}
+
+		for _, pattern := range []string{rule.Remote, rule.Executable} {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("%w: line %d: %w", ErrInvalidAgentPolicy, lineNo, err)
+			}
+		}
+
+		policy.Rules = append(policy.Rules, rule)
+	}
+
+	return policy, scanner.Err()
+}
+
+// Decide returns the decision for the given request and the reason for it.
+func (p *AgentPolicy) Decide(ctx context.Context, req AgentRequest) (AgentDecision, string) {
+	switch {
+	case req.Peer == nil && !p.AllowUnknownPeers:
+		return AgentDecisionDeny, "client credentials are unknown"
+	case req.Peer != nil && int64(req.Peer.UID) != int64(os.Getuid()):
+		return AgentDecisionDeny, "client runs as uid " + strconv.FormatUint(uint64(req.Peer.UID), 10)
+	}
+
+	// locking does not hand out any keys and unlocking requires the passphrase
+	switch req.Procedure {
+	case agentv1connect.IdentitiesStoreServiceLockProcedure, agentv1connect.IdentitiesStoreServiceUnlockProcedure:
+		return AgentDecisionAllow, "lock requests are allowed for the same user"
+	}
+
+	if len(p.Rules) == 0 {
+		return AgentDecisionAllow, "no policy configured"
+	}
+
+	for _, rule := range p.Rules {
+		if !rule.matches(req) {
+			continue
+		}
+
+		reason := "rule at line " + strconv.Itoa(rule.Line)
+		if rule.Decision != AgentDecisionAsk {
+			return rule.Decision, reason
+		}
+
+		return p.confirm(ctx, req, reason)
+	}
+
+	return AgentDecisionDeny, "no rule matches"
+}
+
+// agentRequestOf collects everything the policy decides about from a request.
+func agentRequestOf(ctx context.Context, req connect.AnyRequest) AgentRequest {
+	agentReq := AgentRequest{
+		Procedure:  req.Spec().Procedure,
+		Repository: req.Header().Get(AgentRepositoryHeader),
+	}
+
+	if peer, ok := AgentPeerFrom(ctx); ok {
+		agentReq.Peer = &peer
+	}
+
+	switch msg := req.Any().(type) {
+	case *agentv1.GetIdentitiesRequest:
+		agentReq.Remotes = msg.GetRemotes()
+	case *agentv1.StoreIdentityRequest:
+		if msg.GetRemote() != "" {
+			agentReq.Remotes = []string{msg.GetRemote()}
+		}
+	case *agentv1.GetPassphraseRequest:
+		agentReq.Remotes = msg.GetRemotes()
+	case *agentv1.StorePassphraseRequest:
+		if msg.GetRemote() != "" {
+			agentReq.Remotes = []string{msg.GetRemote()}
+		}
+	}
+
+	return agentReq
+}
+
+func (p *AgentPolicy) confirm(ctx context.Context, req AgentRequest, reason string) (AgentDecision, string) {
+	if p.ConfirmHelper == "" {
+		return AgentDecisionDeny, reason + " asks but no confirmation helper is configured"
+	}
+
+	input := [][2]string{
+		{"procedure", req.Procedure},
+		{"repository", req.Repository},
+	}
+
+	if req.Peer != nil {
+		input = append(
+			input,
+			[2]string{"pid", strconv.Itoa(int(req.Peer.PID))},
+			[2]string{"executable", req.Peer.Executable},
+		)
+	}
+
+	for _, remote := range req.Remotes {
+		input = append(input, [2]string{"remote", remote})
+	}
+
+	stdin := new(bytes.Buffer)
+	if err := writeHelperInput(stdin, input); err != nil {
+		return AgentDecisionDeny, err.Error()
+	}
+
+	//nolint:gosec // running the configured helper is the whole point
+	helperCmd := exec.CommandContext(ctx, "sh", "-c", p.ConfirmHelper)
+	helperCmd.Stdin = stdin
+
+	if err := helperCmd.Run(); err != nil {
+		return AgentDecisionDeny, reason + " asked, confirmation helper refused: " + err.Error()
+	}
+
+	return AgentDecisionAllow, reason + " asked, confirmed"
+}
+
+func (r AgentPolicyRule) matches(req AgentRequest) bool {
+	if r.Executable != "" {
+		if req.Peer == nil || req.Peer.Executable == "" {
+			return false
+		}
+
+		if matched, _ := path.Match(r.Executable, req.Peer.Executable); !matched {
+			return false
+		}
+	}
+
+	// requests outside of repositories have no remotes, only a wildcard matches them
+	if r.Remote == "*" {
+		return true
+	}
+
+	for _, remote := range req.Remotes {
+		if matched, _ := path.Match(r.Remote, remote); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+func logAgentDecision(ctx context.Context, req AgentRequest, decision AgentDecision, reason string) {
+	attrs := []any{
+		slog.String("procedure", req.Procedure),
+		slog.String("decision", string(decision)),
+		slog.String("reason", reason),
+		slog.String("repository", req.Repository),
+		slog.String("remotes", strings.Join(req.Remotes, ",")),
+	}
+
+	if req.Peer != nil {
+		attrs = append(
+			attrs,
+			slog.Int("pid", int(req.Peer.PID)),
+			slog.Uint64("uid", uint64(req.Peer.UID)),
+			slog.String("executable", req.Peer.Executable),
+		)
+	}
+
+	if decision == AgentDecisionAllow {
+		slog.InfoContext(ctx, "Agent request allowed", attrs...)
+	} else {
+		slog.WarnContext(ctx, "Agent request denied", attrs...)
+	}
+}
@@ -0,0 +1,174 @@
+package infrastructure_test
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/prskr/git-age/infrastructure"
+	"github.com/prskr/git-age/internal/testx"
+)
+
+func TestParseAgentPolicy(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		policy    string
+		wantRules int
+		wantErr   error
+	}{
+		{
+			name:   "Empty",
+			policy: "# nothing configured yet\n\n",
+		},
+		{
+			name:      "Rules",
+			policy:    "allow git@github.com:acme/* /usr/bin/git-age\nASK *\ndeny https://github.com/*\n",
+			wantRules: 3,
+		},
+		{
+			name:    "Unknown decision",
+			policy:  "permit *\n",
+			wantErr: infrastructure.ErrInvalidAgentPolicy,
+		},
+		{
+			name:    "Missing remote",
+			policy:  "allow\n",
+			wantErr: infrastructure.ErrInvalidAgentPolicy,
+		},
+		{
+			name:    "Malformed pattern",
+			policy:  "allow git@github.com:[acme\n",
+			wantErr: infrastructure.ErrInvalidAgentPolicy,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			policy, err := infrastructure.ParseAgentPolicy([]byte(tt.policy))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseAgentPolicy() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if err == nil && len(policy.Rules) != tt.wantRules {
+				t.Errorf("ParseAgentPolicy() rules = %v, want %d", policy.Rules, tt.wantRules)
+			}
+		})
+	}
+}
+
+func TestAgentPolicy_Decide(t *testing.T) {
+	t.Parallel()
+
+	const policy = `
+allow git@github.com:acme/* /usr/bin/git-age
+deny  git@github.com:acme/*
+ask   https://github.com/*
+allow https://gitlab.com/*
+`
+
+	gitAge := &infrastructure.AgentPeer{PID: 42, UID: uint32(os.Getuid()), Executable: "/usr/bin/git-age"}
+	other := &infrastructure.AgentPeer{PID: 43, UID: uint32(os.Getuid()), Executable: "/usr/bin/python3"}
+
+	tests := []struct {
+		name          string
+		policy        string
+		confirmHelper string
+		allowUnknown  bool
+		req           infrastructure.AgentRequest
+		want          infrastructure.AgentDecision
+	}{
+		{
+			name: "No policy",
+			req:  infrastructure.AgentRequest{Peer: other},
+			want: infrastructure.AgentDecisionAllow,
+		},
+		{
+			name: "Unknown peer without policy",
+			req:  infrastructure.AgentRequest{},
+			want: infrastructure.AgentDecisionDeny,
+		},
+		{
+			name:         "Unknown peer explicitly allowed",
+			allowUnknown: true,
+			req:          infrastructure.AgentRequest{},
+			want:         infrastructure.AgentDecisionAllow,
+		},
+		{
+			name: "Other user",
+			req:  infrastructure.AgentRequest{Peer: &infrastructure.AgentPeer{UID: uint32(os.Getuid()) + 1}},
+			want: infrastructure.AgentDecisionDeny,
+		},
+		{
+			name:   "Allowed executable",
+			policy: policy,
+			req:    infrastructure.AgentRequest{Peer: gitAge, Remotes: []string{"git@github.com:acme/infra.git"}},
+			want:   infrastructure.AgentDecisionAllow,
+		},
+		{
+			name:   "Other executable",
+			policy: policy,
+			req:    infrastructure.AgentRequest{Peer: other, Remotes: []string{"git@github.com:acme/infra.git"}},
+			want:   infrastructure.AgentDecisionDeny,
+		},
+		{
+			name:   "Unknown peer",
+			policy: policy,
+			req:    infrastructure.AgentRequest{Remotes: []string{"git@github.com:acme/infra.git"}},
+			want:   infrastructure.AgentDecisionDeny,
+		},
+		{
+			name:   "No rule matches",
+			policy: policy,
+			req:    infrastructure.AgentRequest{Peer: gitAge, Remotes: []string{"git@example.com:acme/infra.git"}},
+			want:   infrastructure.AgentDecisionDeny,
+		},
+		{
+			name:   "Ask without helper",
+			policy: policy,
+			req:    infrastructure.AgentRequest{Peer: gitAge, Remotes: []string{"https://github.com/acme"}},
+			want:   infrastructure.AgentDecisionDeny,
+		},
+		{
+			name:          "Ask confirmed",
+			policy:        policy,
+			confirmHelper: `grep -q '^executable=/usr/bin/git-age$'`,
+			req:           infrastructure.AgentRequest{Peer: gitAge, Remotes: []string{"https://github.com/acme"}},
+			want:          infrastructure.AgentDecisionAllow,
+		},
+		{
+			name:          "Ask refused",
+			policy:        policy,
+			confirmHelper: "exit 1",
+			req:           infrastructure.AgentRequest{Peer: gitAge, Remotes: []string{"https://github.com/acme"}},
+			want:          infrastructure.AgentDecisionDeny,
+		},
+		{
+			name:   "Any of the remotes",
+			policy: policy,
+			req:    infrastructure.AgentRequest{Peer: other, Remotes: []string{"git@example.com:x", "https://gitlab.com/acme"}},
+			want:   infrastructure.AgentDecisionAllow,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			policy, err := infrastructure.ParseAgentPolicy([]byte(tt.policy))
+			if err != nil {
+				t.Fatalf("ParseAgentPolicy() error = %v", err)
+			}
+
+			policy.ConfirmHelper = tt.confirmHelper
+			policy.AllowUnknownPeers = tt.allowUnknown
+
+			if got, reason := policy.Decide(testx.Context(t), tt.req); got != tt.want {
+				t.Errorf("Decide() = %s (%s), want %s", got, reason, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,465 @@
+package infrastructure
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"connectrpc.com/connect"
+	"connectrpc.com/grpchealth"
+	"filippo.io/age"
+
+	agentv1 "github.com/prskr/git-age/api/gen/agent/v1"
+	"github.com/prskr/git-age/api/gen/agent/v1/agentv1connect"
+
+	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/core/services"
+)
+
+var (
+	ErrUnsupportedAgentIdentity = errors.New("identity type is not supported by the agent")
+	ErrAgentNotLocked           = errors.New("agent is not locked")
+	ErrMissingLockPassphrase    = errors.New("a passphrase is required to lock the agent")
+	ErrMissingPassphrase        = errors.New("passphrase must not be empty")
+	ErrWrongLockPassphrase      = errors.New("passphrase does not match the one the agent was locked with")
+)
+
+var (
+	_ agentv1connect.IdentitiesStoreServiceHandler = (*AgentServer)(nil)
+	_ grpchealth.Checker                           = (*AgentServer)(nil)
+)
+
+// AgentServer serves the identities of the local stores to other git-age processes,
+// every request is checked against the policy and recorded in the audit log if configured.
+type AgentServer struct {
+	Store  ports.IdentitiesStore
+	Policy *AgentPolicy
+	Audit  *AgentAuditLog
+	// IdleTimeout locks the agent if it did not handle any request for the given period, zero disables it
+	IdleTimeout time.Duration
+	// LockPassphrase unlocks the agent after it locked itself, every Lock request replaces it
+	LockPassphrase string
+
+	mu sync.Mutex
+	// lockDigest is the digest of the passphrase the agent is locked with, nil while it is unlocked
+	lockDigest []byte
+	// idleDigest is the digest of the passphrase the agent locks itself with after IdleTimeout
+	idleDigest   []byte
+	lastActivity time.Time
+	ephemeral    []agentEphemeralIdentity
+}
+
+// agentEphemeralIdentity is only kept in memory, optionally until it expires.
+type agentEphemeralIdentity struct {
+	Identity ports.Identity
+	Remote   string
+	Expires  time.Time
+}
+
+func (s *AgentServer) Handler() http.Handler {
+	s.mu.Lock()
+	s.lastActivity = time.Now()
+	s.mu.Unlock()
+
+	mux := http.NewServeMux()
+	mux.Handle(agentv1connect.NewIdentitiesStoreServiceHandler(s, connect.WithInterceptors(s.interceptor())))
+	mux.Handle(grpchealth.NewHandler(s))
+
+	return mux
+}
+
+// Serve handles connections until the context is canceled.
+func (s *AgentServer) Serve(ctx context.Context, listener net.Listener) error {
+	srv := &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		ConnContext:       AgentPeerContext,
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		defer cancel()
+
+		if err := srv.Shutdown(shutdownCtx); err != nil {
+			slog.Warn("Failed to shut down agent", slog.String("err", err.Error()))
+		}
+	}()
+
+	if err := srv.Serve(listener); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	return nil
+}
+
+// interceptor checks every request against the policy, logs the decision and audits the request.
+func (s *AgentServer) interceptor() connect.UnaryInterceptorFunc {
+	return func(next connect.UnaryFunc) connect.UnaryFunc {
+		return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+			agentReq := agentRequestOf(ctx, req)
+
+			decision, reason := s.Policy.Decide(ctx, agentReq)
+			logAgentDecision(ctx, agentReq, decision, reason)
+
+			entry := NewAgentAuditEntry(agentReq, decision, reason)
+
+			if decision != AgentDecisionAllow {
+				if err := s.audit(entry); err != nil {
+					return nil, err
+				}
+
+				return nil, connect.NewError(connect.CodePermissionDenied, fmt.Errorf("%w: %s", ErrAgentRequestDenied, reason))
+			}
+
+			resp, err := next(ctx, req)
+			if err != nil {
+				entry.Error = err.Error()
+			} else {
+				entry.Keys = auditedKeys(req, resp)
+			}
+
+			// keys must not be handed out without a record
+			if auditErr := s.audit(entry); auditErr != nil {
+				return nil, auditErr
+			}
+
+			return resp, err
+		}
+	}
+}
+
+func (s *AgentServer) audit(entry AgentAuditEntry) error {
+	if s.Audit == nil {
+		return nil
+	}
+
+	if err := s.Audit.Append(entry); err != nil {
+		slog.Error("Failed to write audit log", slog.String("err", err.Error()))
+		return connect.NewError(connect.CodeInternal, err)
+	}
+
+	return nil
+}
+
+// auditedKeys returns the public keys of the identities returned or stored by a request.
+func auditedKeys(req connect.AnyRequest, resp connect.AnyResponse) (keys []string) {
+	var privateKeys []string
+
+	switch msg := resp.Any().(type) {
+	case *agentv1.GetIdentitiesResponse:
+		privateKeys = msg.GetKeys()
+	case *agentv1.GetPassphraseResponse:
+		if msg.GetPassphrase() != "" {
+			keys = append(keys, ports.PassphraseRecipient)
+		}
+	default:
+		switch storeReq := req.Any().(type) {
+		case *agentv1.StoreIdentityRequest:
+			privateKeys = []string{storeReq.GetPrivateKey()}
+		case *agentv1.StorePassphraseRequest:
+			keys = append(keys, ports.PassphraseRecipient)
+		}
+	}
+
+	for _, privateKey := range privateKeys {
+		ids, err := age.ParseIdentities(strings.NewReader(privateKey))
+		if err != nil {
+			continue
+		}
+
+		for _, id := range ids {
+			if publicKey, ok := ports.PublicKeyOf(id); ok {
+				keys = append(keys, publicKey)
+			}
+		}
+	}
+
+	return keys
+}
+
+// Check reports the identities store service as NOT_SERVING while the agent is locked.
+func (s *AgentServer) Check(_ context.Context, req *grpchealth.CheckRequest) (*grpchealth.CheckResponse, error) {
+	if req.Service != "" && req.Service != agentv1connect.IdentitiesStoreServiceName {
+		return nil, connect.NewError(connect.CodeNotFound, fmt.Errorf("unknown service %s", req.Service))
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.isLocked(time.Now()) {
+		return &grpchealth.CheckResponse{Status: grpchealth.StatusNotServing}, nil
+	}
+
+	return &grpchealth.CheckResponse{Status: grpchealth.StatusServing}, nil
+}
+
+func (s *AgentServer) Lock(
+	ctx context.Context,
+	req *connect.Request[agentv1.LockRequest],
+) (*connect.Response[agentv1.LockResponse], error) {
+	if req.Msg.GetPassphrase() == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, ErrMissingLockPassphrase)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.isLocked(time.Now()) {
+		return nil, connect.NewError(connect.CodeFailedPrecondition, ErrAgentLocked)
+	}
+
+	s.lockDigest = lockPassphraseDigest(req.Msg.GetPassphrase())
+	s.idleDigest = s.lockDigest
+
+	slog.InfoContext(ctx, "Agent locked")
+
+	return connect.NewResponse(new(agentv1.LockResponse)), nil
+}
+
+func (s *AgentServer) Unlock(
+	ctx context.Context,
+	req *connect.Request[agentv1.UnlockRequest],
+) (*connect.Response[agentv1.UnlockResponse], error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if !s.isLocked(now) {
+		return nil, connect.NewError(connect.CodeFailedPrecondition, ErrAgentNotLocked)
+	}
+
+	if subtle.ConstantTimeCompare(lockPassphraseDigest(req.Msg.GetPassphrase()), s.lockDigest) != 1 {
+		return nil, connect.NewError(connect.CodePermissionDenied, ErrWrongLockPassphrase)
+	}
+
+	s.lockDigest = nil
+	s.lastActivity = now
+
+	slog.InfoContext(ctx, "Agent unlocked")
+
+	return connect.NewResponse(new(agentv1.UnlockResponse)), nil
+}
+
+// isLocked has to be called with the mutex held,
+// it locks the agent if it was idle for longer than IdleTimeout.
+func (s *AgentServer) isLocked(now time.Time) bool {
+	if s.lockDigest != nil {
+		return true
+	}
+
+	if s.IdleTimeout <= 0 || now.Sub(s.lastActivity) < s.IdleTimeout {
+		return false
+	}
+
+	if s.idleDigest == nil && s.LockPassphrase != "" {
+		s.idleDigest = lockPassphraseDigest(s.LockPassphrase)
+	}
+
+	if s.idleDigest == nil {
+		slog.Warn("Agent cannot lock itself without a lock passphrase")
+		return false
+	}
+
+	s.lockDigest = s.idleDigest
+
+	slog.Info("Agent locked after inactivity", slog.Duration("idle_timeout", s.IdleTimeout))
+
+	return true
+}
+
+// active records the activity for the idle timeout, it fails while the agent is locked.
+func (s *AgentServer) active() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if s.isLocked(now) {
+		return connect.NewError(connect.CodeFailedPrecondition, ErrAgentLocked)
+	}
+
+	s.lastActivity = now
+
+	return nil
+}
+
+// addEphemeral keeps the identity in memory, adding an identity again replaces its lifetime.
+func (s *AgentServer) addEphemeral(id ports.Identity, remote string, lifetime time.Duration) {
+	entry := agentEphemeralIdentity{Identity: id, Remote: remote}
+	if lifetime > 0 {
+		entry.Expires = time.Now().Add(lifetime)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	publicKey := id.Recipient().String()
+	s.ephemeral = slices.DeleteFunc(s.ephemeral, func(existing agentEphemeralIdentity) bool {
+		return existing.Identity.Recipient().String() == publicKey
+	})
+
+	s.ephemeral = append(s.ephemeral, entry)
+}
+
+// ephemeralIdentities drops expired identities and returns the ones without or with one of the remotes.
+func (s *AgentServer) ephemeralIdentities(remotes []string) (ids []ports.Identity) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.ephemeral = slices.DeleteFunc(s.ephemeral, func(entry agentEphemeralIdentity) bool {
+		expired := !entry.Expires.IsZero() && !now.Before(entry.Expires)
+		if expired {
+			slog.Info("Identity lifetime expired", slog.String("public_key", entry.Identity.Recipient().String()))
+		}
+
+		return expired
+	})
+
+	for _, entry := range s.ephemeral {
+		if entry.Remote == "" || slices.Contains(remotes, entry.Remote) {
+			ids = append(ids, entry.Identity)
+		}
+	}
+
+	return ids
+}
+
+func lockPassphraseDigest(passphrase string) []byte {
+	digest := sha256.Sum256([]byte(passphrase))
+	return digest[:]
+}
+
+func (s *AgentServer) GetIdentities(
+	ctx context.Context,
+	req *connect.Request[agentv1.GetIdentitiesRequest],
+) (*connect.Response[agentv1.GetIdentitiesResponse], error) {
+	if err := s.active(); err != nil {
+		return nil, err
+	}
+
+	query := ports.IdentitiesQuery{Remotes: req.Msg.GetRemotes()}
+
+	ids, err := s.Store.Identities(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := new(agentv1.GetIdentitiesResponse)
+
+	for _, id := range s.ephemeralIdentities(query.Remotes) {
+		resp.Keys = append(resp.Keys, id.String())
+	}
+
+	for _, id := range ids {
+		// SSH identities cannot be serialized again, clients have to read them themselves
+		if stringer, ok := id.(fmt.Stringer); ok {
+			resp.Keys = append(resp.Keys, stringer.String())
+		}
+	}
+
+	return connect.NewResponse(resp), nil
+}
+
+func (s *AgentServer) GetPassphrase(
+	ctx context.Context,
+	req *connect.Request[agentv1.GetPassphraseRequest],
+) (*connect.Response[agentv1.GetPassphraseResponse], error) {
+	if err := s.active(); err != nil {
+		return nil, err
+	}
+
+	passphraseStore, ok := s.Store.(ports.PassphraseStore)
+	if !ok {
+		return nil, connect.NewError(connect.CodeUnimplemented, services.ErrPassphraseNotSupported)
+	}
+
+	passphrase, err := passphraseStore.Passphrase(ctx, ports.IdentitiesQuery{Remotes: req.Msg.GetRemotes()})
+	if errors.Is(err, services.ErrNoPassphrase) {
+		passphrase = ""
+	} else if err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(&agentv1.GetPassphraseResponse{Passphrase: passphrase}), nil
+}
+
+func (s *AgentServer) StorePassphrase(
+	ctx context.Context,
+	req *connect.Request[agentv1.StorePassphraseRequest],
+) (*connect.Response[agentv1.StorePassphraseResponse], error) {
+	if err := s.active(); err != nil {
+		return nil, err
+	}
+
+	passphraseStore, ok := s.Store.(ports.PassphraseStore)
+	if !ok {
+		return nil, connect.NewError(connect.CodeUnimplemented, services.ErrPassphraseNotSupported)
+	}
+
+	if req.Msg.GetPassphrase() == "" {
+		return nil, connect.NewError(connect.CodeInvalidArgument, ErrMissingPassphrase)
+	}
+
+	cmd := ports.StorePassphraseCommand{
+		Passphrase: req.Msg.GetPassphrase(),
+		Comment:    req.Msg.GetComment(),
+		Remote:     req.Msg.GetRemote(),
+	}
+
+	if err := passphraseStore.StorePassphrase(ctx, cmd); errors.Is(err, services.ErrPassphraseNotSupported) {
+		return nil, connect.NewError(connect.CodeUnimplemented, err)
+	} else if err != nil {
+		return nil, err
+	}
+
+	return connect.NewResponse(new(agentv1.StorePassphraseResponse)), nil
+}
+
+func (s *AgentServer) StoreIdentity(
+	ctx context.Context,
+	req *connect.Request[agentv1.StoreIdentityRequest],
+) (*connect.Response[agentv1.StoreIdentityResponse], error) {
+	if err := s.active(); err != nil {
+		return nil, err
+	}
+
+	parsed, err := age.ParseIdentities(strings.NewReader(req.Msg.GetPrivateKey()))
+	if err != nil {
+		return nil, connect.NewError(connect.CodeInvalidArgument, err)
+	}
+
+	lifetime := req.Msg.GetLifetime().AsDuration()
+	if lifetime < 0 {
+		return nil, connect.NewError(connect.CodeInvalidArgument, fmt.Errorf("negative lifetime %s", lifetime))
+	}
+
+	cmd := ports.StoreIdentityCommand{Comment: req.Msg.GetComment(), Remote: req.Msg.GetRemote()}
+	for _, id := range parsed {
+		var ok bool
+		if cmd.Identity, ok = ports.WrapIdentity(id); !ok {
+			return nil, connect.NewError(connect.CodeInvalidArgument, ErrUnsupportedAgentIdentity)
+		}
+
+		if req.Msg.GetEphemeral() || req.Msg.GetLifetime() != nil {
+			s.addEphemeral(cmd.Identity, cmd.Remote, lifetime)
+			continue
+		}
+
+		if err := s.Store.Store(ctx, cmd); err != nil {
+			return nil, err
+		}
+	}
+
+	return connect.NewResponse(new(agentv1.StoreIdentityResponse)), nil
+}
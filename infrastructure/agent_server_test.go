@@ -0,0 +1,395 @@
+package infrastructure_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"filippo.io/age"
+
+	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/core/services"
+	"github.com/prskr/git-age/infrastructure"
+	"github.com/prskr/git-age/internal/testx"
+)
+
+func TestAgentServer(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		policy   string
+		wantIDs  int
+		wantCode connect.Code
+	}{
+		{
+			name:    "No policy",
+			wantIDs: 1,
+		},
+		{
+			name:    "Allowed remote",
+			policy:  "allow git@github.com:acme/*\n",
+			wantIDs: 1,
+		},
+		{
+			name:     "Denied remote",
+			policy:   "deny git@github.com:acme/*\nallow *\n",
+			wantCode: connect.CodePermissionDenied,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			id, err := age.GenerateX25519Identity()
+			if err != nil {
+				t.Fatalf("failed to generate identity: %v", err)
+			}
+
+			policy, err := infrastructure.ParseAgentPolicy([]byte(tt.policy))
+			if err != nil {
+				t.Fatalf("ParseAgentPolicy() error = %v", err)
+			}
+
+			socketPath := filepath.Join(t.TempDir(), "agent.sock")
+			auditPath := filepath.Join(t.TempDir(), "agent-audit.jsonl")
+
+			auditLog, err := infrastructure.OpenAgentAuditLog(auditPath)
+			if err != nil {
+				t.Fatalf("OpenAgentAuditLog() error = %v", err)
+			}
+
+			t.Cleanup(func() {
+				_ = auditLog.Close()
+			})
+
+			listener, err := net.Listen("unix", socketPath)
+			if err != nil {
+				t.Fatalf("failed to listen: %v", err)
+			}
+
+			ctx, cancel := context.WithCancel(testx.Context(t))
+			t.Cleanup(cancel)
+
+			server := &infrastructure.AgentServer{
+				Store: &infrastructure.StaticIdentitiesStore{
+					StoreName: "static",
+					Load: func() ([]byte, error) {
+						return []byte(id.String()), nil
+					},
+				},
+				Policy: policy,
+				Audit:  auditLog,
+			}
+
+			go func() {
+				_ = server.Serve(ctx, listener)
+			}()
+
+			source := &infrastructure.AgentIdentitiesStoreSource{BaseURL: "unix://" + socketPath, Repository: t.TempDir()}
+			if valid, err := source.IsValid(ctx); err != nil || !valid {
+				t.Fatalf("IsValid() = %t, %v", valid, err)
+			}
+
+			store, err := source.GetStore()
+			if err != nil {
+				t.Fatalf("GetStore() error = %v", err)
+			}
+
+			ids, err := store.Identities(ctx, ports.IdentitiesQuery{Remotes: []string{"git@github.com:acme/infra.git"}})
+			if tt.wantCode != 0 && connect.CodeOf(err) != tt.wantCode {
+				t.Fatalf("Identities() error = %v, want code %v", err, tt.wantCode)
+			} else if tt.wantCode == 0 && err != nil {
+				t.Fatalf("Identities() error = %v", err)
+			}
+
+			if len(ids) != tt.wantIDs {
+				t.Errorf("got %d identities, want %d", len(ids), tt.wantIDs)
+			}
+
+			entries, err := infrastructure.ReadAgentAuditLog(auditPath)
+			if err != nil {
+				t.Fatalf("ReadAgentAuditLog() error = %v", err)
+			}
+
+			if len(entries) != 1 {
+				t.Fatalf("got %d audit entries, want 1", len(entries))
+			}
+
+			if entries[0].PID == 0 || entries[0].Repository == "" || len(entries[0].Keys) != tt.wantIDs {
+				t.Errorf("incomplete audit entry %+v", entries[0])
+			}
+
+			if tt.wantIDs > 0 && entries[0].Keys[0] != id.Recipient().String() {
+				t.Errorf("audited key %s, want public key %s", entries[0].Keys[0], id.Recipient())
+			}
+		})
+	}
+}
+
+func TestAgentServer_Lock(t *testing.T) {
+	t.Parallel()
+
+	ctx := testx.Context(t)
+	id := testx.ResultOf(t, age.GenerateX25519Identity)
+	source, agent := startAgentServer(t, &infrastructure.AgentServer{
+		Store:  staticAgentStore(id),
+		Policy: new(infrastructure.AgentPolicy),
+	})
+
+	if err := agent.Unlock(ctx, "secret"); connect.CodeOf(err) != connect.CodeFailedPrecondition {
+		t.Errorf("Unlock() of unlocked agent error = %v, want failed precondition", err)
+	}
+
+	if err := agent.Lock(ctx, "secret"); err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+
+	if _, err := source.IsValid(ctx); !errors.Is(err, infrastructure.ErrAgentLocked) {
+		t.Errorf("IsValid() error = %v, want %v", err, infrastructure.ErrAgentLocked)
+	}
+
+	if _, err := agent.Identities(ctx, ports.IdentitiesQuery{}); connect.CodeOf(err) != connect.CodeFailedPrecondition {
+		t.Errorf("Identities() of locked agent error = %v, want failed precondition", err)
+	}
+
+	if err := agent.Unlock(ctx, "wrong"); connect.CodeOf(err) != connect.CodePermissionDenied {
+		t.Errorf("Unlock() with wrong passphrase error = %v, want permission denied", err)
+	}
+
+	if err := agent.Unlock(ctx, "secret"); err != nil {
+		t.Fatalf("Unlock() error = %v", err)
+	}
+
+	if valid, err := source.IsValid(ctx); err != nil || !valid {
+		t.Errorf("IsValid() = %t, %v after unlock", valid, err)
+	}
+
+	if ids, err := agent.Identities(ctx, ports.IdentitiesQuery{}); err != nil || len(ids) != 1 {
+		t.Errorf("Identities() = %d identities, %v after unlock", len(ids), err)
+	}
+}
+
+func TestAgentServer_IdleTimeout(t *testing.T) {
+	t.Parallel()
+
+	const idleTimeout = 100 * time.Millisecond
+
+	ctx := testx.Context(t)
+	id := testx.ResultOf(t, age.GenerateX25519Identity)
+	source, agent := startAgentServer(t, &infrastructure.AgentServer{
+		Store:          staticAgentStore(id),
+		Policy:         new(infrastructure.AgentPolicy),
+		IdleTimeout:    idleTimeout,
+		LockPassphrase: "secret",
+	})
+
+	if _, err := agent.Identities(ctx, ports.IdentitiesQuery{}); err != nil {
+		t.Fatalf("Identities() error = %v", err)
+	}
+
+	time.Sleep(2 * idleTimeout)
+
+	if _, err := source.IsValid(ctx); !errors.Is(err, infrastructure.ErrAgentLocked) {
+		t.Errorf("IsValid() error = %v, want %v after being idle", err, infrastructure.ErrAgentLocked)
+	}
+
+	if err := agent.Unlock(ctx, "secret"); err != nil {
+		t.Fatalf("Unlock() error = %v", err)
+	}
+
+	if _, err := agent.Identities(ctx, ports.IdentitiesQuery{}); err != nil {
+		t.Errorf("Identities() error = %v after unlock", err)
+	}
+}
+
+func TestAgentServer_Lifetime(t *testing.T) {
+	t.Parallel()
+
+	const lifetime = 200 * time.Millisecond
+
+	var (
+		ctx       = testx.Context(t)
+		persisted = testx.ResultOf(t, age.GenerateX25519Identity)
+		temporary = testx.ResultOf(t, ports.IdentityAlgorithmX25519.Generate)
+		scoped    = testx.ResultOf(t, ports.IdentityAlgorithmX25519.Generate)
+		store     = staticAgentStore(persisted)
+	)
+
+	_, agent := startAgentServer(t, &infrastructure.AgentServer{Store: store, Policy: new(infrastructure.AgentPolicy)})
+
+	if err := agent.Add(ctx, ports.StoreIdentityCommand{Identity: temporary}, lifetime); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	scopedCmd := ports.StoreIdentityCommand{Identity: scoped, Remote: "git@github.com:acme/infra.git"}
+	if err := agent.Add(ctx, scopedCmd, 0); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	if got := agentPublicKeys(t, agent, "git@github.com:acme/infra.git"); len(got) != 3 || !got[temporary.Recipient().String()] {
+		t.Errorf("got public keys %v, want persisted, temporary and scoped identity", got)
+	}
+
+	if got := agentPublicKeys(t, agent, "git@github.com:acme/other.git"); got[scoped.Recipient().String()] {
+		t.Errorf("identity scoped to another remote returned: %v", got)
+	}
+
+	time.Sleep(2 * lifetime)
+
+	got := agentPublicKeys(t, agent, "git@github.com:acme/infra.git")
+	if got[temporary.Recipient().String()] {
+		t.Errorf("identity returned after its lifetime expired")
+	}
+
+	if !got[persisted.Recipient().String()] || !got[scoped.Recipient().String()] {
+		t.Errorf("identities without lifetime must be kept, got %v", got)
+	}
+
+	// ephemeral identities are never written to the stores of the agent
+	if ids := testx.ResultOfA[[]age.Identity](t, store.Identities, ctx, ports.IdentitiesQuery{}); len(ids) != 1 {
+		t.Errorf("got %d identities in the store of the agent, want 1", len(ids))
+	}
+}
+
+func TestAgentServer_Passphrase(t *testing.T) {
+	t.Parallel()
+
+	var (
+		ctx    = testx.Context(t)
+		id     = testx.ResultOf(t, age.GenerateX25519Identity)
+		remote = "git@github.com:acme/infra.git"
+	)
+
+	_, agent := startAgentServer(t, &infrastructure.AgentServer{
+		Store:  &passphraseAgentStore{StaticIdentitiesStore: staticAgentStore(id)},
+		Policy: new(infrastructure.AgentPolicy),
+	})
+
+	if passphrase, err := agent.Passphrase(ctx, ports.IdentitiesQuery{Remotes: []string{remote}}); err != nil || passphrase != "" {
+		t.Errorf("Passphrase() = %q, %v before storing one", passphrase, err)
+	}
+
+	cmd := ports.StorePassphraseCommand{Passphrase: "correct horse battery staple", Remote: remote}
+	if err := agent.StorePassphrase(ctx, cmd); err != nil {
+		t.Fatalf("StorePassphrase() error = %v", err)
+	}
+
+	if passphrase, err := agent.Passphrase(ctx, ports.IdentitiesQuery{Remotes: []string{remote}}); err != nil || passphrase != cmd.Passphrase {
+		t.Errorf("Passphrase() = %q, %v, want %q", passphrase, err, cmd.Passphrase)
+	}
+
+	// the passphrase must not show up among the identities
+	if ids, err := agent.Identities(ctx, ports.IdentitiesQuery{Remotes: []string{remote}}); err != nil || len(ids) != 1 {
+		t.Errorf("Identities() = %d identities, %v, want only the identity", len(ids), err)
+	}
+}
+
+func TestAgentServer_PassphraseNotSupported(t *testing.T) {
+	t.Parallel()
+
+	ctx := testx.Context(t)
+	_, agent := startAgentServer(t, &infrastructure.AgentServer{
+		Store:  staticAgentStore(testx.ResultOf(t, age.GenerateX25519Identity)),
+		Policy: new(infrastructure.AgentPolicy),
+	})
+
+	if passphrase, err := agent.Passphrase(ctx, ports.IdentitiesQuery{}); err != nil || passphrase != "" {
+		t.Errorf("Passphrase() = %q, %v, want no passphrase", passphrase, err)
+	}
+
+	cmd := ports.StorePassphraseCommand{Passphrase: "correct horse battery staple"}
+	if err := agent.StorePassphrase(ctx, cmd); !errors.Is(err, services.ErrPassphraseNotSupported) {
+		t.Errorf("StorePassphrase() error = %v, want %v", err, services.ErrPassphraseNotSupported)
+	}
+}
+
+func startAgentServer(
+	t *testing.T,
+	server *infrastructure.AgentServer,
+) (*infrastructure.AgentIdentitiesStoreSource, *infrastructure.AgentIdentitiesStore) {
+	t.Helper()
+
+	socketPath := filepath.Join(t.TempDir(), "agent.sock")
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(testx.Context(t))
+	t.Cleanup(cancel)
+
+	go func() {
+		_ = server.Serve(ctx, listener)
+	}()
+
+	source := &infrastructure.AgentIdentitiesStoreSource{BaseURL: "unix://" + socketPath}
+
+	agent, err := source.Agent()
+	if err != nil {
+		t.Fatalf("Agent() error = %v", err)
+	}
+
+	return source, agent
+}
+
+func staticAgentStore(id *age.X25519Identity) *infrastructure.StaticIdentitiesStore {
+	return &infrastructure.StaticIdentitiesStore{
+		StoreName: "static",
+		Load: func() ([]byte, error) {
+			return []byte(id.String()), nil
+		},
+	}
+}
+
+func agentPublicKeys(t *testing.T, agent *infrastructure.AgentIdentitiesStore, remote string) map[string]bool {
+	t.Helper()
+
+	ids, err := agent.Identities(testx.Context(t), ports.IdentitiesQuery{Remotes: []string{remote}})
+	if err != nil {
+		t.Fatalf("Identities() error = %v", err)
+	}
+
+	publicKeys := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if publicKey, ok := ports.PublicKeyOf(id); ok {
+			publicKeys[publicKey] = true
+		}
+	}
+
+	return publicKeys
+}
+
+var _ ports.PassphraseStore = (*passphraseAgentStore)(nil)
+
+// passphraseAgentStore keeps passphrases per remote in memory.
+type passphraseAgentStore struct {
+	*infrastructure.StaticIdentitiesStore
+	passphrases map[string]string
+}
+
+func (p *passphraseAgentStore) Passphrase(_ context.Context, query ports.IdentitiesQuery) (string, error) {
+	for _, remote := range query.Remotes {
+		if passphrase, ok := p.passphrases[remote]; ok {
+			return passphrase, nil
+		}
+	}
+
+	return "", nil
+}
+
+func (p *passphraseAgentStore) StorePassphrase(_ context.Context, cmd ports.StorePassphraseCommand) error {
+	if p.passphrases == nil {
+		p.passphrases = make(map[string]string)
+	}
+
+	p.passphrases[cmd.Remote] = cmd.Passphrase
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package infrastructure
+
+import (
+	"fmt"
+	"strings"
+)
+
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+var bech32Generator = [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+// bech32Encode encodes data with the given human-readable part as age does for its keys,
+// other than BIP 173 it does not limit the length of the result.
+func bech32Encode(hrp string, data []byte) (string, error) {
+	if strings.ToLower(hrp) != hrp && strings.ToUpper(hrp) != hrp {
+		return "", fmt.Errorf("mixed case human-readable part: %s", hrp)
+	}
+
+	lower := strings.ToLower(hrp)
+	values := bech32ConvertBits(data)
+
+	checksumInput := append(bech32ExpandHRP(lower), values...)
+	checksumInput = append(checksumInput, 0, 0, 0, 0, 0, 0)
+	mod := bech32Polymod(checksumInput) ^ 1
+
+	var encoded strings.Builder
+	encoded.Grow(len(hrp) + 1 + len(values) + 6)
+	encoded.WriteString(lower)
+	encoded.WriteByte('1')
+
+	for _, v := range values {
+		encoded.WriteByte(bech32Charset[v])
+	}
+
+	for i := range 6 {
+		encoded.WriteByte(bech32Charset[(mod>>uint(5*(5-i)))&31])
+	}
+
+	if strings.ToUpper(hrp) == hrp {
+		return strings.ToUpper(encoded.String()), nil
+	}
+
+	return encoded.String(), nil
+}
+
+func bech32Polymod(values []byte) uint32 {
+	chk := uint32(1)
+
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+
+		for i, gen := range bech32Generator {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= gen
+			}
+		}
+	}
+
+	return chk
+}
+
+func bech32ExpandHRP(hrp string) []byte {
+	expanded := make([]byte, 0, len(hrp)*2+1)
+	for i := range len(hrp) {
+		expanded = append(expanded, hrp[i]>>5)
+	}
+
+	expanded = append(expanded, 0)
+
+	for i := range len(hrp) {
+		expanded = append(expanded, hrp[i]&31)
+	}
+
+	return expanded
+}
+
+// bech32ConvertBits regroups 8-bit bytes to 5-bit values, the last value is padded with zeros.
+func bech32ConvertBits(data []byte) []byte {
+	var (
+		acc    uint32
+		bits   uint
+		result = make([]byte, 0, len(data)*8/5+1)
+	)
+
+	for _, b := range data {
+		acc = acc<<8 | uint32(b)
+		bits += 8
+
+		for bits >= 5 {
+			bits -= 5
+			result = append(result, byte(acc>>bits)&31)
+		}
+	}
+
+	if bits > 0 {
+		result = append(result, byte(acc<<(5-bits))&31)
+	}
+
+	return result
+}
@@ -0,0 +1,227 @@
+package infrastructure
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os/exec"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+
+	"github.com/prskr/git-age/core/ports"
+)
+
+const (
+	helperActionGet             = "get"
+	helperActionStore           = "store"
+	helperActionPassphrase      = "passphrase"
+	helperActionStorePassphrase = "store-passphrase"
+)
+
+var (
+	ErrHelperFailed       = errors.New("identity helper failed")
+	ErrInvalidHelperValue = errors.New("identity helper values must not contain newlines")
+)
+
+var (
+	_ ports.IdentitiesStore = (*CommandIdentitiesStore)(nil)
+	_ ports.PassphraseStore = (*CommandIdentitiesStore)(nil)
+	_ IdentityStoreSource   = (*CommandIdentitiesStoreSource)(nil)
+)
+
+func NewCommandIdentitiesStoreSource(env ports.OSEnv) *CommandIdentitiesStoreSource {
+	return &CommandIdentitiesStoreSource{
+		Helper: env.Get("GIT_AGE_IDENTITY_HELPER"),
+	}
+}
+
+type CommandIdentitiesStoreSource struct {
+	Helper string
+	// Label distinguishes helpers configured as keys source from the one configured with GIT_AGE_IDENTITY_HELPER
+	Label string
+}
+
+func (c *CommandIdentitiesStoreSource) Name() string {
+	return storeName("helper", c.Label)
+}
+
+func (c *CommandIdentitiesStoreSource) IsValid(ctx context.Context) (bool, error) {
+	if c.Helper == "" {
+		slog.DebugContext(ctx, "Skipping identity helper because it is not configured")
+		return false, nil
+	}
+
+	return true, nil
+}
+
+func (c *CommandIdentitiesStoreSource) GetStore() (ports.IdentitiesStore, error) {
+	return &CommandIdentitiesStore{Helper: c.Helper, Label: c.Label}, nil
+}
+
+// CommandIdentitiesStore delegates to an external helper similar to git credential helpers.
+// The helper is invoked by the shell with the action (get or store) as argument,
+// it receives key=value lines on STDIN and answers get requests with identity=<private key> lines on STDOUT.
+// The optional actions passphrase and store-passphrase do the same for the shared passphrase of a repository.
+type CommandIdentitiesStore struct {
+	Helper string
+	Label  string
+}
+
+func (c *CommandIdentitiesStore) Name() string {
+	return storeName("helper", c.Label)
+}
+
+func (c *CommandIdentitiesStore) Generate(
+	ctx context.Context,
+	cmd ports.GenerateIdentityCommand,
+) (publicKey string, err error) {
+	newID, err := cmd.Algorithm.Generate()
+	if err != nil {
+		return "", err
+	}
+
+	storeCmd := ports.StoreIdentityCommand{
+		Identity: newID,
+		Comment:  cmd.Comment,
+		Remote:   cmd.Remote,
+	}
+
+	if err := c.Store(ctx, storeCmd); err != nil {
+		return "", err
+	}
+
+	return newID.Recipient().String(), nil
+}
+
+func (c *CommandIdentitiesStore) Store(ctx context.Context, cmd ports.StoreIdentityCommand) error {
+	if cmd.Comment == "" {
+		cmd.Comment = "Generated on " + time.Now().Format(time.RFC3339)
+	}
+
+	input := [][2]string{
+		{"public_key", cmd.Identity.Recipient().String()},
+		{"identity", cmd.Identity.String()},
+		{"comment", strings.Join(strings.Fields(cmd.Comment), " ")},
+	}
+
+	if cmd.Remote != "" {
+		input = append(input, [2]string{"remote", cmd.Remote})
+	}
+
+	_, err := c.run(ctx, helperActionStore, input)
+
+	return err
+}
+
+func (c *CommandIdentitiesStore) Identities(ctx context.Context, query ports.IdentitiesQuery) ([]age.Identity, error) {
+	input := make([][2]string, 0, len(query.Remotes))
+	for _, remote := range query.Remotes {
+		input = append(input, [2]string{"remote", remote})
+	}
+
+	output, err := c.run(ctx, helperActionGet, input)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []age.Identity
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		key, value, found := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !found || key != "identity" {
+			continue
+		}
+
+		parsed, err := age.ParseIdentities(strings.NewReader(value))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse identity returned by helper: %w", err)
+		}
+
+		ids = append(ids, parsed...)
+	}
+
+	return ids, scanner.Err()
+}
+
+// Passphrase returns the value of the first passphrase=<value> line the helper prints.
+func (c *CommandIdentitiesStore) Passphrase(ctx context.Context, query ports.IdentitiesQuery) (string, error) {
+	input := make([][2]string, 0, len(query.Remotes))
+	for _, remote := range query.Remotes {
+		input = append(input, [2]string{"remote", remote})
+	}
+
+	output, err := c.run(ctx, helperActionPassphrase, input)
+	if err != nil {
+		return "", err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		if passphrase, found := strings.CutPrefix(strings.TrimRight(scanner.Text(), "\r"), "passphrase="); found {
+			return passphrase, nil
+		}
+	}
+
+	return "", scanner.Err()
+}
+
+func (c *CommandIdentitiesStore) StorePassphrase(ctx context.Context, cmd ports.StorePassphraseCommand) error {
+	input := [][2]string{
+		{"passphrase", cmd.Passphrase},
+		{"comment", strings.Join(strings.Fields(cmd.Comment), " ")},
+	}
+
+	if cmd.Remote != "" {
+		input = append(input, [2]string{"remote", cmd.Remote})
+	}
+
+	_, err := c.run(ctx, helperActionStorePassphrase, input)
+
+	return err
+}
+
+func (c *CommandIdentitiesStore) run(ctx context.Context, action string, input [][2]string) ([]byte, error) {
+	stdin := new(bytes.Buffer)
+	if err := writeHelperInput(stdin, input); err != nil {
+		return nil, err
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	//nolint:gosec // running the configured helper is the whole point
+	helperCmd := exec.CommandContext(ctx, "sh", "-c", c.Helper+` "$@"`, c.Helper, action)
+	helperCmd.Stdin = stdin
+	helperCmd.Stdout = &stdout
+	helperCmd.Stderr = &stderr
+
+	slog.DebugContext(ctx, "Running identity helper", slog.String("helper", c.Helper), slog.String("action", action))
+
+	if err := helperCmd.Run(); err != nil {
+		return nil, fmt.Errorf("%w: %s %s: %w: %s", ErrHelperFailed, c.Helper, action, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.Bytes(), nil
+}
+
+func writeHelperInput(writer io.Writer, input [][2]string) error {
+	for _, kv := range input {
+		if strings.ContainsAny(kv[1], "\r\n") {
+			return fmt.Errorf("%w: %s", ErrInvalidHelperValue, kv[0])
+		}
+
+		if _, err := fmt.Fprintf(writer, "%s=%s\n", kv[0], kv[1]); err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintln(writer)
+
+	return err
+}
@@ -0,0 +1,152 @@
+package infrastructure_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/infrastructure"
+	"github.com/prskr/git-age/internal/testx"
+)
+
+// fakeHelper stores all input of store requests in a file and returns the stored identities on get requests.
+const fakeHelper = `#!/bin/sh
+store="$(dirname "$0")/store.txt"
+case "$1" in
+	get)
+		cat > "$(dirname "$0")/get-input.txt"
+		[ -f "$store" ] && grep '^identity=' "$store"
+		exit 0
+		;;
+	store)
+		cat >> "$store"
+		;;
+	*)
+		echo "unknown action $1" >&2
+		exit 1
+		;;
+esac
+`
+
+func TestCommandIdentitiesStore_StoreAndIdentities(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("helper script requires a POSIX shell")
+	}
+
+	helper := writeHelper(t, fakeHelper)
+	store := infrastructure.CommandIdentitiesStore{Helper: helper}
+
+	pubKey, err := store.Generate(testx.Context(t), ports.GenerateIdentityCommand{
+		Comment:   "Hello,\nworld",
+		Remote:    "git@github.com:prskr/git-age.git",
+		Algorithm: ports.IdentityAlgorithmX25519,
+	})
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	stored, err := os.ReadFile(filepath.Join(filepath.Dir(helper), "store.txt"))
+	if err != nil {
+		t.Fatalf("failed to read stored input: %v", err)
+	}
+
+	for _, want := range []string{"public_key=" + pubKey, "comment=Hello, world", "remote=git@github.com:prskr/git-age.git"} {
+		if !strings.Contains(string(stored), want+"\n") {
+			t.Errorf("store input does not contain %q:\n%s", want, stored)
+		}
+	}
+
+	ids, err := store.Identities(testx.Context(t), ports.IdentitiesQuery{Remotes: []string{"https://github.com/prskr/git-age.git"}})
+	if err != nil {
+		t.Fatalf("Identities() error = %v", err)
+	}
+
+	if len(ids) != 1 {
+		t.Fatalf("expected 1 identity, got %d", len(ids))
+	}
+
+	if got, _ := ports.PublicKeyOf(ids[0]); got != pubKey {
+		t.Errorf("Identities() returned %s, want %s", got, pubKey)
+	}
+
+	getInput, err := os.ReadFile(filepath.Join(filepath.Dir(helper), "get-input.txt"))
+	if err != nil {
+		t.Fatalf("failed to read get input: %v", err)
+	}
+
+	if want := "remote=https://github.com/prskr/git-age.git\n\n"; string(getInput) != want {
+		t.Errorf("get input = %q, want %q", getInput, want)
+	}
+}
+
+func TestCommandIdentitiesStore_Identities_HelperFails(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("helper script requires a POSIX shell")
+	}
+
+	store := infrastructure.CommandIdentitiesStore{Helper: writeHelper(t, "#!/bin/sh\necho 'vault is sealed' >&2\nexit 1\n")}
+
+	_, err := store.Identities(testx.Context(t), ports.IdentitiesQuery{})
+	if !errors.Is(err, infrastructure.ErrHelperFailed) {
+		t.Fatalf("Identities() error = %v, want %v", err, infrastructure.ErrHelperFailed)
+	}
+
+	if !strings.Contains(err.Error(), "vault is sealed") {
+		t.Errorf("expected error to contain helper output, got %v", err)
+	}
+}
+
+func writeHelper(tb testing.TB, script string) string {
+	tb.Helper()
+
+	helperPath := filepath.Join(tb.TempDir(), "git-age-helper")
+
+	//nolint:gosec // helper has to be executable
+	if err := os.WriteFile(helperPath, []byte(script), 0o700); err != nil {
+		tb.Fatalf("failed to write helper: %v", err)
+	}
+
+	return helperPath
+}
+
+func TestCommandIdentitiesStore_Passphrase(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("helper script requires a POSIX shell")
+	}
+
+	store := infrastructure.CommandIdentitiesStore{Helper: writeHelper(t, `#!/bin/sh
+store="$(dirname "$0")/passphrase.txt"
+case "$1" in
+	passphrase) [ -f "$store" ] && grep '^passphrase=' "$store"; exit 0 ;;
+	store-passphrase) cat > "$store" ;;
+esac
+`)}
+
+	if got, err := store.Passphrase(testx.Context(t), ports.IdentitiesQuery{}); err != nil || got != "" {
+		t.Fatalf("Passphrase() = %q, %v, want empty passphrase", got, err)
+	}
+
+	cmd := ports.StorePassphraseCommand{Passphrase: "correct horse battery staple", Remote: "git@github.com:prskr/git-age.git"}
+	if err := store.StorePassphrase(testx.Context(t), cmd); err != nil {
+		t.Fatalf("StorePassphrase() error = %v", err)
+	}
+
+	got, err := store.Passphrase(testx.Context(t), ports.IdentitiesQuery{Remotes: []string{cmd.Remote}})
+	if err != nil {
+		t.Fatalf("Passphrase() error = %v", err)
+	}
+
+	if got != cmd.Passphrase {
+		t.Errorf("Passphrase() = %q, want %q", got, cmd.Passphrase)
+	}
+}
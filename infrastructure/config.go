@@ -0,0 +1,296 @@
+package infrastructure
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/prskr/git-age/core/ports"
+)
+
+const configSection = "age"
+
+var (
+	ErrUnknownConfigKey   = errors.New("unknown config key")
+	ErrUnknownConfigScope = errors.New("unknown config scope")
+	ErrNoConfigSource     = errors.New("config scope is not available")
+)
+
+type ConfigScope string
+
+const (
+	ConfigScopeFile     ConfigScope = "file"
+	ConfigScopeSystem   ConfigScope = "system"
+	ConfigScopeGlobal   ConfigScope = "global"
+	ConfigScopeLocal    ConfigScope = "local"
+	ConfigScopeWorktree ConfigScope = "worktree"
+	ConfigScopeCommand  ConfigScope = "command"
+	ConfigScopeEnv      ConfigScope = "env"
+	// ConfigScopeGit reads all git config files git itself reads, every value keeps the scope git reports for it
+	ConfigScopeGit ConfigScope = "git"
+)
+
+// ConfigKey describes a supported setting and the environment variable overriding it.
+type ConfigKey struct {
+	Name string
+	Env  string
+}
+
+// ConfigKeys are all settings that can be configured in git config (age.<name>) or the config file (<name>).
+var ConfigKeys = []ConfigKey{
+	{Name: "keys", Env: "GIT_AGE_KEYS"},
+	{Name: "agentHost", Env: "GIT_AGE_AGENT_HOST"},
+	{Name: "identityHelper", Env: "GIT_AGE_IDENTITY_HELPER"},
+	{Name: "agentConfirmHelper", Env: "GIT_AGE_AGENT_CONFIRM_HELPER"},
+	{Name: "agentLockAfter", Env: "GIT_AGE_AGENT_LOCK_AFTER"},
+	{Name: "algorithm"},
+	{Name: "logLevel", Env: "GIT_AGE_LOG_LEVEL"},
+	{Name: "storeTimeout", Env: "GIT_AGE_STORE_TIMEOUT"},
+	{Name: "tolerateUnavailableStores", Env: "GIT_AGE_TOLERATE_UNAVAILABLE_STORES"},
+	{Name: "signingKey", Env: "GIT_AGE_SIGNING_KEY"},
+	{Name: "expiryWarning", Env: "GIT_AGE_EXPIRY_WARNING"},
+	{Name: "autoReEncrypt", Env: "GIT_AGE_AUTO_REENCRYPT"},
+}
+
+// LookupConfigKey finds a supported key case-insensitively, with or without the age. prefix.
+func LookupConfigKey(name string) (ConfigKey, error) {
+	name = strings.TrimPrefix(strings.ToLower(name), configSection+".")
+
+	idx := slices.IndexFunc(ConfigKeys, func(key ConfigKey) bool {
+		return strings.EqualFold(key.Name, name)
+	})
+
+	if idx < 0 {
+		return ConfigKey{}, fmt.Errorf("%w: %s", ErrUnknownConfigKey, name)
+	}
+
+	return ConfigKeys[idx], nil
+}
+
+// ConfigSource is a single config file in a certain scope.
+type ConfigSource struct {
+	Scope ConfigScope
+	// Path is the config file, git config sources without a path leave it to git to pick the files of the scope
+	Path string
+	// Dir is the directory git is run in, it determines the repository and the includeIf conditions
+	Dir string
+}
+
+// ConfigValue is the effective value of a setting and where it came from.
+type ConfigValue struct {
+	Key    ConfigKey
+	Values []string
+	Scope  ConfigScope
+	Origin string
+}
+
+func (v ConfigValue) Value() string {
+	if len(v.Values) == 0 {
+		return ""
+	}
+
+	return v.Values[len(v.Values)-1]
+}
+
+type configLayer struct {
+	ConfigSource
+	values map[string][]string
+	// origins are the files the values are defined in, if they differ from the source e.g. for included files
+	origins map[string]string
+}
+
+// Config merges all config sources.
+// Environment variables override git config which overrides the git-age config file.
+// Within git config the usual precedence applies: system < global < local < worktree < command (git -c).
+type Config struct {
+	env    ports.OSEnv
+	layers []configLayer
+}
+
+// DefaultConfigSources returns all config sources in the order of their precedence, lowest first.
+// Git config is read by git itself, hence includes, GIT_CONFIG_* variables and extensions.worktreeConfig behave like in git.
+func DefaultConfigSources(cwd ports.CWD, configFile string) []ConfigSource {
+	return []ConfigSource{
+		{Scope: ConfigScopeFile, Path: configFile},
+		{Scope: ConfigScopeGit, Dir: cwd.Value()},
+	}
+}
+
+// ConfigSourceFor returns the source to write settings of the given scope to.
+// Git picks the file of git config scopes, like git config --worktree the worktree scope requires
+// extensions.worktreeConfig if the repository has linked worktrees.
+func ConfigSourceFor(scope ConfigScope, cwd ports.CWD, configFile string) (ConfigSource, error) {
+	switch scope {
+	case ConfigScopeFile:
+		return ConfigSource{Scope: scope, Path: configFile}, nil
+	case ConfigScopeSystem, ConfigScopeGlobal, ConfigScopeLocal, ConfigScopeWorktree:
+		return ConfigSource{Scope: scope, Dir: cwd.Value()}, nil
+	case ConfigScopeCommand, ConfigScopeEnv, ConfigScopeGit:
+		return ConfigSource{}, fmt.Errorf("%w: %s", ErrNoConfigSource, scope)
+	default:
+		return ConfigSource{}, fmt.Errorf("%w: %s", ErrUnknownConfigScope, scope)
+	}
+}
+
+// LoadConfig reads all given sources, missing files are skipped.
+func LoadConfig(env ports.OSEnv, sources ...ConfigSource) (*Config, error) {
+	cfg := &Config{env: maps.Clone(env)}
+
+	for _, src := range sources {
+		if src.Scope != ConfigScopeFile {
+			layers, err := loadGitConfig(src, env)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load %s config %s: %w", src.Scope, cmp.Or(src.Path, src.Dir), err)
+			}
+
+			cfg.layers = append(cfg.layers, layers...)
+
+			continue
+		}
+
+		raw, err := os.ReadFile(src.Path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+
+		layer := configLayer{ConfigSource: src}
+		if err == nil {
+			layer.values, err = parseTOMLConfig(raw)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s config %s: %w", src.Scope, src.Path, err)
+		}
+
+		cfg.layers = append(cfg.layers, layer)
+	}
+
+	return cfg, nil
+}
+
+// Lookup returns the effective value of the given key.
+func (c *Config) Lookup(name string) (ConfigValue, bool) {
+	key, err := LookupConfigKey(name)
+	if err != nil {
+		return ConfigValue{}, false
+	}
+
+	if key.Env != "" {
+		if value, ok := c.env[key.Env]; ok {
+			return ConfigValue{Key: key, Values: []string{value}, Scope: ConfigScopeEnv, Origin: key.Env}, true
+		}
+	}
+
+	for _, layer := range slices.Backward(c.layers) {
+		name := strings.ToLower(key.Name)
+		if values, ok := layer.values[name]; ok {
+			return ConfigValue{Key: key, Values: values, Scope: layer.Scope, Origin: cmp.Or(layer.origins[name], layer.Path)}, true
+		}
+	}
+
+	return ConfigValue{}, false
+}
+
+// List returns the effective values of all configured keys.
+func (c *Config) List() []ConfigValue {
+	values := make([]ConfigValue, 0, len(ConfigKeys))
+	for _, key := range ConfigKeys {
+		if value, ok := c.Lookup(key.Name); ok {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+// ApplyEnv sets the environment variables of all configured keys that are not already set,
+// this way settings that are only read from the environment can be configured as well.
+func (c *Config) ApplyEnv(env ports.OSEnv) {
+	for _, value := range c.List() {
+		if value.Key.Env == "" || value.Scope == ConfigScopeEnv {
+			continue
+		}
+
+		if _, ok := env[value.Key.Env]; !ok {
+			env[value.Key.Env] = value.Value()
+		}
+	}
+}
+
+// SetConfig replaces all values of the given key in the given source.
+func SetConfig(src ConfigSource, env ports.OSEnv, name string, values ...string) error {
+	key, err := LookupConfigKey(name)
+	if err != nil {
+		return err
+	}
+
+	if src.Path != "" {
+		if err := os.MkdirAll(filepath.Dir(src.Path), 0o700); err != nil {
+			return fmt.Errorf("failed to create config directory: %w", err)
+		}
+	}
+
+	if src.Scope != ConfigScopeFile {
+		if err := setGitConfig(src, env, key.Name, values...); err != nil {
+			return fmt.Errorf("failed to update %s config %s: %w", src.Scope, cmp.Or(src.Path, src.Dir), err)
+		}
+
+		return nil
+	}
+
+	raw, err := os.ReadFile(src.Path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to read %s config %s: %w", src.Scope, src.Path, err)
+	}
+
+	updated, err := setTOMLConfig(raw, key.Name, values...)
+	if err != nil {
+		return fmt.Errorf("failed to update %s config %s: %w", src.Scope, src.Path, err)
+	}
+
+	return os.WriteFile(src.Path, updated, 0o644)
+}
+
+// gitDirs returns the git directory of the current worktree and the common git directory of the repository.
+func gitDirs(cwd ports.CWD) (gitDir, commonDir string, err error) {
+	root, err := FindRepoRootFrom(cwd)
+	if err != nil {
+		return "", "", err
+	}
+
+	gitDir = filepath.Join(root, ".git")
+
+	info, err := os.Stat(gitDir)
+	if err != nil {
+		return "", "", err
+	}
+
+	// linked worktrees have a .git file pointing to their git directory
+	if !info.IsDir() {
+		raw, err := os.ReadFile(gitDir)
+		if err != nil {
+			return "", "", err
+		}
+
+		gitDir = strings.TrimSpace(strings.TrimPrefix(string(raw), "gitdir:"))
+		if !filepath.IsAbs(gitDir) {
+			gitDir = filepath.Join(root, gitDir)
+		}
+	}
+
+	commonDir = gitDir
+	if raw, err := os.ReadFile(filepath.Join(gitDir, "commondir")); err == nil {
+		commonDir = strings.TrimSpace(string(raw))
+		if !filepath.IsAbs(commonDir) {
+			commonDir = filepath.Join(gitDir, commonDir)
+		}
+	}
+
+	return gitDir, commonDir, nil
+}
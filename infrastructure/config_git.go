@@ -0,0 +1,183 @@
+package infrastructure
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/prskr/git-age/core/ports"
+)
+
+// gitConfigExitNoMatch is the exit code of git config if no value matches or the file does not exist.
+const gitConfigExitNoMatch = 1
+
+// gitConfigExitNoKey is the exit code of git config --unset-all if the key does not exist.
+const gitConfigExitNoKey = 5
+
+var ErrGitConfig = errors.New("git config failed")
+
+// gitConfigOption is a single value as reported by git config.
+type gitConfigOption struct {
+	Scope ConfigScope
+	// Origin is the file the value is defined in, it differs from the source for included files
+	Origin string
+	// Key is the full key e.g. age.keys, section and key names are lower case
+	Key   string
+	Value string
+}
+
+// readGitConfig asks git for all values whose key matches the given regular expression in the order git reads them.
+// Git follows includes and decides which files to read e.g. config.worktree only if extensions.worktreeConfig is enabled.
+// If the source has a path only this file and the files it includes are read, otherwise every scope git knows about.
+func readGitConfig(src ConfigSource, env ports.OSEnv, keyPattern string) ([]gitConfigOption, error) {
+	args := []string{"config", "--null", "--show-scope", "--show-origin"}
+	if src.Path != "" {
+		args = append(args, "--file", src.Path, "--includes")
+	}
+
+	out, err := runGitConfig(src.Dir, env, append(args, "--get-regexp", keyPattern)...)
+	if err != nil {
+		if gitExitCode(err) == gitConfigExitNoMatch {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	// every value is reported as scope, origin and key followed by a newline and the value if it has one
+	fields := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+	if len(fields)%3 != 0 {
+		return nil, fmt.Errorf("%w: unexpected output %q", ErrGitConfig, out)
+	}
+
+	options := make([]gitConfigOption, 0, len(fields)/3)
+	for idx := 0; idx < len(fields); idx += 3 {
+		key, value, _ := strings.Cut(fields[idx+2], "\n")
+
+		opt := gitConfigOption{
+			Scope:  ConfigScope(fields[idx]),
+			Origin: gitConfigOrigin(src.Dir, fields[idx+1]),
+			Key:    key,
+			Value:  value,
+		}
+
+		// values of a single file are reported with the command scope
+		if src.Path != "" {
+			opt.Scope = src.Scope
+		}
+
+		options = append(options, opt)
+	}
+
+	return options, nil
+}
+
+// loadGitConfig returns a layer for every scope with values of the age section, lowest precedence first.
+func loadGitConfig(src ConfigSource, env ports.OSEnv) ([]configLayer, error) {
+	options, err := readGitConfig(src, env, `^`+configSection+`\.`)
+	if err != nil {
+		return nil, err
+	}
+
+	var layers []configLayer
+
+	for _, opt := range options {
+		key := strings.TrimPrefix(opt.Key, configSection+".")
+		if strings.Contains(key, ".") {
+			// subsections like [age "other"] are not settings of git-age
+			continue
+		}
+
+		if len(layers) == 0 || layers[len(layers)-1].Scope != opt.Scope {
+			layers = append(layers, configLayer{
+				ConfigSource: ConfigSource{Scope: opt.Scope, Path: src.Path, Dir: src.Dir},
+				values:       make(map[string][]string),
+				origins:      make(map[string]string),
+			})
+		}
+
+		layer := layers[len(layers)-1]
+		layer.values[key] = append(layer.values[key], opt.Value)
+		layer.origins[key] = opt.Origin
+	}
+
+	return layers, nil
+}
+
+// setGitConfig replaces all values of age.<key> with git config, everything else in the file is left untouched.
+// Without a path git picks the file of the scope and refuses the worktree scope like git config --worktree does.
+func setGitConfig(src ConfigSource, env ports.OSEnv, key string, values ...string) error {
+	target := []string{"config", "--file", src.Path}
+	if src.Path == "" {
+		target = []string{"config", "--" + string(src.Scope)}
+	}
+
+	name := configSection + "." + key
+
+	if len(values) == 0 {
+		_, err := runGitConfig(src.Dir, env, append(target, "--unset-all", name)...)
+		if err != nil && gitExitCode(err) != gitConfigExitNoKey {
+			return err
+		}
+
+		return nil
+	}
+
+	for idx, value := range values {
+		action := "--add"
+		if idx == 0 {
+			action = "--replace-all"
+		}
+
+		if _, err := runGitConfig(src.Dir, env, append(target, action, name, value)...); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func runGitConfig(dir string, env ports.OSEnv, args ...string) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = env.Environ()
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%w: %w: %s", ErrGitConfig, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.Bytes(), nil
+}
+
+func gitExitCode(err error) int {
+	if exitErr := new(exec.ExitError); errors.As(err, &exitErr) {
+		return exitErr.ExitCode()
+	}
+
+	return -1
+}
+
+// gitConfigOrigin turns the origin reported by git into a path, relative paths are relative to the directory git ran in.
+func gitConfigOrigin(dir, origin string) string {
+	path, found := strings.CutPrefix(origin, "file:")
+	if !found || filepath.IsAbs(path) {
+		return path
+	}
+
+	if dir == "" {
+		if abs, err := filepath.Abs(path); err == nil {
+			return abs
+		}
+
+		return path
+	}
+
+	return filepath.Join(dir, path)
+}
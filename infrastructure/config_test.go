@@ -0,0 +1,382 @@
+package infrastructure_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+
+	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/infrastructure"
+)
+
+func TestLoadConfig_Precedence(t *testing.T) {
+	t.Parallel()
+
+	tmpDir := t.TempDir()
+
+	sources := []infrastructure.ConfigSource{
+		{Scope: infrastructure.ConfigScopeFile, Path: writeConfig(t, tmpDir, "config.toml", `
+# git-age config
+keys = [
+	"file:///keys.txt",
+	'env://AGE_KEY',
+]
+algorithm = "x25519"
+logLevel = "info"
+storeTimeout = "5s"
+tolerateUnavailableStores = true
+
+[age]
+expiryWarning = "720h"
+
+[other]
+expiryWarning = 1
+`)},
+		{Scope: infrastructure.ConfigScopeGlobal, Path: writeConfig(t, tmpDir, "gitconfig", `
+[age]
+	algorithm = hybrid
+	logLevel = debug
+`)},
+		{Scope: infrastructure.ConfigScopeLocal, Path: writeConfig(t, tmpDir, "config", `
+[core]
+	bare = false
+[age]
+	logLevel = error
+`)},
+		{Scope: infrastructure.ConfigScopeWorktree, Path: filepath.Join(tmpDir, "does-not-exist")},
+	}
+
+	cfg, err := infrastructure.LoadConfig(ports.OSEnv{"GIT_AGE_STORE_TIMEOUT": "1s"}, sources...)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	tests := []struct {
+		key        string
+		wantValues []string
+		wantScope  infrastructure.ConfigScope
+	}{
+		{key: "keys", wantValues: []string{"file:///keys.txt", "env://AGE_KEY"}, wantScope: infrastructure.ConfigScopeFile},
+		{key: "age.algorithm", wantValues: []string{"hybrid"}, wantScope: infrastructure.ConfigScopeGlobal},
+		{key: "age.loglevel", wantValues: []string{"error"}, wantScope: infrastructure.ConfigScopeLocal},
+		{key: "storeTimeout", wantValues: []string{"1s"}, wantScope: infrastructure.ConfigScopeEnv},
+		{key: "tolerateUnavailableStores", wantValues: []string{"true"}, wantScope: infrastructure.ConfigScopeFile},
+		{key: "expiryWarning", wantValues: []string{"720h"}, wantScope: infrastructure.ConfigScopeFile},
+	}
+
+	for _, tt := range tests {
+		value, ok := cfg.Lookup(tt.key)
+		if !ok {
+			t.Errorf("Lookup(%s) found nothing", tt.key)
+			continue
+		}
+
+		if !slices.Equal(value.Values, tt.wantValues) || value.Scope != tt.wantScope {
+			t.Errorf("Lookup(%s) = %v from %s, want %v from %s", tt.key, value.Values, value.Scope, tt.wantValues, tt.wantScope)
+		}
+	}
+
+	env := ports.OSEnv{}
+	cfg.ApplyEnv(env)
+
+	if env.Get("GIT_AGE_LOG_LEVEL") != "error" || env.Get("GIT_AGE_STORE_TIMEOUT") != "" {
+		t.Errorf("ApplyEnv() = %v", env)
+	}
+}
+
+func TestLoadConfig_InvalidTOML(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr error
+	}{
+		{name: "Missing value", content: "keys\n", wantErr: infrastructure.ErrInvalidTOML},
+		{name: "Unterminated string", content: `keys = "file:///keys.txt`, wantErr: infrastructure.ErrInvalidTOML},
+		{name: "Bare string", content: "keys = keys.txt", wantErr: infrastructure.ErrInvalidTOML},
+		{name: "Float value", content: "expiryWarning = 1.5", wantErr: infrastructure.ErrUnsupportedTOML},
+		{name: "Datetime in [age] table", content: "[age]\nexpiryWarning = 2026-01-01", wantErr: infrastructure.ErrUnsupportedTOML},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfgPath := writeConfig(t, t.TempDir(), "config.toml", tt.content)
+
+			_, err := infrastructure.LoadConfig(ports.NewOSEnv(), infrastructure.ConfigSource{Scope: infrastructure.ConfigScopeFile, Path: cfgPath})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("LoadConfig() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadConfig_GitIncludes(t *testing.T) {
+	t.Parallel()
+
+	home := t.TempDir()
+	repoRoot := filepath.Join(home, "work", "repo")
+	gitDir := filepath.Join(repoRoot, ".git")
+
+	if _, err := git.PlainInit(repoRoot, false); err != nil {
+		t.Fatalf("failed to init repository: %v", err)
+	}
+
+	writeConfig(t, gitDir, "HEAD", "ref: refs/heads/feature/includes\n")
+	writeConfig(t, gitDir, "shared.inc", "[age]\n\talgorithm = hybrid\n\tlogLevel = info\n")
+	workInc := writeConfig(t, home, "work.inc", "[age]\n\tstoreTimeout = 3s\n")
+	writeConfig(t, gitDir, "branch.inc", "[age]\n\texpiryWarning = 48h\n")
+	writeConfig(t, gitDir, "other.inc", "[age]\n\tkeys = file:///wrong.txt\n")
+
+	localConfig := writeConfig(t, gitDir, "config", `
+[core]
+	repositoryformatversion = 0
+[age]
+	logLevel = debug
+[include]
+	path = shared.inc
+[age]
+	algorithm = x25519
+[includeIf "gitdir:~/work/"]
+	path = ~/work.inc
+[includeIf "gitdir:/does/not/match/"]
+	path = other.inc
+[includeIf "gitdir/i:REPO/.GIT"]
+	path = missing.inc
+[includeIf "onbranch:feature/"]
+	path = branch.inc
+[includeIf "onbranch:main"]
+	path = other.inc
+[includeIf "hasconfig:remote.*.url:https://**"]
+	path = other.inc
+`)
+
+	env := ports.OSEnv{"HOME": home, "GIT_CONFIG_NOSYSTEM": "1"}
+
+	cfg, err := infrastructure.LoadConfig(env, infrastructure.DefaultConfigSources(ports.CWD(repoRoot), "")...)
+	if err != nil {
+		t.Fatalf("LoadConfig() error = %v", err)
+	}
+
+	tests := []struct {
+		key        string
+		wantValue  string
+		wantOrigin string
+	}{
+		{key: "algorithm", wantValue: "x25519", wantOrigin: localConfig},
+		{key: "logLevel", wantValue: "info", wantOrigin: filepath.Join(gitDir, "shared.inc")},
+		{key: "storeTimeout", wantValue: "3s", wantOrigin: workInc},
+		{key: "expiryWarning", wantValue: "48h", wantOrigin: filepath.Join(gitDir, "branch.inc")},
+	}
+
+	for _, tt := range tests {
+		value, ok := cfg.Lookup(tt.key)
+		if !ok {
+			t.Errorf("Lookup(%s) found nothing", tt.key)
+			continue
+		}
+
+		if value.Value() != tt.wantValue || value.Origin != tt.wantOrigin || value.Scope != infrastructure.ConfigScopeLocal {
+			t.Errorf("Lookup(%s) = %s from %s %s, want %s from local %s", tt.key, value.Value(), value.Scope, value.Origin, tt.wantValue, tt.wantOrigin)
+		}
+	}
+
+	if value, ok := cfg.Lookup("keys"); ok {
+		t.Errorf("Lookup(keys) = %v from %s, expected include conditions to not match", value.Values, value.Origin)
+	}
+}
+
+func TestLoadConfig_GitIncludeCycle(t *testing.T) {
+	t.Parallel()
+
+	cfgPath := writeConfig(t, t.TempDir(), "config", "[include]\n\tpath = config\n")
+
+	_, err := infrastructure.LoadConfig(ports.NewOSEnv(), infrastructure.ConfigSource{Scope: infrastructure.ConfigScopeGlobal, Path: cfgPath})
+	if !errors.Is(err, infrastructure.ErrGitConfig) {
+		t.Errorf("LoadConfig() error = %v, want %v", err, infrastructure.ErrGitConfig)
+	}
+}
+
+func TestSetConfig_WorktreeScope(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		config        string
+		linked        bool
+		wantWritePath string
+		wantScope     infrastructure.ConfigScope
+		wantErr       error
+	}{
+		{
+			name:          "Extension disabled",
+			config:        "[core]\n\tbare = false\n",
+			wantWritePath: "config",
+			wantScope:     infrastructure.ConfigScopeLocal,
+		},
+		{
+			name:    "Extension disabled with linked worktrees",
+			config:  "[core]\n\tbare = false\n",
+			linked:  true,
+			wantErr: infrastructure.ErrGitConfig,
+		},
+		{
+			name:          "Extension enabled",
+			config:        "[core]\n\trepositoryformatversion = 1\n[extensions]\n\tworktreeConfig = true\n",
+			linked:        true,
+			wantWritePath: "config.worktree",
+			wantScope:     infrastructure.ConfigScopeWorktree,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			repoRoot := t.TempDir()
+			gitDir := filepath.Join(repoRoot, ".git")
+
+			if _, err := git.PlainInit(repoRoot, false); err != nil {
+				t.Fatalf("failed to init repository: %v", err)
+			}
+
+			writeConfig(t, gitDir, "config", tt.config)
+
+			if tt.linked {
+				linkedDir := filepath.Join(gitDir, "worktrees", "other")
+				writeConfig(t, linkedDir, "HEAD", "ref: refs/heads/other\n")
+				writeConfig(t, linkedDir, "gitdir", filepath.Join(t.TempDir(), ".git")+"\n")
+			}
+
+			env := ports.OSEnv{"HOME": t.TempDir(), "GIT_CONFIG_NOSYSTEM": "1"}
+
+			src, err := infrastructure.ConfigSourceFor(infrastructure.ConfigScopeWorktree, ports.CWD(repoRoot), "")
+			if err != nil {
+				t.Fatalf("ConfigSourceFor() error = %v", err)
+			}
+
+			err = infrastructure.SetConfig(src, env, "logLevel", "debug")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("SetConfig() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr != nil {
+				return
+			}
+
+			cfg, err := infrastructure.LoadConfig(env, infrastructure.DefaultConfigSources(ports.CWD(repoRoot), "")...)
+			if err != nil {
+				t.Fatalf("LoadConfig() error = %v", err)
+			}
+
+			value, _ := cfg.Lookup("logLevel")
+			if value.Value() != "debug" || value.Scope != tt.wantScope || value.Origin != filepath.Join(gitDir, tt.wantWritePath) {
+				t.Errorf("Lookup(logLevel) = %s from %s %s, want debug from %s %s", value.Value(), value.Scope, value.Origin, tt.wantScope, tt.wantWritePath)
+			}
+		})
+	}
+}
+
+func TestSetConfig(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		scope   infrastructure.ConfigScope
+		initial string
+		key     string
+		values  []string
+		keep    string
+	}{
+		{
+			name:    "TOML - new file",
+			scope:   infrastructure.ConfigScopeFile,
+			key:     "age.agentHost",
+			values:  []string{"unix:///run/user/1000/git-age.sock"},
+			initial: "",
+		},
+		{
+			name:    "TOML - replace existing key",
+			scope:   infrastructure.ConfigScopeFile,
+			key:     "keys",
+			values:  []string{"file:///a.txt", "file:///b.d/"},
+			initial: "keys = \"file:///old.txt\"\n\n[other]\nkeys = 1\n",
+			keep:    "[other]\nkeys = 1",
+		},
+		{
+			name:    "TOML - replace key in [age] table",
+			scope:   infrastructure.ConfigScopeFile,
+			key:     "logLevel",
+			values:  []string{"debug"},
+			initial: "LOGLEVEL = \"info\"\n\n[age]\nloglevel = \"warn\"\nalgorithm = \"hybrid\"\n",
+			keep:    "[age]\nalgorithm = \"hybrid\"\nlogLevel = \"debug\"",
+		},
+		{
+			name:    "Git config - keep other sections",
+			scope:   infrastructure.ConfigScopeLocal,
+			key:     "keys",
+			values:  []string{"file:///a.txt", "env://AGE_KEY"},
+			initial: "[core]\n\tbare = false\n[age]\n\tkeys = file:///old.txt\n",
+			keep:    "bare = false",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			src := infrastructure.ConfigSource{Scope: tt.scope, Path: filepath.Join(t.TempDir(), "nested", "config")}
+			if tt.initial != "" {
+				writeConfig(t, filepath.Dir(src.Path), filepath.Base(src.Path), tt.initial)
+			}
+
+			if err := infrastructure.SetConfig(src, ports.NewOSEnv(), tt.key, tt.values...); err != nil {
+				t.Fatalf("SetConfig() error = %v", err)
+			}
+
+			cfg, err := infrastructure.LoadConfig(ports.NewOSEnv(), src)
+			if err != nil {
+				t.Fatalf("LoadConfig() error = %v", err)
+			}
+
+			if value, _ := cfg.Lookup(tt.key); !slices.Equal(value.Values, tt.values) {
+				t.Errorf("Lookup(%s) = %v, want %v", tt.key, value.Values, tt.values)
+			}
+
+			if raw, _ := os.ReadFile(src.Path); !strings.Contains(string(raw), tt.keep) {
+				t.Errorf("SetConfig() dropped unrelated settings:\n%s", raw)
+			}
+		})
+	}
+}
+
+func TestSetConfig_UnknownKey(t *testing.T) {
+	t.Parallel()
+
+	src := infrastructure.ConfigSource{Scope: infrastructure.ConfigScopeFile, Path: filepath.Join(t.TempDir(), "config.toml")}
+	if err := infrastructure.SetConfig(src, ports.NewOSEnv(), "age.unknown", "value"); !errors.Is(err, infrastructure.ErrUnknownConfigKey) {
+		t.Errorf("SetConfig() error = %v, want %v", err, infrastructure.ErrUnknownConfigKey)
+	}
+}
+
+func writeConfig(tb testing.TB, dir, name, content string) string {
+	tb.Helper()
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		tb.Fatalf("failed to create config directory: %v", err)
+	}
+
+	cfgPath := filepath.Join(dir, name)
+	if err := os.WriteFile(cfgPath, []byte(content), 0o600); err != nil {
+		tb.Fatalf("failed to write config: %v", err)
+	}
+
+	return cfgPath
+}
@@ -0,0 +1,142 @@
+package infrastructure
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+var (
+	ErrInvalidTOML     = errors.New("invalid TOML")
+	ErrUnsupportedTOML = errors.New("unsupported TOML")
+)
+
+// parseTOMLConfig reads the top-level keys and the keys of the [age] table of the git-age config file,
+// keys of the [age] table take precedence.
+// Values can be strings, booleans, integers or arrays of them, other tables are ignored.
+func parseTOMLConfig(raw []byte) (map[string][]string, error) {
+	doc, err := decodeTOMLConfig(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string][]string)
+	ageTable, _ := doc[configSection].(map[string]any)
+
+	for _, table := range []map[string]any{doc, ageTable} {
+		for _, key := range slices.Sorted(maps.Keys(table)) {
+			if isTOMLTable(table[key]) {
+				continue
+			}
+
+			parsed, err := tomlValues(table[key])
+			if err != nil {
+				return nil, fmt.Errorf("key %s: %w", key, err)
+			}
+
+			values[strings.ToLower(key)] = parsed
+		}
+	}
+
+	return values, nil
+}
+
+// setTOMLConfig replaces the key in the [age] table if the file has one, otherwise the top-level key.
+// The file is encoded again, hence comments are not preserved.
+func setTOMLConfig(raw []byte, key string, values ...string) ([]byte, error) {
+	doc, err := decodeTOMLConfig(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	table := doc
+	ageTable, hasAgeTable := doc[configSection].(map[string]any)
+
+	// remove all spellings of the key, no matter where they are defined
+	for _, candidate := range []map[string]any{doc, ageTable} {
+		maps.DeleteFunc(candidate, func(existing string, value any) bool {
+			return strings.EqualFold(existing, key) && !isTOMLTable(value)
+		})
+	}
+
+	if hasAgeTable {
+		table = ageTable
+	}
+
+	if len(values) == 1 {
+		table[key] = values[0]
+	} else {
+		table[key] = values
+	}
+
+	buf := new(bytes.Buffer)
+	encoder := toml.NewEncoder(buf)
+	encoder.Indent = ""
+
+	if err := encoder.Encode(doc); err != nil {
+		return nil, fmt.Errorf("failed to encode TOML: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func decodeTOMLConfig(raw []byte) (map[string]any, error) {
+	doc := make(map[string]any)
+	if _, err := toml.NewDecoder(bytes.NewReader(raw)).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidTOML, err)
+	}
+
+	return doc, nil
+}
+
+func isTOMLTable(value any) bool {
+	switch value.(type) {
+	case map[string]any, []map[string]any:
+		return true
+	default:
+		return false
+	}
+}
+
+func tomlValues(value any) ([]string, error) {
+	array, isArray := value.([]any)
+	if !isArray {
+		scalar, err := tomlScalar(value)
+		if err != nil {
+			return nil, err
+		}
+
+		return []string{scalar}, nil
+	}
+
+	values := make([]string, 0, len(array))
+	for _, item := range array {
+		scalar, err := tomlScalar(item)
+		if err != nil {
+			return nil, err
+		}
+
+		values = append(values, scalar)
+	}
+
+	return values, nil
+}
+
+func tomlScalar(value any) (string, error) {
+	switch typed := value.(type) {
+	case string:
+		return typed, nil
+	case bool:
+		return strconv.FormatBool(typed), nil
+	case int64:
+		return strconv.FormatInt(typed, 10), nil
+	default:
+		return "", fmt.Errorf("%w: value of type %T", ErrUnsupportedTOML, value)
+	}
+}
@@ -0,0 +1,22 @@
+//go:build unix
+
+package infrastructure
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/unix"
+)
+
+// validateFD checks with fstat that the descriptor is open before it is wrapped in an *os.File,
+// otherwise closing the file later could close an unrelated descriptor that reused the number.
+func validateFD(fd uintptr) error {
+	var stat unix.Stat_t
+
+	//nolint:gosec // descriptors are small ints, there is no overflow
+	if err := unix.Fstat(int(fd), &stat); err != nil {
+		return fmt.Errorf("%w: %d: %w", ErrInvalidFileDescriptor, fd, err)
+	}
+
+	return nil
+}
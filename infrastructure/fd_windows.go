@@ -0,0 +1,18 @@
+//go:build windows
+
+package infrastructure
+
+import (
+	"fmt"
+
+	"golang.org/x/sys/windows"
+)
+
+// validateFD checks that the inherited handle refers to an open file before it is wrapped in an *os.File.
+func validateFD(fd uintptr) error {
+	if _, err := windows.GetFileType(windows.Handle(fd)); err != nil {
+		return fmt.Errorf("%w: %d: %w", ErrInvalidFileDescriptor, fd, err)
+	}
+
+	return nil
+}
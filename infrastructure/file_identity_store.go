@@ -2,13 +2,17 @@ package infrastructure
 
 import (
 	"bufio"
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"net/url"
 	"os"
 	"path/filepath"
 	"runtime"
+	"slices"
 	"strings"
 	"time"
 
@@ -17,9 +21,17 @@ import (
 	"github.com/prskr/git-age/core/ports"
 )
 
+const (
+	retireAfterPrefix   = "# retire after: "
+	defaultKeysFileName = "keys.txt"
+)
+
+var ErrIdentityNotFound = errors.New("identity not found")
+
 var (
 	_ ports.IdentitiesStore = (*FileIdentityStore)(nil)
-	_ identityStoreSource   = (*FileIdentityStoreSource)(nil)
+	_ ports.IdentityRetirer = (*FileIdentityStore)(nil)
+	_ IdentityStoreSource   = (*FileIdentityStoreSource)(nil)
 )
 
 func NewFileIdentityStoreSource(url *url.URL) *FileIdentityStoreSource {
@@ -28,6 +40,10 @@ func NewFileIdentityStoreSource(url *url.URL) *FileIdentityStoreSource {
 
 type FileIdentityStoreSource url.URL
 
+func (f *FileIdentityStoreSource) Name() string {
+	return (*FileIdentityStore)(f).Name()
+}
+
 func (f *FileIdentityStoreSource) IsValid(context.Context) (bool, error) {
 	return f != nil && f.Path != "", nil
 }
@@ -38,69 +54,172 @@ func (f *FileIdentityStoreSource) GetStore() (ports.IdentitiesStore, error) {
 
 type FileIdentityStore url.URL
 
-func (f *FileIdentityStore) Identities(context.Context, ports.IdentitiesQuery) ([]age.Identity, error) {
-	keysFile, err := os.Open(f.identitiesFilePath())
+// Identities reads all identities from the keys file.
+// If the path points to a directory (keys.d), all files in it are read in lexical order.
+func (f *FileIdentityStore) Identities(context.Context, ports.IdentitiesQuery) (ids []age.Identity, err error) {
+	filePaths, err := f.identitiesFiles()
 	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			return nil, nil
+		return nil, err
+	}
+
+	now := time.Now()
+	for _, filePath := range filePaths {
+		parsed, err := readIdentitiesFile(filePath, now)
+		if err != nil {
+			return nil, err
 		}
-		return nil, fmt.Errorf("failed to open identities file: %w", err)
+
+		ids = append(ids, parsed...)
 	}
 
-	defer func() {
-		_ = keysFile.Close()
-	}()
+	return ids, nil
+}
+
+// Retire either removes the identity immediately if after is not in the future
+// or marks it to be ignored as soon as after has passed.
+func (f *FileIdentityStore) Retire(_ context.Context, publicKey string, after time.Time) error {
+	filePaths, err := f.identitiesFiles()
+	if err != nil {
+		return err
+	}
+
+	for _, filePath := range filePaths {
+		if err := retireIdentity(filePath, publicKey, after); err == nil {
+			return nil
+		} else if !errors.Is(err, ErrIdentityNotFound) {
+			return err
+		}
+	}
 
-	return age.ParseIdentities(keysFile)
+	return fmt.Errorf("%w: %s", ErrIdentityNotFound, publicKey)
 }
 
-func (f *FileIdentityStore) Generate(_ context.Context, cmd ports.GenerateIdentityCommand) (publicKey string, err error) {
+// Name is derived from the path of the keys file unless the URL has a #label.
+func (f *FileIdentityStore) Name() string {
+	return storeName("file", cmp.Or(f.Fragment, f.identitiesFilePath()))
+}
+
+func (f *FileIdentityStore) Generate(ctx context.Context, cmd ports.GenerateIdentityCommand) (publicKey string, err error) {
 	newID, err := cmd.Algorithm.Generate()
 	if err != nil {
 		return "", err
 	}
 
-	publicKey = newID.Recipient().String()
+	storeCmd := ports.StoreIdentityCommand{
+		Identity: newID,
+		Comment:  cmd.Comment,
+		Remote:   cmd.Remote,
+	}
+
+	if err := f.Store(ctx, storeCmd); err != nil {
+		return "", err
+	}
+
+	return newID.Recipient().String(), nil
+}
+
+func (f *FileIdentityStore) Store(_ context.Context, cmd ports.StoreIdentityCommand) (err error) {
+	publicKey := cmd.Identity.Recipient().String()
 
 	if cmd.Comment == "" {
 		cmd.Comment = "# generated on " + time.Now().Format(time.RFC3339)
 	}
 
-	ifp := f.identitiesFilePath()
+	ifp := f.storeFilePath()
 	identitiesDir, _ := filepath.Split(ifp)
 	if err := os.MkdirAll(identitiesDir, 0o700); err != nil {
-		return "", fmt.Errorf("failed to create identities directory: %w", err)
+		return fmt.Errorf("failed to create identities directory: %w", err)
 	}
 
-	identitiesFile, err := os.OpenFile(ifp, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	identitiesFile, err := os.OpenFile(ifp, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0o600)
 	if err != nil {
-		return "", fmt.Errorf("failed to open identities file: %w", err)
+		return fmt.Errorf("failed to open identities file: %w", err)
 	}
 
 	defer func() {
 		err = errors.Join(err, identitiesFile.Close())
 	}()
 
+	if err := ensureTrailingNewline(identitiesFile); err != nil {
+		return fmt.Errorf("failed to prepare identities file: %w", err)
+	}
+
 	scanner := bufio.NewScanner(strings.NewReader(cmd.Comment))
 	for scanner.Scan() {
 		if _, err := fmt.Fprintf(identitiesFile, "# %s\n", scanner.Text()); err != nil {
-			return "", fmt.Errorf("failed to write comment to identities file: %w", err)
+			return fmt.Errorf("failed to write comment to identities file: %w", err)
 		}
 	}
 
 	if scanner.Err() != nil {
-		return "", fmt.Errorf("failed to write comment: %w", err)
+		return fmt.Errorf("failed to write comment: %w", err)
 	}
 
 	if _, err := fmt.Fprintf(identitiesFile, "# public key: %s\n", publicKey); err != nil {
-		return "", fmt.Errorf("failed to write public key to identities file: %w", err)
+		return fmt.Errorf("failed to write public key to identities file: %w", err)
+	}
+
+	if _, err := identitiesFile.WriteString(cmd.Identity.String() + "\n"); err != nil {
+		return fmt.Errorf("failed to write public key to identities file: %w", err)
+	}
+
+	return nil
+}
+
+// ensureTrailingNewline makes sure content appended to f starts on a new line.
+func ensureTrailingNewline(f *os.File) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	} else if info.Size() == 0 {
+		return nil
 	}
 
-	if _, err := identitiesFile.WriteString(newID.String() + "\n"); err != nil {
-		return "", fmt.Errorf("failed to write public key to identities file: %w", err)
+	lastByte := make([]byte, 1)
+	if _, err := f.ReadAt(lastByte, info.Size()-1); err != nil {
+		return err
+	} else if lastByte[0] == '\n' {
+		return nil
 	}
 
-	return publicKey, nil
+	_, err = f.WriteString("\n")
+
+	return err
+}
+
+func parseIdentities(reader io.Reader, now time.Time) (ids []age.Identity, err error) {
+	var retireAfter time.Time
+
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, retireAfterPrefix):
+			retireAfter, err = time.Parse(time.RFC3339, strings.TrimPrefix(line, retireAfterPrefix))
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse retirement date: %w", err)
+			}
+		case strings.HasPrefix(line, "#"):
+			continue
+		default:
+			parsed, err := age.ParseIdentities(strings.NewReader(line))
+			if err != nil {
+				return nil, err
+			}
+
+			if retireAfter.IsZero() || now.Before(retireAfter) {
+				ids = append(ids, parsed...)
+			} else {
+				slog.Debug("Skipping retired identity", slog.Time("retired_at", retireAfter))
+			}
+
+			retireAfter = time.Time{}
+		}
+	}
+
+	return ids, scanner.Err()
 }
 
 func (f *FileIdentityStore) identitiesFilePath() string {
@@ -110,3 +229,118 @@ func (f *FileIdentityStore) identitiesFilePath() string {
 
 	return f.Path
 }
+
+// identitiesFiles returns the keys file or all files within the keys directory.
+func (f *FileIdentityStore) identitiesFiles() ([]string, error) {
+	ifp := f.identitiesFilePath()
+
+	info, err := os.Stat(ifp)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to stat identities file: %w", err)
+	}
+
+	if !info.IsDir() {
+		return []string{ifp}, nil
+	}
+
+	entries, err := os.ReadDir(ifp)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read identities directory: %w", err)
+	}
+
+	filePaths := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		filePaths = append(filePaths, filepath.Join(ifp, entry.Name()))
+	}
+
+	return filePaths, nil
+}
+
+// storeFilePath returns the file new identities are appended to.
+// For a keys directory this is the keys.txt file within the directory.
+func (f *FileIdentityStore) storeFilePath() string {
+	ifp := f.identitiesFilePath()
+
+	if strings.HasSuffix(f.Path, "/") {
+		return filepath.Join(ifp, defaultKeysFileName)
+	}
+
+	if info, err := os.Stat(ifp); err == nil && info.IsDir() {
+		return filepath.Join(ifp, defaultKeysFileName)
+	}
+
+	return ifp
+}
+
+func readIdentitiesFile(filePath string, now time.Time) ([]age.Identity, error) {
+	keysFile, err := os.Open(filePath)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open identities file: %w", err)
+	}
+
+	defer func() {
+		_ = keysFile.Close()
+	}()
+
+	return parseIdentities(keysFile, now)
+}
+
+func retireIdentity(filePath, publicKey string, after time.Time) error {
+	raw, err := os.ReadFile(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to read identities file: %w", err)
+	}
+
+	var (
+		lines   = strings.Split(string(raw), "\n")
+		updated = make([]string, 0, len(lines)+1)
+		pending []string
+		found   bool
+	)
+
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			pending = append(pending, line)
+			continue
+		}
+
+		if id, err := age.ParseIdentities(strings.NewReader(trimmed)); err == nil {
+			if pubKey, ok := ports.PublicKeyOf(id[0]); ok && pubKey == publicKey {
+				found = true
+				if !after.After(time.Now()) {
+					pending = nil
+					continue
+				}
+
+				// retiring again replaces the previous grace period
+				pending = slices.DeleteFunc(pending, func(comment string) bool {
+					return strings.HasPrefix(strings.TrimSpace(comment), retireAfterPrefix)
+				})
+				pending = append(pending, retireAfterPrefix+after.Format(time.RFC3339))
+			}
+		}
+
+		updated = append(updated, pending...)
+		updated = append(updated, line)
+		pending = nil
+	}
+
+	if !found {
+		return fmt.Errorf("%w: %s", ErrIdentityNotFound, publicKey)
+	}
+
+	updated = append(updated, pending...)
+
+	return os.WriteFile(filePath, []byte(strings.Join(updated, "\n")), 0o600)
+}
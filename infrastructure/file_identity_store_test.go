@@ -5,7 +5,9 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"filippo.io/age"
 	"github.com/stretchr/testify/assert"
@@ -151,6 +153,39 @@ func TestFileIdentityStore_Identities(t *testing.T) {
 	}
 }
 
+func TestFileIdentityStore_KeysDirectory(t *testing.T) {
+	t.Parallel()
+
+	keysDir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(keysDir, "01-team.txt"), []byte(multipleIdentities), 0o600))
+	assert.NoError(t, os.WriteFile(filepath.Join(keysDir, ".hidden"), []byte("garbage"), 0o600))
+
+	store, err := infrastructure.NewFileIdentityStoreSource(&url.URL{Path: filepath.ToSlash(keysDir) + "/"}).GetStore()
+	assert.NoError(t, err, "failed to get store")
+
+	pubKey, err := store.Generate(testx.Context(t), ports.GenerateIdentityCommand{Algorithm: ports.IdentityAlgorithmX25519})
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(keysDir, "keys.txt")); err != nil {
+		t.Fatalf("expected generated identity to be stored in keys.txt: %v", err)
+	}
+
+	ids, err := store.Identities(testx.Context(t), ports.IdentitiesQuery{})
+	if err != nil {
+		t.Fatalf("Identities() error = %v", err)
+	}
+
+	if len(ids) != 3 {
+		t.Fatalf("expected 3 identities, got %d", len(ids))
+	}
+
+	if got, _ := ports.PublicKeyOf(ids[2]); got != pubKey {
+		t.Errorf("expected identities in lexical file order, got %s as last identity", got)
+	}
+}
+
 func TestFileIdentityStore_Generate(t *testing.T) {
 	t.Parallel()
 
@@ -290,3 +325,86 @@ type writerFunc func(p []byte) (n int, err error)
 func (w writerFunc) Write(p []byte) (n int, err error) {
 	return w(p)
 }
+
+func TestFileIdentityStore_Retire(t *testing.T) {
+	t.Parallel()
+
+	const retiredPubKey = "age1g5h29jjf0c69s7z86nrtd997un6z7zcq54x7l2a6j27745h5p5lqsmklq9"
+
+	tests := []struct {
+		name      string
+		after     time.Duration
+		pubKey    string
+		wantCount int
+		wantErr   bool
+	}{
+		{
+			name:      "Retire immediately",
+			pubKey:    retiredPubKey,
+			wantCount: 1,
+		},
+		{
+			name:      "Retire after grace period",
+			pubKey:    retiredPubKey,
+			after:     time.Hour,
+			wantCount: 2,
+		},
+		{
+			name:    "Unknown identity",
+			pubKey:  "age1a975r8q6gylt6vu5jugert3faj3s5a0jwwlaa7zw033zhqg85clsu5u6kz",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			keysFilePath := filepath.Join(t.TempDir(), "keys.txt")
+			assert.NoError(t, os.WriteFile(keysFilePath, []byte(multipleIdentities), 0o600), "failed to write keys file")
+
+			store, err := infrastructure.NewFileIdentityStoreSource(&url.URL{Path: keysFilePath}).GetStore()
+			assert.NoError(t, err, "failed to get store")
+
+			retirer, ok := store.(ports.IdentityRetirer)
+			if !ok {
+				t.Fatal("expected file identity store to support retiring identities")
+			}
+
+			err = retirer.Retire(testx.Context(t), tt.pubKey, time.Now().Add(tt.after))
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Retire() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			} else if tt.wantErr {
+				return
+			}
+
+			ids, err := store.Identities(testx.Context(t), ports.IdentitiesQuery{})
+			assert.NoError(t, err, "failed to read identities")
+			assert.Len(t, ids, tt.wantCount)
+		})
+	}
+}
+
+func TestFileIdentityStore_Retire_Again(t *testing.T) {
+	t.Parallel()
+
+	const retiredPubKey = "age1g5h29jjf0c69s7z86nrtd997un6z7zcq54x7l2a6j27745h5p5lqsmklq9"
+
+	keysFilePath := filepath.Join(t.TempDir(), "keys.txt")
+	assert.NoError(t, os.WriteFile(keysFilePath, []byte(multipleIdentities), 0o600), "failed to write keys file")
+
+	store := infrastructure.FileIdentityStore(url.URL{Path: keysFilePath})
+
+	first := time.Now().Add(time.Hour).Truncate(time.Second)
+	second := first.Add(time.Hour)
+
+	assert.NoError(t, store.Retire(testx.Context(t), retiredPubKey, first))
+	assert.NoError(t, store.Retire(testx.Context(t), retiredPubKey, second))
+
+	raw, err := os.ReadFile(keysFilePath)
+	assert.NoError(t, err, "failed to read keys file")
+
+	assert.Equal(t, 1, strings.Count(string(raw), "# retire after: "), "expected a single retirement marker")
+	assert.Contains(t, string(raw), "# retire after: "+second.Format(time.RFC3339))
+}
@@ -0,0 +1,32 @@
+package infrastructure
+
+// fingerprintWords renders one byte of a fingerprint each,
+// the words are short, common and distinct to read them out over a call.
+var fingerprintWords = [256]string{
+	"acid", "acorn", "actor", "adult", "agent", "alarm", "album", "alien", "alley", "amber", "angel",
+	"ankle", "apple", "april", "apron", "arena", "armor", "arrow", "atlas", "attic", "audio",
+	"autumn", "badge", "bagel", "baker", "bamboo", "banjo", "barrel", "basil", "basket", "beach",
+	"beaver", "bench", "berry", "bishop", "blade", "board", "bonus", "border", "bottle", "brain",
+	"branch", "bread", "breeze", "brick", "bridge", "broom", "bubble", "bucket", "bullet", "bundle",
+	"butter", "button", "cabin", "cactus", "camera", "camel", "candle", "canoe", "canvas", "carbon",
+	"carpet", "carrot", "castle", "cattle", "cedar", "cello", "cement", "chair", "chalk", "cherry",
+	"chess", "cider", "cinema", "circle", "circus", "citrus", "claw", "clock", "cloud", "clover",
+	"coach", "cobra", "coffee", "comet", "copper", "coral", "cotton", "cousin", "coyote", "crane",
+	"crater", "crayon", "credit", "cube", "daisy", "dancer", "delta", "desert", "dinner", "doctor",
+	"domino", "donkey", "dragon", "drawer", "dream", "drum", "eagle", "earth", "echo", "elbow",
+	"embers", "engine", "falcon", "farmer", "fence", "fiber", "fiddle", "finger", "fjord", "flame",
+	"flute", "forest", "fossil", "fox", "garden", "garlic", "gecko", "ginger", "globe", "goat",
+	"grape", "gravel", "guitar", "hammer", "harbor", "hazel", "helmet", "hermit", "honey", "hornet",
+	"horse", "hunter", "igloo", "index", "island", "ivory", "jacket", "jaguar", "jelly", "jersey",
+	"jewel", "jungle", "kayak", "kettle", "kitten", "koala", "ladder", "lagoon", "lantern", "laser",
+	"lemon", "lily", "lion", "lizard", "locket", "magnet", "mango", "maple", "marble", "meadow",
+	"melon", "mirror", "monkey", "moose", "motor", "muffin", "museum", "nectar", "needle", "nickel",
+	"noodle", "oasis", "ocean", "olive", "onion", "orange", "orbit", "orchid", "otter", "oven", "owl",
+	"oyster", "paddle", "palace", "panda", "parrot", "peach", "pebble", "pencil", "pepper", "piano",
+	"pickle", "pilot", "pirate", "planet", "pocket", "pony", "potato", "pumpkin", "puzzle", "quartz",
+	"rabbit", "radar", "radio", "raven", "rocket", "saddle", "salmon", "sandal", "satin", "scarf",
+	"shadow", "sheep", "shovel", "silver", "spider", "sponge", "squid", "statue", "studio", "sugar",
+	"summit", "sunset", "swan", "tablet", "tango", "teapot", "tiger", "tomato", "tulip", "tunnel",
+	"turtle", "valley", "velvet", "violin", "wagon", "walnut", "walrus", "whale", "willow", "window",
+	"winter", "wizard", "yogurt", "zebra",
+}
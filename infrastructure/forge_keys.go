@@ -0,0 +1,163 @@
+package infrastructure
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	ErrInvalidForgeUser     = errors.New("invalid forge user, expected <forge>:[<host>/]<user> or https://<host>/<user>")
+	ErrForgeKeysUnavailable = errors.New("failed to fetch keys from forge")
+	ErrNoForgeKeys          = errors.New("forge user has no age compatible SSH keys (ssh-ed25519 or ssh-rsa)")
+)
+
+// maxForgeKeysSize limits the size of the keys response, even users with many keys stay far below.
+const maxForgeKeysSize = 1 << 20
+
+// forgeHosts are the default hosts of the supported forges, all of them publish the SSH keys of a user
+// at https://<host>/<user>.keys. Gitea (and Forgejo) has no default host, hence it is always required.
+var forgeHosts = map[string]string{
+	"github": "github.com",
+	"gitlab": "gitlab.com",
+	"gitea":  "",
+}
+
+var (
+	forgeUserNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+	forgeHostPattern     = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9.-]*(:[0-9]+)?$`)
+)
+
+// ForgeUser is a user of a forge whose SSH keys are published at KeysURL.
+type ForgeUser struct {
+	Name    string
+	KeysURL *url.URL
+}
+
+// ForgeKey is an age compatible SSH key published by a forge user.
+type ForgeKey struct {
+	// PublicKey is the key in authorized_keys format without comment
+	PublicKey string
+	// Fingerprint is the recipient fingerprint as shown by 'git age keys list' and 'git age recipients'
+	Fingerprint string
+}
+
+// ParseForgeUser parses a user spec like github:alice, gitlab:gitlab.example.com/alice, gitea:codeberg.org/alice
+// or the URL of any other forge publishing keys the same way e.g. https://git.example.com/alice.
+func ParseForgeUser(spec string) (ForgeUser, error) {
+	forge, rest, found := strings.Cut(spec, ":")
+	if !found {
+		return ForgeUser{}, fmt.Errorf("%w: %s", ErrInvalidForgeUser, spec)
+	}
+
+	var keysURL *url.URL
+
+	switch defaultHost, known := forgeHosts[strings.ToLower(forge)]; {
+	case strings.EqualFold(forge, "http"):
+		return ForgeUser{}, fmt.Errorf("%w: keys must be fetched via https", ErrInvalidForgeUser)
+	case strings.EqualFold(forge, "https"):
+		parsed, err := url.Parse(spec)
+		if err != nil {
+			return ForgeUser{}, fmt.Errorf("%w: %w", ErrInvalidForgeUser, err)
+		}
+		keysURL = parsed
+	case known:
+		host, name, hasHost := strings.Cut(rest, "/")
+		if !hasHost {
+			host, name = defaultHost, rest
+		}
+
+		if host == "" {
+			return ForgeUser{}, fmt.Errorf("%w: %s requires a host e.g. %s:codeberg.org/%s", ErrInvalidForgeUser, forge, forge, rest)
+		}
+
+		if !forgeHostPattern.MatchString(host) || !forgeUserNamePattern.MatchString(name) {
+			return ForgeUser{}, fmt.Errorf("%w: %s", ErrInvalidForgeUser, spec)
+		}
+
+		keysURL = &url.URL{Scheme: "https", Host: host, Path: "/" + name}
+	default:
+		return ForgeUser{}, fmt.Errorf("%w: unknown forge %s", ErrInvalidForgeUser, forge)
+	}
+
+	keysURL.Path = strings.TrimSuffix(keysURL.Path, "/")
+	if !strings.HasSuffix(keysURL.Path, ".keys") {
+		keysURL.Path += ".keys"
+	}
+
+	name := strings.TrimSuffix(path.Base(keysURL.Path), ".keys")
+	if keysURL.Host == "" || !forgeUserNamePattern.MatchString(name) {
+		return ForgeUser{}, fmt.Errorf("%w: %s", ErrInvalidForgeUser, spec)
+	}
+
+	return ForgeUser{Name: name, KeysURL: keysURL}, nil
+}
+
+// FetchForgeKeys fetches the SSH keys of the user and returns those age can encrypt to,
+// other key types like ECDSA or security keys are skipped.
+func FetchForgeKeys(ctx context.Context, client *http.Client, user ForgeUser) ([]ForgeKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, user.KeysURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrForgeKeysUnavailable, err)
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: %s returned %s", ErrForgeKeysUnavailable, user.KeysURL, resp.Status)
+	}
+
+	var keys []ForgeKey
+
+	scanner := bufio.NewScanner(io.LimitReader(resp.Body, maxForgeKeysSize))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			slog.Warn("Skipping malformed SSH key", slog.String("user", user.Name), slog.String("err", err.Error()))
+			continue
+		}
+
+		if key.Type() != ssh.KeyAlgoED25519 && key.Type() != ssh.KeyAlgoRSA {
+			slog.Info("Skipping SSH key not supported by age", slog.String("user", user.Name), slog.String("type", key.Type()))
+			continue
+		}
+
+		publicKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+		keys = append(keys, ForgeKey{
+			PublicKey:   publicKey,
+			Fingerprint: RecipientFingerprint(publicKey),
+		})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrForgeKeysUnavailable, err)
+	}
+
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNoForgeKeys, user.KeysURL)
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,137 @@
+package infrastructure_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/prskr/git-age/infrastructure"
+	"github.com/prskr/git-age/internal/testx"
+)
+
+func TestParseForgeUser(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		spec     string
+		wantName string
+		wantURL  string
+		wantErr  error
+	}{
+		{name: "GitHub", spec: "github:alice", wantName: "alice", wantURL: "https://github.com/alice.keys"},
+		{name: "GitLab", spec: "gitlab:alice", wantName: "alice", wantURL: "https://gitlab.com/alice.keys"},
+		{
+			name:     "Self-hosted GitLab",
+			spec:     "gitlab:gitlab.example.com/alice",
+			wantName: "alice",
+			wantURL:  "https://gitlab.example.com/alice.keys",
+		},
+		{name: "Gitea", spec: "gitea:codeberg.org/alice", wantName: "alice", wantURL: "https://codeberg.org/alice.keys"},
+		{name: "Gitea without host", spec: "gitea:alice", wantErr: infrastructure.ErrInvalidForgeUser},
+		{name: "Custom base URL", spec: "https://git.example.com/alice", wantName: "alice", wantURL: "https://git.example.com/alice.keys"},
+		{name: "Custom keys URL", spec: "https://git.example.com/alice.keys", wantName: "alice", wantURL: "https://git.example.com/alice.keys"},
+		{name: "Plain HTTP", spec: "http://git.example.com/alice", wantErr: infrastructure.ErrInvalidForgeUser},
+		{name: "Unknown forge", spec: "bitbucket:alice", wantErr: infrastructure.ErrInvalidForgeUser},
+		{name: "Missing forge", spec: "alice", wantErr: infrastructure.ErrInvalidForgeUser},
+		{name: "Invalid user", spec: "github:../alice", wantErr: infrastructure.ErrInvalidForgeUser},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := infrastructure.ParseForgeUser(tt.spec)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParseForgeUser() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			if got.Name != tt.wantName || got.KeysURL.String() != tt.wantURL {
+				t.Errorf("ParseForgeUser() = %s %s, want %s %s", got.Name, got.KeysURL, tt.wantName, tt.wantURL)
+			}
+		})
+	}
+}
+
+func TestFetchForgeKeys(t *testing.T) {
+	t.Parallel()
+
+	ed25519Key := newTestSSHSigner(t).PublicKey()
+	rsaPrivateKey := testx.ResultOfA[*rsa.PrivateKey](t, rsa.GenerateKey, rand.Reader, 2048)
+	rsaKey := testx.ResultOfA[ssh.PublicKey](t, ssh.NewPublicKey, &rsaPrivateKey.PublicKey)
+	ecdsaPrivateKey := testx.ResultOfA[*ecdsa.PrivateKey](t, ecdsa.GenerateKey, elliptic.P256(), rand.Reader)
+	ecdsaKey := testx.ResultOfA[ssh.PublicKey](t, ssh.NewPublicKey, &ecdsaPrivateKey.PublicKey)
+
+	published := map[string][]ssh.PublicKey{
+		"/alice.keys": {ed25519Key, ecdsaKey, rsaKey},
+		"/bob.keys":   {ecdsaKey},
+	}
+
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		keys, ok := published[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		for _, key := range keys {
+			_, _ = w.Write(ssh.MarshalAuthorizedKey(key))
+		}
+
+		_, _ = fmt.Fprintln(w, "not a key")
+	}))
+	t.Cleanup(srv.Close)
+
+	fetch := func(user string) ([]infrastructure.ForgeKey, error) {
+		forgeUser, err := infrastructure.ParseForgeUser(srv.URL + "/" + user)
+		if err != nil {
+			t.Fatalf("ParseForgeUser() error = %v", err)
+		}
+
+		return infrastructure.FetchForgeKeys(testx.Context(t), srv.Client(), forgeUser)
+	}
+
+	keys, err := fetch("alice")
+	if err != nil {
+		t.Fatalf("FetchForgeKeys() error = %v", err)
+	}
+
+	if len(keys) != 2 {
+		t.Fatalf("FetchForgeKeys() returned %d keys, want the ed25519 and RSA key: %+v", len(keys), keys)
+	}
+
+	if !strings.HasPrefix(keys[0].PublicKey, ssh.KeyAlgoED25519+" ") || keys[0].Fingerprint != infrastructure.RecipientFingerprint(keys[0].PublicKey) {
+		t.Errorf("unexpected ed25519 key %+v", keys[0])
+	}
+
+	if keys[1].Fingerprint != infrastructure.RecipientFingerprint(string(ssh.MarshalAuthorizedKey(rsaKey))) {
+		t.Errorf("unexpected RSA key %+v", keys[1])
+	}
+
+	for _, key := range keys {
+		if _, _, err := infrastructure.ParseRecipient(key.PublicKey); err != nil {
+			t.Errorf("fetched key %s is no valid recipient: %v", key.PublicKey, err)
+		}
+	}
+
+	if _, err := fetch("bob"); !errors.Is(err, infrastructure.ErrNoForgeKeys) {
+		t.Errorf("FetchForgeKeys() error = %v, want %v", err, infrastructure.ErrNoForgeKeys)
+	}
+
+	if _, err := fetch("carol"); !errors.Is(err, infrastructure.ErrForgeKeysUnavailable) {
+		t.Errorf("FetchForgeKeys() error = %v, want %v", err, infrastructure.ErrForgeKeysUnavailable)
+	}
+}
@@ -1,15 +1,20 @@
 package infrastructure
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"log/slog"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/format/gitattributes"
 	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
 	"github.com/go-git/go-git/v5/plumbing/object"
@@ -25,6 +30,7 @@ var (
 	_ ports.Comitter         = (*GitRepository)(nil)
 	_ ports.HeadObjectOpener = (*GitRepository)(nil)
 	_ ports.RemotesLister    = (*GitRepository)(nil)
+	_ ports.HeadRefResolver  = (*GitRepository)(nil)
 )
 
 func NewGitRepositoryFromPath(from ports.CWD) (*GitRepository, *ReadWriteDirFS, error) {
@@ -103,6 +109,20 @@ func (g GitRepository) OpenObjectAtHead(filePath string) (*object.File, error) {
 	return tree.File(filePath)
 }
 
+// HeadRef returns the branch HEAD points to, even if it has no commits yet, or an empty string if HEAD is detached.
+func (g GitRepository) HeadRef() (string, error) {
+	head, err := g.Repository.Storer.Reference(plumbing.HEAD)
+	if err != nil {
+		return "", err
+	}
+
+	if head.Type() != plumbing.SymbolicReference {
+		return "", nil
+	}
+
+	return head.Target().String(), nil
+}
+
 func (g GitRepository) StageFile(path string) error {
 	_, err := g.Worktree.Add(path)
 	return err
@@ -187,6 +207,97 @@ func (g GitRepository) IsStagingDirty() (bool, error) {
 	return false, nil
 }
 
+// OperationInProgress returns the name of the rebase, merge or similar operation in progress, if any.
+func (g GitRepository) OperationInProgress() (string, error) {
+	gitDir, _, err := gitDirs(ports.CWD(g.Worktree.Filesystem.Root()))
+	if err != nil {
+		return "", err
+	}
+
+	operations := []struct {
+		name string
+		path string
+	}{
+		{name: "rebase", path: "rebase-merge"},
+		{name: "rebase", path: "rebase-apply"},
+		{name: "merge", path: "MERGE_HEAD"},
+		{name: "cherry-pick", path: "CHERRY_PICK_HEAD"},
+		{name: "revert", path: "REVERT_HEAD"},
+	}
+
+	for _, op := range operations {
+		if _, err := os.Stat(filepath.Join(gitDir, op.path)); err == nil {
+			return op.name, nil
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+	}
+
+	return "", nil
+}
+
+// IsWorktreeClean checks for changes of tracked files with git itself,
+// go-git compares the decrypted files in the worktree with the encrypted ones in the index as it doesn't apply filters.
+func (g GitRepository) IsWorktreeClean(ctx context.Context) (bool, error) {
+	var stdout, stderr bytes.Buffer
+
+	//nolint:gosec // arguments are fixed
+	cmd := exec.CommandContext(ctx, "git", "-C", g.Worktree.Filesystem.Root(), "status", "--porcelain", "--untracked-files=no")
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return false, fmt.Errorf("git status: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.Len() == 0, nil
+}
+
+// Merge merges the given branch into the current branch with git itself as the filters have to be applied.
+func (g GitRepository) Merge(ctx context.Context, stdout, stderr io.Writer, branch string) error {
+	//nolint:gosec // the branch is passed as single argument after --
+	cmd := exec.CommandContext(ctx, "git", "-C", g.Worktree.Filesystem.Root(), "merge", "--no-edit", branch)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("git merge %s: %w", branch, err)
+	}
+
+	return nil
+}
+
+// SectionRef returns the ref the recipients section is picked by when merging the given branch,
+// remote-tracking branches use the sections of the local branch of the same name.
+// It is empty for revisions that are no branches.
+func (g GitRepository) SectionRef(branch string) (string, error) {
+	candidates := []plumbing.ReferenceName{
+		plumbing.ReferenceName(branch),
+		plumbing.NewBranchReferenceName(branch),
+		plumbing.ReferenceName("refs/remotes/" + branch),
+	}
+
+	for _, candidate := range candidates {
+		if _, err := g.Repository.Reference(candidate, false); errors.Is(err, plumbing.ErrReferenceNotFound) {
+			continue
+		} else if err != nil {
+			return "", err
+		}
+
+		switch {
+		case candidate.IsBranch():
+			return candidate.String(), nil
+		case candidate.IsRemote():
+			_, name, _ := strings.Cut(strings.TrimPrefix(candidate.String(), "refs/remotes/"), "/")
+			return plumbing.NewBranchReferenceName(name).String(), nil
+		default:
+			return "", nil
+		}
+	}
+
+	return "", nil
+}
+
 func FindRepoRootFrom(cwd ports.CWD) (string, error) {
 	currentDir := cwd.Value()
 
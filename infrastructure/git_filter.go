@@ -0,0 +1,300 @@
+package infrastructure
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"filippo.io/age"
+	"github.com/go-git/go-git/v5/plumbing/format/gitattributes"
+
+	"github.com/prskr/git-age/core/ports"
+)
+
+const (
+	ageFilterName   = "age"
+	selfTestFile    = "secret.txt"
+	selfTestContent = "git-age self-test\n"
+)
+
+var (
+	ErrFilterNotConfigured = errors.New("filter.age is not configured")
+	ErrSelfTestFailed      = errors.New("self-test failed")
+)
+
+// GitFilter is the effective filter.age section of the git config.
+type GitFilter struct {
+	Clean    string
+	Smudge   string
+	Required bool
+	// Origin is the config file that defined the filter last
+	Origin string
+}
+
+// Binary returns the first word of the clean command, which is the executable git will run.
+func (f GitFilter) Binary() string {
+	if fields := strings.Fields(f.Clean); len(fields) > 0 {
+		return strings.Trim(fields[0], `"'`)
+	}
+
+	return ""
+}
+
+// ResolveBinary looks up the executable of the clean command the same way the shell would.
+func (f GitFilter) ResolveBinary() (string, error) {
+	binary := f.Binary()
+	if binary == "" {
+		return "", fmt.Errorf("%w: filter.age.clean is empty", ErrFilterNotConfigured)
+	}
+
+	return exec.LookPath(binary)
+}
+
+// LoadGitFilter merges the filter.age section of all git config files git reads in the given directory.
+func LoadGitFilter(cwd ports.CWD, env ports.OSEnv) (GitFilter, error) {
+	src := ConfigSource{Scope: ConfigScopeGit, Dir: cwd.Value()}
+	prefix := "filter." + ageFilterName + "."
+
+	options, err := readGitConfig(src, env, "^"+regexp.QuoteMeta(prefix))
+	if err != nil {
+		return GitFilter{}, fmt.Errorf("failed to read git config: %w", err)
+	}
+
+	if len(options) == 0 {
+		return GitFilter{}, ErrFilterNotConfigured
+	}
+
+	var filter GitFilter
+
+	for _, opt := range options {
+		filter.Origin = opt.Origin
+
+		switch strings.TrimPrefix(opt.Key, prefix) {
+		case "clean":
+			filter.Clean = opt.Value
+		case "smudge":
+			filter.Smudge = opt.Value
+		case "required":
+			filter.Required = strings.EqualFold(opt.Value, "true")
+		}
+	}
+
+	return filter, nil
+}
+
+// AgeAttributePattern is a .gitattributes line assigning filter=age and the number of files it matches.
+type AgeAttributePattern struct {
+	File    string
+	Line    int
+	Pattern string
+	Matches int
+}
+
+// AgeAttributePatterns returns all patterns in the .gitattributes files of the repository that assign the age filter,
+// together with the number of files in the working tree each of them matches.
+//
+//nolint:cyclop // walking attributes and files in one go is easier to follow
+func AgeAttributePatterns(repoFS fs.FS) ([]AgeAttributePattern, error) {
+	var (
+		patterns []AgeAttributePattern
+		matchers []gitattributes.MatchAttribute
+		files    [][]string
+	)
+
+	err := fs.WalkDir(repoFS, ".", func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			if filePath == ".git" {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		if d.Name() != ports.GitAttributesFileName {
+			files = append(files, strings.Split(filePath, "/"))
+			return nil
+		}
+
+		var domain []string
+		if dir := path.Dir(filePath); dir != "." {
+			domain = strings.Split(dir, "/")
+		}
+
+		raw, err := fs.ReadFile(repoFS, filePath)
+		if err != nil {
+			return err
+		}
+
+		scanner := bufio.NewScanner(bytes.NewReader(raw))
+		for lineNo := 1; scanner.Scan(); lineNo++ {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+
+			attr, err := gitattributes.ParseAttributesLine(line, domain, false)
+			if err != nil {
+				return fmt.Errorf("%s:%d: %w", filePath, lineNo, err)
+			}
+
+			if !slices.ContainsFunc(attr.Attributes, isAgeFilter) {
+				continue
+			}
+
+			patterns = append(patterns, AgeAttributePattern{File: filePath, Line: lineNo, Pattern: strings.Fields(line)[0]})
+			matchers = append(matchers, attr)
+		}
+
+		return scanner.Err()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", ports.GitAttributesFileName, err)
+	}
+
+	for idx, matcher := range matchers {
+		for _, file := range files {
+			if matcher.Pattern.Match(file) {
+				patterns[idx].Matches++
+			}
+		}
+	}
+
+	return patterns, nil
+}
+
+func isAgeFilter(attr gitattributes.Attribute) bool {
+	return attr.Name() == "filter" && attr.IsValueSet() && attr.Value() == ageFilterName
+}
+
+// FilterSelfTest adds and checks out a file in a temporary repository with the configured age filter.
+// The file is encrypted for a throwaway identity, all other identities stores are disabled.
+func FilterSelfTest(ctx context.Context, env ports.OSEnv) (err error) {
+	tmpDir, err := os.MkdirTemp("", "git-age-selftest")
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		err = errors.Join(err, os.RemoveAll(tmpDir))
+	}()
+
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		return err
+	}
+
+	keysPath := filepath.Join(tmpDir, defaultKeysFileName)
+	if err := os.WriteFile(keysPath, []byte(identity.String()+"\n"), 0o600); err != nil {
+		return err
+	}
+
+	repoPath := filepath.Join(tmpDir, "repo")
+
+	git := func(args ...string) ([]byte, error) {
+		var stdout, stderr bytes.Buffer
+
+		//nolint:gosec // arguments are fixed
+		cmd := exec.CommandContext(ctx, "git", append([]string{"-C", repoPath}, args...)...)
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		cmd.Env = selfTestEnv(env, keysPath)
+
+		if err := cmd.Run(); err != nil {
+			return nil, fmt.Errorf("%w: git %s: %w: %s", ErrSelfTestFailed, args[0], err, strings.TrimSpace(stderr.String()))
+		}
+
+		return stdout.Bytes(), nil
+	}
+
+	if err := os.MkdirAll(repoPath, 0o700); err != nil {
+		return err
+	}
+
+	if _, err := git("init", "--quiet"); err != nil {
+		return err
+	}
+
+	files := map[string]string{
+		ports.RecipientsFileName:    identity.Recipient().String() + "\n",
+		ports.GitAttributesFileName: selfTestFile + " filter=age\n",
+		selfTestFile:                selfTestContent,
+	}
+
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(repoPath, name), []byte(content), 0o600); err != nil {
+			return err
+		}
+	}
+
+	if _, err := git("add", "."); err != nil {
+		return err
+	}
+
+	blob, err := git("cat-file", "blob", ":"+selfTestFile)
+	if err != nil {
+		return err
+	}
+
+	if !bytes.HasPrefix(blob, []byte("age-encryption.org/v1\n")) {
+		return fmt.Errorf("%w: clean did not encrypt %s", ErrSelfTestFailed, selfTestFile)
+	}
+
+	if err := os.Remove(filepath.Join(repoPath, selfTestFile)); err != nil {
+		return err
+	}
+
+	if _, err := git("checkout", "--", selfTestFile); err != nil {
+		return err
+	}
+
+	smudged, err := os.ReadFile(filepath.Join(repoPath, selfTestFile))
+	if err != nil {
+		return err
+	}
+
+	if string(smudged) != selfTestContent {
+		return fmt.Errorf("%w: smudge did not restore %s", ErrSelfTestFailed, selfTestFile)
+	}
+
+	return nil
+}
+
+// selfTestEnv disables all identities stores but the throwaway keys file,
+// the empty values are required as git-age would otherwise fall back to the git config
+// and an empty agent host would still discover an agent at the default socket.
+func selfTestEnv(env ports.OSEnv, keysPath string) []string {
+	overrides := map[string]string{
+		"GIT_AGE_KEYS":            keysPath,
+		"GIT_AGE_AGENT_HOST":      AgentHostNone,
+		"GIT_AGE_IDENTITY_HELPER": "",
+	}
+
+	vars := make([]string, 0, len(env)+len(overrides))
+	for key, value := range env {
+		// the self-test must not operate on the repository doctor was started in
+		if _, ok := overrides[key]; ok || slices.Contains([]string{"GIT_DIR", "GIT_WORK_TREE", "GIT_INDEX_FILE"}, key) {
+			continue
+		}
+
+		vars = append(vars, key+"="+value)
+	}
+
+	for key, value := range overrides {
+		vars = append(vars, key+"="+value)
+	}
+
+	return vars
+}
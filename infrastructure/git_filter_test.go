@@ -0,0 +1,162 @@
+package infrastructure_test
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"testing/fstest"
+
+	"github.com/go-git/go-git/v5"
+
+	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/infrastructure"
+	"github.com/prskr/git-age/internal/testx"
+)
+
+func TestLoadGitFilter(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		globalConfig string
+		localConfig  string
+		want         infrastructure.GitFilter
+		wantErr      error
+	}{
+		{
+			name:    "Not configured",
+			wantErr: infrastructure.ErrFilterNotConfigured,
+		},
+		{
+			name:         "Global filter",
+			globalConfig: "[filter \"age\"]\n\tclean = git-age clean -- %f\n\tsmudge = git-age smudge -- %f\n\trequired = true\n",
+			want: infrastructure.GitFilter{
+				Clean:    "git-age clean -- %f",
+				Smudge:   "git-age smudge -- %f",
+				Required: true,
+				Origin:   "gitconfig",
+			},
+		},
+		{
+			name:         "Local config overrides single options",
+			globalConfig: "[filter \"age\"]\n\tclean = git-age clean -- %f\n\tsmudge = git-age smudge -- %f\n\trequired = true\n",
+			localConfig:  "[filter \"age\"]\n\tclean = /opt/git-age clean -- %f\n",
+			want: infrastructure.GitFilter{
+				Clean:    "/opt/git-age clean -- %f",
+				Smudge:   "git-age smudge -- %f",
+				Required: true,
+				Origin:   "config",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			repoRoot := t.TempDir()
+			gitDir := filepath.Join(repoRoot, ".git")
+			if _, err := git.PlainInit(repoRoot, false); err != nil {
+				t.Fatalf("failed to init repository: %v", err)
+			}
+
+			globalConfig := filepath.Join(t.TempDir(), "gitconfig")
+
+			writeIfNotEmpty(t, globalConfig, tt.globalConfig)
+			writeIfNotEmpty(t, filepath.Join(gitDir, "config"), tt.localConfig)
+
+			env := ports.OSEnv{
+				"GIT_CONFIG_NOSYSTEM": "1",
+				"GIT_CONFIG_GLOBAL":   globalConfig,
+			}
+
+			got, err := infrastructure.LoadGitFilter(ports.CWD(repoRoot), env)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("LoadGitFilter() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr != nil {
+				return
+			}
+
+			got.Origin = filepath.Base(got.Origin)
+			if got != tt.want {
+				t.Errorf("LoadGitFilter() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAgeAttributePatterns(t *testing.T) {
+	t.Parallel()
+
+	repoFS := fstest.MapFS{
+		".gitattributes":         {Data: []byte("# secrets\n*.env filter=age diff=age\n*.md text\n*.key filter=age\n")},
+		".env":                   {},
+		"config/prod.env":        {},
+		"config/.gitattributes":  {Data: []byte("*.yaml filter=age\n")},
+		"config/secrets.yaml":    {},
+		"README.md":              {},
+		".git/config":            {},
+		".git/objects/info/pack": {},
+	}
+
+	patterns, err := infrastructure.AgeAttributePatterns(repoFS)
+	if err != nil {
+		t.Fatalf("AgeAttributePatterns() error = %v", err)
+	}
+
+	want := []infrastructure.AgeAttributePattern{
+		{File: ".gitattributes", Line: 2, Pattern: "*.env", Matches: 2},
+		{File: ".gitattributes", Line: 4, Pattern: "*.key", Matches: 0},
+		{File: "config/.gitattributes", Line: 1, Pattern: "*.yaml", Matches: 1},
+	}
+
+	if len(patterns) != len(want) {
+		t.Fatalf("AgeAttributePatterns() = %+v, want %+v", patterns, want)
+	}
+
+	for idx := range want {
+		if patterns[idx] != want[idx] {
+			t.Errorf("AgeAttributePatterns()[%d] = %+v, want %+v", idx, patterns[idx], want[idx])
+		}
+	}
+}
+
+func TestFilterSelfTest_NotEncrypting(t *testing.T) {
+	t.Parallel()
+
+	if runtime.GOOS == "windows" {
+		t.Skip("filter is a shell command")
+	}
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	globalConfig := filepath.Join(t.TempDir(), "gitconfig")
+	writeIfNotEmpty(t, globalConfig, "[filter \"age\"]\n\tclean = cat\n\tsmudge = cat\n\trequired = true\n")
+
+	env := testx.ResultOf(t, ports.HostEnv)
+	env["GIT_CONFIG_NOSYSTEM"] = "1"
+	env["GIT_CONFIG_GLOBAL"] = globalConfig
+
+	if err := infrastructure.FilterSelfTest(testx.Context(t), env); !errors.Is(err, infrastructure.ErrSelfTestFailed) {
+		t.Errorf("FilterSelfTest() error = %v, want %v", err, infrastructure.ErrSelfTestFailed)
+	}
+}
+
+func writeIfNotEmpty(tb testing.TB, filePath, content string) {
+	tb.Helper()
+
+	if content == "" {
+		return
+	}
+
+	if err := os.WriteFile(filePath, []byte(content), 0o600); err != nil {
+		tb.Fatalf("failed to write %s: %v", filePath, err)
+	}
+}
@@ -0,0 +1,136 @@
+package infrastructure
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+
+	"github.com/prskr/git-age/core/ports"
+)
+
+// gitHookMarker identifies hooks installed by git-age, other hooks are never touched.
+const gitHookMarker = "# installed by git-age"
+
+var ErrForeignHook = errors.New("hook was not installed by git-age")
+
+// GitHookNames are the hooks running after the recipients file might have changed.
+var GitHookNames = []string{"post-checkout", "post-merge", "post-rewrite"}
+
+func NewGitHooks(cwd ports.CWD, repo *git.Repository) (*GitHooks, error) {
+	// the global scope includes the local config as well
+	cfg, err := repo.ConfigScoped(config.GlobalScope)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read git config: %w", err)
+	}
+
+	root, err := FindRepoRootFrom(cwd)
+	if err != nil {
+		return nil, err
+	}
+
+	if hooksPath := cfg.Raw.Section("core").Option("hooksPath"); hooksPath != "" {
+		hooksPath, err = expandHome(hooksPath)
+		if err != nil {
+			return nil, err
+		}
+
+		if !filepath.IsAbs(hooksPath) {
+			hooksPath = filepath.Join(root, hooksPath)
+		}
+
+		return &GitHooks{Dir: hooksPath}, nil
+	}
+
+	_, commonDir, err := gitDirs(ports.CWD(root))
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate git directory: %w", err)
+	}
+
+	return &GitHooks{Dir: filepath.Join(commonDir, "hooks")}, nil
+}
+
+// GitHooks manages the git-age hooks in the hooks directory of a repository.
+type GitHooks struct {
+	Dir string
+}
+
+// Install writes all git-age hooks, existing hooks of other tools are only replaced if force is set.
+func (h GitHooks) Install(force bool) ([]string, error) {
+	if err := os.MkdirAll(h.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create hooks directory: %w", err)
+	}
+
+	installed := make([]string, 0, len(GitHookNames))
+
+	for _, name := range GitHookNames {
+		hookPath := filepath.Join(h.Dir, name)
+
+		if own, err := isGitAgeHook(hookPath); err != nil {
+			return installed, err
+		} else if !own && !force {
+			return installed, fmt.Errorf("%w: %s", ErrForeignHook, hookPath)
+		}
+
+		//nolint:gosec // hooks have to be executable
+		if err := os.WriteFile(hookPath, gitHookScript(name), 0o755); err != nil {
+			return installed, fmt.Errorf("failed to write hook %s: %w", name, err)
+		}
+
+		installed = append(installed, hookPath)
+	}
+
+	return installed, nil
+}
+
+// Uninstall removes all hooks installed by git-age and leaves hooks of other tools alone.
+func (h GitHooks) Uninstall() ([]string, error) {
+	removed := make([]string, 0, len(GitHookNames))
+
+	for _, name := range GitHookNames {
+		hookPath := filepath.Join(h.Dir, name)
+
+		if _, err := os.Stat(hookPath); errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+
+		if own, err := isGitAgeHook(hookPath); err != nil {
+			return removed, err
+		} else if !own {
+			continue
+		}
+
+		if err := os.Remove(hookPath); err != nil {
+			return removed, fmt.Errorf("failed to remove hook %s: %w", name, err)
+		}
+
+		removed = append(removed, hookPath)
+	}
+
+	return removed, nil
+}
+
+// isGitAgeHook checks whether the hook was installed by git-age, a missing hook counts as own.
+func isGitAgeHook(hookPath string) (bool, error) {
+	raw, err := os.ReadFile(hookPath)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return true, nil
+	case err != nil:
+		return false, fmt.Errorf("failed to read hook: %w", err)
+	default:
+		return bytes.Contains(raw, []byte(gitHookMarker)), nil
+	}
+}
+
+func gitHookScript(name string) []byte {
+	return fmt.Appendf(nil, `#!/bin/sh
+%s, remove with: git age hooks uninstall
+exec git-age hooks check --hook %s -- "$@"
+`, gitHookMarker, name)
+}
@@ -0,0 +1,84 @@
+package infrastructure_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-git/go-git/v5"
+
+	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/infrastructure"
+)
+
+func TestGitHooks(t *testing.T) {
+	t.Parallel()
+
+	root := t.TempDir()
+
+	repo, err := git.PlainInit(root, false)
+	if err != nil {
+		t.Fatalf("failed to init repository: %v", err)
+	}
+
+	hooks, err := infrastructure.NewGitHooks(ports.CWD(root), repo)
+	if err != nil {
+		t.Fatalf("NewGitHooks() error = %v", err)
+	}
+
+	if want := filepath.Join(root, ".git", "hooks"); hooks.Dir != want {
+		t.Errorf("hooks dir = %s, want %s", hooks.Dir, want)
+	}
+
+	foreignHook := filepath.Join(hooks.Dir, "post-merge")
+	if err := os.MkdirAll(hooks.Dir, 0o755); err != nil {
+		t.Fatalf("failed to create hooks directory: %v", err)
+	}
+
+	//nolint:gosec // hooks have to be executable
+	if err := os.WriteFile(foreignHook, []byte("#!/bin/sh\necho foreign\n"), 0o755); err != nil {
+		t.Fatalf("failed to write foreign hook: %v", err)
+	}
+
+	if _, err := hooks.Install(false); !errors.Is(err, infrastructure.ErrForeignHook) {
+		t.Fatalf("Install() error = %v, want %v", err, infrastructure.ErrForeignHook)
+	}
+
+	installed, err := hooks.Install(true)
+	if err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+
+	if len(installed) != len(infrastructure.GitHookNames) {
+		t.Errorf("installed %v, want all hooks", installed)
+	}
+
+	// installing again replaces the own hooks
+	if _, err := hooks.Install(false); err != nil {
+		t.Fatalf("Install() again error = %v", err)
+	}
+
+	script, err := os.ReadFile(foreignHook)
+	if err != nil {
+		t.Fatalf("failed to read hook: %v", err)
+	}
+
+	if !strings.Contains(string(script), "git-age hooks check --hook post-merge") {
+		t.Errorf("unexpected hook script %q", script)
+	}
+
+	removed, err := hooks.Uninstall()
+	if err != nil {
+		t.Fatalf("Uninstall() error = %v", err)
+	}
+
+	if len(removed) != len(infrastructure.GitHookNames) {
+		t.Errorf("removed %v, want all hooks", removed)
+	}
+
+	if _, err := os.Stat(foreignHook); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected hook to be removed, got %v", err)
+	}
+}
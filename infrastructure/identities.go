@@ -2,31 +2,62 @@ package infrastructure
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
 
 	"github.com/prskr/git-age/core/ports"
 	"github.com/prskr/git-age/core/services"
 )
 
-type identityStoreSource interface {
+var ErrDuplicateStoreName = errors.New("identities stores must have unique names, add a #label to the keys spec to name them")
+
+type IdentityStoreSource interface {
+	Name() string
 	IsValid(ctx context.Context) (bool, error)
 	GetStore() (ports.IdentitiesStore, error)
 }
 
-func IdentitiesStore(ctx context.Context, sources ...identityStoreSource) (ports.IdentitiesStore, error) {
-	var stores []ports.IdentitiesStore
+func IdentitiesStore(
+	ctx context.Context,
+	opts []services.IdentitiesStoreChainOption,
+	sources ...IdentityStoreSource,
+) (*services.IdentitiesStoreChain, error) {
+	chain := services.NewIdentitiesStoreChain(opts...)
 
 	for _, src := range sources {
-		if isValid, err := src.IsValid(ctx); err != nil {
-			return nil, err
-		} else if isValid {
-			store, err := src.GetStore()
-			if err != nil {
-				return nil, err
+		isValid, err := src.IsValid(ctx)
+		if err != nil {
+			// a locked agent is not unavailable - it deliberately refuses to hand out identities
+			if chain.TolerateUnavailable && !errors.Is(err, ErrAgentLocked) {
+				slog.WarnContext(
+					ctx,
+					"Ignoring unavailable identities store",
+					slog.String("store", src.Name()),
+					slog.String("err", err.Error()),
+				)
+				continue
 			}
 
-			stores = append(stores, store)
+			return nil, &services.StoreError{Store: src.Name(), Err: err}
+		} else if !isValid {
+			continue
+		}
+
+		store, err := src.GetStore()
+		if err != nil {
+			return nil, &services.StoreError{Store: src.Name(), Err: err}
 		}
+
+		if slices.ContainsFunc(chain.Stores, func(other ports.IdentitiesStore) bool {
+			return other.Name() == store.Name()
+		}) {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicateStoreName, store.Name())
+		}
+
+		chain.Stores = append(chain.Stores, store)
 	}
 
-	return services.NewIdentitiesStoreChain(stores...), nil
+	return chain, nil
 }
@@ -0,0 +1,247 @@
+package infrastructure_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/infrastructure"
+	"github.com/prskr/git-age/internal/testx"
+)
+
+func TestParseKeyBundle_AgeKeygen(t *testing.T) {
+	t.Parallel()
+
+	id := testx.ResultOf(t, age.GenerateX25519Identity)
+	raw := strings.Join([]string{
+		"# created: 2026-01-02T15:04:05+01:00",
+		"# public key: " + id.Recipient().String(),
+		id.String(),
+		"",
+		"# remote: git@github.com:acme/infra.git",
+		"# work laptop",
+		"# public key: " + id.Recipient().String(),
+		id.String(),
+	}, "\n")
+
+	entries, err := infrastructure.ParseKeyBundle([]byte(raw))
+	if err != nil {
+		t.Fatalf("ParseKeyBundle() error = %v", err)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+
+	if got, want := entries[0].Comment, "created: 2026-01-02T15:04:05+01:00"; got != want {
+		t.Errorf("comment = %q, want %q", got, want)
+	}
+
+	if entries[0].Remote != "" {
+		t.Errorf("expected first entry without remote, got %q", entries[0].Remote)
+	}
+
+	if got, want := entries[1].Remote, "git@github.com:acme/infra.git"; got != want {
+		t.Errorf("remote = %q, want %q", got, want)
+	}
+
+	if got, want := entries[1].Comment, "work laptop"; got != want {
+		t.Errorf("comment = %q, want %q", got, want)
+	}
+}
+
+func TestSealKeyBundle_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	entries := []infrastructure.KeyBundleEntry{
+		{Identity: testx.ResultOf(t, ports.IdentityAlgorithmX25519.Generate), Comment: "laptop\ngenerated by age-keygen"},
+		{Identity: testx.ResultOf(t, ports.IdentityAlgorithmHybrid.Generate), Remote: "git@github.com:acme/infra.git"},
+	}
+
+	target := testx.ResultOf(t, age.GenerateX25519Identity)
+
+	tests := []struct {
+		name    string
+		armored bool
+		paper   bool
+	}{
+		{name: "Binary"},
+		{name: "Armored", armored: true},
+		{name: "Paper", armored: true, paper: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			bundle := new(bytes.Buffer)
+			if err := infrastructure.SealKeyBundle(bundle, entries, tt.armored, target.Recipient()); err != nil {
+				t.Fatalf("SealKeyBundle() error = %v", err)
+			}
+
+			if tt.paper {
+				paper := new(bytes.Buffer)
+				if err := infrastructure.WritePaperBackup(paper, bundle.Bytes(), []string{"age1test"}); err != nil {
+					t.Fatalf("WritePaperBackup() error = %v", err)
+				}
+
+				bundle = paper
+			}
+
+			if _, err := infrastructure.OpenKeyBundle(bundle.Bytes()); !errors.Is(err, infrastructure.ErrMissingKeyBundleKeys) {
+				t.Errorf("expected ErrMissingKeyBundleKeys without identities, got %v", err)
+			}
+
+			opened, err := infrastructure.OpenKeyBundle(bundle.Bytes(), target)
+			if err != nil {
+				t.Fatalf("OpenKeyBundle() error = %v", err)
+			}
+
+			if len(opened) != len(entries) {
+				t.Fatalf("got %d entries, want %d", len(opened), len(entries))
+			}
+
+			for idx, entry := range entries {
+				if got, want := opened[idx].Identity.String(), entry.Identity.String(); got != want {
+					t.Errorf("entry %d: identity differs", idx)
+				}
+
+				if opened[idx].Comment != entry.Comment || opened[idx].Remote != entry.Remote {
+					t.Errorf("entry %d: got comment %q and remote %q, want %q and %q",
+						idx, opened[idx].Comment, opened[idx].Remote, entry.Comment, entry.Remote)
+				}
+			}
+		})
+	}
+}
+
+func TestParsePaperBackup_Tampered(t *testing.T) {
+	t.Parallel()
+
+	entries := []infrastructure.KeyBundleEntry{
+		{Identity: testx.ResultOf(t, ports.IdentityAlgorithmX25519.Generate)},
+	}
+
+	scrypt := testx.ResultOfA[*age.ScryptRecipient](t, age.NewScryptRecipient, "correct horse battery staple")
+	scrypt.SetWorkFactor(10)
+
+	bundle := new(bytes.Buffer)
+	if err := infrastructure.SealKeyBundle(bundle, entries, true, scrypt); err != nil {
+		t.Fatalf("SealKeyBundle() error = %v", err)
+	}
+
+	paper := new(bytes.Buffer)
+	if err := infrastructure.WritePaperBackup(paper, bundle.Bytes(), nil); err != nil {
+		t.Fatalf("WritePaperBackup() error = %v", err)
+	}
+
+	lines := strings.Split(paper.String(), "\n")
+
+	tests := []struct {
+		name   string
+		tamper func() string
+	}{
+		{
+			name: "Typo in line",
+			tamper: func() string {
+				tampered := append([]string(nil), lines...)
+				for idx, line := range tampered {
+					if isPaperLine(line, "2") {
+						last := line[len(line)-1]
+						replacement := "A"
+						if last == 'A' {
+							replacement = "B"
+						}
+						tampered[idx] = line[:len(line)-1] + replacement
+					}
+				}
+				return strings.Join(tampered, "\n")
+			},
+		},
+		{
+			name: "Line missing",
+			tamper: func() string {
+				tampered := make([]string, 0, len(lines))
+				for _, line := range lines {
+					if !isPaperLine(line, "2") {
+						tampered = append(tampered, line)
+					}
+				}
+				return strings.Join(tampered, "\n")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if _, err := infrastructure.ParsePaperBackup([]byte(tt.tamper())); !errors.Is(err, infrastructure.ErrPaperChecksum) {
+				t.Errorf("expected ErrPaperChecksum, got %v", err)
+			}
+		})
+	}
+
+	armored, err := infrastructure.ParsePaperBackup(paper.Bytes())
+	if err != nil {
+		t.Fatalf("ParsePaperBackup() error = %v", err)
+	}
+
+	if !bytes.Equal(armored, bundle.Bytes()) {
+		t.Errorf("expected paper backup to restore the armored bundle")
+	}
+}
+
+func TestConvertSSHIdentity(t *testing.T) {
+	t.Parallel()
+
+	_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ed25519 key: %v", err)
+	}
+
+	block, err := ssh.MarshalPrivateKey(privateKey, "jane@laptop")
+	if err != nil {
+		t.Fatalf("failed to marshal SSH key: %v", err)
+	}
+
+	pemBytes := pem.EncodeToMemory(block)
+
+	entries, err := infrastructure.OpenKeyBundle(pemBytes)
+	if err != nil {
+		t.Fatalf("OpenKeyBundle() error = %v", err)
+	}
+
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+
+	if !strings.HasPrefix(entries[0].Comment, "converted from ssh-ed25519 ") {
+		t.Errorf("expected comment to record the SSH key, got %q", entries[0].Comment)
+	}
+
+	// the identity is derived from the SSH key and must be stable
+	again := testx.ResultOfA[ports.Identity](t, infrastructure.ConvertSSHIdentity, pemBytes)
+	if entries[0].Identity.String() != again.String() {
+		t.Errorf("expected converting the same SSH key to result in the same identity")
+	}
+
+	if _, err := age.ParseX25519Identity(entries[0].Identity.String()); err != nil {
+		t.Errorf("expected a valid X25519 identity: %v", err)
+	}
+}
+
+// isPaperLine checks the line number of a paper backup line, numbers are padded with zeros.
+func isPaperLine(line, number string) bool {
+	fields := strings.Fields(line)
+
+	return len(fields) == 3 && strings.TrimLeft(fields[0], "0") == number
+}
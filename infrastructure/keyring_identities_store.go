@@ -0,0 +1,195 @@
+package infrastructure
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+
+	"github.com/prskr/git-age/core/ports"
+)
+
+const (
+	keyringDescriptionPrefix = "git-age:"
+	keyringDefaultScope      = "default"
+)
+
+var (
+	ErrKeyringUnsupported = errors.New("kernel keyring is not supported on this platform")
+	ErrUnknownKeyring     = errors.New("unknown keyring")
+)
+
+var (
+	_ ports.IdentitiesStore = (*KeyringIdentitiesStore)(nil)
+	_ IdentityStoreSource   = (*KeyringIdentitiesStoreSource)(nil)
+)
+
+// NewKeyringIdentitiesStoreSource creates a source for a keyring://<user|session>?timeout=<duration> keys spec.
+func NewKeyringIdentitiesStoreSource(spec *url.URL) (*KeyringIdentitiesStoreSource, error) {
+	src := &KeyringIdentitiesStoreSource{
+		Keyring: spec.Host,
+	}
+
+	if src.Keyring == "" {
+		src.Keyring = "user"
+	}
+
+	if rawTimeout := spec.Query().Get("timeout"); rawTimeout != "" {
+		timeout, err := time.ParseDuration(rawTimeout)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse keyring timeout: %w", err)
+		}
+		src.Timeout = timeout
+	}
+
+	return src, nil
+}
+
+type KeyringIdentitiesStoreSource struct {
+	Keyring string
+	Timeout time.Duration
+	// Label replaces the keyring in the name of the store
+	Label string
+}
+
+func (k *KeyringIdentitiesStoreSource) Name() string {
+	return storeName("keyring", cmp.Or(k.Label, k.Keyring))
+}
+
+func (k *KeyringIdentitiesStoreSource) IsValid(context.Context) (bool, error) {
+	if _, err := keyringID(k.Keyring); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (k *KeyringIdentitiesStoreSource) GetStore() (ports.IdentitiesStore, error) {
+	return &KeyringIdentitiesStore{
+		Keyring: k.Keyring,
+		Timeout: k.Timeout,
+		Label:   k.Label,
+	}, nil
+}
+
+// KeyringIdentitiesStore keeps identities in the Linux kernel keyring as keys of type user.
+// The description of every key is git-age:<remote>:<public key> with the normalized remote
+// or default for identities without remote, the payload is the identity in the keys file format.
+// If a Timeout is set, the kernel drops the keys automatically once it expired.
+type KeyringIdentitiesStore struct {
+	Keyring string
+	Timeout time.Duration
+	Label   string
+}
+
+func (k *KeyringIdentitiesStore) Name() string {
+	return storeName("keyring", cmp.Or(k.Label, k.Keyring))
+}
+
+func (k *KeyringIdentitiesStore) Generate(
+	ctx context.Context,
+	cmd ports.GenerateIdentityCommand,
+) (publicKey string, err error) {
+	newID, err := cmd.Algorithm.Generate()
+	if err != nil {
+		return "", err
+	}
+
+	storeCmd := ports.StoreIdentityCommand{
+		Identity: newID,
+		Comment:  cmd.Comment,
+		Remote:   cmd.Remote,
+	}
+
+	if err := k.Store(ctx, storeCmd); err != nil {
+		return "", err
+	}
+
+	return newID.Recipient().String(), nil
+}
+
+func (k *KeyringIdentitiesStore) Store(ctx context.Context, cmd ports.StoreIdentityCommand) error {
+	if cmd.Comment == "" {
+		cmd.Comment = "generated on " + time.Now().Format(time.RFC3339)
+	}
+
+	ring, err := keyringID(k.Keyring)
+	if err != nil {
+		return err
+	}
+
+	publicKey := cmd.Identity.Recipient().String()
+
+	var payload strings.Builder
+	for line := range strings.Lines(cmd.Comment) {
+		_, _ = fmt.Fprintf(&payload, "# %s\n", strings.TrimRight(line, "\r\n"))
+	}
+
+	_, _ = fmt.Fprintf(&payload, "# public key: %s\n%s\n", publicKey, cmd.Identity.String())
+
+	description := keyringDescriptionPrefix + keyringScope(cmd.Remote) + ":" + publicKey
+
+	slog.DebugContext(ctx, "Adding identity to kernel keyring", slog.String("description", description))
+
+	return keyringAdd(ring, description, []byte(payload.String()), k.Timeout)
+}
+
+// Identities returns the identities of all given remotes followed by the identities without remote.
+func (k *KeyringIdentitiesStore) Identities(_ context.Context, query ports.IdentitiesQuery) (ids []age.Identity, err error) {
+	ring, err := keyringID(k.Keyring)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := keyringEntries(ring)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := make([]string, 0, len(query.Remotes)+1)
+	for _, remote := range append(query.Remotes, "") {
+		scopes = append(scopes, keyringScope(remote))
+	}
+
+	now := time.Now()
+	seen := make(map[string]bool)
+
+	for _, scope := range scopes {
+		prefix := keyringDescriptionPrefix + scope + ":"
+		for _, entry := range entries {
+			if !strings.HasPrefix(entry.Description, prefix) || seen[entry.Description] {
+				continue
+			}
+
+			seen[entry.Description] = true
+
+			parsed, err := parseIdentities(strings.NewReader(entry.Payload), now)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse identity %s: %w", entry.Description, err)
+			}
+
+			ids = append(ids, parsed...)
+		}
+	}
+
+	return ids, nil
+}
+
+type keyringEntry struct {
+	Description string
+	Payload     string
+}
+
+func keyringScope(remote string) string {
+	if remote == "" {
+		return keyringDefaultScope
+	}
+
+	return normalizeRemote(remote)
+}
@@ -0,0 +1,70 @@
+package infrastructure_test
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/infrastructure"
+	"github.com/prskr/git-age/internal/testx"
+)
+
+func TestKeyringIdentitiesStore(t *testing.T) {
+	t.Parallel()
+
+	src, err := infrastructure.NewKeyringIdentitiesStoreSource(&url.URL{Scheme: "keyring", Host: "user", RawQuery: "timeout=1m"})
+	if err != nil {
+		t.Fatalf("NewKeyringIdentitiesStoreSource() error = %v", err)
+	}
+
+	if isValid, err := src.IsValid(testx.Context(t)); err != nil || !isValid {
+		t.Skipf("kernel keyring not available: %v", err)
+	}
+
+	store := testx.ResultOf(t, src.GetStore)
+
+	// the user keyring is shared, hence every test run uses its own remote
+	remote := fmt.Sprintf("https://git.example.com/git-age/%d.git", time.Now().UnixNano())
+	otherRemote := remote + "-other"
+
+	pubKey, err := store.Generate(testx.Context(t), ports.GenerateIdentityCommand{
+		Comment:   "keyring test",
+		Remote:    remote,
+		Algorithm: ports.IdentityAlgorithmX25519,
+	})
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	if _, err := store.Generate(testx.Context(t), ports.GenerateIdentityCommand{
+		Remote:    otherRemote,
+		Algorithm: ports.IdentityAlgorithmX25519,
+	}); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	ids, err := store.Identities(testx.Context(t), ports.IdentitiesQuery{Remotes: []string{remote}})
+	if err != nil {
+		t.Fatalf("Identities() error = %v", err)
+	}
+
+	var found int
+	for _, id := range ids {
+		got, _ := ports.PublicKeyOf(id)
+		if got == pubKey {
+			found++
+		}
+	}
+
+	if found != 1 {
+		t.Errorf("expected identity of remote exactly once, found it %d times", found)
+	}
+
+	if len(ids) > 0 {
+		if got, _ := ports.PublicKeyOf(ids[0]); got != pubKey {
+			t.Errorf("expected remote specific identity first, got %s", got)
+		}
+	}
+}
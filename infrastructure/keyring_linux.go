@@ -0,0 +1,107 @@
+//go:build linux
+
+package infrastructure
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const keyringKeyType = "user"
+
+func keyringID(name string) (int, error) {
+	var spec int
+
+	switch name {
+	case "user":
+		spec = unix.KEY_SPEC_USER_KEYRING
+	case "session":
+		spec = unix.KEY_SPEC_SESSION_KEYRING
+	default:
+		return 0, fmt.Errorf("%w: %s - supported are user and session", ErrUnknownKeyring, name)
+	}
+
+	ring, err := unix.KeyctlGetKeyringID(spec, true)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get %s keyring: %w", name, err)
+	}
+
+	return ring, nil
+}
+
+func keyringAdd(ring int, description string, payload []byte, timeout time.Duration) error {
+	id, err := unix.AddKey(keyringKeyType, description, payload, ring)
+	if err != nil {
+		return fmt.Errorf("failed to add key to keyring: %w", err)
+	}
+
+	if timeout <= 0 {
+		return nil
+	}
+
+	seconds := int(min(math.Ceil(timeout.Seconds()), math.MaxInt32))
+	if _, err := unix.KeyctlInt(unix.KEYCTL_SET_TIMEOUT, id, seconds, 0, 0); err != nil {
+		return fmt.Errorf("failed to set key timeout: %w", err)
+	}
+
+	return nil
+}
+
+// keyringEntries returns all git-age keys linked to the given keyring.
+func keyringEntries(ring int) ([]keyringEntry, error) {
+	raw, err := keyctlRead(ring)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read keyring: %w", err)
+	}
+
+	entries := make([]keyringEntry, 0, len(raw)/4)
+	for idx := 0; idx+4 <= len(raw); idx += 4 {
+		id := int(int32(binary.NativeEndian.Uint32(raw[idx : idx+4])))
+
+		// <type>;<uid>;<gid>;<perm>;<description>
+		described, err := unix.KeyctlString(unix.KEYCTL_DESCRIBE, id)
+		if err != nil {
+			// keys might expire or be revoked in the meantime
+			continue
+		}
+
+		fields := strings.SplitN(described, ";", 5)
+		if len(fields) != 5 || fields[0] != keyringKeyType || !strings.HasPrefix(fields[4], keyringDescriptionPrefix) {
+			continue
+		}
+
+		payload, err := keyctlRead(id)
+		if err != nil {
+			if errors.Is(err, unix.EKEYEXPIRED) || errors.Is(err, unix.EKEYREVOKED) {
+				continue
+			}
+			return nil, fmt.Errorf("failed to read key %s: %w", fields[4], err)
+		}
+
+		entries = append(entries, keyringEntry{Description: fields[4], Payload: string(payload)})
+	}
+
+	return entries, nil
+}
+
+func keyctlRead(id int) ([]byte, error) {
+	var buf []byte
+	for {
+		length, err := unix.KeyctlBuffer(unix.KEYCTL_READ, id, buf, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		if length <= len(buf) {
+			return buf[:length], nil
+		}
+
+		buf = make([]byte, length)
+	}
+}
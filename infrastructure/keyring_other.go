@@ -0,0 +1,17 @@
+//go:build !linux
+
+package infrastructure
+
+import "time"
+
+func keyringID(string) (int, error) {
+	return 0, ErrKeyringUnsupported
+}
+
+func keyringAdd(int, string, []byte, time.Duration) error {
+	return ErrKeyringUnsupported
+}
+
+func keyringEntries(int) ([]keyringEntry, error) {
+	return nil, ErrKeyringUnsupported
+}
@@ -0,0 +1,156 @@
+package infrastructure
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/prskr/git-age/core/ports"
+)
+
+var ErrUnsupportedKeysScheme = errors.New("unsupported keys scheme")
+
+// keysSpecStart matches the beginning of a new keys spec after a colon separator e.g. :env://.
+var keysSpecStart = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9+.-]*://`)
+
+// SplitKeysSpecs splits keys specs separated like PATH e.g. /a/keys.txt:/b/keys.txt:env://AGE_KEY.
+// Plain paths end at the next os.PathListSeparator (a colon on Unix and a semicolon on Windows)
+// or at a colon followed by a scheme.
+// URLs may contain colons (e.g. Windows drive letters in file:///C:/keys.txt), hence they only end at a colon
+// followed by a scheme, a plain path following a URL has to be written as file:// URL.
+// Empty specs are skipped.
+func SplitKeysSpecs(specs ...string) []string {
+	split := make([]string, 0, len(specs))
+
+	for _, spec := range specs {
+		for spec != "" {
+			end := keysSpecEnd(spec)
+			if end > 0 {
+				split = append(split, spec[:end])
+			}
+
+			if end == len(spec) {
+				break
+			}
+
+			spec = spec[end+1:]
+		}
+	}
+
+	return split
+}
+
+// keysSpecEnd returns the index of the separator following the first spec or the length of specs if there is none.
+func keysSpecEnd(specs string) int {
+	isURL := keysSpecStart.MatchString(specs)
+
+	for idx := range len(specs) {
+		switch {
+		case specs[idx] == ':' && idx > 0 && keysSpecStart.MatchString(specs[idx+1:]):
+			return idx
+		case !isURL && specs[idx] == os.PathListSeparator:
+			return idx
+		}
+	}
+
+	return len(specs)
+}
+
+// KeysSources converts keys specs to identity store sources.
+// Supported are file:// (a keys file or keys.d directory), env://VAR, fd://N, cmd://helper, vault://mount/path,
+// keyring://<user|session>, secret-service:// and ssh://path/to/private/key,
+// specs without scheme are treated as file paths.
+// Every source is named after its kind and a label derived from the spec e.g. file:/home/jane/keys.txt or env:AGE_KEY,
+// the fragment of URL specs (e.g. file:///mnt/usb/keys.txt#backup) replaces the derived label.
+// Plain paths and cmd:// helpers are taken as they are, a # in them is not treated as label.
+func KeysSources(env ports.OSEnv, specs ...string) ([]IdentityStoreSource, error) {
+	specs = SplitKeysSpecs(specs...)
+	sources := make([]IdentityStoreSource, 0, len(specs))
+
+	for _, spec := range specs {
+		scheme, rest, found := strings.Cut(spec, "://")
+		if !found {
+			// plain paths are taken as they are, a # is part of the file name
+			sources = append(sources, NewFileIdentityStoreSource(&url.URL{Scheme: "file", Path: spec}))
+			continue
+		}
+
+		if strings.EqualFold(scheme, "cmd") {
+			// helper commands are taken as they are, a # may be part of their arguments
+			sources = append(sources, &CommandIdentitiesStoreSource{Helper: rest, Label: helperLabel(rest)})
+			continue
+		}
+
+		parsed, err := url.Parse(spec)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse keys URL %s: %w", spec, err)
+		}
+
+		label := parsed.Fragment
+		rest, _, _ = strings.Cut(rest, "#")
+
+		switch strings.ToLower(scheme) {
+		case "file":
+			sources = append(sources, NewFileIdentityStoreSource(parsed))
+		case "env":
+			src := NewEnvIdentitiesStoreSource(env, rest)
+			src.Label = label
+			sources = append(sources, src)
+		case "fd":
+			fd, err := strconv.ParseUint(rest, 10, 0)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse file descriptor %s: %w", rest, err)
+			}
+			src := NewFDIdentitiesStoreSource(uintptr(fd))
+			src.Label = label
+			sources = append(sources, src)
+		case "vault":
+			src := NewVaultIdentitiesStoreSource(env, parsed)
+			src.Label = label
+			sources = append(sources, src)
+		case "keyring":
+			src, err := NewKeyringIdentitiesStoreSource(parsed)
+			if err != nil {
+				return nil, err
+			}
+			src.Label = label
+			sources = append(sources, src)
+		case "secret-service":
+			src := NewSecretServiceIdentitiesStoreSource(env)
+			src.Label = label
+			sources = append(sources, src)
+		case "ssh":
+			src := NewSSHIdentitiesStoreSource(rest)
+			src.Label = label
+			sources = append(sources, src)
+		default:
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedKeysScheme, scheme)
+		}
+	}
+
+	return sources, nil
+}
+
+// helperLabel names helpers after their executable, the arguments are usually too long for a name.
+func helperLabel(helper string) string {
+	if fields := strings.Fields(helper); len(fields) > 0 {
+		return filepath.Base(fields[0])
+	}
+
+	return ""
+}
+
+// storeName combines the kind of a store with its label e.g. file:/home/jane/keys.txt,
+// stores can be selected by their full name, their kind or their label.
+func storeName(kind, label string) string {
+	if label == "" {
+		return kind
+	}
+
+	return kind + ":" + label
+}
@@ -0,0 +1,246 @@
+package infrastructure_test
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/infrastructure"
+	"github.com/prskr/git-age/internal/testx"
+)
+
+func TestSplitKeysSpecs(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		specs []string
+		want  []string
+	}{
+		{
+			name:  "Single file URL",
+			specs: []string{"file:///home/prskr/.config/git-age/keys.txt"},
+			want:  []string{"file:///home/prskr/.config/git-age/keys.txt"},
+		},
+		{
+			name:  "Windows path",
+			specs: []string{"file:///C:/Users/prskr/keys.txt"},
+			want:  []string{"file:///C:/Users/prskr/keys.txt"},
+		},
+		{
+			name:  "Colon separated",
+			specs: []string{"file:///home/prskr/keys.txt:env://AGE_KEY:fd://3"},
+			want:  []string{"file:///home/prskr/keys.txt", "env://AGE_KEY", "fd://3"},
+		},
+		{
+			name:  "Repeated and colon separated",
+			specs: []string{"file:///C:/keys.d/:cmd://pass-helper --vault dev", "/home/prskr/keys.txt"},
+			want:  []string{"file:///C:/keys.d/", "cmd://pass-helper --vault dev", "/home/prskr/keys.txt"},
+		},
+		{
+			name:  "Plain paths separated like PATH",
+			specs: []string{joinPathList("/a/keys.txt", "/b/keys.d/", "", "env://AGE_KEY")},
+			want:  []string{"/a/keys.txt", "/b/keys.d/", "env://AGE_KEY"},
+		},
+		{
+			name:  "Plain path followed by URL",
+			specs: []string{"/a/keys.txt:env://AGE_KEY"},
+			want:  []string{"/a/keys.txt", "env://AGE_KEY"},
+		},
+		{
+			name:  "Plain path after URL is not split",
+			specs: []string{"env://AGE_KEY:/a/keys.txt"},
+			want:  []string{"env://AGE_KEY:/a/keys.txt"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := infrastructure.SplitKeysSpecs(tt.specs...); !slices.Equal(got, tt.want) {
+				t.Errorf("SplitKeysSpecs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func joinPathList(elems ...string) string {
+	return strings.Join(elems, string(os.PathListSeparator))
+}
+
+func TestKeysSources(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name      string
+		specs     []string
+		wantNames []string
+		wantErr   error
+	}{
+		{
+			name:      "All schemes",
+			specs:     []string{"file:///tmp/keys.txt:env://AGE_KEY:fd://3:cmd://pass-helper", "/tmp/keys.d/", "ssh://~/.ssh/id_ed25519"},
+			wantNames: []string{"file:/tmp/keys.txt", "env:AGE_KEY", "fd:3", "helper:pass-helper", "file:/tmp/keys.d/", "ssh:~/.ssh/id_ed25519"},
+		},
+		{
+			name:      "Explicit labels",
+			specs:     []string{"file:///tmp/keys.txt#work:env://AGE_KEY#ci", "vault://secret/git-age#team"},
+			wantNames: []string{"file:work", "env:ci", "vault:team"},
+		},
+		{
+			name:      "Hash in plain paths and helpers",
+			specs:     []string{"/tmp/keys#1.txt", "cmd://pass-helper --vault dev#dev"},
+			wantNames: []string{"file:/tmp/keys#1.txt", "helper:pass-helper"},
+		},
+		{
+			name:    "Unsupported scheme",
+			specs:   []string{"https://example.com/keys.txt"},
+			wantErr: infrastructure.ErrUnsupportedKeysScheme,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			sources, err := infrastructure.KeysSources(ports.NewOSEnv(), tt.specs...)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("KeysSources() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			names := make([]string, 0, len(sources))
+			for _, src := range sources {
+				names = append(names, src.Name())
+			}
+
+			if !slices.Equal(names, tt.wantNames) {
+				t.Errorf("KeysSources() = %v, want %v", names, tt.wantNames)
+			}
+		})
+	}
+}
+
+func TestEnvIdentitiesStoreSource(t *testing.T) {
+	t.Parallel()
+
+	env := ports.OSEnv{"AGE_KEY": singleIdentity}
+
+	src := infrastructure.NewEnvIdentitiesStoreSource(env, "AGE_KEY")
+	if isValid, err := src.IsValid(testx.Context(t)); err != nil || !isValid {
+		t.Fatalf("IsValid() = %v, %v", isValid, err)
+	}
+
+	if isValid, _ := infrastructure.NewEnvIdentitiesStoreSource(env, "MISSING").IsValid(testx.Context(t)); isValid {
+		t.Errorf("expected empty variable to be skipped")
+	}
+
+	store := testx.ResultOf(t, src.GetStore)
+
+	ids, err := store.Identities(testx.Context(t), ports.IdentitiesQuery{})
+	if err != nil {
+		t.Fatalf("Identities() error = %v", err)
+	}
+
+	if len(ids) != 1 {
+		t.Errorf("expected 1 identity, got %d", len(ids))
+	}
+
+	if err := store.Store(testx.Context(t), ports.StoreIdentityCommand{}); !errors.Is(err, infrastructure.ErrReadOnlyStore) {
+		t.Errorf("Store() error = %v, want %v", err, infrastructure.ErrReadOnlyStore)
+	}
+}
+
+func TestFDIdentitiesStoreSource(t *testing.T) {
+	t.Parallel()
+
+	keysFile, err := os.Open(writeConfig(t, t.TempDir(), "keys.txt", singleIdentity))
+	if err != nil {
+		t.Fatalf("failed to open keys file: %v", err)
+	}
+
+	t.Cleanup(func() {
+		_ = keysFile.Close()
+	})
+
+	if isValid, err := infrastructure.NewFDIdentitiesStoreSource(keysFile.Fd()).IsValid(testx.Context(t)); err != nil || !isValid {
+		t.Errorf("IsValid() of open descriptor = %v, %v", isValid, err)
+	}
+
+	// far beyond any descriptor limit, hence never open
+	src := infrastructure.NewFDIdentitiesStoreSource(1 << 30)
+	if isValid, err := src.IsValid(testx.Context(t)); isValid || !errors.Is(err, infrastructure.ErrInvalidFileDescriptor) {
+		t.Errorf("IsValid() of closed descriptor = %v, %v", isValid, err)
+	}
+
+	store := testx.ResultOf(t, src.GetStore)
+	if _, err := store.Identities(testx.Context(t), ports.IdentitiesQuery{}); !errors.Is(err, infrastructure.ErrInvalidFileDescriptor) {
+		t.Errorf("Identities() error = %v, want %v", err, infrastructure.ErrInvalidFileDescriptor)
+	}
+}
+
+func TestSSHIdentitiesStoreSource(t *testing.T) {
+	t.Parallel()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ed25519 key: %v", err)
+	}
+
+	dir := t.TempDir()
+
+	writeKey := func(name string, block *pem.Block) string {
+		t.Helper()
+
+		keyPath := filepath.Join(dir, name)
+		if err := os.WriteFile(keyPath, pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatalf("failed to write SSH key: %v", err)
+		}
+
+		return keyPath
+	}
+
+	plainKey := writeKey("id_ed25519", testx.ResultOfA[*pem.Block](t, ssh.MarshalPrivateKey, key, ""))
+	encryptedKey := writeKey(
+		"id_ed25519_encrypted",
+		testx.ResultOfA[*pem.Block](t, ssh.MarshalPrivateKeyWithPassphrase, key, "", []byte("secret")),
+	)
+
+	store := testx.ResultOf(t, infrastructure.NewSSHIdentitiesStoreSource(plainKey).GetStore)
+
+	ids, err := store.Identities(testx.Context(t), ports.IdentitiesQuery{})
+	if err != nil {
+		t.Fatalf("Identities() error = %v", err)
+	}
+
+	pubKey := testx.ResultOfA[ssh.PublicKey](t, ssh.NewPublicKey, key.Public())
+	recipient := testx.ResultOfA[age.Recipient](t, agessh.NewEd25519Recipient, pubKey)
+
+	encrypted := new(bytes.Buffer)
+	w := testx.ResultOfA[io.WriteCloser](t, age.Encrypt, encrypted, recipient)
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to encrypt: %v", err)
+	}
+
+	if _, err := age.Decrypt(encrypted, ids...); err != nil {
+		t.Errorf("SSH identity cannot decrypt for its recipient: %v", err)
+	}
+
+	store = testx.ResultOf(t, infrastructure.NewSSHIdentitiesStoreSource(encryptedKey).GetStore)
+	if _, err := store.Identities(testx.Context(t), ports.IdentitiesQuery{}); !errors.Is(err, infrastructure.ErrEncryptedSSHKey) {
+		t.Errorf("Identities() error = %v, want %v", err, infrastructure.ErrEncryptedSSHKey)
+	}
+}
@@ -1,19 +1,122 @@
 package infrastructure
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
-	"io"
 	"io/fs"
+	"log/slog"
+	"path"
 	"slices"
 	"strings"
+	"time"
 
 	"filippo.io/age"
+	"golang.org/x/crypto/ssh"
 
 	"github.com/prskr/git-age/core/ports"
 )
 
-var _ ports.Recipients = (*RecipientsFile)(nil)
+var (
+	_ ports.Recipients         = (*RecipientsFile)(nil)
+	_ ports.RecipientsVerifier = (*RecipientsFile)(nil)
+	_ ports.ExpiringRecipients = (*RecipientsFile)(nil)
+)
+
+var (
+	ErrMixedPassphraseRecipients  = errors.New("a passphrase recipient cannot be mixed with other recipients")
+	ErrPassphraseRequired         = errors.New("repository is encrypted for a shared passphrase but no passphrase is set")
+	ErrRecipientsNotSigned        = errors.New("recipients file is not signed but trusted signers are pinned")
+	ErrInvalidRecipientsSignature = errors.New("recipients file signature is invalid")
+	ErrUntrustedRecipientsSigner  = errors.New("recipients file is signed by an untrusted key")
+	ErrRecipientsSignerNotTrusted = errors.New("recipients file is signed by a key that is not trusted yet")
+	ErrSigningKeyRequired         = errors.New("recipients file is signed, a signing key is required to change it")
+	ErrMixedPostQuantumRecipients = errors.New("age refuses to mix post-quantum and classic recipients")
+	ErrUnsupportedRecipientType   = errors.New("unsupported recipient type")
+	ErrInvalidRecipientExpiry     = errors.New("invalid recipient expiry date, expected YYYY-MM-DD")
+	ErrAllRecipientsExpired       = errors.New("all recipients are expired")
+	ErrNoRecipients               = errors.New("no recipients found")
+	ErrInvalidRecipientsSection   = errors.New("invalid recipients section, expected a ref pattern like [refs/heads/main]")
+)
+
+// recipientExpiresKey annotates a recipient with the last day (UTC) files are encrypted for it, e.g. # expires: 2027-01-31.
+const recipientExpiresKey = "expires:"
+
+// RecipientEntry is a single recipient line of the recipients file together with its comment.
+type RecipientEntry struct {
+	PublicKey string `json:"publicKey"`
+	// Comment are the comment lines directly preceding the recipient, usually the name of its owner
+	Comment string `json:"comment,omitempty"`
+	// Expires is the last day files are encrypted for the recipient, zero if the recipient does not expire
+	Expires time.Time `json:"expires,omitzero"`
+	// Ref is the ref pattern of the section the recipient is listed in, empty for the default recipients
+	Ref  string `json:"ref,omitempty"`
+	Line int    `json:"line"`
+}
+
+// IsExpired checks whether the last day of the recipient has passed at the given point in time.
+func (e RecipientEntry) IsExpired(now time.Time) bool {
+	return !e.Expires.IsZero() && !now.Before(e.Expires.AddDate(0, 0, 1))
+}
+
+// ParseRecipientEntries parses the recipients file without validating the recipients, other than age.ParseRecipients
+// it keeps the comments. Malformed expiry annotations are kept as comment, use RecipientsFile.Entries to reject them.
+func ParseRecipientEntries(raw []byte) []RecipientEntry {
+	entries, _ := parseRecipientEntries(raw)
+	return entries
+}
+
+func parseRecipientEntries(raw []byte) ([]RecipientEntry, error) {
+	var (
+		entries []RecipientEntry
+		pending []string
+		expires time.Time
+		ref     string
+		lineNo  int
+		errs    []error
+	)
+
+	for line := range strings.Lines(string(raw)) {
+		lineNo++
+
+		switch trimmed := strings.TrimSpace(line); {
+		case trimmed == "":
+			pending, expires = nil, time.Time{}
+		case isRecipientsSection(trimmed):
+			pending, expires = nil, time.Time{}
+			ref = sectionRef(trimmed)
+
+			if _, err := path.Match(ref, ""); err != nil || ref == "" {
+				errs = append(errs, fmt.Errorf("%w at line %d: %s", ErrInvalidRecipientsSection, lineNo, trimmed))
+			}
+		case strings.HasPrefix(trimmed, "#"):
+			comment := strings.TrimSpace(strings.TrimPrefix(trimmed, "#"))
+
+			if value, ok := strings.CutPrefix(comment, recipientExpiresKey); ok {
+				parsed, err := time.Parse(time.DateOnly, strings.TrimSpace(value))
+				if err == nil {
+					expires = parsed
+					continue
+				}
+
+				errs = append(errs, fmt.Errorf("%w at line %d: %w", ErrInvalidRecipientExpiry, lineNo, err))
+			}
+
+			pending = append(pending, comment)
+		default:
+			entries = append(entries, RecipientEntry{
+				PublicKey: trimmed,
+				Comment:   strings.Join(pending, " "),
+				Expires:   expires,
+				Ref:       ref,
+				Line:      lineNo,
+			})
+			pending, expires = nil, time.Time{}
+		}
+	}
+
+	return entries, errors.Join(errs...)
+}
 
 func NewRecipientsFile(fs ports.ReadWriteFS) *RecipientsFile {
 	return &RecipientsFile{FS: fs}
@@ -21,78 +124,692 @@ func NewRecipientsFile(fs ports.ReadWriteFS) *RecipientsFile {
 
 type RecipientsFile struct {
 	FS ports.ReadWriteFS
+	// Head resolves the current branch, the first section whose ref pattern matches it replaces the default recipients
+	Head ports.HeadRefResolver
+	// Passphrase is used for repositories whose recipients file only contains the passphrase marker
+	Passphrase string
+	// SigningKey signs the recipients file after every change, it is required as soon as the file is signed
+	SigningKey ssh.Signer
+	// TrustedSigners are the maintainer keys allowed to sign the recipients file,
+	// without them only the integrity of an existing signature is checked
+	TrustedSigners *TrustedSigners
+	// SkipExpired is called for every expired recipient All skips, by default a warning is logged
+	SkipExpired func(RecipientEntry)
 }
 
 func (r RecipientsFile) All() ([]age.Recipient, error) {
-	existingRecipients, err := r.FS.Open(ports.RecipientsFileName)
-	if err != nil {
-		if !errors.Is(err, fs.ErrNotExist) {
+	raw, err := r.read()
+	if err != nil || raw == nil {
+		return nil, err
+	}
+
+	protected, err := isPassphraseProtected(raw)
+	switch {
+	case err != nil:
+		return nil, err
+	case protected:
+		return r.passphraseRecipients()
+	default:
+		entries, err := r.activeEntries(raw)
+		if err != nil {
 			return nil, err
 		}
-		return nil, nil
+
+		skipExpired := r.SkipExpired
+		if skipExpired == nil {
+			skipExpired = warnExpiredRecipient
+		}
+
+		return unexpiredRecipients(entries, time.Now(), skipExpired)
 	}
+}
 
-	defer func() {
-		_ = existingRecipients.Close()
-	}()
+// Active returns the recipients files are encrypted for on the current branch.
+func (r RecipientsFile) Active() ([]RecipientEntry, error) {
+	raw, err := r.read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recipients file: %w", err)
+	}
 
-	return age.ParseRecipients(existingRecipients)
+	return r.activeEntries(raw)
 }
 
-func (r RecipientsFile) Append(pubKey string, comment string) (recipients []age.Recipient, err error) {
-	recipients, err = age.ParseRecipients(strings.NewReader(pubKey))
+// Ref returns the ref pattern of the section used on the current branch, empty for the default recipients.
+func (r RecipientsFile) Ref() (string, error) {
+	raw, err := r.read()
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse public key: %w", err)
+		return "", fmt.Errorf("failed to read recipients file: %w", err)
 	}
 
-	alreadyInRecipients, err := r.isKnown(pubKey)
+	headRef, err := r.headRef()
 	if err != nil {
-		return nil, fmt.Errorf("failed to check if recipient is already known: %w", err)
+		return "", err
 	}
 
-	if alreadyInRecipients {
-		return nil, nil
+	return MatchRecipientsSection(RecipientSections(raw), headRef), nil
+}
+
+// Entries returns all recipients of the recipients file together with their comments and expiry dates.
+func (r RecipientsFile) Entries() ([]RecipientEntry, error) {
+	raw, err := r.read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recipients file: %w", err)
 	}
 
-	recipientsFile, err := r.FS.Create(ports.RecipientsFileName)
+	return parseRecipientEntries(raw)
+}
+
+// Expiring returns the recipients whose last day is before the given point in time, including the expired ones.
+func (r RecipientsFile) Expiring(before time.Time) ([]RecipientEntry, error) {
+	entries, err := r.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.DeleteFunc(entries, func(entry RecipientEntry) bool {
+		return !entry.IsExpired(before)
+	}), nil
+}
+
+// IsPassphraseProtected checks whether the repository is encrypted for a shared passphrase.
+func (r RecipientsFile) IsPassphraseProtected() (bool, error) {
+	raw, err := r.read()
+	if err != nil || raw == nil {
+		return false, err
+	}
+
+	return isPassphraseProtected(raw)
+}
+
+func (r RecipientsFile) Append(pubKey string, comment string) ([]age.Recipient, error) {
+	return r.AppendExpiring(pubKey, comment, time.Time{})
+}
+
+// AppendExpiring appends the recipient with an expiry annotation, files are encrypted for it until the end of lastDay (UTC).
+// A zero lastDay appends a recipient that does not expire.
+func (r RecipientsFile) AppendExpiring(pubKey, comment string, lastDay time.Time) ([]age.Recipient, error) {
+	raw, err := r.read()
 	if err != nil {
-		return nil, fmt.Errorf("failed to open recipients file: %w", err)
+		return nil, fmt.Errorf("failed to read recipients file: %w", err)
 	}
 
-	if _, err := recipientsFile.Seek(0, io.SeekEnd); err != nil {
+	protected, err := isPassphraseProtected(raw)
+	if err != nil {
 		return nil, err
 	}
 
-	defer func() {
-		err = errors.Join(err, recipientsFile.Close())
-	}()
+	var recipients []age.Recipient
 
-	if comment != "" {
-		if _, err := fmt.Fprintf(recipientsFile, "# %s\n", comment); err != nil {
-			return nil, fmt.Errorf("failed to write comment to recipients file: %w", err)
+	if pubKey == ports.PassphraseRecipient {
+		if protected {
+			return nil, nil
+		}
+
+		if len(recipientLines(raw)) > 0 {
+			return nil, ErrMixedPassphraseRecipients
+		}
+	} else {
+		if protected {
+			return nil, ErrMixedPassphraseRecipients
+		}
+
+		recipient, recipientType, err := ParseRecipient(pubKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key: %w", err)
+		} else if recipient == nil {
+			return nil, fmt.Errorf("%w: %s", ErrUnsupportedRecipientType, recipientType)
+		}
+
+		recipients = []age.Recipient{recipient}
+
+		alreadyInRecipients, err := r.isKnown(pubKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check if recipient is already known: %w", err)
+		}
+
+		if alreadyInRecipients {
+			return nil, nil
 		}
 	}
 
-	if _, err := recipientsFile.WriteString(pubKey + "\n"); err != nil {
-		return nil, fmt.Errorf("failed to write public key to recipients file: %w", err)
+	if err := r.prepareChange(); err != nil {
+		return nil, err
+	}
+
+	if err := r.appendLine(pubKey, comment, lastDay); err != nil {
+		return nil, err
+	}
+
+	if err := r.sign(); err != nil {
+		return nil, err
+	}
+
+	if pubKey == ports.PassphraseRecipient && r.Passphrase != "" {
+		return r.passphraseRecipients()
 	}
 
 	return recipients, nil
 }
 
-func (r RecipientsFile) isKnown(pubKey string) (bool, error) {
-	recipients, err := r.All()
+// CompatibleWith checks whether a recipient of the given type can be added to the current recipients,
+// age refuses to encrypt for post-quantum and classic recipients at the same time.
+func (r RecipientsFile) CompatibleWith(recipientType RecipientType) error {
+	raw, err := r.read()
 	if err != nil {
-		return false, err
+		return fmt.Errorf("failed to read recipients file: %w", err)
+	}
+
+	if protected, err := isPassphraseProtected(raw); err != nil {
+		return err
+	} else if protected {
+		return ErrMixedPassphraseRecipients
+	}
+
+	if !slices.Contains([]RecipientType{RecipientTypeX25519, RecipientTypeHybrid, RecipientTypeSSH}, recipientType) {
+		return fmt.Errorf("%w: %s", ErrUnsupportedRecipientType, recipientType)
+	}
+
+	ref, err := r.Ref()
+	if err != nil {
+		return err
+	}
+
+	for _, detail := range InspectRecipients(raw) {
+		if detail.Type == RecipientTypeInvalid || detail.Ref != ref {
+			continue
+		}
+
+		if (detail.Type == RecipientTypeHybrid) != (recipientType == RecipientTypeHybrid) {
+			return fmt.Errorf("%w: line %d is %s, the new recipient %s", ErrMixedPostQuantumRecipients, detail.Line, detail.Type, recipientType)
+		}
+	}
+
+	return nil
+}
+
+// Remove drops the given public keys and the comments directly preceding them from the section
+// used on the current branch, the same keys in other sections are kept.
+func (r RecipientsFile) Remove(pubKeys ...string) error {
+	raw, err := fs.ReadFile(r.FS, ports.RecipientsFileName)
+	if err != nil {
+		return fmt.Errorf("failed to read recipients file: %w", err)
+	}
+
+	ref, err := r.Ref()
+	if err != nil {
+		return err
 	}
 
-	return slices.ContainsFunc(recipients, func(recipient age.Recipient) bool {
-		switch actual := recipient.(type) {
-		// currently there are only X25519 recipients
-		case *age.X25519Recipient:
-			return actual.String() == pubKey
+	var (
+		lines   = strings.Split(string(raw), "\n")
+		kept    = make([]string, 0, len(lines))
+		pending []string
+		current string
+	)
+
+	for _, line := range lines {
+		switch trimmed := strings.TrimSpace(line); {
+		case strings.HasPrefix(trimmed, "#"):
+			pending = append(pending, line)
+		case current == ref && slices.Contains(pubKeys, trimmed):
+			pending = nil
 		default:
-			return false
+			if isRecipientsSection(trimmed) {
+				current = sectionRef(trimmed)
+			}
+
+			kept = append(kept, pending...)
+			kept = append(kept, line)
+			pending = nil
 		}
+	}
+
+	kept = append(kept, pending...)
+
+	if err := r.prepareChange(); err != nil {
+		return err
+	}
+
+	if err := r.write(ports.RecipientsFileName, []byte(strings.Join(kept, "\n"))); err != nil {
+		return fmt.Errorf("failed to write recipients file: %w", err)
+	}
+
+	return r.sign()
+}
+
+// Verify checks the signature of the recipients file against the trusted signers.
+// An unsigned file is accepted as long as no signer is trusted yet,
+// the signer of the first signed file is trusted on first use.
+func (r RecipientsFile) Verify() error {
+	signer, trusted, err := r.verifySignature()
+	if err != nil || signer == nil {
+		return err
+	}
+
+	return r.trust(signer, trusted)
+}
+
+// CheckSignature verifies the recipients file like Verify but never trusts a signer on first use.
+// The signer of a file whose signer would be trusted on first use is returned with ErrRecipientsSignerNotTrusted,
+// an unsigned file is reported without signer and without error.
+func (r RecipientsFile) CheckSignature() (ssh.PublicKey, error) {
+	signer, trusted, err := r.verifySignature()
+	if err != nil || signer == nil {
+		return signer, err
+	}
+
+	if len(trusted) == 0 {
+		return signer, fmt.Errorf("%w: %s", ErrRecipientsSignerNotTrusted, SSHFingerprint(signer))
+	}
+
+	if !slices.ContainsFunc(trusted, isSigner(signer)) {
+		return signer, fmt.Errorf("%w: %s", ErrUntrustedRecipientsSigner, SSHFingerprint(signer))
+	}
+
+	return signer, nil
+}
+
+// verifySignature checks the signature without trusting its signer,
+// the signer is nil if the recipients file is not signed.
+func (r RecipientsFile) verifySignature() (signer ssh.PublicKey, trusted []TrustedSigner, err error) {
+	raw, err := r.read()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read recipients file: %w", err)
+	}
+
+	sig, err := r.readSignature()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	trusted, err = r.trustedSigners()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if sig == nil {
+		if len(trusted) > 0 {
+			return nil, nil, fmt.Errorf("%w: %s is missing", ErrRecipientsNotSigned, ports.RecipientsSignatureFileName)
+		}
+
+		return nil, trusted, nil
+	}
+
+	signer, err = VerifySSH(sig, RecipientsSignatureNamespace, raw)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w", ErrInvalidRecipientsSignature, err)
+	}
+
+	return signer, trusted, nil
+}
+
+// IsSigned checks whether a signature of the recipients file exists, it does not verify it.
+func (r RecipientsFile) IsSigned() (bool, error) {
+	sig, err := r.readSignature()
+
+	return sig != nil, err
+}
+
+// prepareChange makes sure the current recipients file is authentic
+// and that the changed file can be signed again if it was signed before.
+func (r RecipientsFile) prepareChange() error {
+	if err := r.Verify(); err != nil {
+		return err
+	}
+
+	if r.SigningKey == nil {
+		if signed, err := r.IsSigned(); err != nil {
+			return err
+		} else if signed {
+			return ErrSigningKeyRequired
+		}
+
+		return nil
+	}
+
+	trusted, err := r.trustedSigners()
+	if err != nil {
+		return err
+	}
+
+	if len(trusted) > 0 && !slices.ContainsFunc(trusted, isSigner(r.SigningKey.PublicKey())) {
+		return fmt.Errorf("%w: %s", ErrUntrustedRecipientsSigner, SSHFingerprint(r.SigningKey.PublicKey()))
+	}
+
+	return nil
+}
+
+// sign writes a detached signature of the recipients file if a signing key is configured.
+func (r RecipientsFile) sign() error {
+	if r.SigningKey == nil {
+		return nil
+	}
+
+	raw, err := r.read()
+	if err != nil {
+		return fmt.Errorf("failed to read recipients file: %w", err)
+	}
+
+	sig, err := SignSSH(r.SigningKey, RecipientsSignatureNamespace, raw)
+	if err != nil {
+		return fmt.Errorf("failed to sign recipients file: %w", err)
+	}
+
+	if err := r.write(ports.RecipientsSignatureFileName, sig); err != nil {
+		return fmt.Errorf("failed to write recipients signature: %w", err)
+	}
+
+	trusted, err := r.trustedSigners()
+	if err != nil {
+		return err
+	}
+
+	return r.trust(r.SigningKey.PublicKey(), trusted)
+}
+
+func (r RecipientsFile) trust(signer ssh.PublicKey, trusted []TrustedSigner) error {
+	if r.TrustedSigners == nil {
+		return nil
+	}
+
+	if len(trusted) == 0 {
+		slog.Warn("Trusting signer of recipients file on first use", slog.String("fingerprint", SSHFingerprint(signer)))
+		return r.TrustedSigners.Add(signer, "")
+	}
+
+	if !slices.ContainsFunc(trusted, isSigner(signer)) {
+		return fmt.Errorf("%w: %s", ErrUntrustedRecipientsSigner, SSHFingerprint(signer))
+	}
+
+	return nil
+}
+
+func (r RecipientsFile) trustedSigners() ([]TrustedSigner, error) {
+	if r.TrustedSigners == nil {
+		return nil, nil
+	}
+
+	return r.TrustedSigners.All()
+}
+
+// appendLine adds the recipient at the end of the section used on the current branch.
+func (r RecipientsFile) appendLine(pubKey, comment string, lastDay time.Time) error {
+	raw, err := r.read()
+	if err != nil {
+		return fmt.Errorf("failed to read recipients file: %w", err)
+	}
+
+	var added []string
+
+	if comment != "" {
+		added = append(added, "# "+comment)
+	}
+
+	if !lastDay.IsZero() {
+		added = append(added, fmt.Sprintf("# %s %s", recipientExpiresKey, lastDay.Format(time.DateOnly)))
+	}
+
+	added = append(added, pubKey)
+
+	ref, err := r.Ref()
+	if err != nil {
+		return err
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(raw), "\n"), "\n")
+	if len(raw) == 0 {
+		lines = nil
+	}
+
+	insertAt := sectionEnd(lines, ref)
+
+	// keep the blank line separating the section from the next one
+	for insertAt > 0 && insertAt < len(lines) && strings.TrimSpace(lines[insertAt-1]) == "" {
+		insertAt--
+	}
+
+	if insertAt < len(lines) && isRecipientsSection(strings.TrimSpace(lines[insertAt])) {
+		added = append(added, "")
+	}
+
+	lines = slices.Insert(lines, insertAt, added...)
+
+	if err := r.write(ports.RecipientsFileName, []byte(strings.Join(lines, "\n")+"\n")); err != nil {
+		return fmt.Errorf("failed to write recipients file: %w", err)
+	}
+
+	return nil
+}
+
+func (r RecipientsFile) write(name string, content []byte) (err error) {
+	f, err := r.FS.Create(name, ports.WithTruncate)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		err = errors.Join(err, f.Close())
+	}()
+
+	_, err = f.Write(content)
+
+	return err
+}
+
+func (r RecipientsFile) isKnown(pubKey string) (bool, error) {
+	entries, err := r.Active()
+	if err != nil {
+		return false, err
+	}
+
+	return slices.ContainsFunc(entries, func(entry RecipientEntry) bool {
+		return entry.PublicKey == pubKey
 	}), nil
 }
+
+// activeEntries returns the entries of the section used on the current branch.
+func (r RecipientsFile) activeEntries(raw []byte) ([]RecipientEntry, error) {
+	if _, err := parseRecipientEntries(raw); err != nil {
+		return nil, err
+	}
+
+	headRef, err := r.headRef()
+	if err != nil {
+		return nil, err
+	}
+
+	return RecipientsForRef(raw, headRef), nil
+}
+
+// headRef returns the current branch or an empty string if HEAD is detached or no resolver is configured.
+func (r RecipientsFile) headRef() (string, error) {
+	if r.Head == nil {
+		return "", nil
+	}
+
+	headRef, err := r.Head.HeadRef()
+	if err != nil {
+		return "", fmt.Errorf("failed to determine current branch: %w", err)
+	}
+
+	return headRef, nil
+}
+
+// read returns the content of the recipients file or nil if it does not exist yet.
+func (r RecipientsFile) read() ([]byte, error) {
+	return readOptional(r.FS, ports.RecipientsFileName)
+}
+
+// readSignature returns the signature of the recipients file or nil if it is not signed.
+func (r RecipientsFile) readSignature() ([]byte, error) {
+	sig, err := readOptional(r.FS, ports.RecipientsSignatureFileName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recipients signature: %w", err)
+	}
+
+	return sig, nil
+}
+
+func readOptional(fsys fs.FS, name string) ([]byte, error) {
+	raw, err := fs.ReadFile(fsys, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+
+	return raw, err
+}
+
+func (r RecipientsFile) passphraseRecipients() ([]age.Recipient, error) {
+	if r.Passphrase == "" {
+		return nil, ErrPassphraseRequired
+	}
+
+	recipient, err := age.NewScryptRecipient(r.Passphrase)
+	if err != nil {
+		return nil, err
+	}
+
+	return []age.Recipient{recipient}, nil
+}
+
+// unexpiredRecipients parses all recipients except the expired ones, which are passed to skipExpired.
+func unexpiredRecipients(entries []RecipientEntry, now time.Time, skipExpired func(RecipientEntry)) ([]age.Recipient, error) {
+	var (
+		recipients = make([]age.Recipient, 0, len(entries))
+		expired    int
+	)
+
+	for _, entry := range entries {
+		if entry.IsExpired(now) {
+			skipExpired(entry)
+			expired++
+			continue
+		}
+
+		recipient, recipientType, err := ParseRecipient(entry.PublicKey)
+		if err != nil {
+			return nil, fmt.Errorf("malformed recipient at line %d: %w", entry.Line, err)
+		}
+
+		if recipient == nil {
+			return nil, fmt.Errorf("%w at line %d: %s", ErrUnsupportedRecipientType, entry.Line, recipientType)
+		}
+
+		recipients = append(recipients, recipient)
+	}
+
+	switch {
+	case expired > 0 && len(recipients) == 0:
+		return nil, ErrAllRecipientsExpired
+	case len(recipients) == 0:
+		return nil, ErrNoRecipients
+	default:
+		return recipients, nil
+	}
+}
+
+func warnExpiredRecipient(entry RecipientEntry) {
+	slog.Warn(
+		"Not encrypting for expired recipient, remove it with git age recipients prune-expired",
+		slog.String("recipient", entry.PublicKey),
+		slog.String("comment", entry.Comment),
+		slog.String("expired", entry.Expires.Format(time.DateOnly)),
+	)
+}
+
+func isSigner(key ssh.PublicKey) func(TrustedSigner) bool {
+	return func(signer TrustedSigner) bool {
+		return bytes.Equal(signer.Key.Marshal(), key.Marshal())
+	}
+}
+
+func isPassphraseProtected(raw []byte) (bool, error) {
+	lines := recipientLines(raw)
+	if !slices.Contains(lines, ports.PassphraseRecipient) {
+		return false, nil
+	}
+
+	if len(lines) > 1 {
+		return false, ErrMixedPassphraseRecipients
+	}
+
+	return true, nil
+}
+
+// recipientLines returns all lines of the recipients file that are neither empty nor comments.
+func recipientLines(raw []byte) (lines []string) {
+	for line := range strings.Lines(string(raw)) {
+		if trimmed := strings.TrimSpace(line); trimmed != "" && !strings.HasPrefix(trimmed, "#") && !isRecipientsSection(trimmed) {
+			lines = append(lines, trimmed)
+		}
+	}
+
+	return lines
+}
+
+// RecipientSections returns the ref patterns of all sections of the recipients file in the order they are listed,
+// including sections without recipients.
+func RecipientSections(raw []byte) (sections []string) {
+	for line := range strings.Lines(string(raw)) {
+		if trimmed := strings.TrimSpace(line); isRecipientsSection(trimmed) {
+			sections = append(sections, sectionRef(trimmed))
+		}
+	}
+
+	return sections
+}
+
+// RecipientsForRef returns the recipients files are encrypted for on the given ref,
+// the first section whose ref pattern matches replaces the default recipients, even if it is empty.
+func RecipientsForRef(raw []byte, ref string) []RecipientEntry {
+	section := MatchRecipientsSection(RecipientSections(raw), ref)
+
+	return slices.DeleteFunc(ParseRecipientEntries(raw), func(entry RecipientEntry) bool {
+		return entry.Ref != section
+	})
+}
+
+// MatchRecipientsSection returns the first of the given section ref patterns matching the given ref
+// or an empty string for the default recipients.
+func MatchRecipientsSection(sections []string, ref string) string {
+	if ref == "" {
+		return ""
+	}
+
+	for _, section := range sections {
+		if matched, _ := path.Match(section, ref); section != "" && matched {
+			return section
+		}
+	}
+
+	return ""
+}
+
+// sectionEnd returns the index of the line following the last line of the given section,
+// the default recipients end at the first section header.
+func sectionEnd(lines []string, ref string) int {
+	inSection := ref == ""
+
+	for idx, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if !isRecipientsSection(trimmed) {
+			continue
+		}
+
+		if inSection {
+			return idx
+		}
+
+		inSection = sectionRef(trimmed) == ref
+	}
+
+	return len(lines)
+}
+
+func isRecipientsSection(trimmed string) bool {
+	return strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]")
+}
+
+func sectionRef(trimmed string) string {
+	return strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(trimmed, "["), "]"))
+}
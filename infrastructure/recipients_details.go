@@ -0,0 +1,148 @@
+package infrastructure
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"filippo.io/age/plugin"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/prskr/git-age/core/ports"
+)
+
+type RecipientType string
+
+const (
+	RecipientTypeX25519     RecipientType = "x25519"
+	RecipientTypeHybrid     RecipientType = "hybrid"
+	RecipientTypeSSH        RecipientType = "ssh"
+	RecipientTypePlugin     RecipientType = "plugin"
+	RecipientTypePassphrase RecipientType = "passphrase"
+	RecipientTypeInvalid    RecipientType = "invalid"
+)
+
+const (
+	// fingerprintLength is the number of base64 characters of the SHA-256 hash shown as fingerprint.
+	fingerprintLength = 12
+	// fingerprintWordCount is the number of bytes of the SHA-256 hash rendered as words.
+	fingerprintWordCount = 6
+)
+
+var ErrUnknownRecipientType = errors.New("unknown recipient type")
+
+// RecipientDetails describes a single recipient of the recipients file.
+type RecipientDetails struct {
+	RecipientEntry
+	Type             RecipientType `json:"type"`
+	Fingerprint      string        `json:"fingerprint,omitempty"`
+	FingerprintWords string        `json:"fingerprintWords,omitempty"`
+	// DuplicateOf is the line of the first occurrence of the same recipient
+	DuplicateOf int    `json:"duplicateOf,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// InspectRecipients parses the recipients file line by line and describes every recipient,
+// other than RecipientsFile.All it does not stop at the first invalid line.
+func InspectRecipients(raw []byte) []RecipientDetails {
+	entries := ParseRecipientEntries(raw)
+	details := make([]RecipientDetails, 0, len(entries))
+	firstSeen := make(map[string]int, len(entries))
+
+	for _, entry := range entries {
+		detail := RecipientDetails{RecipientEntry: entry}
+
+		_, recipientType, err := ParseRecipient(entry.PublicKey)
+		if err != nil {
+			detail.Type = RecipientTypeInvalid
+			detail.Error = err.Error()
+		} else {
+			detail.Type = recipientType
+			detail.Fingerprint = RecipientFingerprint(entry.PublicKey)
+			detail.FingerprintWords = RecipientFingerprintWords(entry.PublicKey)
+		}
+
+		// the same recipient may be listed in several sections
+		key := entry.Ref + " " + entry.PublicKey
+		if line, ok := firstSeen[key]; ok {
+			detail.DuplicateOf = line
+		} else {
+			firstSeen[key] = entry.Line
+		}
+
+		details = append(details, detail)
+	}
+
+	return details
+}
+
+// ParseRecipient determines the type of the given recipient and validates it.
+// The returned recipient is nil for passphrase and plugin recipients,
+// the latter can only be used with the plugin binary installed.
+func ParseRecipient(pubKey string) (age.Recipient, RecipientType, error) {
+	switch {
+	case pubKey == ports.PassphraseRecipient:
+		return nil, RecipientTypePassphrase, nil
+	case strings.HasPrefix(pubKey, "age1pq1"):
+		recipient, err := age.ParseHybridRecipient(pubKey)
+		if err != nil {
+			return nil, "", err
+		}
+		return recipient, RecipientTypeHybrid, nil
+	case strings.HasPrefix(pubKey, "ssh-"):
+		recipient, err := agessh.ParseRecipient(pubKey)
+		if err != nil {
+			return nil, "", err
+		}
+		return recipient, RecipientTypeSSH, nil
+	case strings.HasPrefix(pubKey, "age1"):
+		if recipient, err := age.ParseX25519Recipient(pubKey); err == nil {
+			return recipient, RecipientTypeX25519, nil
+		}
+
+		// plugin recipients are age1<plugin name>1...
+		if _, _, err := plugin.ParseRecipient(pubKey); err != nil {
+			return nil, "", err
+		}
+		return nil, RecipientTypePlugin, nil
+	default:
+		return nil, "", fmt.Errorf("%w: %.20q", ErrUnknownRecipientType, pubKey)
+	}
+}
+
+// RecipientFingerprint is a short, fixed length representation of a recipient,
+// post-quantum and SSH recipients are too long to compare them by eye.
+// The fingerprint of an SSH key is the beginning of the fingerprint shown by ssh-keygen -l.
+func RecipientFingerprint(pubKey string) string {
+	hash := recipientHash(pubKey)
+
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(hash[:])[:fingerprintLength]
+}
+
+// RecipientFingerprintWords renders the same hash as RecipientFingerprint as words,
+// they are easier to read out than base64 e.g. to verify a key over a call.
+func RecipientFingerprintWords(pubKey string) string {
+	hash := recipientHash(pubKey)
+
+	words := make([]string, 0, fingerprintWordCount)
+	for _, b := range hash[:fingerprintWordCount] {
+		words = append(words, fingerprintWords[b])
+	}
+
+	return strings.Join(words, " ")
+}
+
+// recipientHash hashes the canonical form of the recipient,
+// SSH keys are hashed in their wire format like ssh-keygen does i.e. independent of their comment.
+func recipientHash(pubKey string) [sha256.Size]byte {
+	pubKey = strings.TrimSpace(pubKey)
+	if key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(pubKey)); err == nil {
+		return sha256.Sum256(key.Marshal())
+	}
+
+	return sha256.Sum256([]byte(strings.ToLower(pubKey)))
+}
@@ -0,0 +1,109 @@
+package infrastructure_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/plugin"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/prskr/git-age/infrastructure"
+	"github.com/prskr/git-age/internal/testx"
+)
+
+func TestInspectRecipients(t *testing.T) {
+	t.Parallel()
+
+	x25519 := testx.ResultOf(t, age.GenerateX25519Identity).Recipient().String()
+	hybrid := testx.ResultOf(t, age.GenerateHybridIdentity).Recipient().String()
+	pluginRecipient := testx.ResultOfA[string](t, plugin.EncodeRecipient, "yubikey", []byte("not a real yubikey"))
+
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ed25519 key: %v", err)
+	}
+
+	sshKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(testx.ResultOfA[ssh.PublicKey](t, ssh.NewPublicKey, pub))))
+
+	raw := strings.Join([]string{
+		"# Alice",
+		x25519,
+		"# Bob (post-quantum)",
+		hybrid,
+		sshKey,
+		pluginRecipient,
+		"garbage",
+		"# Alice again",
+		x25519,
+	}, "\n")
+
+	want := []struct {
+		recipientType infrastructure.RecipientType
+		comment       string
+		duplicateOf   int
+	}{
+		{recipientType: infrastructure.RecipientTypeX25519, comment: "Alice"},
+		{recipientType: infrastructure.RecipientTypeHybrid, comment: "Bob (post-quantum)"},
+		{recipientType: infrastructure.RecipientTypeSSH},
+		{recipientType: infrastructure.RecipientTypePlugin},
+		{recipientType: infrastructure.RecipientTypeInvalid},
+		{recipientType: infrastructure.RecipientTypeX25519, comment: "Alice again", duplicateOf: 2},
+	}
+
+	got := infrastructure.InspectRecipients([]byte(raw))
+	if len(got) != len(want) {
+		t.Fatalf("InspectRecipients() returned %d recipients, want %d: %+v", len(got), len(want), got)
+	}
+
+	for idx, w := range want {
+		if got[idx].Type != w.recipientType || got[idx].Comment != w.comment || got[idx].DuplicateOf != w.duplicateOf {
+			t.Errorf("InspectRecipients()[%d] = %+v, want %+v", idx, got[idx], w)
+		}
+
+		if hasFingerprint := got[idx].Fingerprint != ""; hasFingerprint != (w.recipientType != infrastructure.RecipientTypeInvalid) {
+			t.Errorf("InspectRecipients()[%d] unexpected fingerprint %q", idx, got[idx].Fingerprint)
+		}
+
+		if words := strings.Fields(got[idx].FingerprintWords); got[idx].Fingerprint != "" && len(words) != 6 {
+			t.Errorf("InspectRecipients()[%d] expected 6 fingerprint words, got %q", idx, got[idx].FingerprintWords)
+		}
+	}
+
+	if got[0].Fingerprint != got[5].Fingerprint || got[0].FingerprintWords != got[5].FingerprintWords {
+		t.Errorf("expected duplicates to have the same fingerprint")
+	}
+
+	if got[0].FingerprintWords == got[1].FingerprintWords {
+		t.Errorf("expected different recipients to have different fingerprint words")
+	}
+}
+
+func TestRecipientFingerprint_SSHComment(t *testing.T) {
+	t.Parallel()
+
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate ed25519 key: %v", err)
+	}
+
+	sshKey := testx.ResultOfA[ssh.PublicKey](t, ssh.NewPublicKey, pub)
+	plain := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshKey)))
+
+	for _, pubKey := range []string{plain + " jane@laptop", plain + " jane@desktop", plain + "\n"} {
+		if got, want := infrastructure.RecipientFingerprint(pubKey), infrastructure.RecipientFingerprint(plain); got != want {
+			t.Errorf("RecipientFingerprint(%q) = %s, want %s", pubKey, got, want)
+		}
+
+		if got, want := infrastructure.RecipientFingerprintWords(pubKey), infrastructure.RecipientFingerprintWords(plain); got != want {
+			t.Errorf("RecipientFingerprintWords(%q) = %s, want %s", pubKey, got, want)
+		}
+	}
+
+	// the fingerprint is the beginning of the one ssh-keygen -l shows
+	if fingerprint := infrastructure.RecipientFingerprint(plain); !strings.HasPrefix(ssh.FingerprintSHA256(sshKey), fingerprint) {
+		t.Errorf("expected %s to be a prefix of %s", fingerprint, ssh.FingerprintSHA256(sshKey))
+	}
+}
@@ -0,0 +1,177 @@
+package infrastructure
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"github.com/prskr/git-age/core/ports"
+)
+
+// RecipientsChange is a commit that changed the recipients file.
+type RecipientsChange struct {
+	Commit  string           `json:"commit"`
+	Author  string           `json:"author"`
+	Date    time.Time        `json:"date"`
+	Message string           `json:"message"`
+	Added   []RecipientEntry `json:"added,omitempty"`
+	Removed []RecipientEntry `json:"removed,omitempty"`
+}
+
+// RecipientsLog returns all commits reachable from HEAD that changed the recipients file, newest first.
+// Like git log, merges are only listed if the recipients file differs from all of their parents.
+func (g GitRepository) RecipientsLog() ([]RecipientsChange, error) {
+	head, err := g.Repository.Head()
+	if err != nil {
+		if errors.Is(err, plumbing.ErrReferenceNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	commits, err := g.Repository.Log(&git.LogOptions{From: head.Hash(), Order: git.LogOrderCommitterTime})
+	if err != nil {
+		return nil, fmt.Errorf("failed to walk history: %w", err)
+	}
+
+	defer commits.Close()
+
+	var changes []RecipientsChange
+
+	err = commits.ForEach(func(commit *object.Commit) error {
+		change, changed, err := recipientsChangeOf(commit)
+		if err != nil {
+			return fmt.Errorf("commit %s: %w", commit.Hash, err)
+		}
+
+		if changed {
+			changes = append(changes, change)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+// RecipientsAt returns the recipients that were effective at the given revision, e.g. a commit, tag or HEAD~3.
+func (g GitRepository) RecipientsAt(rev string) ([]RecipientEntry, error) {
+	raw, err := g.RecipientsFileAt(rev)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseRecipientEntries(raw), nil
+}
+
+// RecipientsFileAt returns the content of the recipients file at the given revision, nil if it did not exist.
+func (g GitRepository) RecipientsFileAt(rev string) ([]byte, error) {
+	hash, err := g.Repository.ResolveRevision(plumbing.Revision(rev))
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve revision %s: %w", rev, err)
+	}
+
+	commit, err := g.Repository.CommitObject(*hash)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, _, err := recipientsFileAt(commit)
+
+	return raw, err
+}
+
+func recipientsChangeOf(commit *object.Commit) (RecipientsChange, bool, error) {
+	raw, hash, err := recipientsFileAt(commit)
+	if err != nil {
+		return RecipientsChange{}, false, err
+	}
+
+	var parentRaw []byte
+
+	for idx := range commit.NumParents() {
+		parent, err := commit.Parent(idx)
+		if err != nil {
+			return RecipientsChange{}, false, err
+		}
+
+		current, parentHash, err := recipientsFileAt(parent)
+		if err != nil {
+			return RecipientsChange{}, false, err
+		}
+
+		if parentHash == hash {
+			return RecipientsChange{}, false, nil
+		}
+
+		// merges are compared to their first parent
+		if idx == 0 {
+			parentRaw = current
+		}
+	}
+
+	added, removed := diffRecipients(ParseRecipientEntries(parentRaw), ParseRecipientEntries(raw))
+	if len(added) == 0 && len(removed) == 0 {
+		// e.g. only comments changed
+		return RecipientsChange{}, false, nil
+	}
+
+	return RecipientsChange{
+		Commit:  commit.Hash.String(),
+		Author:  fmt.Sprintf("%s <%s>", commit.Author.Name, commit.Author.Email),
+		Date:    commit.Author.When,
+		Message: strings.TrimSpace(strings.SplitN(commit.Message, "\n", 2)[0]),
+		Added:   added,
+		Removed: removed,
+	}, true, nil
+}
+
+// recipientsFileAt returns the content and blob hash of the recipients file in the given commit,
+// the zero hash if it does not exist.
+func recipientsFileAt(commit *object.Commit) ([]byte, plumbing.Hash, error) {
+	file, err := commit.File(ports.RecipientsFileName)
+	if err != nil {
+		if errors.Is(err, object.ErrFileNotFound) {
+			return nil, plumbing.ZeroHash, nil
+		}
+		return nil, plumbing.ZeroHash, err
+	}
+
+	content, err := file.Contents()
+	if err != nil {
+		return nil, plumbing.ZeroHash, err
+	}
+
+	return []byte(content), file.Hash, nil
+}
+
+func diffRecipients(before, after []RecipientEntry) (added, removed []RecipientEntry) {
+	for _, entry := range after {
+		if !slices.ContainsFunc(before, samePublicKey(entry)) {
+			added = append(added, entry)
+		}
+	}
+
+	for _, entry := range before {
+		if !slices.ContainsFunc(after, samePublicKey(entry)) {
+			removed = append(removed, entry)
+		}
+	}
+
+	return added, removed
+}
+
+func samePublicKey(entry RecipientEntry) func(RecipientEntry) bool {
+	return func(other RecipientEntry) bool {
+		return other.PublicKey == entry.PublicKey
+	}
+}
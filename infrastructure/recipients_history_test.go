@@ -0,0 +1,86 @@
+package infrastructure_test
+
+import (
+	"testing"
+	"time"
+
+	"filippo.io/age"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/object"
+
+	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/infrastructure"
+	"github.com/prskr/git-age/internal/fsx"
+	"github.com/prskr/git-age/internal/testx"
+)
+
+func TestGitRepository_RecipientsLog(t *testing.T) {
+	t.Parallel()
+
+	root, repo := prepareTestRepo(t)
+	repoFS := infrastructure.NewReadWriteDirFS(root)
+	g := testx.ResultOfA[*infrastructure.GitRepository](t, infrastructure.NewGitRepository, repoFS, repo)
+
+	alice := testx.ResultOf(t, age.GenerateX25519Identity).Recipient().String()
+	bob := testx.ResultOf(t, age.GenerateX25519Identity).Recipient().String()
+	carol := testx.ResultOf(t, age.GenerateX25519Identity).Recipient().String()
+
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	commitRecipients := func(content, message, author string, offset time.Duration) {
+		t.Helper()
+
+		if err := fsx.WriteTo(repoFS, ports.RecipientsFileName, []byte(content)); err != nil {
+			t.Fatalf("failed to write recipients file: %v", err)
+		}
+
+		testx.ResultOfA[plumbing.Hash](t, g.Worktree.Add, ports.RecipientsFileName)
+		testx.ResultOfA[plumbing.Hash](t, g.Worktree.Commit, message, &git.CommitOptions{
+			Author: &object.Signature{Name: author, Email: "ci@git-age.io", When: start.Add(offset)},
+		})
+	}
+
+	commitRecipients("# Alice\n"+alice+"\n# Bob\n"+bob+"\n", "chore: init", "Alice", time.Hour)
+	commitRecipients("# Alice\n"+alice+"\n# Carol\n"+carol+"\n", "chore: replace Bob by Carol", "Alice", 2*time.Hour)
+	commitRecipients("# Alice (ops)\n"+alice+"\n# Carol\n"+carol+"\n", "docs: rename", "Carol", 3*time.Hour)
+
+	changes, err := g.RecipientsLog()
+	if err != nil {
+		t.Fatalf("RecipientsLog() error = %v", err)
+	}
+
+	if len(changes) != 2 {
+		t.Fatalf("RecipientsLog() returned %d changes, want 2: %+v", len(changes), changes)
+	}
+
+	latest := changes[0]
+	if latest.Message != "chore: replace Bob by Carol" || latest.Author != "Alice <ci@git-age.io>" {
+		t.Errorf("unexpected latest change %+v", latest)
+	}
+
+	if len(latest.Added) != 1 || latest.Added[0].PublicKey != carol || latest.Added[0].Comment != "Carol" {
+		t.Errorf("expected Carol to be added, got %+v", latest.Added)
+	}
+
+	if len(latest.Removed) != 1 || latest.Removed[0].PublicKey != bob || latest.Removed[0].Comment != "Bob" {
+		t.Errorf("expected Bob to be removed, got %+v", latest.Removed)
+	}
+
+	if initial := changes[1]; len(initial.Added) != 2 || len(initial.Removed) != 0 {
+		t.Errorf("expected Alice and Bob to be added initially, got %+v", initial)
+	}
+
+	recipients, err := g.RecipientsAt("HEAD~2")
+	if err != nil {
+		t.Fatalf("RecipientsAt() error = %v", err)
+	}
+
+	if len(recipients) != 2 || recipients[0].PublicKey != alice || recipients[1].PublicKey != bob {
+		t.Errorf("RecipientsAt(HEAD~2) = %+v, want Alice and Bob", recipients)
+	}
+
+	if recipients, err := g.RecipientsAt("HEAD~3"); err != nil || len(recipients) != 0 {
+		t.Errorf("RecipientsAt(HEAD~3) = %+v, %v, want no recipients", recipients, err)
+	}
+}
@@ -0,0 +1,335 @@
+package infrastructure
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/prskr/git-age/core/ports"
+)
+
+const reEncryptMarkerFileName = "reencrypt-needed"
+
+// RecipientsMerge is the result of a three-way merge of the recipients file.
+type RecipientsMerge struct {
+	Result []byte
+	// Conflicts describe recipients that were removed on one side but changed on the other
+	// or changed differently on both sides, the merged file keeps them until they are resolved manually
+	Conflicts []string
+	// ReEncrypt is set if the merged recipients differ from the recipients of either side,
+	// the files of that side are encrypted for other recipients than the merged ones
+	ReEncrypt bool
+}
+
+// recipientBlock is a part of the recipients file, either a recipient with the comments directly preceding it,
+// a section header or lines not attached to any recipient like blank lines.
+type recipientBlock struct {
+	Lines []string
+	Entry *RecipientEntry
+	// Key identifies the recipient within its section independent of its notation e.g. the comment of an SSH key
+	Key string
+	// Ref is the ref pattern of the section the block belongs to
+	Ref    string
+	Header bool
+}
+
+// MergeRecipients merges two versions of the recipients file with their common ancestor like a union merge.
+// Recipients are compared by their parsed keys, the comments attached to every recipient are kept.
+// Recipients removed on one side are removed unless the other side changed their comments or expiry date.
+func MergeRecipients(base, ours, theirs []byte) RecipientsMerge {
+	var (
+		baseBlocks   = recipientBlocks(base)
+		oursBlocks   = recipientBlocks(ours)
+		theirsBlocks = recipientBlocks(theirs)
+		baseByKey    = blocksByKey(baseBlocks)
+		oursByKey    = blocksByKey(oursBlocks)
+		theirsByKey  = blocksByKey(theirsBlocks)
+		merged       []recipientBlock
+		emitted      = make(map[string]bool)
+		conflicts    []string
+	)
+
+	keep := func(block recipientBlock) {
+		emitted[block.Key] = true
+		merged = append(merged, block)
+	}
+
+	for _, block := range oursBlocks {
+		if block.Entry == nil {
+			merged = append(merged, block)
+			continue
+		}
+
+		if emitted[block.Key] {
+			continue
+		}
+
+		baseBlock, inBase := baseByKey[block.Key]
+		theirsBlock, inTheirs := theirsByKey[block.Key]
+
+		switch {
+		case !inBase:
+			keep(block)
+		case !inTheirs:
+			if entryChanged(baseBlock, block) {
+				conflicts = append(conflicts, fmt.Sprintf("%s was removed by theirs but changed by ours", formatBlock(block)))
+				keep(block)
+			}
+		case !entryChanged(baseBlock, block) && entryChanged(baseBlock, theirsBlock):
+			keep(theirsBlock)
+		case entryChanged(baseBlock, block) && entryChanged(baseBlock, theirsBlock) && entryChanged(block, theirsBlock):
+			conflicts = append(conflicts, fmt.Sprintf("%s was changed differently by ours and theirs", formatBlock(block)))
+			keep(block)
+		default:
+			keep(block)
+		}
+	}
+
+	for _, block := range theirsBlocks {
+		if block.Entry == nil || emitted[block.Key] {
+			continue
+		}
+
+		if _, removedByOurs := oursByKey[block.Key]; !removedByOurs {
+			if baseBlock, inBase := baseByKey[block.Key]; inBase {
+				if entryChanged(baseBlock, block) {
+					conflicts = append(conflicts, fmt.Sprintf("%s was removed by ours but changed by theirs", formatBlock(block)))
+					emitted[block.Key] = true
+					merged = insertIntoSection(merged, block)
+				}
+				continue
+			}
+		}
+
+		emitted[block.Key] = true
+		merged = insertIntoSection(merged, block)
+	}
+
+	mergedKeys := blockKeys(merged)
+
+	return RecipientsMerge{
+		Result:    joinBlocks(merged),
+		Conflicts: conflicts,
+		ReEncrypt: !slices.Equal(mergedKeys, blockKeys(oursBlocks)) || !slices.Equal(mergedKeys, blockKeys(theirsBlocks)),
+	}
+}
+
+func recipientBlocks(raw []byte) []recipientBlock {
+	var (
+		blocks  []recipientBlock
+		pending []string
+		entries = ParseRecipientEntries(raw)
+		lines   = strings.Split(strings.TrimSuffix(string(raw), "\n"), "\n")
+	)
+
+	if len(raw) == 0 {
+		return nil
+	}
+
+	var ref string
+
+	for idx, line := range lines {
+		switch trimmed := strings.TrimSpace(line); {
+		case strings.HasPrefix(trimmed, "#"):
+			pending = append(pending, line)
+		case trimmed == "":
+			blocks = append(blocks, recipientBlock{Lines: append(pending, line), Ref: ref})
+			pending = nil
+		case isRecipientsSection(trimmed):
+			ref = sectionRef(trimmed)
+			blocks = append(blocks, recipientBlock{Lines: append(pending, line), Ref: ref, Header: true})
+			pending = nil
+		default:
+			entryIdx := slices.IndexFunc(entries, func(entry RecipientEntry) bool {
+				return entry.Line == idx+1
+			})
+
+			entry := entries[entryIdx]
+			blocks = append(blocks, recipientBlock{
+				Lines: append(pending, line),
+				Entry: &entry,
+				Key:   entry.Ref + " " + recipientKey(entry.PublicKey),
+				Ref:   entry.Ref,
+			})
+			pending = nil
+		}
+	}
+
+	if len(pending) > 0 {
+		blocks = append(blocks, recipientBlock{Lines: pending, Ref: ref})
+	}
+
+	return blocks
+}
+
+// recipientKey normalizes the notation of a recipient, age keys are case-insensitive
+// and SSH keys may have different comments.
+func recipientKey(pubKey string) string {
+	if _, recipientType, err := ParseRecipient(pubKey); err == nil && recipientType == RecipientTypeSSH {
+		if key, _, _, _, err := ssh.ParseAuthorizedKey([]byte(pubKey)); err == nil {
+			return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(key)))
+		}
+	}
+
+	return strings.ToLower(pubKey)
+}
+
+// insertIntoSection adds the block after the last recipient of its section,
+// a section that is missing so far is added at the end.
+func insertIntoSection(merged []recipientBlock, block recipientBlock) []recipientBlock {
+	last := slices.IndexFunc(merged, func(candidate recipientBlock) bool {
+		return candidate.Header && candidate.Ref != ""
+	})
+
+	if block.Ref == "" {
+		if last < 0 {
+			last = len(merged)
+		}
+
+		// skip the blank lines before the first section
+		for last > 0 && merged[last-1].Entry == nil && !merged[last-1].Header {
+			last--
+		}
+
+		return slices.Insert(merged, last, block)
+	}
+
+	last = -1
+	for idx, candidate := range merged {
+		if candidate.Ref == block.Ref && (candidate.Entry != nil || candidate.Header) {
+			last = idx
+		}
+	}
+
+	if last < 0 {
+		header := recipientBlock{Lines: []string{fmt.Sprintf("[%s]", block.Ref)}, Ref: block.Ref, Header: true}
+		if len(merged) > 0 {
+			header.Lines = append([]string{""}, header.Lines...)
+		}
+
+		return append(merged, header, block)
+	}
+
+	return slices.Insert(merged, last+1, block)
+}
+
+// SameRecipients compares two sets of recipients by their parsed keys, ignoring the order, comments and sections.
+func SameRecipients(a, b []RecipientEntry) bool {
+	keysOf := func(entries []RecipientEntry) []string {
+		keys := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			keys = append(keys, recipientKey(entry.PublicKey))
+		}
+
+		slices.Sort(keys)
+
+		return slices.Compact(keys)
+	}
+
+	return slices.Equal(keysOf(a), keysOf(b))
+}
+
+func blocksByKey(blocks []recipientBlock) map[string]recipientBlock {
+	byKey := make(map[string]recipientBlock, len(blocks))
+
+	for _, block := range blocks {
+		if _, ok := byKey[block.Key]; block.Entry != nil && !ok {
+			byKey[block.Key] = block
+		}
+	}
+
+	return byKey
+}
+
+// blockKeys returns the sorted keys of all recipients.
+func blockKeys(blocks []recipientBlock) []string {
+	keys := make([]string, 0, len(blocks))
+
+	for _, block := range blocks {
+		if block.Entry != nil && !slices.Contains(keys, block.Key) {
+			keys = append(keys, block.Key)
+		}
+	}
+
+	slices.Sort(keys)
+
+	return keys
+}
+
+func entryChanged(a, b recipientBlock) bool {
+	return a.Entry.Comment != b.Entry.Comment || !a.Entry.Expires.Equal(b.Entry.Expires)
+}
+
+func formatBlock(block recipientBlock) string {
+	formatted := block.Entry.PublicKey
+	if block.Entry.Comment != "" {
+		formatted = fmt.Sprintf("%s (%s)", formatted, block.Entry.Comment)
+	}
+
+	if block.Ref != "" {
+		formatted = fmt.Sprintf("%s in [%s]", formatted, block.Ref)
+	}
+
+	return formatted
+}
+
+func joinBlocks(blocks []recipientBlock) []byte {
+	var lines []string
+	for _, block := range blocks {
+		lines = append(lines, block.Lines...)
+	}
+
+	if len(lines) == 0 {
+		return nil
+	}
+
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
+
+func NewReEncryptMarker(cwd ports.CWD) (*ReEncryptMarker, error) {
+	gitDir, _, err := gitDirs(cwd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate git directory: %w", err)
+	}
+
+	return &ReEncryptMarker{Path: filepath.Join(gitDir, "git-age", reEncryptMarkerFileName)}, nil
+}
+
+// ReEncryptMarker flags that a merge changed the recipients and the files have to be re-encrypted.
+// It is kept in the git directory of the worktree as it only concerns the local merge.
+type ReEncryptMarker struct {
+	Path string
+}
+
+// Set flags the worktree, the reason is shown until the files were re-encrypted.
+func (m ReEncryptMarker) Set(reason string) error {
+	if err := os.MkdirAll(filepath.Dir(m.Path), 0o700); err != nil {
+		return err
+	}
+
+	return os.WriteFile(m.Path, []byte(reason+"\n"), 0o600)
+}
+
+// Reason returns why the files have to be re-encrypted or an empty string if they don't.
+func (m ReEncryptMarker) Reason() (string, error) {
+	raw, err := os.ReadFile(m.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+
+	return strings.TrimSpace(string(raw)), err
+}
+
+func (m ReEncryptMarker) Clear() error {
+	if err := os.Remove(m.Path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	return nil
+}
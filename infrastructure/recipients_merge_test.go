@@ -0,0 +1,203 @@
+package infrastructure_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/prskr/git-age/infrastructure"
+)
+
+func TestMergeRecipients(t *testing.T) {
+	t.Parallel()
+
+	alice, bob, carol, dave := newTestRecipient(t), newTestRecipient(t), newTestRecipient(t), newTestRecipient(t)
+
+	edPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate SSH key: %v", err)
+	}
+
+	sshPub, err := ssh.NewPublicKey(edPub)
+	if err != nil {
+		t.Fatalf("failed to convert SSH key: %v", err)
+	}
+
+	sshKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshPub)))
+
+	tests := []struct {
+		name          string
+		base          []string
+		ours          []string
+		theirs        []string
+		want          []string
+		wantConflicts int
+		wantReEncrypt bool
+	}{
+		{
+			name:   "Unchanged",
+			base:   []string{"# alice", alice},
+			ours:   []string{"# alice", alice},
+			theirs: []string{"# alice", alice},
+			want:   []string{"# alice", alice},
+		},
+		{
+			name:          "Both sides add a recipient",
+			base:          []string{"# alice", alice},
+			ours:          []string{"# alice", alice, "# bob", bob},
+			theirs:        []string{"# alice", alice, "# carol", carol},
+			want:          []string{"# alice", alice, "# bob", bob, "# carol", carol},
+			wantReEncrypt: true,
+		},
+		{
+			name:   "Both sides add the same recipient",
+			base:   []string{alice},
+			ours:   []string{alice, "# bob", bob},
+			theirs: []string{alice, "# bob on laptop", strings.ToUpper(bob)},
+			want:   []string{alice, "# bob", bob},
+		},
+		{
+			name:   "SSH keys are compared without their comment",
+			base:   []string{alice},
+			ours:   []string{alice, sshKey + " bob@laptop"},
+			theirs: []string{alice, sshKey + " bob@desktop"},
+			want:   []string{alice, sshKey + " bob@laptop"},
+		},
+		{
+			name:          "Removal on one side",
+			base:          []string{"# alice", alice, "# bob", bob},
+			ours:          []string{"# alice", alice, "# bob", bob, "# carol", carol},
+			theirs:        []string{"# alice", alice},
+			want:          []string{"# alice", alice, "# carol", carol},
+			wantReEncrypt: true,
+		},
+		{
+			name:   "Comment changed on one side",
+			base:   []string{"# alice", alice},
+			ours:   []string{"# alice", alice},
+			theirs: []string{"# alice", "# expires: 2030-01-01", alice},
+			want:   []string{"# alice", "# expires: 2030-01-01", alice},
+		},
+		{
+			name:          "Removed by theirs but changed by ours",
+			base:          []string{alice, "# bob", bob},
+			ours:          []string{alice, "# bob", "# expires: 2030-01-01", bob},
+			theirs:        []string{alice},
+			want:          []string{alice, "# bob", "# expires: 2030-01-01", bob},
+			wantConflicts: 1,
+			wantReEncrypt: true,
+		},
+		{
+			name:          "Removed by ours but changed by theirs",
+			base:          []string{alice, "# bob", bob},
+			ours:          []string{alice},
+			theirs:        []string{alice, "# bob (ops)", bob},
+			want:          []string{alice, "# bob (ops)", bob},
+			wantConflicts: 1,
+			wantReEncrypt: true,
+		},
+		{
+			name:          "Both sides add to different sections",
+			base:          []string{alice, "", "[refs/heads/main]", bob},
+			ours:          []string{alice, carol, "", "[refs/heads/main]", bob},
+			theirs:        []string{alice, "", "[refs/heads/main]", bob, dave},
+			want:          []string{alice, carol, "", "[refs/heads/main]", bob, dave},
+			wantReEncrypt: true,
+		},
+		{
+			name:          "Section added by theirs",
+			base:          []string{alice},
+			ours:          []string{alice, carol},
+			theirs:        []string{alice, "", "[refs/heads/main]", bob},
+			want:          []string{alice, carol, "", "[refs/heads/main]", bob},
+			wantReEncrypt: true,
+		},
+		{
+			name:          "Same recipient in different sections",
+			base:          []string{alice},
+			ours:          []string{alice, "", "[refs/heads/main]", alice},
+			theirs:        []string{alice},
+			want:          []string{alice, "", "[refs/heads/main]", alice},
+			wantReEncrypt: true,
+		},
+		{
+			name:          "Changed differently on both sides",
+			base:          []string{"# alice", alice},
+			ours:          []string{"# alice (dev)", alice},
+			theirs:        []string{"# alice (ops)", alice},
+			want:          []string{"# alice (dev)", alice},
+			wantConflicts: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			got := infrastructure.MergeRecipients(recipientsLines(tt.base), recipientsLines(tt.ours), recipientsLines(tt.theirs))
+
+			if want := string(recipientsLines(tt.want)); string(got.Result) != want {
+				t.Errorf("MergeRecipients() result = %q, want %q", got.Result, want)
+			}
+
+			if len(got.Conflicts) != tt.wantConflicts {
+				t.Errorf("MergeRecipients() conflicts = %v, want %d", got.Conflicts, tt.wantConflicts)
+			}
+
+			if got.ReEncrypt != tt.wantReEncrypt {
+				t.Errorf("MergeRecipients() re-encrypt = %t, want %t", got.ReEncrypt, tt.wantReEncrypt)
+			}
+		})
+	}
+}
+
+func TestReEncryptMarker(t *testing.T) {
+	t.Parallel()
+
+	marker := infrastructure.ReEncryptMarker{Path: t.TempDir() + "/git-age/reencrypt-needed"}
+
+	if reason, err := marker.Reason(); err != nil || reason != "" {
+		t.Fatalf("Reason() = %q, %v, want no reason", reason, err)
+	}
+
+	if err := marker.Set("recipients changed"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	if reason, err := marker.Reason(); err != nil || reason != "recipients changed" {
+		t.Fatalf("Reason() = %q, %v, want recipients changed", reason, err)
+	}
+
+	for range 2 {
+		if err := marker.Clear(); err != nil {
+			t.Fatalf("Clear() error = %v", err)
+		}
+	}
+
+	if reason, err := marker.Reason(); err != nil || reason != "" {
+		t.Fatalf("Reason() = %q, %v, want no reason after clear", reason, err)
+	}
+}
+
+func newTestRecipient(tb testing.TB) string {
+	tb.Helper()
+
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		tb.Fatalf("failed to create age identity: %v", err)
+	}
+
+	return id.Recipient().String()
+}
+
+func recipientsLines(lines []string) []byte {
+	if len(lines) == 0 {
+		return nil
+	}
+
+	return []byte(strings.Join(lines, "\n") + "\n")
+}
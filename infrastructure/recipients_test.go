@@ -1,10 +1,21 @@
 package infrastructure_test
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
 	"strings"
 	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
 
 	"github.com/prskr/git-age/internal/fsx"
+	"github.com/prskr/git-age/internal/testx"
 
 	"filippo.io/age"
 
@@ -92,3 +103,564 @@ func TestRecipientsFile_All(t *testing.T) {
 		})
 	}
 }
+
+func TestRecipientsFile_Remove(t *testing.T) {
+	t.Parallel()
+
+	tfs := infrastructure.NewReadWriteDirFS(t.TempDir())
+	r := infrastructure.NewRecipientsFile(tfs)
+
+	publicKeys := make([]string, 0, 3)
+	for i := range 3 {
+		id, err := age.GenerateX25519Identity()
+		if err != nil {
+			t.Fatalf("failed to create age identity: %v", err)
+		}
+
+		publicKeys = append(publicKeys, id.Recipient().String())
+		if _, err := r.Append(id.Recipient().String(), fmt.Sprintf("recipient %d", i)); err != nil {
+			t.Fatalf("failed to append recipient: %v", err)
+		}
+	}
+
+	if err := r.Remove(publicKeys[1]); err != nil {
+		t.Errorf("Remove() error = %v", err)
+		return
+	}
+
+	raw, err := fs.ReadFile(tfs, ports.RecipientsFileName)
+	if err != nil {
+		t.Fatalf("failed to read recipients file: %v", err)
+	}
+
+	if strings.Contains(string(raw), publicKeys[1]) || strings.Contains(string(raw), "recipient 1") {
+		t.Errorf("expected recipient and its comment to be removed, got %s", raw)
+	}
+
+	got, err := r.All()
+	if err != nil {
+		t.Errorf("All() error = %v", err)
+		return
+	}
+
+	if len(got) != 2 {
+		t.Errorf("All() got = %v, want %v", len(got), 2)
+	}
+}
+
+func TestRecipientsFile_Passphrase(t *testing.T) {
+	t.Parallel()
+
+	id, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("failed to create age identity: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		content    string
+		passphrase string
+		append     string
+		wantErr    error
+		wantScrypt bool
+	}{
+		{
+			name:    "Passphrase required",
+			content: "# shared\nscrypt\n",
+			wantErr: infrastructure.ErrPassphraseRequired,
+		},
+		{
+			name:       "Passphrase recipient",
+			content:    "# shared\nscrypt\n",
+			passphrase: "correct horse battery staple",
+			wantScrypt: true,
+		},
+		{
+			name:       "Mixed with other recipients",
+			content:    "scrypt\n" + id.Recipient().String() + "\n",
+			passphrase: "correct horse battery staple",
+			wantErr:    infrastructure.ErrMixedPassphraseRecipients,
+		},
+		{
+			name:       "Append key to passphrase protected repository",
+			content:    "scrypt\n",
+			passphrase: "correct horse battery staple",
+			append:     id.Recipient().String(),
+			wantErr:    infrastructure.ErrMixedPassphraseRecipients,
+		},
+		{
+			name:    "Append passphrase to repository with recipients",
+			content: id.Recipient().String() + "\n",
+			append:  ports.PassphraseRecipient,
+			wantErr: infrastructure.ErrMixedPassphraseRecipients,
+		},
+		{
+			name:       "Append passphrase to empty repository",
+			passphrase: "correct horse battery staple",
+			append:     ports.PassphraseRecipient,
+			wantScrypt: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tfs := infrastructure.NewReadWriteDirFS(t.TempDir())
+			if tt.content != "" {
+				if err := fsx.WriteTo(tfs, ports.RecipientsFileName, []byte(tt.content)); err != nil {
+					t.Fatalf("failed to write recipients file: %v", err)
+				}
+			}
+
+			r := infrastructure.NewRecipientsFile(tfs)
+			r.Passphrase = tt.passphrase
+
+			var (
+				got []age.Recipient
+				err error
+			)
+
+			if tt.append != "" {
+				got, err = r.Append(tt.append, "")
+			} else {
+				got, err = r.All()
+			}
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantScrypt {
+				return
+			}
+
+			if len(got) != 1 {
+				t.Fatalf("expected a single recipient, got %d", len(got))
+			}
+
+			if _, ok := got[0].(*age.ScryptRecipient); !ok {
+				t.Errorf("expected scrypt recipient, got %T", got[0])
+			}
+		})
+	}
+}
+
+func TestRecipientsFile_Verify(t *testing.T) {
+	t.Parallel()
+
+	maintainer := newTestSSHSigner(t)
+	attacker := newTestSSHSigner(t)
+	recipient := testx.ResultOf(t, age.GenerateX25519Identity).Recipient().String()
+
+	tests := []struct {
+		name     string
+		pinned   []ssh.Signer
+		signer   ssh.Signer
+		tamper   bool
+		wantErr  error
+		wantPins int
+		// wantCheckErr is the expected error of CheckSignature if it differs from the one of Verify
+		wantCheckErr error
+	}{
+		{
+			name: "Unsigned without pins",
+		},
+		{
+			name:     "Unsigned with pins",
+			pinned:   []ssh.Signer{maintainer},
+			wantErr:  infrastructure.ErrRecipientsNotSigned,
+			wantPins: 1,
+		},
+		{
+			name:         "Trust on first use",
+			signer:       maintainer,
+			wantPins:     1,
+			wantCheckErr: infrastructure.ErrRecipientsSignerNotTrusted,
+		},
+		{
+			name:     "Signed by trusted key",
+			pinned:   []ssh.Signer{maintainer},
+			signer:   maintainer,
+			wantPins: 1,
+		},
+		{
+			name:     "Signed by untrusted key",
+			pinned:   []ssh.Signer{maintainer},
+			signer:   attacker,
+			wantErr:  infrastructure.ErrUntrustedRecipientsSigner,
+			wantPins: 1,
+		},
+		{
+			name:     "Injected recipient",
+			pinned:   []ssh.Signer{maintainer},
+			signer:   maintainer,
+			tamper:   true,
+			wantErr:  infrastructure.ErrInvalidRecipientsSignature,
+			wantPins: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			tfs := infrastructure.NewReadWriteDirFS(t.TempDir())
+			trusted := &infrastructure.TrustedSigners{Path: filepath.Join(t.TempDir(), "trusted-signers")}
+
+			for _, pinned := range tt.pinned {
+				if err := trusted.Add(pinned.PublicKey(), ""); err != nil {
+					t.Fatalf("failed to pin signer: %v", err)
+				}
+			}
+
+			// sign without pins to set up the file independent of the trusted signers under test
+			r := infrastructure.NewRecipientsFile(tfs)
+			r.SigningKey = tt.signer
+
+			if _, err := r.Append(recipient, "maintainer"); err != nil {
+				t.Fatalf("failed to append recipient: %v", err)
+			}
+
+			if tt.tamper {
+				injected := testx.ResultOf(t, age.GenerateX25519Identity).Recipient().String()
+				raw := testx.ResultOfA[[]byte](t, fs.ReadFile, tfs, ports.RecipientsFileName)
+				if err := fsx.WriteTo(tfs, ports.RecipientsFileName, append(raw, injected+"\n"...)); err != nil {
+					t.Fatalf("failed to inject recipient: %v", err)
+				}
+			}
+
+			r.TrustedSigners = trusted
+
+			wantCheckErr := tt.wantCheckErr
+			if wantCheckErr == nil {
+				wantCheckErr = tt.wantErr
+			}
+
+			if _, err := r.CheckSignature(); !errors.Is(err, wantCheckErr) {
+				t.Errorf("CheckSignature() error = %v, wantErr %v", err, wantCheckErr)
+			}
+
+			if pins := testx.ResultOf(t, trusted.All); len(pins) != len(tt.pinned) {
+				t.Errorf("expected CheckSignature() to keep %d pinned signers, got %d", len(tt.pinned), len(pins))
+			}
+
+			if err := r.Verify(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if pins := testx.ResultOf(t, trusted.All); len(pins) != tt.wantPins {
+				t.Errorf("expected %d pinned signers, got %d", tt.wantPins, len(pins))
+			}
+		})
+	}
+}
+
+func TestRecipientsFile_SigningKeyRequired(t *testing.T) {
+	t.Parallel()
+
+	tfs := infrastructure.NewReadWriteDirFS(t.TempDir())
+	trusted := &infrastructure.TrustedSigners{Path: filepath.Join(t.TempDir(), "trusted-signers")}
+
+	r := infrastructure.NewRecipientsFile(tfs)
+	r.TrustedSigners = trusted
+	r.SigningKey = newTestSSHSigner(t)
+
+	if _, err := r.Append(testx.ResultOf(t, age.GenerateX25519Identity).Recipient().String(), ""); err != nil {
+		t.Fatalf("failed to append recipient: %v", err)
+	}
+
+	r.SigningKey = nil
+	if _, err := r.Append(testx.ResultOf(t, age.GenerateX25519Identity).Recipient().String(), ""); !errors.Is(err, infrastructure.ErrSigningKeyRequired) {
+		t.Errorf("Append() error = %v, wantErr %v", err, infrastructure.ErrSigningKeyRequired)
+	}
+
+	r.SigningKey = newTestSSHSigner(t)
+	if _, err := r.Append(testx.ResultOf(t, age.GenerateX25519Identity).Recipient().String(), ""); !errors.Is(err, infrastructure.ErrUntrustedRecipientsSigner) {
+		t.Errorf("Append() error = %v, wantErr %v", err, infrastructure.ErrUntrustedRecipientsSigner)
+	}
+}
+
+func newTestSSHSigner(tb testing.TB) ssh.Signer {
+	tb.Helper()
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		tb.Fatalf("failed to generate ed25519 key: %v", err)
+	}
+
+	return testx.ResultOfA[ssh.Signer](tb, ssh.NewSignerFromSigner, key)
+}
+
+func TestParseRecipientEntries(t *testing.T) {
+	t.Parallel()
+
+	raw := "# Alice\n# ops team\nage1alice\n\n# dangling comment\n\nage1bob\n# Contractor\n# expires: 2027-01-31\nage1carol\n"
+
+	want := []infrastructure.RecipientEntry{
+		{PublicKey: "age1alice", Comment: "Alice ops team", Line: 3},
+		{PublicKey: "age1bob", Line: 7},
+		{PublicKey: "age1carol", Comment: "Contractor", Expires: time.Date(2027, 1, 31, 0, 0, 0, 0, time.UTC), Line: 10},
+	}
+
+	got := infrastructure.ParseRecipientEntries([]byte(raw))
+	if !slices.Equal(got, want) {
+		t.Errorf("ParseRecipientEntries() = %+v, want %+v", got, want)
+	}
+}
+
+func TestRecipientEntry_IsExpired(t *testing.T) {
+	t.Parallel()
+
+	entry := infrastructure.RecipientEntry{Expires: time.Date(2027, 1, 31, 0, 0, 0, 0, time.UTC)}
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want bool
+	}{
+		{name: "Day before", now: time.Date(2027, 1, 30, 23, 59, 0, 0, time.UTC)},
+		{name: "Last day", now: time.Date(2027, 1, 31, 23, 59, 0, 0, time.UTC)},
+		{name: "Day after", now: time.Date(2027, 2, 1, 0, 0, 0, 0, time.UTC), want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			if got := entry.IsExpired(tt.now); got != tt.want {
+				t.Errorf("IsExpired(%s) = %t, want %t", tt.now, got, tt.want)
+			}
+		})
+	}
+
+	if (infrastructure.RecipientEntry{}).IsExpired(time.Now()) {
+		t.Error("recipient without expiry date must not expire")
+	}
+}
+
+func TestRecipientsFile_Expiry(t *testing.T) {
+	t.Parallel()
+
+	repoFS := infrastructure.NewReadWriteDirFS(t.TempDir())
+	recipients := infrastructure.NewRecipientsFile(repoFS)
+
+	active := testx.ResultOf(t, age.GenerateX25519Identity).Recipient().String()
+	expiring := testx.ResultOf(t, age.GenerateX25519Identity).Recipient().String()
+	expired := testx.ResultOf(t, age.GenerateX25519Identity).Recipient().String()
+
+	tomorrow := time.Now().UTC().AddDate(0, 0, 1).Truncate(24 * time.Hour)
+
+	if _, err := recipients.Append(active, "Active"); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+
+	if _, err := recipients.AppendExpiring(expiring, "Expiring", tomorrow); err != nil {
+		t.Fatalf("AppendExpiring() error = %v", err)
+	}
+
+	if _, err := recipients.AppendExpiring(expired, "Expired", time.Date(2020, 1, 31, 0, 0, 0, 0, time.UTC)); err != nil {
+		t.Fatalf("AppendExpiring() error = %v", err)
+	}
+
+	all, err := recipients.All()
+	if err != nil {
+		t.Fatalf("All() error = %v", err)
+	}
+
+	if len(all) != 2 {
+		t.Errorf("All() returned %d recipients, want the 2 not expired ones", len(all))
+	}
+
+	gotExpired := testx.ResultOfA[[]infrastructure.RecipientEntry](t, recipients.Expiring, time.Now())
+	if len(gotExpired) != 1 || gotExpired[0].PublicKey != expired || gotExpired[0].Comment != "Expired" {
+		t.Errorf("Expiring(now) = %+v, want only the expired recipient", gotExpired)
+	}
+
+	gotExpiring := testx.ResultOfA[[]infrastructure.RecipientEntry](t, recipients.Expiring, time.Now().AddDate(0, 0, 7))
+	if len(gotExpiring) != 2 || gotExpiring[0].PublicKey != expiring || !gotExpiring[0].Expires.Equal(tomorrow) {
+		t.Errorf("Expiring(in a week) = %+v, want the expiring and the expired recipient", gotExpiring)
+	}
+
+	if err := recipients.Remove(expired); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+
+	raw := testx.ResultOfA[[]byte](t, fs.ReadFile, fs.FS(repoFS), ports.RecipientsFileName)
+	if strings.Contains(string(raw), "2020-01-31") {
+		t.Errorf("expected expiry annotation to be removed with the recipient, got:\n%s", raw)
+	}
+}
+
+func TestRecipientsFile_InvalidExpiry(t *testing.T) {
+	t.Parallel()
+
+	repoFS := infrastructure.NewReadWriteDirFS(t.TempDir())
+	content := "# expires: 31.01.2027\n" + testx.ResultOf(t, age.GenerateX25519Identity).Recipient().String() + "\n"
+
+	if err := fsx.WriteTo(repoFS, ports.RecipientsFileName, []byte(content)); err != nil {
+		t.Fatalf("failed to write recipients file: %v", err)
+	}
+
+	if _, err := infrastructure.NewRecipientsFile(repoFS).All(); !errors.Is(err, infrastructure.ErrInvalidRecipientExpiry) {
+		t.Errorf("All() error = %v, want %v", err, infrastructure.ErrInvalidRecipientExpiry)
+	}
+}
+
+type headRef string
+
+func (h headRef) HeadRef() (string, error) {
+	return string(h), nil
+}
+
+func TestRecipientsFile_Sections(t *testing.T) {
+	t.Parallel()
+
+	dev := testx.ResultOf(t, age.GenerateX25519Identity).Recipient().String()
+	ops := testx.ResultOf(t, age.GenerateX25519Identity).Recipient().String()
+	hybrid := testx.ResultOf(t, age.GenerateHybridIdentity).Recipient().String()
+
+	content := fmt.Sprintf("# Dev\n%s\n\n[refs/heads/main]\n# Ops\n%s\n\n[refs/heads/release/*]\n%s\n", dev, ops, hybrid)
+
+	tests := []struct {
+		name    string
+		head    ports.HeadRefResolver
+		wantRef string
+		wantKey string
+	}{
+		{name: "No resolver uses the default recipients", wantKey: dev},
+		{name: "Detached HEAD uses the default recipients", head: headRef(""), wantKey: dev},
+		{name: "Feature branch uses the default recipients", head: headRef("refs/heads/feature"), wantKey: dev},
+		{name: "Main branch", head: headRef("refs/heads/main"), wantRef: "refs/heads/main", wantKey: ops},
+		{name: "Ref pattern", head: headRef("refs/heads/release/1.0"), wantRef: "refs/heads/release/*", wantKey: hybrid},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			repoFS := infrastructure.NewReadWriteDirFS(t.TempDir())
+			if err := fsx.WriteTo(repoFS, ports.RecipientsFileName, []byte(content)); err != nil {
+				t.Fatalf("failed to write recipients file: %v", err)
+			}
+
+			recipients := infrastructure.NewRecipientsFile(repoFS)
+			recipients.Head = tt.head
+
+			if ref := testx.ResultOf(t, recipients.Ref); ref != tt.wantRef {
+				t.Errorf("Ref() = %q, want %q", ref, tt.wantRef)
+			}
+
+			active := testx.ResultOf(t, recipients.Active)
+			if len(active) != 1 || active[0].PublicKey != tt.wantKey {
+				t.Errorf("Active() = %+v, want only %s", active, tt.wantKey)
+			}
+
+			if all := testx.ResultOf(t, recipients.All); len(all) != 1 {
+				t.Errorf("All() returned %d recipients, want 1", len(all))
+			}
+
+			added := testx.ResultOf(t, age.GenerateX25519Identity).Recipient().String()
+			if tt.wantKey == hybrid {
+				added = testx.ResultOf(t, age.GenerateHybridIdentity).Recipient().String()
+			}
+
+			if _, err := recipients.Append(added, "Added"); err != nil {
+				t.Fatalf("Append() error = %v", err)
+			}
+
+			active = testx.ResultOf(t, recipients.Active)
+			if len(active) != 2 || active[1].PublicKey != added || active[1].Comment != "Added" {
+				t.Errorf("Active() after Append() = %+v, want the added recipient in the same section", active)
+			}
+
+			if entries := testx.ResultOf(t, recipients.Entries); len(entries) != 4 {
+				t.Errorf("Entries() returned %d recipients, want 4", len(entries))
+			}
+		})
+	}
+}
+
+func TestRecipientsFile_EmptySection(t *testing.T) {
+	t.Parallel()
+
+	repoFS := infrastructure.NewReadWriteDirFS(t.TempDir())
+	content := testx.ResultOf(t, age.GenerateX25519Identity).Recipient().String() + "\n\n[refs/heads/main]\n"
+
+	if err := fsx.WriteTo(repoFS, ports.RecipientsFileName, []byte(content)); err != nil {
+		t.Fatalf("failed to write recipients file: %v", err)
+	}
+
+	recipients := infrastructure.NewRecipientsFile(repoFS)
+	recipients.Head = headRef("refs/heads/main")
+
+	if ref := testx.ResultOf(t, recipients.Ref); ref != "refs/heads/main" {
+		t.Errorf("Ref() = %q, want refs/heads/main", ref)
+	}
+
+	if _, err := recipients.All(); !errors.Is(err, infrastructure.ErrNoRecipients) {
+		t.Errorf("All() error = %v, want %v", err, infrastructure.ErrNoRecipients)
+	}
+}
+
+func TestRecipientsFile_RemoveFromSection(t *testing.T) {
+	t.Parallel()
+
+	shared := testx.ResultOf(t, age.GenerateX25519Identity).Recipient().String()
+	dev := testx.ResultOf(t, age.GenerateX25519Identity).Recipient().String()
+	ops := testx.ResultOf(t, age.GenerateX25519Identity).Recipient().String()
+
+	content := fmt.Sprintf("# Shared\n%s\n%s\n\n[refs/heads/main]\n# Shared\n%s\n%s\n", shared, dev, shared, ops)
+
+	tests := []struct {
+		name        string
+		head        ports.HeadRefResolver
+		wantDefault []string
+		wantMain    []string
+	}{
+		{name: "Default recipients", head: headRef("refs/heads/feature"), wantDefault: []string{dev}, wantMain: []string{shared, ops}},
+		{name: "Main branch", head: headRef("refs/heads/main"), wantDefault: []string{shared, dev}, wantMain: []string{ops}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			repoFS := infrastructure.NewReadWriteDirFS(t.TempDir())
+			if err := fsx.WriteTo(repoFS, ports.RecipientsFileName, []byte(content)); err != nil {
+				t.Fatalf("failed to write recipients file: %v", err)
+			}
+
+			recipients := infrastructure.NewRecipientsFile(repoFS)
+			recipients.Head = tt.head
+
+			if err := recipients.Remove(shared); err != nil {
+				t.Fatalf("Remove() error = %v", err)
+			}
+
+			got := map[string][]string{}
+			for _, entry := range testx.ResultOf(t, recipients.Entries) {
+				got[entry.Ref] = append(got[entry.Ref], entry.PublicKey)
+			}
+
+			if !slices.Equal(got[""], tt.wantDefault) || !slices.Equal(got["refs/heads/main"], tt.wantMain) {
+				t.Errorf("Remove() left %v, want default %v and main %v", got, tt.wantDefault, tt.wantMain)
+			}
+		})
+	}
+}
+
+func TestRecipientsFile_InvalidSection(t *testing.T) {
+	t.Parallel()
+
+	repoFS := infrastructure.NewReadWriteDirFS(t.TempDir())
+	content := "[refs/heads/[main]\n" + testx.ResultOf(t, age.GenerateX25519Identity).Recipient().String() + "\n"
+
+	if err := fsx.WriteTo(repoFS, ports.RecipientsFileName, []byte(content)); err != nil {
+		t.Fatalf("failed to write recipients file: %v", err)
+	}
+
+	if _, err := infrastructure.NewRecipientsFile(repoFS).All(); !errors.Is(err, infrastructure.ErrInvalidRecipientsSection) {
+		t.Errorf("All() error = %v, want %v", err, infrastructure.ErrInvalidRecipientsSection)
+	}
+}
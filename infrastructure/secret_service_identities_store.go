@@ -0,0 +1,384 @@
+package infrastructure
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"filippo.io/age"
+	"github.com/godbus/dbus/v5"
+
+	"github.com/prskr/git-age/core/ports"
+)
+
+const (
+	secretServiceApplication = "git-age"
+
+	secretServiceBusName             = "org.freedesktop.secrets"
+	secretServiceInterface           = "org.freedesktop.Secret.Service"
+	secretServiceCollectionInterface = "org.freedesktop.Secret.Collection"
+	secretServicePromptInterface     = "org.freedesktop.Secret.Prompt"
+	secretServiceItemInterface       = "org.freedesktop.Secret.Item"
+
+	secretServicePath              dbus.ObjectPath = "/org/freedesktop/secrets"
+	secretServiceDefaultCollection dbus.ObjectPath = "/org/freedesktop/secrets/aliases/default"
+	secretServiceNoPrompt          dbus.ObjectPath = "/"
+)
+
+var (
+	ErrSecretServiceUnavailable     = errors.New("no Secret Service on the session bus")
+	ErrSecretServiceFailed          = errors.New("secret service request failed")
+	ErrSecretServicePromptDismissed = errors.New("secret service prompt was dismissed")
+)
+
+var (
+	_ ports.IdentitiesStore = (*SecretServiceIdentitiesStore)(nil)
+	_ IdentityStoreSource   = (*SecretServiceIdentitiesStoreSource)(nil)
+)
+
+// NewSecretServiceIdentitiesStoreSource creates a source for the secret-service:// keys spec.
+// The session bus is taken from DBUS_SESSION_BUS_ADDRESS, if it is not set the platform default is used.
+func NewSecretServiceIdentitiesStoreSource(env ports.OSEnv) *SecretServiceIdentitiesStoreSource {
+	return &SecretServiceIdentitiesStoreSource{
+		BusAddress: env.Get("DBUS_SESSION_BUS_ADDRESS"),
+	}
+}
+
+type SecretServiceIdentitiesStoreSource struct {
+	BusAddress string
+	// Label is appended to the name of the store
+	Label string
+}
+
+func (s *SecretServiceIdentitiesStoreSource) Name() string {
+	return storeName("secret-service", s.Label)
+}
+
+func (s *SecretServiceIdentitiesStoreSource) IsValid(ctx context.Context) (bool, error) {
+	conn, err := connectSessionBus(s.BusAddress)
+	if err != nil {
+		return false, err
+	}
+
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	var hasOwner bool
+	if err := conn.BusObject().CallWithContext(ctx, "org.freedesktop.DBus.NameHasOwner", 0, secretServiceBusName).Store(&hasOwner); err != nil {
+		return false, fmt.Errorf("%w: %w", ErrSecretServiceUnavailable, err)
+	}
+
+	if hasOwner {
+		return true, nil
+	}
+
+	// the Secret Service is usually started on demand
+	var activatable []string
+	if err := conn.BusObject().CallWithContext(ctx, "org.freedesktop.DBus.ListActivatableNames", 0).Store(&activatable); err != nil {
+		return false, fmt.Errorf("%w: %w", ErrSecretServiceUnavailable, err)
+	}
+
+	if !slices.Contains(activatable, secretServiceBusName) {
+		return false, ErrSecretServiceUnavailable
+	}
+
+	return true, nil
+}
+
+func (s *SecretServiceIdentitiesStoreSource) GetStore() (ports.IdentitiesStore, error) {
+	return &SecretServiceIdentitiesStore{BusAddress: s.BusAddress, Label: s.Label}, nil
+}
+
+// SecretServiceIdentitiesStore keeps identities in the freedesktop Secret Service (e.g. GNOME Keyring or KWallet)
+// by talking to org.freedesktop.secrets on the session bus.
+// Every identity is an item of the default collection with the attributes application=git-age,
+// scope=<normalized remote|default> and public_key=<public key>, the secret is the private key.
+type SecretServiceIdentitiesStore struct {
+	BusAddress string
+	Label      string
+}
+
+func (s *SecretServiceIdentitiesStore) Name() string {
+	return storeName("secret-service", s.Label)
+}
+
+func (s *SecretServiceIdentitiesStore) Generate(
+	ctx context.Context,
+	cmd ports.GenerateIdentityCommand,
+) (publicKey string, err error) {
+	newID, err := cmd.Algorithm.Generate()
+	if err != nil {
+		return "", err
+	}
+
+	storeCmd := ports.StoreIdentityCommand{
+		Identity: newID,
+		Comment:  cmd.Comment,
+		Remote:   cmd.Remote,
+	}
+
+	if err := s.Store(ctx, storeCmd); err != nil {
+		return "", err
+	}
+
+	return newID.Recipient().String(), nil
+}
+
+func (s *SecretServiceIdentitiesStore) Store(ctx context.Context, cmd ports.StoreIdentityCommand) error {
+	if cmd.Comment == "" {
+		cmd.Comment = "generated on " + time.Now().Format(time.RFC3339)
+	}
+
+	session, err := openSecretServiceSession(ctx, s.BusAddress)
+	if err != nil {
+		return err
+	}
+
+	defer session.Close()
+
+	if err := session.unlock(ctx, secretServiceDefaultCollection); err != nil {
+		return err
+	}
+
+	publicKey := cmd.Identity.Recipient().String()
+	properties := map[string]dbus.Variant{
+		secretServiceItemInterface + ".Label": dbus.MakeVariant(
+			fmt.Sprintf("git-age %s (%s)", publicKey, strings.Join(strings.Fields(cmd.Comment), " ")),
+		),
+		secretServiceItemInterface + ".Attributes": dbus.MakeVariant(map[string]string{
+			"application": secretServiceApplication,
+			"scope":       keyringScope(cmd.Remote),
+			"public_key":  publicKey,
+		}),
+	}
+
+	var item, prompt dbus.ObjectPath
+
+	slog.DebugContext(ctx, "Storing identity in secret service", slog.String("public_key", publicKey))
+
+	err = session.conn.Object(secretServiceBusName, secretServiceDefaultCollection).
+		CallWithContext(ctx, secretServiceCollectionInterface+".CreateItem", 0, properties, session.secret(cmd.Identity.String()), true).
+		Store(&item, &prompt)
+	if err != nil {
+		return fmt.Errorf("%w: create item: %w", ErrSecretServiceFailed, err)
+	}
+
+	return session.prompt(ctx, prompt)
+}
+
+// Identities returns the identities of all given remotes followed by the identities without remote.
+func (s *SecretServiceIdentitiesStore) Identities(ctx context.Context, query ports.IdentitiesQuery) (ids []age.Identity, err error) {
+	session, err := openSecretServiceSession(ctx, s.BusAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	defer session.Close()
+
+	seen := make(map[string]bool)
+	for _, remote := range append(query.Remotes, "") {
+		scope := keyringScope(remote)
+		if seen[scope] {
+			continue
+		}
+
+		seen[scope] = true
+
+		secrets, err := session.search(ctx, map[string]string{"application": secretServiceApplication, "scope": scope})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, secret := range secrets {
+			parsed, err := age.ParseIdentities(strings.NewReader(string(secret)))
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse identity from secret service: %w", err)
+			}
+
+			ids = append(ids, parsed...)
+		}
+	}
+
+	return ids, nil
+}
+
+// secretServiceSecret is the Secret struct (oayays) of the Secret Service API.
+type secretServiceSecret struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+// secretServiceSession is a connection to the session bus with an open Secret Service session.
+// Secrets are transferred without encryption, the session bus is private to the user anyway.
+type secretServiceSession struct {
+	conn    *dbus.Conn
+	service dbus.BusObject
+	path    dbus.ObjectPath
+}
+
+func connectSessionBus(address string) (*dbus.Conn, error) {
+	var (
+		conn *dbus.Conn
+		err  error
+	)
+
+	if address != "" {
+		conn, err = dbus.Connect(address)
+	} else {
+		conn, err = dbus.ConnectSessionBus()
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSecretServiceUnavailable, err)
+	}
+
+	return conn, nil
+}
+
+func openSecretServiceSession(ctx context.Context, address string) (*secretServiceSession, error) {
+	conn, err := connectSessionBus(address)
+	if err != nil {
+		return nil, err
+	}
+
+	session := &secretServiceSession{
+		conn:    conn,
+		service: conn.Object(secretServiceBusName, secretServicePath),
+	}
+
+	var output dbus.Variant
+	err = session.service.CallWithContext(ctx, secretServiceInterface+".OpenSession", 0, "plain", dbus.MakeVariant("")).
+		Store(&output, &session.path)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("%w: open session: %w", ErrSecretServiceFailed, err)
+	}
+
+	return session, nil
+}
+
+func (s *secretServiceSession) Close() {
+	if err := s.conn.Object(secretServiceBusName, s.path).Call("org.freedesktop.Secret.Session.Close", 0).Err; err != nil {
+		slog.Debug("Failed to close secret service session", slog.String("err", err.Error()))
+	}
+
+	_ = s.conn.Close()
+}
+
+func (s *secretServiceSession) secret(value string) secretServiceSecret {
+	return secretServiceSecret{
+		Session:     s.path,
+		Parameters:  []byte{},
+		Value:       []byte(value),
+		ContentType: "text/plain",
+	}
+}
+
+// search returns the secrets of all items matching the given attributes, locked items are unlocked first.
+func (s *secretServiceSession) search(ctx context.Context, attributes map[string]string) ([][]byte, error) {
+	var unlocked, locked []dbus.ObjectPath
+	if err := s.service.CallWithContext(ctx, secretServiceInterface+".SearchItems", 0, attributes).Store(&unlocked, &locked); err != nil {
+		return nil, fmt.Errorf("%w: search items: %w", ErrSecretServiceFailed, err)
+	}
+
+	if len(locked) > 0 {
+		if err := s.unlock(ctx, locked...); err != nil {
+			return nil, err
+		}
+	}
+
+	items := append(unlocked, locked...)
+	if len(items) == 0 {
+		return nil, nil
+	}
+
+	var secrets map[dbus.ObjectPath]secretServiceSecret
+	if err := s.service.CallWithContext(ctx, secretServiceInterface+".GetSecrets", 0, items, s.path).Store(&secrets); err != nil {
+		return nil, fmt.Errorf("%w: get secrets: %w", ErrSecretServiceFailed, err)
+	}
+
+	values := make([][]byte, 0, len(items))
+	for _, item := range items {
+		if secret, ok := secrets[item]; ok {
+			values = append(values, secret.Value)
+		}
+	}
+
+	return values, nil
+}
+
+func (s *secretServiceSession) unlock(ctx context.Context, objects ...dbus.ObjectPath) error {
+	var (
+		unlocked []dbus.ObjectPath
+		prompt   dbus.ObjectPath
+	)
+
+	if err := s.service.CallWithContext(ctx, secretServiceInterface+".Unlock", 0, objects).Store(&unlocked, &prompt); err != nil {
+		return fmt.Errorf("%w: unlock: %w", ErrSecretServiceFailed, err)
+	}
+
+	return s.prompt(ctx, prompt)
+}
+
+// prompt shows the given prompt, if any, and waits until the user completed or dismissed it.
+func (s *secretServiceSession) prompt(ctx context.Context, prompt dbus.ObjectPath) error {
+	if prompt == secretServiceNoPrompt || prompt == "" {
+		return nil
+	}
+
+	match := []dbus.MatchOption{
+		dbus.WithMatchObjectPath(prompt),
+		dbus.WithMatchInterface(secretServicePromptInterface),
+		dbus.WithMatchMember("Completed"),
+	}
+
+	if err := s.conn.AddMatchSignalContext(ctx, match...); err != nil {
+		return fmt.Errorf("%w: watch prompt: %w", ErrSecretServiceFailed, err)
+	}
+
+	signals := make(chan *dbus.Signal, 1)
+	s.conn.Signal(signals)
+
+	defer func() {
+		s.conn.RemoveSignal(signals)
+		_ = s.conn.RemoveMatchSignal(match...)
+	}()
+
+	err := s.conn.Object(secretServiceBusName, prompt).CallWithContext(ctx, secretServicePromptInterface+".Prompt", 0, "").Err
+	if err != nil {
+		return fmt.Errorf("%w: prompt: %w", ErrSecretServiceFailed, err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case signal := <-signals:
+			if signal.Path != prompt || signal.Name != secretServicePromptInterface+".Completed" {
+				continue
+			}
+
+			var (
+				dismissed bool
+				result    dbus.Variant
+			)
+
+			if err := dbus.Store(signal.Body, &dismissed, &result); err != nil {
+				return fmt.Errorf("%w: prompt: %w", ErrSecretServiceFailed, err)
+			}
+
+			if dismissed {
+				return ErrSecretServicePromptDismissed
+			}
+
+			return nil
+		}
+	}
+}
@@ -0,0 +1,397 @@
+package infrastructure_test
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+
+	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/infrastructure"
+	"github.com/prskr/git-age/internal/testx"
+)
+
+const privateBusConfig = `<!DOCTYPE busconfig PUBLIC "-//freedesktop//DTD D-Bus Bus Configuration 1.0//EN"
+ "http://www.freedesktop.org/standards/dbus/1.0/busconfig.dtd">
+<busconfig>
+  <type>session</type>
+  <listen>unix:tmpdir=%s</listen>
+  <auth>EXTERNAL</auth>
+  <policy context="default">
+    <allow send_destination="*" eavesdrop="true"/>
+    <allow eavesdrop="true"/>
+    <allow own="*"/>
+  </policy>
+</busconfig>
+`
+
+func TestSecretServiceIdentitiesStore(t *testing.T) {
+	t.Parallel()
+
+	busAddress := startPrivateBus(t)
+	src := &infrastructure.SecretServiceIdentitiesStoreSource{BusAddress: busAddress}
+
+	if isValid, err := src.IsValid(testx.Context(t)); isValid || !errors.Is(err, infrastructure.ErrSecretServiceUnavailable) {
+		t.Fatalf("IsValid() without service = %v, %v", isValid, err)
+	}
+
+	service := exportFakeSecretService(t, busAddress)
+
+	if isValid, err := src.IsValid(testx.Context(t)); err != nil || !isValid {
+		t.Fatalf("IsValid() = %v, %v", isValid, err)
+	}
+
+	store := testx.ResultOf(t, src.GetStore)
+
+	ids, err := store.Identities(testx.Context(t), ports.IdentitiesQuery{})
+	if err != nil || len(ids) != 0 {
+		t.Fatalf("Identities() of empty collection = %v, %v", ids, err)
+	}
+
+	pubKey, err := store.Generate(testx.Context(t), ports.GenerateIdentityCommand{
+		Remote:    "git@github.com:prskr/git-age.git",
+		Algorithm: ports.IdentityAlgorithmX25519,
+	})
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	if _, err := store.Generate(testx.Context(t), ports.GenerateIdentityCommand{Algorithm: ports.IdentityAlgorithmX25519}); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	if got := service.prompts(); got != 1 {
+		t.Errorf("expected the locked collection to be unlocked with a single prompt, got %d", got)
+	}
+
+	item := service.item(pubKey)
+	if item.attributes["application"] != "git-age" || item.attributes["scope"] != "github.com/prskr/git-age" {
+		t.Errorf("unexpected attributes %v", item.attributes)
+	}
+
+	if !strings.HasPrefix(item.label, "git-age "+pubKey) {
+		t.Errorf("unexpected label %q", item.label)
+	}
+
+	// lock the collection again so that items have to be unlocked before reading them
+	service.lock()
+
+	ids, err = store.Identities(testx.Context(t), ports.IdentitiesQuery{Remotes: []string{"https://github.com/prskr/git-age"}})
+	if err != nil {
+		t.Fatalf("Identities() error = %v", err)
+	}
+
+	if len(ids) != 2 {
+		t.Fatalf("expected 2 identities, got %d", len(ids))
+	}
+
+	if got, _ := ports.PublicKeyOf(ids[0]); got != pubKey {
+		t.Errorf("expected remote specific identity first, got %s", got)
+	}
+
+	ids, err = store.Identities(testx.Context(t), ports.IdentitiesQuery{Remotes: []string{"https://gitlab.com/other/repo"}})
+	if err != nil {
+		t.Fatalf("Identities() error = %v", err)
+	}
+
+	if len(ids) != 1 {
+		t.Errorf("expected only the default identity, got %d", len(ids))
+	}
+}
+
+func TestSecretServiceIdentitiesStore_PromptDismissed(t *testing.T) {
+	t.Parallel()
+
+	busAddress := startPrivateBus(t)
+	service := exportFakeSecretService(t, busAddress)
+	service.dismissPrompts()
+
+	store := infrastructure.SecretServiceIdentitiesStore{BusAddress: busAddress}
+
+	_, err := store.Generate(testx.Context(t), ports.GenerateIdentityCommand{Algorithm: ports.IdentityAlgorithmX25519})
+	if !errors.Is(err, infrastructure.ErrSecretServicePromptDismissed) {
+		t.Errorf("Generate() error = %v, want %v", err, infrastructure.ErrSecretServicePromptDismissed)
+	}
+}
+
+// startPrivateBus starts a dbus-daemon only used by the current test and returns its address.
+func startPrivateBus(tb testing.TB) string {
+	tb.Helper()
+
+	daemon, err := exec.LookPath("dbus-daemon")
+	if err != nil {
+		tb.Skip("dbus-daemon is not installed")
+	}
+
+	configPath := filepath.Join(tb.TempDir(), "session.conf")
+	if err := os.WriteFile(configPath, fmt.Appendf(nil, privateBusConfig, os.TempDir()), 0o600); err != nil {
+		tb.Fatalf("failed to write bus config: %v", err)
+	}
+
+	cmd := exec.Command(daemon, "--config-file="+configPath, "--nofork", "--print-address")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		tb.Fatalf("failed to get stdout of dbus-daemon: %v", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		tb.Fatalf("failed to start dbus-daemon: %v", err)
+	}
+
+	tb.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+
+	address, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		tb.Fatalf("failed to read address of dbus-daemon: %v", err)
+	}
+
+	return strings.TrimSpace(address)
+}
+
+const (
+	fakeSecretServicePath dbus.ObjectPath = "/org/freedesktop/secrets"
+	fakeCollectionPath    dbus.ObjectPath = "/org/freedesktop/secrets/aliases/default"
+	fakeSessionPath       dbus.ObjectPath = "/org/freedesktop/secrets/session/1"
+	fakePromptPath        dbus.ObjectPath = "/org/freedesktop/secrets/prompt/1"
+)
+
+type fakeSecretValue struct {
+	Session     dbus.ObjectPath
+	Parameters  []byte
+	Value       []byte
+	ContentType string
+}
+
+type fakeSecretItem struct {
+	label      string
+	attributes map[string]string
+	secret     []byte
+}
+
+// fakeSecretService implements the parts of org.freedesktop.secrets used by the store.
+// The default collection starts locked and is unlocked by a prompt.
+type fakeSecretService struct {
+	conn *dbus.Conn
+
+	mu          sync.Mutex
+	dismiss     bool
+	locked      bool
+	promptCount int
+	items       []fakeSecretItem
+}
+
+func exportFakeSecretService(tb testing.TB, busAddress string) *fakeSecretService {
+	tb.Helper()
+
+	conn, err := dbus.Connect(busAddress)
+	if err != nil {
+		tb.Fatalf("failed to connect to private bus: %v", err)
+	}
+
+	tb.Cleanup(func() {
+		_ = conn.Close()
+	})
+
+	service := &fakeSecretService{conn: conn, locked: true}
+
+	exports := []struct {
+		obj   any
+		path  dbus.ObjectPath
+		iface string
+	}{
+		{fakeServiceMethods{service}, fakeSecretServicePath, "org.freedesktop.Secret.Service"},
+		{fakeCollectionMethods{service}, fakeCollectionPath, "org.freedesktop.Secret.Collection"},
+		{fakeSessionMethods{}, fakeSessionPath, "org.freedesktop.Secret.Session"},
+		{fakePromptMethods{service}, fakePromptPath, "org.freedesktop.Secret.Prompt"},
+	}
+
+	for _, export := range exports {
+		if err := conn.Export(export.obj, export.path, export.iface); err != nil {
+			tb.Fatalf("failed to export %s: %v", export.iface, err)
+		}
+	}
+
+	reply, err := conn.RequestName("org.freedesktop.secrets", dbus.NameFlagDoNotQueue)
+	if err != nil || reply != dbus.RequestNameReplyPrimaryOwner {
+		tb.Fatalf("failed to own org.freedesktop.secrets: %v, %v", reply, err)
+	}
+
+	return service
+}
+
+func (f *fakeSecretService) lock() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.locked = true
+}
+
+func (f *fakeSecretService) dismissPrompts() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.dismiss = true
+}
+
+func (f *fakeSecretService) prompts() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.promptCount
+}
+
+func (f *fakeSecretService) item(publicKey string) fakeSecretItem {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, item := range f.items {
+		if item.attributes["public_key"] == publicKey {
+			return item
+		}
+	}
+
+	return fakeSecretItem{}
+}
+
+func itemPath(idx int) dbus.ObjectPath {
+	return dbus.ObjectPath(fmt.Sprintf("/org/freedesktop/secrets/collection/login/%d", idx))
+}
+
+type fakeServiceMethods struct {
+	*fakeSecretService
+}
+
+func (f fakeServiceMethods) OpenSession(algorithm string, _ dbus.Variant) (dbus.Variant, dbus.ObjectPath, *dbus.Error) {
+	if algorithm != "plain" {
+		return dbus.Variant{}, "", dbus.NewError("org.freedesktop.DBus.Error.NotSupported", []any{algorithm})
+	}
+
+	return dbus.MakeVariant(""), fakeSessionPath, nil
+}
+
+func (f fakeServiceMethods) SearchItems(attributes map[string]string) (unlocked, locked []dbus.ObjectPath, _ *dbus.Error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	unlocked, locked = []dbus.ObjectPath{}, []dbus.ObjectPath{}
+
+	for idx, item := range f.items {
+		matches := true
+		for key, value := range attributes {
+			matches = matches && item.attributes[key] == value
+		}
+
+		switch {
+		case !matches:
+		case f.locked:
+			locked = append(locked, itemPath(idx))
+		default:
+			unlocked = append(unlocked, itemPath(idx))
+		}
+	}
+
+	return unlocked, locked, nil
+}
+
+func (f fakeServiceMethods) Unlock(objects []dbus.ObjectPath) (unlocked []dbus.ObjectPath, prompt dbus.ObjectPath, _ *dbus.Error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.locked {
+		return []dbus.ObjectPath{}, fakePromptPath, nil
+	}
+
+	return objects, "/", nil
+}
+
+func (f fakeServiceMethods) GetSecrets(items []dbus.ObjectPath, session dbus.ObjectPath) (map[dbus.ObjectPath]fakeSecretValue, *dbus.Error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.locked {
+		return nil, dbus.NewError("org.freedesktop.Secret.Error.IsLocked", nil)
+	}
+
+	secrets := make(map[dbus.ObjectPath]fakeSecretValue, len(items))
+	for idx, item := range f.items {
+		path := itemPath(idx)
+		for _, requested := range items {
+			if requested == path {
+				secrets[path] = fakeSecretValue{Session: session, Parameters: []byte{}, Value: item.secret, ContentType: "text/plain"}
+			}
+		}
+	}
+
+	return secrets, nil
+}
+
+type fakeCollectionMethods struct {
+	*fakeSecretService
+}
+
+func (f fakeCollectionMethods) CreateItem(
+	properties map[string]dbus.Variant,
+	secret fakeSecretValue,
+	_ bool,
+) (item, prompt dbus.ObjectPath, _ *dbus.Error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.locked {
+		return "", "", dbus.NewError("org.freedesktop.Secret.Error.IsLocked", nil)
+	}
+
+	var (
+		label      string
+		attributes map[string]string
+	)
+
+	if err := properties["org.freedesktop.Secret.Item.Label"].Store(&label); err != nil {
+		return "", "", dbus.MakeFailedError(err)
+	}
+
+	if err := properties["org.freedesktop.Secret.Item.Attributes"].Store(&attributes); err != nil {
+		return "", "", dbus.MakeFailedError(err)
+	}
+
+	f.items = append(f.items, fakeSecretItem{label: label, attributes: maps.Clone(attributes), secret: secret.Value})
+
+	return itemPath(len(f.items) - 1), "/", nil
+}
+
+type fakeSessionMethods struct{}
+
+func (fakeSessionMethods) Close() *dbus.Error {
+	return nil
+}
+
+type fakePromptMethods struct {
+	*fakeSecretService
+}
+
+func (f fakePromptMethods) Prompt(string) *dbus.Error {
+	f.mu.Lock()
+	f.promptCount++
+	dismissed := f.dismiss
+	if !dismissed {
+		f.locked = false
+	}
+	f.mu.Unlock()
+
+	if err := f.conn.Emit(fakePromptPath, "org.freedesktop.Secret.Prompt.Completed", dismissed, dbus.MakeVariant([]dbus.ObjectPath{})); err != nil {
+		return dbus.MakeFailedError(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,209 @@
+package infrastructure
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+
+	"github.com/prskr/git-age/core/ports"
+)
+
+// RecipientsSignatureNamespace is the SSH signature namespace of the recipients file signature,
+// verify it manually with ssh-keygen -Y verify -n git-age.
+const RecipientsSignatureNamespace = "git-age"
+
+const trustedSignersFileName = "trusted-signers"
+
+var (
+	ErrSSHAgentUnavailable = errors.New("ssh-agent is not available")
+	ErrSSHKeyNotInAgent    = errors.New("ssh-agent does not hold the signing key")
+)
+
+// TrustedSigners is the list of maintainer keys whose signatures of the recipients file are accepted.
+// It is kept in the git directory in the authorized_keys format, hence it is never pushed or pulled.
+type TrustedSigners struct {
+	Path string
+}
+
+// NewTrustedSigners locates the trusted signers of the repository cwd is in.
+// The list is shared by all worktrees of a repository.
+func NewTrustedSigners(cwd ports.CWD) (*TrustedSigners, error) {
+	_, commonDir, err := gitDirs(cwd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate git directory: %w", err)
+	}
+
+	return &TrustedSigners{Path: filepath.Join(commonDir, "git-age", trustedSignersFileName)}, nil
+}
+
+// TrustedSigner is a single entry of the trusted signers.
+type TrustedSigner struct {
+	Key     ssh.PublicKey
+	Comment string
+}
+
+func (t TrustedSigners) All() ([]TrustedSigner, error) {
+	raw, err := os.ReadFile(t.Path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read trusted signers: %w", err)
+	}
+
+	var signers []TrustedSigner
+
+	scanner := bufio.NewScanner(bytes.NewReader(raw))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(line))
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", t.Path, lineNo, err)
+		}
+
+		signers = append(signers, TrustedSigner{Key: key, Comment: comment})
+	}
+
+	return signers, scanner.Err()
+}
+
+func (t TrustedSigners) IsTrusted(key ssh.PublicKey) (bool, error) {
+	signers, err := t.All()
+	if err != nil {
+		return false, err
+	}
+
+	return slices.ContainsFunc(signers, isSigner(key)), nil
+}
+
+// Add pins the given key, adding an already trusted key is a no-op.
+func (t TrustedSigners) Add(key ssh.PublicKey, comment string) (err error) {
+	if trusted, err := t.IsTrusted(key); err != nil || trusted {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(t.Path), 0o700); err != nil {
+		return fmt.Errorf("failed to create directory for trusted signers: %w", err)
+	}
+
+	f, err := os.OpenFile(t.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open trusted signers: %w", err)
+	}
+
+	defer func() {
+		err = errors.Join(err, f.Close())
+	}()
+
+	line := marshalAuthorizedKey(key)
+	if comment != "" {
+		line += " " + comment
+	}
+
+	_, err = f.WriteString(line + "\n")
+
+	return err
+}
+
+// Remove drops all entries with the given key.
+func (t TrustedSigners) Remove(key ssh.PublicKey) error {
+	signers, err := t.All()
+	if err != nil {
+		return err
+	}
+
+	var buf strings.Builder
+	for _, signer := range slices.DeleteFunc(signers, isSigner(key)) {
+		buf.WriteString(strings.TrimSpace(marshalAuthorizedKey(signer.Key) + " " + signer.Comment))
+		buf.WriteString("\n")
+	}
+
+	return os.WriteFile(t.Path, []byte(buf.String()), 0o600)
+}
+
+// LoadSSHSigner loads the key to sign the recipients file with.
+// keyPath is either an unencrypted private key or a public key (or passphrase protected private key)
+// whose private key is held by the ssh-agent listening on SSH_AUTH_SOCK.
+func LoadSSHSigner(keyPath string, env ports.OSEnv) (ssh.Signer, error) {
+	keyPath, err := expandHome(keyPath)
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+
+	signer, err := ssh.ParsePrivateKey(raw)
+	if err == nil {
+		return signer, nil
+	}
+
+	var pubKey ssh.PublicKey
+
+	if missingErr := new(ssh.PassphraseMissingError); errors.As(err, &missingErr) && missingErr.PublicKey != nil {
+		pubKey = missingErr.PublicKey
+	} else if pubKey, _, _, _, err = ssh.ParseAuthorizedKey(raw); err != nil {
+		return nil, fmt.Errorf("failed to parse signing key %s: %w", keyPath, err)
+	}
+
+	return sshAgentSigner(env, pubKey)
+}
+
+func sshAgentSigner(env ports.OSEnv, pubKey ssh.PublicKey) (ssh.Signer, error) {
+	socket := env.Get("SSH_AUTH_SOCK")
+	if socket == "" {
+		return nil, fmt.Errorf("%w: SSH_AUTH_SOCK is not set", ErrSSHAgentUnavailable)
+	}
+
+	// the connection has to stay open as long as the signer is used, it is closed when the process exits
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrSSHAgentUnavailable, err)
+	}
+
+	signers, err := agent.NewClient(conn).Signers()
+	if err != nil {
+		return nil, errors.Join(fmt.Errorf("%w: %w", ErrSSHAgentUnavailable, err), conn.Close())
+	}
+
+	for _, signer := range signers {
+		if bytes.Equal(signer.PublicKey().Marshal(), pubKey.Marshal()) {
+			return signer, nil
+		}
+	}
+
+	_ = conn.Close()
+
+	return nil, fmt.Errorf("%w: %s", ErrSSHKeyNotInAgent, SSHFingerprint(pubKey))
+}
+
+// expandHome replaces a leading ~/ with the home directory of the current user.
+func expandHome(filePath string) (string, error) {
+	rest, found := strings.CutPrefix(filePath, "~/")
+	if !found {
+		return filePath, nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(home, rest), nil
+}
@@ -0,0 +1,150 @@
+package infrastructure
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SSH signatures as described in https://github.com/openssh/openssh-portable/blob/master/PROTOCOL.sshsig
+// they can also be verified with ssh-keygen -Y verify.
+const (
+	sshSigPreamble = "SSHSIG"
+	sshSigVersion  = 1
+	sshSigPEMType  = "SSH SIGNATURE"
+	sshSigHash     = "sha512"
+)
+
+var ErrInvalidSSHSignature = errors.New("invalid SSH signature")
+
+type sshSigBlob struct {
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     []byte
+}
+
+type sshSigSignedData struct {
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Hash          []byte
+}
+
+// SignSSH creates an armored detached SSH signature of message in the given namespace.
+func SignSSH(signer ssh.Signer, namespace string, message []byte) ([]byte, error) {
+	signedData, err := sshSigDataToSign(namespace, sshSigHash, message)
+	if err != nil {
+		return nil, err
+	}
+
+	var sig *ssh.Signature
+	// RSA keys have to use SHA-2 signatures, ssh-rsa (SHA-1) signatures are rejected by ssh-keygen
+	if algSigner, ok := signer.(ssh.AlgorithmSigner); ok && signer.PublicKey().Type() == ssh.KeyAlgoRSA {
+		sig, err = algSigner.SignWithAlgorithm(rand.Reader, signedData, ssh.KeyAlgoRSASHA512)
+	} else {
+		sig, err = signer.Sign(rand.Reader, signedData)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign: %w", err)
+	}
+
+	blob := append([]byte(sshSigPreamble), ssh.Marshal(sshSigBlob{
+		Version:       sshSigVersion,
+		PublicKey:     signer.PublicKey().Marshal(),
+		Namespace:     namespace,
+		HashAlgorithm: sshSigHash,
+		Signature:     ssh.Marshal(sig),
+	})...)
+
+	return pem.EncodeToMemory(&pem.Block{Type: sshSigPEMType, Bytes: blob}), nil
+}
+
+// VerifySSH verifies an armored detached SSH signature of message in the given namespace
+// and returns the public key that created it.
+// The caller is responsible for checking whether the key is trusted.
+func VerifySSH(armored []byte, namespace string, message []byte) (ssh.PublicKey, error) {
+	block, _ := pem.Decode(armored)
+	if block == nil || block.Type != sshSigPEMType {
+		return nil, fmt.Errorf("%w: not an armored SSH signature", ErrInvalidSSHSignature)
+	}
+
+	raw, found := bytes.CutPrefix(block.Bytes, []byte(sshSigPreamble))
+	if !found {
+		return nil, fmt.Errorf("%w: missing preamble", ErrInvalidSSHSignature)
+	}
+
+	var blob sshSigBlob
+	if err := ssh.Unmarshal(raw, &blob); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSSHSignature, err)
+	}
+
+	switch {
+	case blob.Version != sshSigVersion:
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidSSHSignature, blob.Version)
+	case blob.Namespace != namespace:
+		return nil, fmt.Errorf("%w: namespace %q instead of %q", ErrInvalidSSHSignature, blob.Namespace, namespace)
+	}
+
+	pubKey, err := ssh.ParsePublicKey(blob.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSSHSignature, err)
+	}
+
+	sig := new(ssh.Signature)
+	if err := ssh.Unmarshal(blob.Signature, sig); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSSHSignature, err)
+	}
+
+	signedData, err := sshSigDataToSign(namespace, blob.HashAlgorithm, message)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := pubKey.Verify(signedData, sig); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSSHSignature, err)
+	}
+
+	return pubKey, nil
+}
+
+// SSHFingerprint formats the key like ssh-keygen -l does.
+func SSHFingerprint(key ssh.PublicKey) string {
+	return ssh.FingerprintSHA256(key)
+}
+
+func sshSigDataToSign(namespace, hashAlgorithm string, message []byte) ([]byte, error) {
+	var h hash.Hash
+	switch hashAlgorithm {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return nil, fmt.Errorf("%w: unsupported hash algorithm %s", ErrInvalidSSHSignature, hashAlgorithm)
+	}
+
+	_, _ = h.Write(message)
+
+	return append([]byte(sshSigPreamble), ssh.Marshal(sshSigSignedData{
+		Namespace:     namespace,
+		HashAlgorithm: hashAlgorithm,
+		Hash:          h.Sum(nil),
+	})...), nil
+}
+
+// marshalAuthorizedKey is the single line representation of key without trailing newline.
+func marshalAuthorizedKey(key ssh.PublicKey) string {
+	return key.Type() + " " + base64.StdEncoding.EncodeToString(key.Marshal())
+}
@@ -0,0 +1,169 @@
+package infrastructure_test
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+
+	"github.com/prskr/git-age/infrastructure"
+	"github.com/prskr/git-age/internal/testx"
+)
+
+func TestSignSSH_VerifySSH(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		key     func() (crypto.Signer, error)
+		message []byte
+		verify  []byte
+		ns      string
+		wantErr error
+	}{
+		{
+			name:    "Ed25519",
+			key:     newEd25519Key,
+			message: []byte("age1..."),
+			verify:  []byte("age1..."),
+			ns:      infrastructure.RecipientsSignatureNamespace,
+		},
+		{
+			name: "ECDSA",
+			key: func() (crypto.Signer, error) {
+				return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			},
+			message: []byte("age1..."),
+			verify:  []byte("age1..."),
+			ns:      infrastructure.RecipientsSignatureNamespace,
+		},
+		{
+			name: "RSA",
+			key: func() (crypto.Signer, error) {
+				return rsa.GenerateKey(rand.Reader, 2048)
+			},
+			message: []byte("age1..."),
+			verify:  []byte("age1..."),
+			ns:      infrastructure.RecipientsSignatureNamespace,
+		},
+		{
+			name:    "Tampered message",
+			key:     newEd25519Key,
+			message: []byte("age1..."),
+			verify:  []byte("age1...\nage1injected"),
+			ns:      infrastructure.RecipientsSignatureNamespace,
+			wantErr: infrastructure.ErrInvalidSSHSignature,
+		},
+		{
+			name:    "Other namespace",
+			key:     newEd25519Key,
+			message: []byte("age1..."),
+			verify:  []byte("age1..."),
+			ns:      "file",
+			wantErr: infrastructure.ErrInvalidSSHSignature,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			signer := testx.ResultOfA[ssh.Signer](t, ssh.NewSignerFromSigner, testx.ResultOf(t, tt.key))
+
+			sig, err := infrastructure.SignSSH(signer, tt.ns, tt.message)
+			if err != nil {
+				t.Fatalf("SignSSH() error = %v", err)
+			}
+
+			got, err := infrastructure.VerifySSH(sig, infrastructure.RecipientsSignatureNamespace, tt.verify)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("VerifySSH() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr == nil && !bytes.Equal(got.Marshal(), signer.PublicKey().Marshal()) {
+				t.Errorf("VerifySSH() = %s, want %s", infrastructure.SSHFingerprint(got), infrastructure.SSHFingerprint(signer.PublicKey()))
+			}
+		})
+	}
+}
+
+func TestSignSSH_SSHKeygenCompatibility(t *testing.T) {
+	t.Parallel()
+
+	sshKeygen, err := exec.LookPath("ssh-keygen")
+	if err != nil {
+		t.Skip("ssh-keygen is not installed")
+	}
+
+	var (
+		tmpDir  = t.TempDir()
+		message = []byte("age1qyqszqgpqyqszqgpqyqszqgpqyqszqgpqyqszqgpqyqszqgpqyqs3290gq\n")
+		key     = testx.ResultOf(t, newEd25519Key)
+		signer  = testx.ResultOfA[ssh.Signer](t, ssh.NewSignerFromSigner, key)
+		keyPath = filepath.Join(tmpDir, "id_ed25519")
+		allowed = filepath.Join(tmpDir, "allowed_signers")
+	)
+
+	block := testx.ResultOfA[*pem.Block](t, ssh.MarshalPrivateKey, key, "")
+	writeIfNotEmpty(t, keyPath, string(pem.EncodeToMemory(block)))
+	writeIfNotEmpty(t, allowed, "maintainer "+string(ssh.MarshalAuthorizedKey(signer.PublicKey())))
+
+	t.Run("ssh-keygen verifies git-age signature", func(t *testing.T) {
+		t.Parallel()
+
+		sig, err := infrastructure.SignSSH(signer, infrastructure.RecipientsSignatureNamespace, message)
+		if err != nil {
+			t.Fatalf("SignSSH() error = %v", err)
+		}
+
+		sigPath := filepath.Join(t.TempDir(), "message.sig")
+		writeIfNotEmpty(t, sigPath, string(sig))
+
+		//nolint:gosec // test binary and arguments are fixed
+		cmd := exec.CommandContext(
+			testx.Context(t), sshKeygen,
+			"-Y", "verify", "-f", allowed, "-I", "maintainer", "-n", infrastructure.RecipientsSignatureNamespace, "-s", sigPath,
+		)
+		cmd.Stdin = bytes.NewReader(message)
+
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Errorf("ssh-keygen -Y verify failed: %v: %s", err, out)
+		}
+	})
+
+	t.Run("git-age verifies ssh-keygen signature", func(t *testing.T) {
+		t.Parallel()
+
+		//nolint:gosec // test binary and arguments are fixed
+		cmd := exec.CommandContext(
+			testx.Context(t), sshKeygen,
+			"-Y", "sign", "-q", "-f", keyPath, "-n", infrastructure.RecipientsSignatureNamespace,
+		)
+		cmd.Stdin = bytes.NewReader(message)
+
+		sig, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("ssh-keygen -Y sign failed: %v", err)
+		}
+
+		if _, err := infrastructure.VerifySSH(sig, infrastructure.RecipientsSignatureNamespace, message); err != nil {
+			t.Errorf("VerifySSH() error = %v", err)
+		}
+	})
+}
+
+func newEd25519Key() (crypto.Signer, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+
+	return key, err
+}
@@ -0,0 +1,214 @@
+package infrastructure
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/prskr/git-age/core/ports"
+)
+
+var (
+	ErrReadOnlyStore         = errors.New("identities store is read-only")
+	ErrInvalidFileDescriptor = errors.New("invalid file descriptor")
+	ErrEncryptedSSHKey       = errors.New("passphrase protected SSH keys are not supported as identity")
+)
+
+var (
+	_ ports.IdentitiesStore = (*StaticIdentitiesStore)(nil)
+	_ IdentityStoreSource   = (*EnvIdentitiesStoreSource)(nil)
+	_ IdentityStoreSource   = (*FDIdentitiesStoreSource)(nil)
+	_ IdentityStoreSource   = (*SSHIdentitiesStoreSource)(nil)
+)
+
+func NewEnvIdentitiesStoreSource(env ports.OSEnv, variable string) *EnvIdentitiesStoreSource {
+	return &EnvIdentitiesStoreSource{
+		Env:      env,
+		Variable: variable,
+	}
+}
+
+// EnvIdentitiesStoreSource reads identities from an environment variable e.g. a CI secret.
+type EnvIdentitiesStoreSource struct {
+	Env      ports.OSEnv
+	Variable string
+	// Label replaces the variable name in the name of the store
+	Label string
+}
+
+func (e *EnvIdentitiesStoreSource) Name() string {
+	return storeName("env", cmp.Or(e.Label, e.Variable))
+}
+
+func (e *EnvIdentitiesStoreSource) IsValid(ctx context.Context) (bool, error) {
+	if e.Env.Get(e.Variable) == "" {
+		slog.DebugContext(ctx, "Skipping identities from environment because variable is empty", slog.String("variable", e.Variable))
+		return false, nil
+	}
+
+	return true, nil
+}
+
+func (e *EnvIdentitiesStoreSource) GetStore() (ports.IdentitiesStore, error) {
+	return &StaticIdentitiesStore{
+		StoreName: e.Name(),
+		Load: func() ([]byte, error) {
+			return []byte(e.Env.Get(e.Variable)), nil
+		},
+	}, nil
+}
+
+func NewFDIdentitiesStoreSource(fd uintptr) *FDIdentitiesStoreSource {
+	return &FDIdentitiesStoreSource{FD: fd}
+}
+
+// FDIdentitiesStoreSource reads identities from an inherited file descriptor.
+// The descriptor is read only once, subsequent lookups return the same identities.
+type FDIdentitiesStoreSource struct {
+	FD uintptr
+	// Label replaces the descriptor number in the name of the store
+	Label string
+}
+
+func (f *FDIdentitiesStoreSource) Name() string {
+	return storeName("fd", cmp.Or(f.Label, strconv.FormatUint(uint64(f.FD), 10)))
+}
+
+func (f *FDIdentitiesStoreSource) IsValid(context.Context) (bool, error) {
+	if err := validateFD(f.FD); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (f *FDIdentitiesStoreSource) GetStore() (ports.IdentitiesStore, error) {
+	return &StaticIdentitiesStore{
+		StoreName: f.Name(),
+		Load: sync.OnceValues(func() (raw []byte, err error) {
+			if err := validateFD(f.FD); err != nil {
+				return nil, err
+			}
+
+			file := os.NewFile(f.FD, "fd"+strconv.FormatUint(uint64(f.FD), 10))
+
+			defer func() {
+				err = errors.Join(err, file.Close())
+			}()
+
+			return io.ReadAll(file)
+		}),
+	}, nil
+}
+
+func NewSSHIdentitiesStoreSource(keyPath string) *SSHIdentitiesStoreSource {
+	return &SSHIdentitiesStoreSource{Path: keyPath}
+}
+
+// SSHIdentitiesStoreSource reads an unencrypted SSH private key,
+// e.g. the key whose public key was added as recipient with add-recipient --from-forge.
+type SSHIdentitiesStoreSource struct {
+	Path string
+	// Label replaces the key path in the name of the store
+	Label string
+}
+
+func (s *SSHIdentitiesStoreSource) Name() string {
+	return storeName("ssh", cmp.Or(s.Label, s.Path))
+}
+
+func (s *SSHIdentitiesStoreSource) IsValid(context.Context) (bool, error) {
+	return s.Path != "", nil
+}
+
+func (s *SSHIdentitiesStoreSource) GetStore() (ports.IdentitiesStore, error) {
+	keyPath, err := expandHome(s.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StaticIdentitiesStore{
+		StoreName: s.Name(),
+		Load: func() ([]byte, error) {
+			return os.ReadFile(keyPath)
+		},
+		Parse: parseSSHIdentity,
+	}, nil
+}
+
+// StaticIdentitiesStore is a read-only store for identities in the format of a keys file.
+type StaticIdentitiesStore struct {
+	StoreName string
+	Load      func() ([]byte, error)
+	// Parse overrides the keys file format e.g. for SSH keys
+	Parse func(raw []byte) ([]age.Identity, error)
+}
+
+func (s *StaticIdentitiesStore) Name() string {
+	return s.StoreName
+}
+
+func (s *StaticIdentitiesStore) Generate(context.Context, ports.GenerateIdentityCommand) (string, error) {
+	return "", fmt.Errorf("%w: %s", ErrReadOnlyStore, s.StoreName)
+}
+
+func (s *StaticIdentitiesStore) Store(context.Context, ports.StoreIdentityCommand) error {
+	return fmt.Errorf("%w: %s", ErrReadOnlyStore, s.StoreName)
+}
+
+func (s *StaticIdentitiesStore) Identities(context.Context, ports.IdentitiesQuery) ([]age.Identity, error) {
+	raw, err := s.Load()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load identities: %w", err)
+	}
+
+	if s.Parse != nil {
+		return s.Parse(raw)
+	}
+
+	return parseIdentities(bytes.NewReader(raw), time.Now())
+}
+
+func parseSSHIdentity(raw []byte) ([]age.Identity, error) {
+	id, err := agessh.ParseIdentity(raw)
+	if err != nil {
+		if missingErr := new(ssh.PassphraseMissingError); errors.As(err, &missingErr) {
+			return nil, ErrEncryptedSSHKey
+		}
+
+		return nil, fmt.Errorf("failed to parse SSH key: %w", err)
+	}
+
+	signer, err := ssh.ParsePrivateKey(raw)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse SSH key: %w", err)
+	}
+
+	return []age.Identity{&sshIdentity{Identity: id, publicKey: signer.PublicKey()}}, nil
+}
+
+var _ ports.PublicKeyHolder = (*sshIdentity)(nil)
+
+// sshIdentity remembers the public key of an SSH identity, age does not expose it.
+type sshIdentity struct {
+	age.Identity
+	publicKey ssh.PublicKey
+}
+
+// PublicKey returns the key in authorized_keys format without comment.
+func (s *sshIdentity) PublicKey() string {
+	return strings.TrimSpace(string(ssh.MarshalAuthorizedKey(s.publicKey)))
+}
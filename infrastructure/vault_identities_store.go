@@ -0,0 +1,427 @@
+package infrastructure
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"filippo.io/age"
+
+	"github.com/prskr/git-age/core/ports"
+)
+
+const (
+	vaultDefaultPath     = "git-age"
+	vaultDefaultSecret   = "default"
+	vaultIdentitiesField = "identities"
+)
+
+var (
+	ErrVaultAddressMissing = errors.New("VAULT_ADDR is not set")
+	ErrVaultAuthMissing    = errors.New("neither VAULT_TOKEN nor VAULT_ROLE_ID and VAULT_SECRET_ID are set")
+	ErrVaultRequestFailed  = errors.New("vault request failed")
+	ErrInvalidVaultRemote  = errors.New("remote cannot be mapped to a Vault secret")
+
+	errVaultNotFound  = errors.New("secret not found")
+	errVaultForbidden = errors.New("permission denied")
+)
+
+var (
+	_ ports.IdentitiesStore = (*VaultIdentitiesStore)(nil)
+	_ IdentityStoreSource   = (*VaultIdentitiesStoreSource)(nil)
+)
+
+// NewVaultIdentitiesStoreSource creates a source for a vault://mount/path keys spec.
+// The Vault address and credentials are read from the well known VAULT_* environment variables.
+func NewVaultIdentitiesStoreSource(env ports.OSEnv, spec *url.URL) *VaultIdentitiesStoreSource {
+	secretsPath := strings.Trim(spec.Path, "/")
+	if secretsPath == "" {
+		secretsPath = vaultDefaultPath
+	}
+
+	return &VaultIdentitiesStoreSource{
+		Address:     env.Get("VAULT_ADDR"),
+		Namespace:   env.Get("VAULT_NAMESPACE"),
+		Token:       env.Get("VAULT_TOKEN"),
+		RoleID:      env.Get("VAULT_ROLE_ID"),
+		SecretID:    env.Get("VAULT_SECRET_ID"),
+		AppRolePath: env.Get("VAULT_APPROLE_PATH"),
+		Mount:       spec.Host,
+		Path:        secretsPath,
+	}
+}
+
+type VaultIdentitiesStoreSource struct {
+	Address     string
+	Namespace   string
+	Token       string
+	RoleID      string
+	SecretID    string
+	AppRolePath string
+	Mount       string
+	Path        string
+	Client      *http.Client
+	// Label replaces mount and path in the name of the store
+	Label string
+}
+
+func (v *VaultIdentitiesStoreSource) Name() string {
+	return storeName("vault", cmp.Or(v.Label, v.Mount+"/"+v.Path))
+}
+
+func (v *VaultIdentitiesStoreSource) IsValid(context.Context) (bool, error) {
+	if v.Address == "" {
+		return false, ErrVaultAddressMissing
+	}
+
+	if v.Token == "" && (v.RoleID == "" || v.SecretID == "") {
+		return false, ErrVaultAuthMissing
+	}
+
+	return true, nil
+}
+
+func (v *VaultIdentitiesStoreSource) GetStore() (ports.IdentitiesStore, error) {
+	client := v.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	appRolePath := v.AppRolePath
+	if appRolePath == "" {
+		appRolePath = "approle"
+	}
+
+	return &VaultIdentitiesStore{
+		Address:     strings.TrimSuffix(v.Address, "/"),
+		Namespace:   v.Namespace,
+		Token:       v.Token,
+		RoleID:      v.RoleID,
+		SecretID:    v.SecretID,
+		AppRolePath: appRolePath,
+		Mount:       v.Mount,
+		Path:        v.Path,
+		Client:      client,
+		Label:       v.Label,
+	}, nil
+}
+
+// VaultIdentitiesStore keeps identities in a HashiCorp Vault KV v2 secrets engine.
+// Every remote is mapped to its own secret below Path e.g. git-age/github.com/prskr/git-age,
+// identities without remote are kept in the secret git-age/default.
+// The secrets contain the identities in the keys file format in the field identities.
+type VaultIdentitiesStore struct {
+	Address     string
+	Namespace   string
+	Token       string
+	RoleID      string
+	SecretID    string
+	AppRolePath string
+	Mount       string
+	Path        string
+	Client      *http.Client
+	Label       string
+
+	loginLock sync.Mutex
+	// loginToken is the token of the last AppRole login, it is only used if no Token is configured
+	loginToken string
+}
+
+func (v *VaultIdentitiesStore) Name() string {
+	return storeName("vault", cmp.Or(v.Label, v.Mount+"/"+v.Path))
+}
+
+func (v *VaultIdentitiesStore) Generate(
+	ctx context.Context,
+	cmd ports.GenerateIdentityCommand,
+) (publicKey string, err error) {
+	newID, err := cmd.Algorithm.Generate()
+	if err != nil {
+		return "", err
+	}
+
+	storeCmd := ports.StoreIdentityCommand{
+		Identity: newID,
+		Comment:  cmd.Comment,
+		Remote:   cmd.Remote,
+	}
+
+	if err := v.Store(ctx, storeCmd); err != nil {
+		return "", err
+	}
+
+	return newID.Recipient().String(), nil
+}
+
+func (v *VaultIdentitiesStore) Store(ctx context.Context, cmd ports.StoreIdentityCommand) error {
+	if cmd.Comment == "" {
+		cmd.Comment = "generated on " + time.Now().Format(time.RFC3339)
+	}
+
+	secretPath, err := v.secretPath(cmd.Remote)
+	if err != nil {
+		return err
+	}
+
+	current, version, err := v.readSecret(ctx, secretPath)
+	if err != nil {
+		return err
+	}
+
+	buf := bytes.NewBufferString(current)
+	if buf.Len() > 0 && !strings.HasSuffix(current, "\n") {
+		buf.WriteString("\n")
+	}
+
+	for line := range strings.Lines(cmd.Comment) {
+		_, _ = fmt.Fprintf(buf, "# %s\n", strings.TrimRight(line, "\r\n"))
+	}
+
+	_, _ = fmt.Fprintf(buf, "# public key: %s\n%s\n", cmd.Identity.Recipient().String(), cmd.Identity.String())
+
+	slog.DebugContext(ctx, "Writing identity to Vault", slog.String("path", secretPath))
+
+	// check-and-set prevents overwriting concurrent updates of the same secret
+	payload := map[string]any{
+		"options": map[string]any{"cas": version},
+		"data":    map[string]string{vaultIdentitiesField: buf.String()},
+	}
+
+	return v.do(ctx, http.MethodPost, v.dataURL(secretPath), payload, nil)
+}
+
+func (v *VaultIdentitiesStore) Identities(ctx context.Context, query ports.IdentitiesQuery) (ids []age.Identity, err error) {
+	secretPaths := make([]string, 0, len(query.Remotes)+1)
+	for _, remote := range append(query.Remotes, "") {
+		secretPath, err := v.secretPath(remote)
+		if err != nil {
+			return nil, err
+		}
+
+		// different notations of the same remote map to the same secret
+		if !slices.Contains(secretPaths, secretPath) {
+			secretPaths = append(secretPaths, secretPath)
+		}
+	}
+
+	now := time.Now()
+	for _, secretPath := range secretPaths {
+		raw, _, err := v.readSecret(ctx, secretPath)
+		if err != nil {
+			return nil, err
+		}
+
+		parsed, err := parseIdentities(strings.NewReader(raw), now)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse identities in %s: %w", secretPath, err)
+		}
+
+		ids = append(ids, parsed...)
+	}
+
+	return ids, nil
+}
+
+// readSecret returns the identities of the given secret and its current version.
+// A missing secret is returned as empty secret with version 0.
+func (v *VaultIdentitiesStore) readSecret(ctx context.Context, secretPath string) (identities string, version int, err error) {
+	var resp struct {
+		Data struct {
+			Data     map[string]string `json:"data"`
+			Metadata struct {
+				Version int `json:"version"`
+			} `json:"metadata"`
+		} `json:"data"`
+	}
+
+	if err := v.do(ctx, http.MethodGet, v.dataURL(secretPath), nil, &resp); err != nil {
+		if errors.Is(err, errVaultNotFound) {
+			return "", 0, nil
+		}
+
+		return "", 0, err
+	}
+
+	return resp.Data.Data[vaultIdentitiesField], resp.Data.Metadata.Version, nil
+}
+
+func (v *VaultIdentitiesStore) do(ctx context.Context, method, reqURL string, payload, target any) error {
+	token, err := v.token(ctx)
+	if err != nil {
+		return err
+	}
+
+	err = v.request(ctx, method, reqURL, token, payload, target)
+
+	// AppRole tokens expire after their TTL and Vault rejects expired tokens with 403, log in again and retry once
+	if errors.Is(err, errVaultForbidden) && v.expireLogin(token) {
+		if token, err = v.token(ctx); err != nil {
+			return err
+		}
+
+		return v.request(ctx, method, reqURL, token, payload, target)
+	}
+
+	return err
+}
+
+func (v *VaultIdentitiesStore) request(ctx context.Context, method, reqURL, token string, payload, target any) error {
+	var body io.Reader
+	if payload != nil {
+		encoded, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, reqURL, body)
+	if err != nil {
+		return err
+	}
+
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+
+	if v.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.Namespace)
+	}
+
+	resp, err := v.Client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return errVaultNotFound
+	case resp.StatusCode >= http.StatusBadRequest:
+		var errResp struct {
+			Errors []string `json:"errors"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&errResp)
+
+		reqErr := fmt.Errorf("%w: %s %s: %s: %s", ErrVaultRequestFailed, method, req.URL.Path, resp.Status, strings.Join(errResp.Errors, ", "))
+		if resp.StatusCode == http.StatusForbidden {
+			return errors.Join(errVaultForbidden, reqErr)
+		}
+
+		return reqErr
+	case target == nil || resp.StatusCode == http.StatusNoContent:
+		return nil
+	default:
+		return json.NewDecoder(resp.Body).Decode(target)
+	}
+}
+
+// token returns the configured token or the token of the last AppRole login, without one it logs in with AppRole.
+func (v *VaultIdentitiesStore) token(ctx context.Context) (string, error) {
+	v.loginLock.Lock()
+	defer v.loginLock.Unlock()
+
+	if v.Token != "" {
+		return v.Token, nil
+	}
+
+	if v.loginToken != "" {
+		return v.loginToken, nil
+	}
+
+	var resp struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+
+	payload := map[string]string{"role_id": v.RoleID, "secret_id": v.SecretID}
+	loginURL := v.Address + "/v1/" + path.Join("auth", v.AppRolePath, "login")
+
+	if err := v.request(ctx, http.MethodPost, loginURL, "", payload, &resp); err != nil {
+		return "", fmt.Errorf("failed to log in with AppRole: %w", err)
+	}
+
+	v.loginToken = resp.Auth.ClientToken
+
+	return v.loginToken, nil
+}
+
+// expireLogin drops the given AppRole token so that the next request logs in again.
+// It reports false for a configured token which cannot be replaced.
+func (v *VaultIdentitiesStore) expireLogin(token string) bool {
+	v.loginLock.Lock()
+	defer v.loginLock.Unlock()
+
+	if v.Token != "" {
+		return false
+	}
+
+	// a concurrent request might have logged in again already
+	if v.loginToken == token {
+		v.loginToken = ""
+	}
+
+	return true
+}
+
+func (v *VaultIdentitiesStore) dataURL(secretPath string) string {
+	return v.Address + "/v1/" + path.Join(v.Mount, "data", secretPath)
+}
+
+func (v *VaultIdentitiesStore) secretPath(remote string) (string, error) {
+	if remote == "" {
+		return path.Join(v.Path, vaultDefaultSecret), nil
+	}
+
+	host, repoPath := splitRemote(remote)
+
+	segments := strings.Split(strings.Trim(repoPath, "/"), "/")
+	if host != "" {
+		segments = append(strings.Split(host, "/"), segments...)
+	}
+
+	// path.Join resolves . and .. which could point outside of Path or to the secret of another remote
+	if slices.ContainsFunc(segments, func(segment string) bool { return segment == "" || segment == "." || segment == ".." }) {
+		return "", fmt.Errorf("%w: %s", ErrInvalidVaultRemote, remote)
+	}
+
+	return path.Join(v.Path, normalizeRemote(remote)), nil
+}
+
+// normalizeRemote maps the different notations of a Git remote to the same host/path form
+// e.g. git@github.com:prskr/git-age.git and https://github.com/prskr/git-age become github.com/prskr/git-age.
+func normalizeRemote(remote string) string {
+	host, repoPath := splitRemote(remote)
+
+	return strings.TrimSuffix(path.Join(strings.ToLower(host), repoPath), ".git")
+}
+
+// splitRemote returns host and path of a remote in URL or scp-like notation, local paths have no host.
+func splitRemote(remote string) (host, repoPath string) {
+	if parsed, err := url.Parse(remote); err == nil && parsed.Host != "" {
+		host, repoPath = parsed.Hostname(), parsed.Path
+	} else if before, after, found := strings.Cut(remote, ":"); found {
+		// scp-like syntax e.g. git@github.com:prskr/git-age.git
+		host, repoPath = before[strings.LastIndex(before, "@")+1:], after
+	} else {
+		repoPath = remote
+	}
+
+	return host, repoPath
+}
@@ -0,0 +1,300 @@
+package infrastructure_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/prskr/git-age/core/ports"
+	"github.com/prskr/git-age/infrastructure"
+	"github.com/prskr/git-age/internal/testx"
+)
+
+func TestVaultIdentitiesStore(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		env  ports.OSEnv
+	}{
+		{
+			name: "Token auth",
+			env:  ports.OSEnv{"VAULT_TOKEN": "s.root"},
+		},
+		{
+			name: "AppRole auth",
+			env:  ports.OSEnv{"VAULT_ROLE_ID": "git-age", "VAULT_SECRET_ID": "s3cr3t"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			vault := newFakeVault(t)
+			tt.env["VAULT_ADDR"] = vault.URL
+
+			src := infrastructure.NewVaultIdentitiesStoreSource(tt.env, &url.URL{Scheme: "vault", Host: "secret", Path: "/teams/dev"})
+			if isValid, err := src.IsValid(testx.Context(t)); err != nil || !isValid {
+				t.Fatalf("IsValid() = %v, %v", isValid, err)
+			}
+
+			store := testx.ResultOf(t, src.GetStore)
+
+			projectKey, err := store.Generate(testx.Context(t), ports.GenerateIdentityCommand{
+				Remote:    "git@github.com:prskr/git-age.git",
+				Algorithm: ports.IdentityAlgorithmX25519,
+			})
+			if err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+
+			if _, err := store.Generate(testx.Context(t), ports.GenerateIdentityCommand{Algorithm: ports.IdentityAlgorithmX25519}); err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+
+			if _, ok := vault.secret("secret/data/teams/dev/github.com/prskr/git-age"); !ok {
+				t.Errorf("expected identity to be stored per remote, got secrets %v", vault.paths())
+			}
+
+			ids, err := store.Identities(testx.Context(t), ports.IdentitiesQuery{
+				Remotes: []string{"https://github.com/prskr/git-age.git", "git@github.com:prskr/git-age.git"},
+			})
+			if err != nil {
+				t.Fatalf("Identities() error = %v", err)
+			}
+
+			if len(ids) != 2 {
+				t.Fatalf("expected 2 identities, got %d", len(ids))
+			}
+
+			if got, _ := ports.PublicKeyOf(ids[0]); got != projectKey {
+				t.Errorf("expected remote specific identity first, got %s", got)
+			}
+
+			ids, err = store.Identities(testx.Context(t), ports.IdentitiesQuery{Remotes: []string{"https://gitlab.com/other/repo.git"}})
+			if err != nil {
+				t.Fatalf("Identities() error = %v", err)
+			}
+
+			if len(ids) != 1 {
+				t.Errorf("expected only the default identity, got %d", len(ids))
+			}
+		})
+	}
+}
+
+func TestVaultIdentitiesStore_Unauthorized(t *testing.T) {
+	t.Parallel()
+
+	vault := newFakeVault(t)
+	env := ports.OSEnv{"VAULT_ADDR": vault.URL, "VAULT_TOKEN": "invalid"}
+
+	store := testx.ResultOf(t, infrastructure.NewVaultIdentitiesStoreSource(env, &url.URL{Scheme: "vault", Host: "secret"}).GetStore)
+
+	_, err := store.Identities(testx.Context(t), ports.IdentitiesQuery{})
+	if !errors.Is(err, infrastructure.ErrVaultRequestFailed) {
+		t.Errorf("Identities() error = %v, want %v", err, infrastructure.ErrVaultRequestFailed)
+	}
+}
+
+func TestVaultIdentitiesStore_AppRoleRelogin(t *testing.T) {
+	t.Parallel()
+
+	vault := newFakeVault(t)
+	env := ports.OSEnv{"VAULT_ADDR": vault.URL, "VAULT_ROLE_ID": "git-age", "VAULT_SECRET_ID": "s3cr3t"}
+
+	store := testx.ResultOf(t, infrastructure.NewVaultIdentitiesStoreSource(env, &url.URL{Scheme: "vault", Host: "secret"}).GetStore)
+
+	if _, err := store.Generate(testx.Context(t), ports.GenerateIdentityCommand{Algorithm: ports.IdentityAlgorithmX25519}); err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	// simulates the expiry of the token after its TTL
+	vault.revokeLogins()
+
+	ids, err := store.Identities(testx.Context(t), ports.IdentitiesQuery{})
+	if err != nil {
+		t.Fatalf("Identities() error = %v", err)
+	}
+
+	if len(ids) != 1 {
+		t.Errorf("expected 1 identity, got %d", len(ids))
+	}
+
+	if logins := vault.loginCount(); logins != 2 {
+		t.Errorf("expected 2 logins, got %d", logins)
+	}
+}
+
+func TestVaultIdentitiesStore_InvalidRemote(t *testing.T) {
+	t.Parallel()
+
+	tests := []string{
+		"https://github.com/prskr/../../other",
+		"../../other/repo.git",
+		"git@github.com:prskr//git-age.git",
+		"git@github.com:./git-age.git",
+		"https://github.com",
+	}
+
+	for _, remote := range tests {
+		t.Run(remote, func(t *testing.T) {
+			t.Parallel()
+
+			vault := newFakeVault(t)
+			env := ports.OSEnv{"VAULT_ADDR": vault.URL, "VAULT_TOKEN": "s.root"}
+
+			store := testx.ResultOf(t, infrastructure.NewVaultIdentitiesStoreSource(env, &url.URL{Scheme: "vault", Host: "secret"}).GetStore)
+
+			_, err := store.Generate(testx.Context(t), ports.GenerateIdentityCommand{Remote: remote, Algorithm: ports.IdentityAlgorithmX25519})
+			if !errors.Is(err, infrastructure.ErrInvalidVaultRemote) {
+				t.Errorf("Generate() error = %v, want %v", err, infrastructure.ErrInvalidVaultRemote)
+			}
+
+			_, err = store.Identities(testx.Context(t), ports.IdentitiesQuery{Remotes: []string{remote}})
+			if !errors.Is(err, infrastructure.ErrInvalidVaultRemote) {
+				t.Errorf("Identities() error = %v, want %v", err, infrastructure.ErrInvalidVaultRemote)
+			}
+
+			if paths := vault.paths(); len(paths) != 0 {
+				t.Errorf("expected no secrets to be written, got %v", paths)
+			}
+		})
+	}
+}
+
+type fakeVault struct {
+	*httptest.Server
+	lock    sync.Mutex
+	secrets map[string]fakeSecret
+	// logins are the tokens issued by AppRole logins, revoked tokens are false
+	logins map[string]bool
+}
+
+type fakeSecret struct {
+	Data     map[string]string `json:"data"`
+	Metadata struct {
+		Version int `json:"version"`
+	} `json:"metadata"`
+}
+
+// newFakeVault implements the KV v2 read and write endpoints as well as the AppRole login.
+// The root token s.root is always valid, every AppRole login issues a new token.
+func newFakeVault(tb testing.TB) *fakeVault {
+	tb.Helper()
+
+	const rootToken = "s.root"
+
+	vault := &fakeVault{secrets: make(map[string]fakeSecret), logins: make(map[string]bool)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/auth/approle/login", func(writer http.ResponseWriter, _ *http.Request) {
+		vault.lock.Lock()
+		token := fmt.Sprintf("s.approle-%d", len(vault.logins))
+		vault.logins[token] = true
+		vault.lock.Unlock()
+
+		_ = json.NewEncoder(writer).Encode(map[string]any{"auth": map[string]any{"client_token": token}})
+	})
+
+	mux.HandleFunc("/v1/", func(writer http.ResponseWriter, req *http.Request) {
+		secretPath := strings.TrimPrefix(req.URL.Path, "/v1/")
+
+		vault.lock.Lock()
+		defer vault.lock.Unlock()
+
+		if token := req.Header.Get("X-Vault-Token"); token != rootToken && !vault.logins[token] {
+			writer.WriteHeader(http.StatusForbidden)
+			_ = json.NewEncoder(writer).Encode(map[string]any{"errors": []string{"permission denied"}})
+			return
+		}
+
+		current, exists := vault.secrets[secretPath]
+
+		switch req.Method {
+		case http.MethodGet:
+			if !exists {
+				writer.WriteHeader(http.StatusNotFound)
+				_ = json.NewEncoder(writer).Encode(map[string]any{"errors": []string{}})
+				return
+			}
+
+			_ = json.NewEncoder(writer).Encode(map[string]any{"data": current})
+		case http.MethodPost:
+			var payload struct {
+				Options struct {
+					CAS int `json:"cas"`
+				} `json:"options"`
+				Data map[string]string `json:"data"`
+			}
+
+			if err := json.NewDecoder(req.Body).Decode(&payload); err != nil {
+				writer.WriteHeader(http.StatusBadRequest)
+				return
+			}
+
+			if payload.Options.CAS != current.Metadata.Version {
+				writer.WriteHeader(http.StatusBadRequest)
+				_ = json.NewEncoder(writer).Encode(map[string]any{"errors": []string{"check-and-set parameter did not match"}})
+				return
+			}
+
+			current.Data = payload.Data
+			current.Metadata.Version++
+			vault.secrets[secretPath] = current
+
+			writer.WriteHeader(http.StatusNoContent)
+		default:
+			writer.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+
+	vault.Server = httptest.NewServer(mux)
+	tb.Cleanup(vault.Close)
+
+	return vault
+}
+
+func (f *fakeVault) secret(secretPath string) (fakeSecret, bool) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	secret, ok := f.secrets[secretPath]
+
+	return secret, ok
+}
+
+func (f *fakeVault) revokeLogins() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	for token := range f.logins {
+		f.logins[token] = false
+	}
+}
+
+func (f *fakeVault) loginCount() int {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	return len(f.logins)
+}
+
+func (f *fakeVault) paths() []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	paths := make([]string, 0, len(f.secrets))
+	for secretPath := range f.secrets {
+		paths = append(paths, secretPath)
+	}
+
+	return paths
+}